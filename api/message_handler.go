@@ -1,8 +1,42 @@
 package api
 
-import "github.com/mshaverdo/radish/message"
+import (
+	"github.com/mshaverdo/radish/message"
+	"github.com/mshaverdo/radish/pubsub"
+	"io"
+)
 
 // MessageHandler processes a Request message and return a response message
 type MessageHandler interface {
 	HandleMessage(request *message.Request) message.Response
 }
+
+// TransactionHandler processes queued Request messages atomically, like MULTI/EXEC transaction
+type TransactionHandler interface {
+	// Watch returns versions of the keys to check them when the transaction is executed
+	Watch(keys []string) (versions []uint64)
+
+	// HandleTransaction processes requests atomically, if watched keys are not modified since Watch().
+	// Returns message.ResponseSlice with responses to every request, or StatusNotFound response if transaction is aborted
+	HandleTransaction(requests []*message.Request, watched map[string]uint64) message.Response
+}
+
+// PubSubHandler provides subscriptions to messages, published by PUBLISH command
+type PubSubHandler interface {
+	// NewSubscriber returns subscriber without subscriptions. It should be closed, when it isn't needed anymore
+	NewSubscriber() *pubsub.Subscriber
+}
+
+// ReplicationHandler streams modifications of the storage to replicas
+type ReplicationHandler interface {
+	// Replicate writes the replication stream for the replica, which has applied records up to lastMessageId,
+	// until writing fails or the handler shuts down. If the stream can't be started, the error is written into the stream
+	Replicate(w io.Writer, lastMessageId int64) error
+}
+
+// ClusterHandler processes requests, redirected by ASK from a node of the cluster, which is migrating a slot
+type ClusterHandler interface {
+	// HandleAskingMessage processes the request like HandleMessage(), but serves keys of the slot,
+	// which is importing from another node, instead of MOVED redirect to the owner of the slot
+	HandleAskingMessage(request *message.Request) message.Response
+}
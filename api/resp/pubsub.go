@@ -0,0 +1,219 @@
+package resp
+
+import (
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/pubsub"
+	"github.com/tidwall/redcon"
+	"strings"
+	"sync"
+)
+
+// subscription is a connection in the subscribed mode: it receives messages, pushed by the server,
+// and accepts only SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE, PUNSUBSCRIBE, PING and QUIT commands
+type subscription struct {
+	conn       redcon.DetachedConn
+	subscriber *pubsub.Subscriber
+
+	// writeMutex serializes replies to commands and pushed messages
+	writeMutex sync.Mutex
+}
+
+// isSubscribeCommand returns true, if the command switches the connection into the subscribed mode.
+// Inside MULTI the command is queued as usual
+func (s *Server) isSubscribeCommand(conn redcon.Conn, command redcon.Command) bool {
+	if s.pubSubHandler == nil || len(command.Args) == 0 {
+		return false
+	}
+
+	if tx, _ := conn.Context().(*session); tx != nil && tx.isStarted {
+		return false
+	}
+
+	cmd := strings.ToUpper(string(command.Args[0]))
+	return cmd == "SUBSCRIBE" || cmd == "PSUBSCRIBE"
+}
+
+// serveSubscription serves the connection, detached from redcon server, until it's closed.
+// Commands are processed one by one, while received messages are pushed to the client by a separate goroutine.
+// When all the subscriptions are cancelled, the connection processes any command as usual
+func (s *Server) serveSubscription(conn redcon.DetachedConn, commands []redcon.Command) {
+	sub := &subscription{conn: conn, subscriber: s.pubSubHandler.NewSubscriber()}
+	if !s.addSubscription(sub) {
+		sub.close()
+		return
+	}
+	defer s.removeSubscription(sub)
+
+	go sub.push()
+
+	for {
+		for _, command := range commands {
+			if !s.processSubscriptionRequest(sub, command) {
+				return
+			}
+		}
+
+		if err := sub.flush(); err != nil {
+			return
+		}
+
+		command, err := conn.ReadCommand()
+		if err != nil {
+			return
+		}
+		commands = []redcon.Command{command}
+	}
+}
+
+// processSubscriptionRequest processes command of the connection in the subscribed mode.
+// Returns false, if the connection should be closed
+func (s *Server) processSubscriptionRequest(sub *subscription, command redcon.Command) bool {
+	if len(command.Args) == 0 {
+		return true
+	}
+
+	cmd := strings.ToUpper(string(command.Args[0]))
+	names := make([]string, len(command.Args)-1)
+	for i, v := range command.Args[1:] {
+		names[i] = string(v)
+	}
+
+	sub.writeMutex.Lock()
+	defer sub.writeMutex.Unlock()
+
+	subscriber := sub.subscriber
+	switch {
+	case (cmd == "SUBSCRIBE" || cmd == "PSUBSCRIBE") && len(names) == 0:
+		sub.conn.WriteError("ERR wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+	case cmd == "SUBSCRIBE":
+		sub.writeReplies("subscribe", names, subscriber.Subscribe(names))
+	case cmd == "PSUBSCRIBE":
+		sub.writeReplies("psubscribe", names, subscriber.PSubscribe(names))
+	case cmd == "UNSUBSCRIBE":
+		unsubscribed, counts := subscriber.Unsubscribe(names)
+		sub.writeReplies("unsubscribe", unsubscribed, counts)
+	case cmd == "PUNSUBSCRIBE":
+		unsubscribed, counts := subscriber.PUnsubscribe(names)
+		sub.writeReplies("punsubscribe", unsubscribed, counts)
+	case subscriber.Count() == 0:
+		// the connection without subscriptions works as usual
+		s.processRequest(sub.conn, command, false)
+	case cmd == "PING":
+		pong := ""
+		if len(names) > 0 {
+			pong = names[0]
+		}
+		sub.conn.WriteArray(2)
+		sub.conn.WriteBulkString("pong")
+		sub.conn.WriteBulkString(pong)
+	case cmd == "QUIT":
+		sub.conn.WriteString("OK")
+		return false
+	default:
+		sub.conn.WriteError(
+			"ERR Can't execute '" + strings.ToLower(cmd) +
+				"': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context",
+		)
+	}
+
+	return true
+}
+
+// writeReplies writes reply to (un)subscribe command for every channel or pattern.
+// Unsubscribing without any subscriptions is replied with nil channel
+func (sub *subscription) writeReplies(kind string, names []string, counts []int) {
+	if len(names) == 0 {
+		sub.conn.WriteArray(3)
+		sub.conn.WriteBulkString(kind)
+		sub.conn.WriteNull()
+		sub.conn.WriteInt(sub.subscriber.Count())
+		return
+	}
+
+	for i, name := range names {
+		sub.conn.WriteArray(3)
+		sub.conn.WriteBulkString(kind)
+		sub.conn.WriteBulkString(name)
+		sub.conn.WriteInt(counts[i])
+	}
+}
+
+// push writes received messages to the client, until the subscriber is closed.
+// The subscriber is closed by the broker, if the client can't keep up, so the connection is closed too
+func (sub *subscription) push() {
+	for message := range sub.subscriber.Messages() {
+		sub.writeMutex.Lock()
+		if message.Pattern == "" {
+			sub.conn.WriteArray(3)
+			sub.conn.WriteBulkString("message")
+		} else {
+			sub.conn.WriteArray(4)
+			sub.conn.WriteBulkString("pmessage")
+			sub.conn.WriteBulkString(message.Pattern)
+		}
+		sub.conn.WriteBulkString(message.Channel)
+		sub.conn.WriteBulk(message.Payload)
+		err := sub.conn.Flush()
+		sub.writeMutex.Unlock()
+
+		if err != nil {
+			log.Debugf("Pushing message failed: %s", err)
+			break
+		}
+	}
+
+	sub.closeConn()
+}
+
+func (sub *subscription) flush() error {
+	sub.writeMutex.Lock()
+	defer sub.writeMutex.Unlock()
+
+	return sub.conn.Flush()
+}
+
+// close closes the subscriber and the connection. It should be called by the goroutine, serving the connection
+func (sub *subscription) close() {
+	sub.subscriber.Close()
+	sub.closeConn()
+}
+
+// closeConn closes the connection, so the goroutine, serving the connection, stops reading commands and closes the subscriber
+func (sub *subscription) closeConn() {
+	sub.writeMutex.Lock()
+	defer sub.writeMutex.Unlock()
+
+	sub.conn.Close()
+}
+
+// addSubscription registers the subscription to close it at server stop. Returns false, if the server is already stopped
+func (s *Server) addSubscription(sub *subscription) bool {
+	s.subscriptionsMutex.Lock()
+	defer s.subscriptionsMutex.Unlock()
+
+	if s.subscriptions == nil {
+		return false
+	}
+
+	s.subscriptions[sub] = struct{}{}
+	return true
+}
+
+func (s *Server) removeSubscription(sub *subscription) {
+	s.subscriptionsMutex.Lock()
+	delete(s.subscriptions, sub)
+	s.subscriptionsMutex.Unlock()
+
+	sub.close()
+}
+
+// closeSubscriptions closes all the connections in the subscribed mode and prevents new ones
+func (s *Server) closeSubscriptions() {
+	s.subscriptionsMutex.Lock()
+	defer s.subscriptionsMutex.Unlock()
+
+	for sub := range s.subscriptions {
+		sub.closeConn()
+	}
+	s.subscriptions = nil
+}
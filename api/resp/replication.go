@@ -0,0 +1,58 @@
+package resp
+
+import (
+	"github.com/mshaverdo/radish/log"
+	"github.com/tidwall/redcon"
+	"strconv"
+	"strings"
+)
+
+// isPSyncCommand returns true, if the command starts the replication stream. Inside MULTI the command is queued as usual
+func (s *Server) isPSyncCommand(conn redcon.Conn, command redcon.Command) bool {
+	if s.replicationHandler == nil || len(command.Args) == 0 {
+		return false
+	}
+
+	if tx, _ := conn.Context().(*session); tx != nil && tx.isStarted {
+		return false
+	}
+
+	return strings.ToUpper(string(command.Args[0])) == "PSYNC"
+}
+
+// serveReplica streams replication records of PSYNC last-message-id command to the replica
+// over the connection, detached from redcon server, until the stream is finished
+func (s *Server) serveReplica(conn redcon.DetachedConn, command redcon.Command) {
+	defer conn.Close()
+
+	if len(command.Args) != 2 {
+		conn.WriteError("ERR wrong number of arguments for 'psync' command")
+		conn.Flush()
+		return
+	}
+
+	lastMessageId, err := strconv.ParseInt(string(command.Args[1]), 10, 64)
+	if err != nil {
+		conn.WriteError("ERR value is not an integer or out of range")
+		conn.Flush()
+		return
+	}
+
+	log.Infof("Replica %s connected", conn.RemoteAddr())
+	err = s.replicationHandler.Replicate(detachedWriter{conn}, lastMessageId)
+	log.Infof("Replica %s disconnected: %v", conn.RemoteAddr(), err)
+}
+
+// detachedWriter writes raw data into the detached connection
+type detachedWriter struct {
+	conn redcon.DetachedConn
+}
+
+func (w detachedWriter) Write(p []byte) (n int, err error) {
+	w.conn.WriteRaw(p)
+	if err := w.conn.Flush(); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
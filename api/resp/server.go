@@ -6,7 +6,9 @@ import (
 	"github.com/mshaverdo/radish/log"
 	"github.com/mshaverdo/radish/message"
 	"github.com/tidwall/redcon"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 type Server struct {
@@ -14,17 +16,45 @@ type Server struct {
 	port           int
 	server         *redcon.Server
 	messageHandler api.MessageHandler
+	txHandler      api.TransactionHandler
+	pubSubHandler  api.PubSubHandler
 	stopChan       chan struct{}
+
+	replicationHandler api.ReplicationHandler
+	clusterHandler     api.ClusterHandler
+
+	// subscriptions contains connections in the subscribed mode, detached from redcon server
+	subscriptionsMutex sync.Mutex
+	subscriptions      map[*subscription]struct{}
+}
+
+// session is a state of the connection, stored in the connection context: MULTI/EXEC transaction and ASKING flag
+type session struct {
+	isStarted bool
+	queue     []*message.Request
+	watched   map[string]uint64
+
+	// asking is set by ASKING command, to process the next command by api.ClusterHandler.HandleAskingMessage()
+	asking bool
 }
 
-// NewServer Returns new instance of Server
+// NewServer Returns new instance of Server.
+// MULTI/EXEC transactions are supported, if messageHandler implements api.TransactionHandler,
+// SUBSCRIBE/PSUBSCRIBE are supported, if messageHandler implements api.PubSubHandler,
+// PSYNC replication stream is supported, if messageHandler implements api.ReplicationHandler,
+// and ASKING is supported, if messageHandler implements api.ClusterHandler
 func NewServer(host string, port int, messageHandler api.MessageHandler) *Server {
 	s := Server{
 		messageHandler: messageHandler,
 		stopChan:       make(chan struct{}),
 		host:           host,
 		port:           port,
+		subscriptions:  make(map[*subscription]struct{}),
 	}
+	s.txHandler, _ = messageHandler.(api.TransactionHandler)
+	s.pubSubHandler, _ = messageHandler.(api.PubSubHandler)
+	s.replicationHandler, _ = messageHandler.(api.ReplicationHandler)
+	s.clusterHandler, _ = messageHandler.(api.ClusterHandler)
 
 	s.server = redcon.NewServerNetwork(
 		"tcp",
@@ -51,6 +81,7 @@ func (s *Server) ListenAndServe() error {
 
 // Stops accepting new requests by Resp server, but not causes return from ListenAndServe() until Shutdown()
 func (s *Server) Stop() error {
+	s.closeSubscriptions()
 	return s.server.Close()
 }
 
@@ -64,8 +95,19 @@ func (s *Server) handler(conn redcon.Conn, command redcon.Command) {
 	pipelineCommands := conn.ReadPipeline()
 	unreliable := len(pipelineCommands) > 0
 
-	s.processRequest(conn, command, unreliable)
-	for _, c := range pipelineCommands {
+	commands := append([]redcon.Command{command}, pipelineCommands...)
+	for i, c := range commands {
+		if s.isSubscribeCommand(conn, c) {
+			// the connection switches into the subscribed mode, so it's served by its own goroutine from now on
+			go s.serveSubscription(conn.Detach(), commands[i:])
+			return
+		}
+		if s.isPSyncCommand(conn, c) {
+			// the connection is used by the replication stream only
+			go s.serveReplica(conn.Detach(), c)
+			return
+		}
+
 		s.processRequest(conn, c, unreliable)
 	}
 }
@@ -94,6 +136,14 @@ func (s *Server) processRequest(conn redcon.Conn, command redcon.Command, unreli
 	request := message.NewRequest(cmd, command.Args[1:])
 	request.Unreliable = unreliable
 
+	if s.processTransactionRequest(conn, request) {
+		return
+	}
+
+	if s.processAskingRequest(conn, request) {
+		return
+	}
+
 	//log.Debugf("Handling request: %s", request)
 
 	response := s.messageHandler.HandleMessage(request)
@@ -106,28 +156,182 @@ func (s *Server) processRequest(conn redcon.Conn, command redcon.Command, unreli
 	}
 }
 
+// processTransactionRequest handles MULTI, EXEC, DISCARD, WATCH and UNWATCH commands and queues requests,
+// received after MULTI. Returns false, if request should be processed as usual
+func (s *Server) processTransactionRequest(conn redcon.Conn, request *message.Request) (isProcessed bool) {
+	tx, _ := conn.Context().(*session)
+	isStarted := tx != nil && tx.isStarted
+
+	switch {
+	case !isTransactionCmd(request.Cmd) && !isStarted:
+		return false
+	case s.txHandler == nil:
+		conn.WriteError("ERR transactions are not supported")
+		return true
+	case tx == nil:
+		tx = &session{}
+		conn.SetContext(tx)
+	}
+
+	switch request.Cmd {
+	case "MULTI":
+		if isStarted {
+			conn.WriteError("ERR MULTI calls can not be nested")
+			return true
+		}
+		tx.isStarted = true
+		conn.WriteString("OK")
+	case "EXEC":
+		if !isStarted {
+			conn.WriteError("ERR EXEC without MULTI")
+			return true
+		}
+		response := s.txHandler.HandleTransaction(tx.queue, tx.watched)
+		conn.SetContext(nil)
+		if err := sendResponse(response, conn); err != nil {
+			log.Errorf("Sending response failed: %s", err)
+		}
+	case "DISCARD":
+		if !isStarted {
+			conn.WriteError("ERR DISCARD without MULTI")
+			return true
+		}
+		conn.SetContext(nil)
+		conn.WriteString("OK")
+	case "WATCH":
+		if isStarted {
+			conn.WriteError("ERR WATCH inside MULTI is not allowed")
+			return true
+		}
+		if request.ArgumentsLen() == 0 {
+			conn.WriteError("ERR wrong number of arguments for 'watch' command")
+			return true
+		}
+		keys, _ := request.GetArgumentVariadicString(0)
+		if tx.watched == nil {
+			tx.watched = make(map[string]uint64, len(keys))
+		}
+		for i, version := range s.txHandler.Watch(keys) {
+			// the key watched several times keeps the first version to detect modifications since the first WATCH
+			if _, ok := tx.watched[keys[i]]; !ok {
+				tx.watched[keys[i]] = version
+			}
+		}
+		conn.WriteString("OK")
+	case "UNWATCH":
+		if isStarted {
+			conn.WriteError("ERR UNWATCH inside MULTI is not allowed")
+			return true
+		}
+		tx.watched = nil
+		conn.WriteString("OK")
+	default:
+		tx.queue = append(tx.queue, request)
+		conn.WriteString("QUEUED")
+	}
+
+	return true
+}
+
+// processAskingRequest handles ASKING command and the command following it, which is processed
+// by api.ClusterHandler, even if its keys belong to a slot importing from another node.
+// Returns false, if request should be processed as usual
+func (s *Server) processAskingRequest(conn redcon.Conn, request *message.Request) (isProcessed bool) {
+	sess, _ := conn.Context().(*session)
+
+	switch {
+	case request.Cmd == "ASKING" && s.clusterHandler == nil:
+		conn.WriteError("ERR This instance has cluster support disabled")
+	case request.Cmd == "ASKING":
+		if sess == nil {
+			sess = &session{}
+			conn.SetContext(sess)
+		}
+		sess.asking = true
+		conn.WriteString("OK")
+	case sess != nil && sess.asking:
+		// ASKING flag is valid for the next command only
+		sess.asking = false
+		if err := sendResponse(s.clusterHandler.HandleAskingMessage(request), conn); err != nil {
+			log.Errorf("Sending response failed: %s", err)
+		}
+	default:
+		return false
+	}
+
+	return true
+}
+
+// isTransactionCmd returns true for commands, which control MULTI/EXEC transaction
+func isTransactionCmd(cmd string) bool {
+	switch cmd {
+	case "MULTI", "EXEC", "DISCARD", "WATCH", "UNWATCH":
+		return true
+	default:
+		return false
+	}
+}
+
 func sendResponse(response message.Response, conn redcon.Conn) error {
 	switch concreteResponse := response.(type) {
 	case *message.ResponseStatus:
 		switch concreteResponse.Status() {
 		case message.StatusOk:
-			conn.WriteString("OK")
+			// custom status could be replied by a script
+			if concreteResponse.Payload() != "" {
+				conn.WriteString(concreteResponse.Payload())
+			} else {
+				conn.WriteString("OK")
+			}
 		case message.StatusNotFound:
 			conn.WriteNull()
 		case message.StatusTypeMismatch:
 			conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		case message.StatusScriptError:
+			conn.WriteError(concreteResponse.Payload())
+		case message.StatusReadOnly:
+			conn.WriteError("READONLY " + concreteResponse.Payload())
+		case message.StatusRedirect, message.StatusClusterError:
+			conn.WriteError(concreteResponse.Payload())
+		case message.StatusOutOfMemory:
+			conn.WriteError("OOM " + concreteResponse.Payload())
 		default:
 			conn.WriteError("ERR " + concreteResponse.Payload())
 		}
 	case *message.ResponseString:
 		conn.WriteBulk(concreteResponse.Payload())
 	case *message.ResponseStringSlice:
+		conn.WriteArray(len(concreteResponse.Payload()))
+		for _, v := range concreteResponse.Payload() {
+			// nil elements are missing values, e.g. MGET on not existing key
+			if v == nil {
+				conn.WriteNull()
+			} else {
+				conn.WriteBulk(v)
+			}
+		}
+	case *message.ResponseCursor:
+		// SCAN-like reply is two elements array: cursor and array of elements
+		conn.WriteArray(2)
+		conn.WriteBulkString(strconv.Itoa(concreteResponse.Cursor()))
 		conn.WriteArray(len(concreteResponse.Payload()))
 		for _, v := range concreteResponse.Payload() {
 			conn.WriteBulk(v)
 		}
+	case *message.ResponseSlice:
+		conn.WriteArray(len(concreteResponse.Payload()))
+		for _, v := range concreteResponse.Payload() {
+			if err := sendResponse(v, conn); err != nil {
+				return err
+			}
+		}
 	case *message.ResponseInt:
 		conn.WriteInt(concreteResponse.Payload())
+	case *message.ResponseIntSlice:
+		conn.WriteArray(len(concreteResponse.Payload()))
+		for _, v := range concreteResponse.Payload() {
+			conn.WriteInt(v)
+		}
 	default:
 		return fmt.Errorf("unknown response type: %T", response)
 	}
@@ -0,0 +1,82 @@
+package restless
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mshaverdo/radish/message"
+	"github.com/mshaverdo/radish/pubsub"
+	"net/http"
+)
+
+// isSubscribeRequest returns true, if request should be served by serveSubscription()
+func isSubscribeRequest(request *message.Request) bool {
+	return request.Cmd == "SUBSCRIBE" || request.Cmd == "PSUBSCRIBE"
+}
+
+// serveSubscription streams messages of /SUBSCRIBE/<CHANNEL>/... and /PSUBSCRIBE/<PATTERN>/... requests
+// as Server-Sent Events, until the client disconnects or the server shuts down.
+// Every event data is JSON array in the RESP push format: ["message", channel, payload]
+// or ["pmessage", pattern, channel, payload]
+func (s *Server) serveSubscription(w http.ResponseWriter, r *http.Request, request *message.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Error during processing request: streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	if request.ArgumentsLen() == 0 {
+		http.Error(w, "Error during processing request: no channels to subscribe", http.StatusBadRequest)
+		return
+	}
+
+	subscriber := s.pubSubHandler.NewSubscriber()
+	defer subscriber.Close()
+
+	names, _ := request.GetArgumentVariadicString(0)
+	if request.Cmd == "SUBSCRIBE" {
+		subscriber.Subscribe(names)
+	} else {
+		subscriber.PSubscribe(names)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set(StatusHeader, message.StatusOk.String())
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case msg, ok := <-subscriber.Messages():
+			if !ok {
+				// the client can't keep up with published messages
+				return
+			}
+
+			if err := writeEvent(w, msg); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.streamsStopChan:
+			return
+		}
+	}
+}
+
+// writeEvent writes message as Server-Sent Event
+func writeEvent(w http.ResponseWriter, msg pubsub.Message) error {
+	event := []string{"message", msg.Channel, string(msg.Payload)}
+	if msg.Pattern != "" {
+		event = []string{"pmessage", msg.Pattern, msg.Channel, string(msg.Payload)}
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event[0], data)
+	return err
+}
@@ -0,0 +1,66 @@
+package restless_test
+
+import (
+	"bufio"
+	"github.com/go-test/deep"
+	"github.com/mshaverdo/radish/api/restless"
+	"github.com/mshaverdo/radish/message"
+	"github.com/mshaverdo/radish/pubsub"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pubSubHandler is a MessageHandler with a pub/sub broker
+type pubSubHandler struct {
+	*pubsub.Broker
+}
+
+func (h pubSubHandler) HandleMessage(request *message.Request) message.Response {
+	return message.NewResponseStatus(message.StatusInvalidCommand, request.Cmd)
+}
+
+func TestHttpServer_Subscription(t *testing.T) {
+	broker := pubsub.NewBroker()
+	srv := httptest.NewServer(restless.NewServer("", 0, pubSubHandler{broker}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/PSUBSCRIBE/news*/sport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type %q != text/event-stream", got)
+	}
+
+	// the response headers are received after subscription
+	broker.Publish("newsfeed", []byte("hello\n\"world\""))
+	broker.Publish("weather", []byte("ignored"))
+	broker.Publish("sport", []byte("goal"))
+
+	want := []string{
+		"event: pmessage",
+		`data: ["pmessage","news*","newsfeed","hello\n\"world\""]`,
+		"",
+		"event: pmessage",
+		`data: ["pmessage","sport","sport","goal"]`,
+		"",
+	}
+
+	var got []string
+	reader := bufio.NewReader(resp.Body)
+	for len(got) < len(want) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, strings.TrimSuffix(line, "\n"))
+	}
+
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("%s\n\ngot:%q\n\nwant:%q", diff, got, want)
+	}
+}
@@ -0,0 +1,53 @@
+package restless
+
+import (
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"net/http"
+)
+
+// isPSyncRequest returns true, if request should be served by serveReplica()
+func isPSyncRequest(request *message.Request) bool {
+	return request.Cmd == "PSYNC"
+}
+
+// serveReplica streams replication records of /PSYNC/<LAST_MESSAGE_ID> request to the replica, until the stream is finished
+func (s *Server) serveReplica(w http.ResponseWriter, r *http.Request, request *message.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Error during processing request: streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	if request.ArgumentsLen() != 1 {
+		http.Error(w, "Error during processing request: wrong number of arguments", http.StatusBadRequest)
+		return
+	}
+
+	lastMessageId, err := request.GetArgumentInt(0)
+	if err != nil {
+		http.Error(w, "Error during processing request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(StatusHeader, message.StatusOk.String())
+	w.WriteHeader(http.StatusOK)
+
+	log.Infof("Replica %s connected", r.RemoteAddr)
+	err = s.replicationHandler.Replicate(flushWriter{w, flusher}, int64(lastMessageId))
+	log.Infof("Replica %s disconnected: %v", r.RemoteAddr, err)
+}
+
+// flushWriter flushes every write to the client
+type flushWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (fw flushWriter) Write(p []byte) (n int, err error) {
+	n, err = fw.w.Write(p)
+	fw.flusher.Flush()
+
+	return n, err
+}
@@ -15,31 +15,52 @@ import (
 	"net/textproto"
 	"net/url"
 	"strings"
+	"sync"
 )
 
 const (
 	StatusHeader = "X-Radish-Status"
+	// AskingHeader marks request, redirected by ASK, like ASKING command does in RESP
+	AskingHeader = "X-Radish-Asking"
 )
 
 // Server is a implementation of Server interface
 type Server struct {
 	http.Server
 	messageHandler api.MessageHandler
+	pubSubHandler  api.PubSubHandler
 	stopChan       chan struct{}
+
+	replicationHandler api.ReplicationHandler
+	clusterHandler     api.ClusterHandler
+
+	// streamsStopChan is closed at shutdown to finish subscription streams, which never become idle
+	streamsStopChan chan struct{}
+	streamsStopOnce sync.Once
 }
 
-// NewServer Returns new instance of Radish HTTP server
+// NewServer Returns new instance of Radish HTTP server.
+// SUBSCRIBE/PSUBSCRIBE streams are supported, if messageHandler implements api.PubSubHandler,
+// PSYNC replication stream is supported, if messageHandler implements api.ReplicationHandler,
+// and requests with AskingHeader are supported, if messageHandler implements api.ClusterHandler
 func NewServer(host string, port int, messageHandler api.MessageHandler) *Server {
 	// use server instance instead of http.ListenAndServe -- due to we should use graceful shutdown
 	addr := fmt.Sprintf("%s:%d", host, port)
 
 	s := Server{
-		Server:         http.Server{Addr: addr},
-		messageHandler: messageHandler,
-		stopChan:       make(chan struct{}),
+		Server:          http.Server{Addr: addr},
+		messageHandler:  messageHandler,
+		stopChan:        make(chan struct{}),
+		streamsStopChan: make(chan struct{}),
 	}
+	s.pubSubHandler, _ = messageHandler.(api.PubSubHandler)
+	s.replicationHandler, _ = messageHandler.(api.ReplicationHandler)
+	s.clusterHandler, _ = messageHandler.(api.ClusterHandler)
 
 	s.Server.Handler = &s
+	s.Server.RegisterOnShutdown(func() {
+		s.streamsStopOnce.Do(func() { close(s.streamsStopChan) })
+	})
 
 	return &s
 }
@@ -85,9 +106,23 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.pubSubHandler != nil && isSubscribeRequest(request) {
+		s.serveSubscription(w, r, request)
+		return
+	}
+
+	if s.replicationHandler != nil && isPSyncRequest(request) {
+		s.serveReplica(w, r, request)
+		return
+	}
+
 	//log.Debugf("Handling request: %s", request)
 
-	response = s.messageHandler.HandleMessage(request)
+	if s.clusterHandler != nil && r.Header.Get(AskingHeader) != "" {
+		response = s.clusterHandler.HandleAskingMessage(request)
+	} else {
+		response = s.messageHandler.HandleMessage(request)
+	}
 
 	//log.Debugf("Sending response: %s", response)
 
@@ -153,6 +188,11 @@ func getResponseHttpStatus(r message.Response) int {
 		message.StatusInvalidCommand:   http.StatusBadRequest,
 		message.StatusTypeMismatch:     http.StatusBadRequest,
 		message.StatusInvalidArguments: http.StatusBadRequest,
+		message.StatusScriptError:      http.StatusBadRequest,
+		message.StatusReadOnly:         http.StatusForbidden,
+		message.StatusRedirect:         http.StatusMisdirectedRequest,
+		message.StatusClusterError:     http.StatusBadRequest,
+		message.StatusOutOfMemory:      http.StatusInsufficientStorage,
 	}
 
 	if httpStatus, ok := statusMap[r.Status()]; ok {
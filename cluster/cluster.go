@@ -0,0 +1,328 @@
+package cluster
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+)
+
+var (
+	ErrInvalidSlot    = errors.New("invalid or out of range slot")
+	ErrSlotBusy       = errors.New("slot is already busy")
+	ErrSlotUnassigned = errors.New("slot is already unassigned")
+	ErrUnknownNode    = errors.New("unknown node")
+	ErrForgetMyself   = errors.New("I tried hard but I can't forget myself")
+	ErrNotOwner       = errors.New("I'm not the owner of hash slot")
+	ErrAlreadyOwner   = errors.New("I'm already the owner of hash slot")
+)
+
+// Node is a node of the cluster
+type Node struct {
+	Id   string
+	Host string
+	Port int
+}
+
+// NewNode Constructs new instance of Node
+func NewNode(id, host string, port int) *Node {
+	return &Node{Id: id, Host: host, Port: port}
+}
+
+// NewNodeId returns new random node id: 40 hex characters, like in Redis Cluster
+func NewNodeId() string {
+	id := make([]byte, 20)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// Addr returns host:port of the node
+func (n *Node) Addr() string {
+	return net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+}
+
+// SlotRange is a range of slots from Start to End inclusive, served by Owner
+type SlotRange struct {
+	Start, End int
+	Owner      *Node
+}
+
+// Cluster is a configuration of the cluster, as it's seen by the node: known nodes and owners of the slots.
+// There is no gossip between nodes, so every node is configured separately by CLUSTER commands
+type Cluster struct {
+	mutex  sync.RWMutex
+	myself *Node
+	nodes  map[string]*Node
+	owners [SlotsCount]*Node
+
+	// migrating and importing are slots, which keys are moved from this node to another one, or vice versa
+	migrating map[int]*Node
+	importing map[int]*Node
+}
+
+// New Constructs new instance of Cluster, containing the only node: myself, without slots
+func New(myself *Node) *Cluster {
+	return &Cluster{
+		myself:    myself,
+		nodes:     map[string]*Node{myself.Id: myself},
+		migrating: make(map[int]*Node),
+		importing: make(map[int]*Node),
+	}
+}
+
+// Myself returns the node itself
+func (c *Cluster) Myself() *Node {
+	return c.myself
+}
+
+// Node returns known node by id, or nil if the node is unknown
+func (c *Cluster) Node(id string) *Node {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.nodes[id]
+}
+
+// Nodes returns all known nodes, sorted by id
+func (c *Cluster) Nodes() []*Node {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.sortedNodes()
+}
+
+// Meet adds the node into the known nodes, or updates address of the known one
+func (c *Cluster) Meet(node *Node) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if known, ok := c.nodes[node.Id]; ok {
+		known.Host, known.Port = node.Host, node.Port
+		return
+	}
+
+	c.nodes[node.Id] = node
+}
+
+// Forget removes the node from the known nodes. Slots, served by the node, become unassigned
+func (c *Cluster) Forget(id string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	node, ok := c.nodes[id]
+	switch {
+	case !ok:
+		return ErrUnknownNode
+	case node == c.myself:
+		return ErrForgetMyself
+	}
+
+	delete(c.nodes, id)
+	for slot, owner := range c.owners {
+		if owner == node {
+			c.owners[slot] = nil
+		}
+	}
+	for slot, target := range c.migrating {
+		if target == node {
+			delete(c.migrating, slot)
+		}
+	}
+	for slot, source := range c.importing {
+		if source == node {
+			delete(c.importing, slot)
+		}
+	}
+
+	return nil
+}
+
+// AddSlots assigns unassigned slots to myself. Nothing is assigned, if any of the slots is busy
+func (c *Cluster) AddSlots(slots []int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, slot := range slots {
+		if !isValidSlot(slot) {
+			return ErrInvalidSlot
+		}
+		if c.owners[slot] != nil {
+			return ErrSlotBusy
+		}
+	}
+
+	for _, slot := range slots {
+		c.owners[slot] = c.myself
+		delete(c.importing, slot)
+	}
+
+	return nil
+}
+
+// AddNodeSlots assigns unassigned slots to the known node, slots served by another node are skipped.
+// It's used to learn slots of the node, met by CLUSTER MEET, since there is no gossip between nodes
+func (c *Cluster) AddNodeSlots(id string, slots []int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	node, ok := c.nodes[id]
+	if !ok {
+		return ErrUnknownNode
+	}
+
+	for _, slot := range slots {
+		if !isValidSlot(slot) {
+			return ErrInvalidSlot
+		}
+	}
+
+	for _, slot := range slots {
+		if c.owners[slot] == nil {
+			c.owners[slot] = node
+		}
+	}
+
+	return nil
+}
+
+// DelSlots makes the slots unassigned. Nothing is changed, if any of the slots is already unassigned
+func (c *Cluster) DelSlots(slots []int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, slot := range slots {
+		if !isValidSlot(slot) {
+			return ErrInvalidSlot
+		}
+		if c.owners[slot] == nil {
+			return ErrSlotUnassigned
+		}
+	}
+
+	for _, slot := range slots {
+		c.owners[slot] = nil
+		delete(c.migrating, slot)
+		delete(c.importing, slot)
+	}
+
+	return nil
+}
+
+// SetSlotNode assigns the slot to the node and finishes its migration or import
+func (c *Cluster) SetSlotNode(slot int, id string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	node, err := c.slotNode(slot, id)
+	if err != nil {
+		return err
+	}
+
+	c.owners[slot] = node
+	delete(c.migrating, slot)
+	delete(c.importing, slot)
+
+	return nil
+}
+
+// SetSlotMigrating starts migration of the slot, served by myself, to the node
+func (c *Cluster) SetSlotMigrating(slot int, id string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	node, err := c.slotNode(slot, id)
+	switch {
+	case err != nil:
+		return err
+	case c.owners[slot] != c.myself:
+		return ErrNotOwner
+	}
+
+	c.migrating[slot] = node
+
+	return nil
+}
+
+// SetSlotImporting starts import of the slot from the node, which serves it
+func (c *Cluster) SetSlotImporting(slot int, id string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	node, err := c.slotNode(slot, id)
+	switch {
+	case err != nil:
+		return err
+	case c.owners[slot] == c.myself:
+		return ErrAlreadyOwner
+	}
+
+	c.importing[slot] = node
+
+	return nil
+}
+
+// SetSlotStable cancels migration or import of the slot
+func (c *Cluster) SetSlotStable(slot int) error {
+	if !isValidSlot(slot) {
+		return ErrInvalidSlot
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.migrating, slot)
+	delete(c.importing, slot)
+
+	return nil
+}
+
+// Slot returns owner of the slot, the node the slot is migrating to and the node the slot is importing from.
+// Unassigned slot has nil owner
+func (c *Cluster) Slot(slot int) (owner, migrating, importing *Node) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.owners[slot], c.migrating[slot], c.importing[slot]
+}
+
+// SlotRanges returns ranges of the assigned slots, ordered by slots
+func (c *Cluster) SlotRanges() (ranges []SlotRange) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for slot, owner := range c.owners {
+		switch {
+		case owner == nil:
+			continue
+		case len(ranges) > 0 && ranges[len(ranges)-1].Owner == owner && ranges[len(ranges)-1].End == slot-1:
+			ranges[len(ranges)-1].End = slot
+		default:
+			ranges = append(ranges, SlotRange{Start: slot, End: slot, Owner: owner})
+		}
+	}
+
+	return ranges
+}
+
+// slotNode validates the slot and returns known node by id. MUST be invoked only while c.mutex locked!
+func (c *Cluster) slotNode(slot int, id string) (*Node, error) {
+	if !isValidSlot(slot) {
+		return nil, ErrInvalidSlot
+	}
+
+	node, ok := c.nodes[id]
+	if !ok {
+		return nil, ErrUnknownNode
+	}
+
+	return node, nil
+}
+
+func isValidSlot(slot int) bool {
+	return slot >= 0 && slot < SlotsCount
+}
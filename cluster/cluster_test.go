@@ -0,0 +1,114 @@
+package cluster_test
+
+import (
+	"bytes"
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/cluster"
+	"strings"
+	"testing"
+)
+
+const (
+	idA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	idB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	idC = "cccccccccccccccccccccccccccccccccccccccc"
+)
+
+func newCluster() *Cluster {
+	c := New(NewNode(idA, "127.0.0.1", 6380))
+	c.Meet(NewNode(idB, "127.0.0.1", 6381))
+	c.Meet(NewNode(idC, "127.0.0.1", 6382))
+
+	return c
+}
+
+func TestCluster_Slots(t *testing.T) {
+	c := newCluster()
+
+	tests := []struct {
+		name string
+		run  func() error
+		err  error
+	}{
+		{"AddSlots", func() error { return c.AddSlots([]int{0, 1, 2, 3, 10}) }, nil},
+		{"AddSlots busy", func() error { return c.AddSlots([]int{4, 3}) }, ErrSlotBusy},
+		{"AddSlots invalid", func() error { return c.AddSlots([]int{SlotsCount}) }, ErrInvalidSlot},
+		{"DelSlots", func() error { return c.DelSlots([]int{2}) }, nil},
+		{"DelSlots unassigned", func() error { return c.DelSlots([]int{1, 2}) }, ErrSlotUnassigned},
+		{"SetSlotNode", func() error { return c.SetSlotNode(100, idB) }, nil},
+		{"SetSlotNode unknown", func() error { return c.SetSlotNode(101, "404") }, ErrUnknownNode},
+		{"AddNodeSlots", func() error { return c.AddNodeSlots(idB, []int{0, 200}) }, nil},
+		{"AddNodeSlots unknown", func() error { return c.AddNodeSlots("404", []int{201}) }, ErrUnknownNode},
+		{"SetSlotMigrating", func() error { return c.SetSlotMigrating(3, idB) }, nil},
+		{"SetSlotMigrating not owner", func() error { return c.SetSlotMigrating(100, idC) }, ErrNotOwner},
+		{"SetSlotImporting", func() error { return c.SetSlotImporting(100, idB) }, nil},
+		{"SetSlotImporting owner", func() error { return c.SetSlotImporting(0, idB) }, ErrAlreadyOwner},
+		{"Forget myself", func() error { return c.Forget(idA) }, ErrForgetMyself},
+		{"Forget", func() error { return c.Forget(idC) }, nil},
+		{"Forget unknown", func() error { return c.Forget(idC) }, ErrUnknownNode},
+	}
+
+	for _, tst := range tests {
+		if err := tst.run(); err != tst.err {
+			t.Errorf("%s: %v != %v", tst.name, err, tst.err)
+		}
+	}
+
+	var got []string
+	for _, r := range c.SlotRanges() {
+		got = append(got, r.Owner.Id[:1]+" "+strings.Repeat("#", r.End-r.Start+1))
+	}
+	want := []string{"a ##", "a #", "a #", "b #", "b #"}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("SlotRanges(): %s\n\ngot:%q\n\nwant:%q", diff, got, want)
+	}
+
+	owner, migrating, importing := c.Slot(3)
+	if owner.Id != idA || migrating.Id != idB || importing != nil {
+		t.Errorf("Slot(3): %v, %v, %v", owner, migrating, importing)
+	}
+
+	owner, migrating, importing = c.Slot(100)
+	if owner.Id != idB || migrating != nil || importing.Id != idB {
+		t.Errorf("Slot(100): %v, %v, %v", owner, migrating, importing)
+	}
+}
+
+func TestCluster_Nodes(t *testing.T) {
+	c := newCluster()
+	c.AddSlots([]int{0, 1, 2, 5})
+	c.SetSlotNode(6, idB)
+	c.SetSlotNode(7, idB)
+	c.SetSlotMigrating(5, idC)
+	c.SetSlotImporting(6, idB)
+
+	want := idA + " 127.0.0.1:6380@16380 myself,master - 0 0 0 connected 0-2 5 [5->-" + idC + "] [6-<-" + idB + "]\n" +
+		idB + " 127.0.0.1:6381@16381 master - 0 0 0 connected 6-7\n" +
+		idC + " 127.0.0.1:6382@16382 master - 0 0 0 connected\n"
+
+	buf := &bytes.Buffer{}
+	if err := c.WriteNodes(buf); err != nil {
+		t.Fatalf("WriteNodes(): %s", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("WriteNodes():\n%s\n!=\n%s", got, want)
+	}
+
+	loaded, err := ReadNodes(strings.NewReader(want))
+	if err != nil {
+		t.Fatalf("ReadNodes(): %s", err)
+	}
+	if loaded.Myself().Id != idA {
+		t.Errorf("ReadNodes(): myself %s != %s", loaded.Myself().Id, idA)
+	}
+
+	buf.Reset()
+	loaded.WriteNodes(buf)
+	if got := buf.String(); got != want {
+		t.Errorf("WriteNodes() of loaded:\n%s\n!=\n%s", got, want)
+	}
+
+	if _, err := ReadNodes(strings.NewReader(idB + " 127.0.0.1:6381@16381 master - 0 0 0 connected 6-7\n")); err != ErrNodesFormat {
+		t.Errorf("ReadNodes() without myself: %v != %v", err, ErrNodesFormat)
+	}
+}
@@ -0,0 +1,193 @@
+package cluster
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// clusterBusPortOffset is the offset of the cluster bus port, shown in CLUSTER NODES, like in Redis Cluster.
+// Radish has no cluster bus, so it's shown only for compatibility of the format
+const clusterBusPortOffset = 10000
+
+var (
+	ErrNodesFormat = errors.New("malformed cluster nodes configuration")
+)
+
+// WriteNodes writes the configuration in CLUSTER NODES format, like in Redis Cluster: a line for every node
+// with id, address, flags, master, ping, pong, epoch, link state and slots. Slots, migrating to or importing from
+// another node, are shown on the myself line as [slot->-id] and [slot-<-id]
+func (c *Cluster) WriteNodes(w io.Writer) error {
+	ranges := c.SlotRanges()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, node := range c.sortedNodes() {
+		flags := "master"
+		if node == c.myself {
+			flags = "myself,master"
+		}
+		fmt.Fprintf(bw, "%s %s@%d %s - 0 0 0 connected", node.Id, node.Addr(), node.Port+clusterBusPortOffset, flags)
+
+		for _, r := range ranges {
+			switch {
+			case r.Owner != node:
+				continue
+			case r.Start == r.End:
+				fmt.Fprintf(bw, " %d", r.Start)
+			default:
+				fmt.Fprintf(bw, " %d-%d", r.Start, r.End)
+			}
+		}
+
+		if node == c.myself {
+			for _, slot := range sortedSlots(c.migrating) {
+				fmt.Fprintf(bw, " [%d->-%s]", slot, c.migrating[slot].Id)
+			}
+			for _, slot := range sortedSlots(c.importing) {
+				fmt.Fprintf(bw, " [%d-<-%s]", slot, c.importing[slot].Id)
+			}
+		}
+
+		bw.WriteString("\n")
+	}
+
+	return bw.Flush()
+}
+
+// ReadNodes reads the configuration, written by WriteNodes()
+func ReadNodes(r io.Reader) (*Cluster, error) {
+	var (
+		c         *Cluster
+		nodes     []*Node
+		nodeSlots [][]string
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 8 {
+			return nil, ErrNodesFormat
+		}
+
+		addr := strings.SplitN(fields[1], "@", 2)[0]
+		host, portString, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, ErrNodesFormat
+		}
+		port, err := strconv.Atoi(portString)
+		if err != nil {
+			return nil, ErrNodesFormat
+		}
+
+		node := NewNode(fields[0], host, port)
+		if strings.Contains(fields[2], "myself") {
+			if c != nil {
+				return nil, ErrNodesFormat
+			}
+			c = New(node)
+		}
+
+		nodes = append(nodes, node)
+		nodeSlots = append(nodeSlots, fields[8:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrNodesFormat
+	}
+
+	for _, node := range nodes {
+		c.Meet(node)
+	}
+
+	// slots are parsed after all the nodes are known, because migrating slots refer to other nodes
+	for i, slots := range nodeSlots {
+		for _, slot := range slots {
+			if err := c.readSlot(nodes[i], slot); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// readSlot applies slot or slot range of the node, in format of WriteNodes()
+func (c *Cluster) readSlot(node *Node, slot string) error {
+	if strings.HasPrefix(slot, "[") {
+		slot = strings.Trim(slot, "[]")
+		if parts := strings.SplitN(slot, "->-", 2); len(parts) == 2 {
+			start, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return ErrNodesFormat
+			}
+			return c.SetSlotMigrating(start, parts[1])
+		}
+		if parts := strings.SplitN(slot, "-<-", 2); len(parts) == 2 {
+			start, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return ErrNodesFormat
+			}
+			return c.SetSlotImporting(start, parts[1])
+		}
+
+		return ErrNodesFormat
+	}
+
+	bounds := strings.SplitN(slot, "-", 2)
+	start, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return ErrNodesFormat
+	}
+	end := start
+	if len(bounds) == 2 {
+		if end, err = strconv.Atoi(bounds[1]); err != nil {
+			return ErrNodesFormat
+		}
+	}
+
+	if !isValidSlot(start) || !isValidSlot(end) || start > end {
+		return ErrInvalidSlot
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for s := start; s <= end; s++ {
+		c.owners[s] = node
+	}
+
+	return nil
+}
+
+// sortedNodes returns all known nodes, sorted by id. MUST be invoked only while c.mutex locked!
+func (c *Cluster) sortedNodes() []*Node {
+	nodes := make([]*Node, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Id < nodes[j].Id })
+
+	return nodes
+}
+
+func sortedSlots(slots map[int]*Node) []int {
+	result := make([]int, 0, len(slots))
+	for slot := range slots {
+		result = append(result, slot)
+	}
+	sort.Ints(result)
+
+	return result
+}
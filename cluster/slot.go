@@ -0,0 +1,50 @@
+// Package cluster implements hash-slot clustering, compatible with Redis Cluster: the keyspace is split
+// into 16384 hash slots, and every slot is served by a single node of the cluster
+package cluster
+
+import (
+	"strings"
+)
+
+// SlotsCount is the count of hash slots in the cluster
+const SlotsCount = 16384
+
+// crc16Table is the lookup table of CRC16-CCITT (XMODEM), used by Redis Cluster
+var crc16Table [256]uint16
+
+func init() {
+	for i := range crc16Table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16Table[i] = crc
+	}
+}
+
+// crc16 returns CRC16-CCITT (XMODEM) checksum of s
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+
+	return crc
+}
+
+// Slot returns hash slot of the key. Like in Redis Cluster, if the key contains not empty hash tag,
+// the part between the first { and the following }, only the hash tag is hashed,
+// so keys like {user1000}.following and {user1000}.followers are stored in the same slot
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key)) & (SlotsCount - 1)
+}
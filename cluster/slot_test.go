@@ -0,0 +1,32 @@
+package cluster_test
+
+import (
+	. "github.com/mshaverdo/radish/cluster"
+	"testing"
+)
+
+func TestSlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+	}{
+		// values are taken from Redis Cluster: CLUSTER KEYSLOT
+		{"123456789", 12739},
+		{"foo", 12182},
+		{"bar", 5061},
+		{"", 0},
+		{"{user1000}.following", 3443},
+		{"{user1000}.followers", 3443},
+		{"user1000", 3443},
+		{"foo{}{bar}", 8363},
+		{"foo{{bar}}zap", 4015},
+		{"foo{bar}{zap}", 5061},
+		{"{bar", 4015},
+	}
+
+	for _, tst := range tests {
+		if got := Slot(tst.key); got != tst.want {
+			t.Errorf("Slot(%q): %d != %d", tst.key, got, tst.want)
+		}
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"github.com/mshaverdo/assert"
 	"github.com/mshaverdo/radish/controller"
 	"github.com/mshaverdo/radish/log"
+	"net"
 	"os"
 	"os/signal"
 	"runtime/pprof"
+	"strconv"
 	"syscall"
 	"time"
 )
@@ -28,6 +30,11 @@ func main() {
 		quiet, verbose, veryVerbose bool
 		cpuProfile                  string
 		useHttp                     bool
+		notifyKeyspaceEvents        string
+		replicaOf                   string
+		clusterEnabled              bool
+		maxMemory, maxMemoryPolicy  string
+		storageEngine               string
 	)
 
 	flag.StringVar(&host, "h", "", "The listening host.")
@@ -43,6 +50,13 @@ func main() {
 	flag.BoolVar(&quiet, "q", false, "Quiet logging. Totally silent.")
 	flag.BoolVar(&veryVerbose, "vv", false, "Enable very verbose logging.")
 	flag.BoolVar(&useHttp, "http", false, "Use HTTP API")
+	flag.StringVar(&notifyKeyspaceEvents, "notify-keyspace-events", "", "Keyspace notifications classes, like in Redis: K, E, g, $, l, s, h, z, x, e, A")
+	flag.StringVar(&replicaOf, "replicaof", "", "Replicate the master at host:port, serving read-only requests")
+	flag.BoolVar(&clusterEnabled, "cluster", false, "Enable cluster mode: serve only keys of the hash slots, assigned to the node")
+	flag.StringVar(&maxMemory, "maxmemory", "0", "Maximum memory used by the storage, like 100mb or 1gb, 0 means no limit")
+	flag.StringVar(&maxMemoryPolicy, "maxmemory-policy", "noeviction", "Eviction policy: noeviction, allkeys-lru, allkeys-lfu, volatile-lru, volatile-ttl")
+	flag.StringVar(&storageEngine, "storage", controller.StorageEngineHash, "Storage engine: hash, or btree to keep keys in lexicographic order")
+	flag.BoolVar(&controller.WalStrict, "wal-strict", false, "Refuse to start, if WAL is corrupted, instead of truncating it to the last valid record")
 	flag.Parse()
 
 	if cpuProfile != "" {
@@ -65,6 +79,11 @@ func main() {
 		log.SetLevel(log.NOTICE)
 	}
 
+	if err := controller.SetStorageEngine(storageEngine); err != nil {
+		log.Critical("Invalid storage: " + err.Error())
+		return
+	}
+
 	c := controller.New(
 		host,
 		port,
@@ -75,6 +94,42 @@ func main() {
 		useHttp,
 	)
 
+	if err := c.SetKeyspaceEvents(notifyKeyspaceEvents); err != nil {
+		log.Critical("Invalid notify-keyspace-events: " + err.Error())
+		return
+	}
+
+	if err := c.SetMaxMemory(maxMemory); err != nil {
+		log.Critical("Invalid maxmemory: " + err.Error())
+		return
+	}
+
+	if err := c.SetEvictionPolicy(maxMemoryPolicy); err != nil {
+		log.Critical("Invalid maxmemory-policy: " + err.Error())
+		return
+	}
+
+	if replicaOf != "" {
+		masterHost, masterPortString, err := net.SplitHostPort(replicaOf)
+		if err != nil {
+			log.Critical("Invalid replicaof: " + err.Error())
+			return
+		}
+		masterPort, err := strconv.Atoi(masterPortString)
+		if err != nil {
+			log.Critical("Invalid replicaof port: " + err.Error())
+			return
+		}
+		c.ReplicaOf(masterHost, masterPort)
+	}
+
+	if clusterEnabled {
+		if err := c.EnableCluster(); err != nil {
+			log.Critical("Can't enable cluster mode: " + err.Error())
+			return
+		}
+	}
+
 	go handleSignals(c)
 
 	if err := c.ListenAndServe(); err != nil {
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/message"
+	"math"
+	"time"
+)
+
+var (
+	ErrNegativeTimeout = errors.New("timeout is negative")
+)
+
+// blockingCommands maps blocking list command to the non-blocking one, used to pop values
+var blockingCommands = map[string]string{
+	"BLPOP":  "LPOP",
+	"BRPOP":  "RPOP",
+	"BLMOVE": "LMOVE",
+}
+
+// isBlockingRequest returns true, if request should be handled by processBlockingRequest()
+func isBlockingRequest(request *message.Request) bool {
+	_, ok := blockingCommands[request.Cmd]
+	return ok
+}
+
+// processBlockingRequest handles blocking list commands: BLPOP key [key ...] timeout, BRPOP key [key ...] timeout
+// and BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout.
+// It tries to pop value with non-blocking command and parks the client until a push into one of the keys,
+// timeout or server shutdown. Popping is done by regular requests, so blocking commands never reach the WAL.
+func (c *Controller) processBlockingRequest(request *message.Request) message.Response {
+	popRequests, keys, timeout, err := parseBlockingRequest(request)
+	if err != nil {
+		return getResponseInvalidArguments(request.Cmd, err)
+	}
+
+	// popping requests are routed one by one, so keys of different slots are rejected before the client is parked
+	c.txMutex.RLock()
+	response := c.routeRequest(keys, false)
+	c.txMutex.RUnlock()
+	if response != nil {
+		return response
+	}
+
+	process := func(popRequest *message.Request) message.Response {
+		return c.processRequest(popRequest, false)
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	// register waiter BEFORE trying to pop, to not miss a push between pop and wait
+	pushed, release := c.core.WaitPush(keys)
+	defer release()
+
+	for {
+		if response, ok := tryBlockingPop(request, popRequests, process); ok {
+			return response
+		}
+
+		select {
+		case <-pushed:
+			// try to pop again
+		case <-expired:
+			return message.NewResponseStatus(message.StatusNotFound, "")
+		case <-c.stopChan:
+			return getResponseCommandError(request.Cmd, ErrServerShutdown)
+		}
+	}
+}
+
+// processBlockingRequestNowait handles blocking list command inside a transaction.
+// Like in Redis, it never blocks and responds nil at once, if all the lists are empty
+func processBlockingRequestNowait(request *message.Request, process processFunc) message.Response {
+	popRequests, _, _, err := parseBlockingRequest(request)
+	if err != nil {
+		return getResponseInvalidArguments(request.Cmd, err)
+	}
+
+	if response, ok := tryBlockingPop(request, popRequests, process); ok {
+		return response
+	}
+
+	return message.NewResponseStatus(message.StatusNotFound, "")
+}
+
+// tryBlockingPop tries to pop value with non-blocking popRequests, processed by process().
+// Returns false, if all the lists are empty, so the client should wait for a push
+func tryBlockingPop(
+	request *message.Request,
+	popRequests []*message.Request,
+	process processFunc,
+) (response message.Response, ok bool) {
+	for _, popRequest := range popRequests {
+		response := process(popRequest)
+		switch {
+		case response.Status() == message.StatusNotFound:
+			continue
+		case response.Status() != message.StatusOk || request.Cmd == "BLMOVE":
+			return response, true
+		default:
+			// BLPOP and BRPOP reply with the key and the popped value
+			return getResponseStringSlicePayload(append([][]byte{popRequest.Args[0]}, response.Bytes()...)), true
+		}
+	}
+
+	return nil, false
+}
+
+// parseBlockingRequest builds non-blocking requests to pop values and returns keys to wait and timeout.
+// Timeout is the last argument in seconds, zero timeout means wait forever
+func parseBlockingRequest(request *message.Request) (popRequests []*message.Request, keys []string, timeout time.Duration, err error) {
+	minArgs := 2
+	if request.Cmd == "BLMOVE" {
+		minArgs = 5
+	}
+
+	argsLen := request.ArgumentsLen()
+	if argsLen < minArgs || (request.Cmd == "BLMOVE" && argsLen != minArgs) {
+		return nil, nil, 0, errors.New("wrong number of arguments")
+	}
+
+	seconds, err := request.GetArgumentFloat(argsLen - 1)
+	if err != nil {
+		return nil, nil, 0, errors.New("timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return nil, nil, 0, ErrNegativeTimeout
+	}
+	// too long timeout is the same as infinite one. The timeout is rounded up,
+	// so a positive timeout shorter than a nanosecond doesn't turn into the infinite one
+	if seconds < float64(math.MaxInt64/int64(time.Second)) {
+		timeout = time.Duration(math.Ceil(seconds * float64(time.Second)))
+	}
+
+	popCmd := blockingCommands[request.Cmd]
+	if request.Cmd == "BLMOVE" {
+		popRequests = []*message.Request{message.NewRequest(popCmd, request.Args[:4])}
+		return popRequests, []string{string(request.Args[0])}, timeout, nil
+	}
+
+	for _, key := range request.Args[:argsLen-1] {
+		keys = append(keys, string(key))
+		popRequests = append(popRequests, message.NewRequest(popCmd, [][]byte{key}))
+	}
+
+	return popRequests, keys, timeout, nil
+}
@@ -0,0 +1,100 @@
+package controller_test
+
+import (
+	"github.com/go-test/deep"
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"testing"
+	"time"
+)
+
+func newRequest(cmd string, args ...string) *message.Request {
+	byteArgs := make([][]byte, len(args))
+	for i, v := range args {
+		byteArgs[i] = []byte(v)
+	}
+
+	return message.NewRequest(cmd, byteArgs)
+}
+
+func TestController_BlockingRequest(t *testing.T) {
+	tests := []struct {
+		request    *message.Request
+		push       *message.Request
+		wantStatus message.Status
+		want       []string
+	}{
+		{newRequest("BLPOP", "list"), nil, message.StatusInvalidArguments, nil},
+		{newRequest("BLPOP", "list", "-1"), nil, message.StatusInvalidArguments, nil},
+		{newRequest("BLMOVE", "list", "dst", "LEFT", "0.01"), nil, message.StatusInvalidArguments, nil},
+		{newRequest("BLPOP", "list", "0.01"), nil, message.StatusNotFound, nil},
+		{newRequest("BLPOP", "list", "0.0000000001"), nil, message.StatusNotFound, nil},
+		{newRequest("BLPOP", "bytes", "list", "0"), nil, message.StatusTypeMismatch, nil},
+		{newRequest("BLPOP", "list", "full", "0"), nil, message.StatusOk, []string{"full", "f1"}},
+		{newRequest("BRPOP", "list", "full", "0"), nil, message.StatusOk, []string{"full", "f3"}},
+		{newRequest("BLPOP", "list", "list2", "0"), newRequest("RPUSH", "list2", "a", "b"), message.StatusOk, []string{"list2", "a"}},
+		{newRequest("BRPOP", "list", "0"), newRequest("LPUSH", "list", "c", "d"), message.StatusOk, []string{"list", "c"}},
+		{newRequest("BLMOVE", "src", "list", "RIGHT", "LEFT", "0"), newRequest("RPUSH", "src", "e"), message.StatusOk, []string{"e"}},
+		{newRequest("BLMOVE", "src", "list", "UP", "LEFT", "0"), newRequest("RPUSH", "src", "e"), message.StatusInvalidArguments, nil},
+	}
+
+	c := controller.New("", 0, "", 0, 0, 0, false)
+	c.HandleMessage(newRequest("SET", "bytes", "value"))
+	c.HandleMessage(newRequest("RPUSH", "full", "f1", "f2", "f3"))
+
+	for _, tst := range tests {
+		if tst.push != nil {
+			go func(push *message.Request) {
+				time.Sleep(10 * time.Millisecond)
+				c.HandleMessage(push)
+			}(tst.push)
+		}
+
+		response := c.HandleMessage(tst.request)
+
+		if response.Status() != tst.wantStatus {
+			t.Errorf("%s: status %s != %s", tst.request, response.Status(), tst.wantStatus)
+		}
+
+		if tst.want == nil {
+			continue
+		}
+
+		got := make([]string, len(response.Bytes()))
+		for i, v := range response.Bytes() {
+			got[i] = string(v)
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("%s: %s\n\ngot:%v\n\nwant:%v", tst.request, diff, got, tst.want)
+		}
+	}
+}
+
+func TestController_BlockingRequestShutdown(t *testing.T) {
+	log.SetLevel(log.CRITICAL)
+
+	c := controller.New("localhost", 0, "", 0, time.Second, 0, false)
+	go c.ListenAndServe()
+
+	responses := make(chan message.Response)
+	for i := 0; i < 3; i++ {
+		go func() {
+			responses <- c.HandleMessage(newRequest("BLPOP", "list", "0"))
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	go c.Shutdown()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case response := <-responses:
+			if response.Status() != message.StatusError {
+				t.Errorf("BLPOP on shutdown: status %s != %s", response.Status(), message.StatusError)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("blocked clients were not woken up on shutdown")
+		}
+	}
+}
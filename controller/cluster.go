@@ -0,0 +1,611 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mshaverdo/radish/cluster"
+	"github.com/mshaverdo/radish/core"
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configuration
+var (
+	// ClusterNodeTimeout is the default timeout of requests to other nodes of the cluster, like CLUSTER MEET
+	ClusterNodeTimeout = 5 * time.Second
+)
+
+const (
+	clusterFileName = "nodes.conf"
+
+	// restoreAskingCmd is RESTORE, sent by MIGRATE to the node importing the slot, so it's processed like after ASKING
+	restoreAskingCmd = "RESTORE-ASKING"
+
+	// keysInSlotScanCount is COUNT of the keyspace pages, scanned by keysInSlot()
+	keysInSlotScanCount = 1000
+)
+
+var (
+	ErrClusterDisabled = errors.New("This instance has cluster support disabled")
+	ErrNodeReply       = errors.New("malformed reply of the cluster node")
+)
+
+// EnableCluster enables cluster mode: keys are served only if their hash slots are assigned to this node,
+// requests for other keys are redirected to the owners of the slots.
+// The configuration of the cluster is loaded from nodes.conf in the data dir, if it exists,
+// otherwise the node starts with a new id and without slots. It must be invoked before ListenAndServe()
+func (c *Controller) EnableCluster() error {
+	host := c.host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	if c.isPersistent {
+		file, err := os.Open(c.clusterFileName())
+		switch {
+		case err == nil:
+			defer file.Close()
+
+			loaded, err := cluster.ReadNodes(file)
+			if err != nil {
+				return fmt.Errorf("can't load %s: %s", c.clusterFileName(), err)
+			}
+
+			// the node could be restarted at another address
+			loaded.Meet(cluster.NewNode(loaded.Myself().Id, host, c.port))
+			c.cluster = loaded
+			log.Infof("Cluster configuration loaded, node id %s", loaded.Myself().Id)
+			return c.saveCluster()
+		case !os.IsNotExist(err):
+			return err
+		}
+	}
+
+	c.cluster = cluster.New(cluster.NewNode(cluster.NewNodeId(), host, c.port))
+	log.Infof("New cluster node id %s", c.cluster.Myself().Id)
+
+	return c.saveCluster()
+}
+
+// saveCluster writes the configuration of the cluster into nodes.conf, if the server is persistent
+func (c *Controller) saveCluster() error {
+	if !c.isPersistent {
+		return nil
+	}
+
+	c.clusterFileMutex.Lock()
+	defer c.clusterFileMutex.Unlock()
+
+	file, err := ioutil.TempFile(filepath.Dir(c.clusterFileName()), filepath.Base(c.clusterFileName()))
+	if err != nil {
+		return err
+	}
+
+	if err := c.cluster.WriteNodes(file); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), c.clusterFileName())
+}
+
+func (c *Controller) clusterFileName() string {
+	return path.Join(c.dataDir, clusterFileName)
+}
+
+// HandleAskingMessage processes Request, redirected by ASK: keys of the slot, importing from another node, are served
+func (c *Controller) HandleAskingMessage(request *message.Request) message.Response {
+	return c.handleMessage(request, true)
+}
+
+// routeRequest returns MOVED or ASK redirect, if the keys are served by another node of the cluster,
+// or cluster error, if the keys belong to different slots or the slot is unassigned.
+// Returns nil, if the keys are served by this node. MUST be invoked only while c.txMutex locked,
+// so keys of a migrating slot aren't moved by MIGRATE, while the request is processed
+func (c *Controller) routeRequest(keys []string, asking bool) message.Response {
+	if c.cluster == nil || len(keys) == 0 {
+		return nil
+	}
+
+	slot := cluster.Slot(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.Slot(key) != slot {
+			return getResponseClusterError("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+
+	owner, migrating, importing := c.cluster.Slot(slot)
+	myself := c.cluster.Myself()
+	switch {
+	case owner == myself && migrating != nil:
+		// keys, already moved to the target node, are served there
+		switch c.core.Exists(keys) {
+		case len(keys):
+			return nil
+		case 0:
+			return getResponseRedirect(fmt.Sprintf("ASK %d %s", slot, migrating.Addr()))
+		default:
+			return getResponseClusterError("TRYAGAIN Multiple keys request during rehashing of slot")
+		}
+	case owner == myself:
+		return nil
+	case importing != nil && asking:
+		return nil
+	case owner == nil:
+		return getResponseClusterError("CLUSTERDOWN Hash slot not served")
+	default:
+		return getResponseRedirect(fmt.Sprintf("MOVED %d %s", slot, owner.Addr()))
+	}
+}
+
+// isClusterRequest returns true, if request should be handled by processClusterRequest()
+func isClusterRequest(request *message.Request) bool {
+	return request.Cmd == "CLUSTER" || request.Cmd == "MIGRATE"
+}
+
+// processClusterRequest handles CLUSTER subcommands and MIGRATE.
+// The configuration of the cluster is stored in nodes.conf, so it never reaches the WAL
+func (c *Controller) processClusterRequest(request *message.Request) message.Response {
+	if c.cluster == nil {
+		return getResponseCommandError(request.Cmd, ErrClusterDisabled)
+	}
+	if request.Cmd == "MIGRATE" {
+		return c.processMigrateRequest(request)
+	}
+
+	argsLen := request.ArgumentsLen()
+	if argsLen == 0 {
+		return getResponseInvalidArguments(request.Cmd, errors.New("wrong number of arguments"))
+	}
+
+	args := make([]string, argsLen-1)
+	for i, arg := range request.Args[1:] {
+		args[i] = string(arg)
+	}
+
+	var err error
+	switch subcommand := strings.ToUpper(string(request.Args[0])); {
+	case subcommand == "INFO" && argsLen == 1:
+		return getResponseStringPayload([]byte(c.clusterInfo()))
+	case subcommand == "MYID" && argsLen == 1:
+		return getResponseStringPayload([]byte(c.cluster.Myself().Id))
+	case subcommand == "NODES" && argsLen == 1:
+		buf := &bytes.Buffer{}
+		c.cluster.WriteNodes(buf)
+		return getResponseStringPayload(buf.Bytes())
+	case subcommand == "SLOTS" && argsLen == 1:
+		return c.clusterSlots()
+	case subcommand == "KEYSLOT" && argsLen == 2:
+		return getResponseIntPayload(cluster.Slot(args[0]))
+	case subcommand == "COUNTKEYSINSLOT" && argsLen == 2:
+		slot, err := parseSlots(args)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		return getResponseIntPayload(len(c.keysInSlot(slot[0], -1)))
+	case subcommand == "GETKEYSINSLOT" && argsLen == 3:
+		slot, err := parseSlots(args[:1])
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		count, err := strconv.Atoi(args[1])
+		if err != nil || count < 0 {
+			return getResponseInvalidArguments(request.Cmd, errors.New("invalid number of keys"))
+		}
+		return getResponseStringSlicePayload(stringsSliceToBytesSlise(c.keysInSlot(slot[0], count)))
+	case subcommand == "MEET" && argsLen == 3:
+		err = c.clusterMeet(args[0], args[1])
+	case subcommand == "FORGET" && argsLen == 2:
+		err = c.cluster.Forget(args[0])
+	case (subcommand == "ADDSLOTS" || subcommand == "DELSLOTS") && argsLen > 1:
+		var slots []int
+		if slots, err = parseSlots(args); err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		if subcommand == "ADDSLOTS" {
+			err = c.cluster.AddSlots(slots)
+		} else {
+			err = c.cluster.DelSlots(slots)
+		}
+	case subcommand == "ADDSLOTSRANGE" && argsLen > 1 && argsLen%2 == 1:
+		var slots []int
+		if slots, err = parseSlotRanges(args); err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		err = c.cluster.AddSlots(slots)
+	case subcommand == "SETSLOT" && argsLen >= 3:
+		err = c.clusterSetSlot(args)
+	default:
+		return getResponseInvalidArguments(request.Cmd, errors.New("unknown subcommand or wrong number of arguments for '"+subcommand+"'"))
+	}
+
+	if err != nil {
+		return getResponseCommandError(request.Cmd, err)
+	}
+	if err := c.saveCluster(); err != nil {
+		log.Errorf("Can't save cluster configuration: %s", err)
+		return getResponseCommandError(request.Cmd, err)
+	}
+
+	return getResponseStatusOkPayload()
+}
+
+// clusterInfo builds CLUSTER INFO reply: the cluster is ok, if all the slots are assigned
+func (c *Controller) clusterInfo() string {
+	assigned := 0
+	owners := make(map[*cluster.Node]struct{})
+	for _, r := range c.cluster.SlotRanges() {
+		assigned += r.End - r.Start + 1
+		owners[r.Owner] = struct{}{}
+	}
+
+	state := "ok"
+	if assigned < cluster.SlotsCount {
+		state = "fail"
+	}
+
+	return fmt.Sprintf(
+		"cluster_enabled:1\r\ncluster_state:%s\r\ncluster_slots_assigned:%d\r\ncluster_known_nodes:%d\r\ncluster_size:%d\r\n",
+		state, assigned, len(c.cluster.Nodes()), len(owners),
+	)
+}
+
+// clusterSlots builds CLUSTER SLOTS reply: start and end slot of every range, followed by host, port and id of the owner
+func (c *Controller) clusterSlots() message.Response {
+	var ranges []message.Response
+	for _, r := range c.cluster.SlotRanges() {
+		ranges = append(ranges, message.NewResponseSlice(message.StatusOk, []message.Response{
+			getResponseIntPayload(r.Start),
+			getResponseIntPayload(r.End),
+			message.NewResponseSlice(message.StatusOk, []message.Response{
+				getResponseStringPayload([]byte(r.Owner.Host)),
+				getResponseIntPayload(r.Owner.Port),
+				getResponseStringPayload([]byte(r.Owner.Id)),
+			}),
+		}))
+	}
+
+	return message.NewResponseSlice(message.StatusOk, ranges)
+}
+
+// keysInSlot returns up to count keys of the slot, stored by this node. Negative count means all the keys.
+// The keyspace is scanned page by page, so the keys aren't collected at once, and the scan stops at count keys
+func (c *Controller) keysInSlot(slot, count int) (keys []string) {
+	// keys could be returned by several pages, while the keyspace is modified
+	seen := make(map[string]struct{})
+	cursor := 0
+	for count < 0 || len(keys) < count {
+		page, err := c.core.Scan(cursor, "COUNT", strconv.Itoa(keysInSlotScanCount))
+		if err != nil {
+			log.Errorf("Controller.keysInSlot(): %s", err)
+			return keys
+		}
+
+		for _, key := range page.Elements {
+			if _, ok := seen[string(key)]; ok || cluster.Slot(string(key)) != slot {
+				continue
+			}
+
+			seen[string(key)] = struct{}{}
+			keys = append(keys, string(key))
+			if len(keys) == count {
+				break
+			}
+		}
+
+		cursor = page.Cursor
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return keys
+}
+
+// clusterMeet requests configuration of the node at host:port and adds the node into the known nodes.
+// There is no gossip between nodes, so the slots, served by the node, are assigned to it, unless they are busy
+func (c *Controller) clusterMeet(host, portString string) error {
+	port, err := strconv.Atoi(portString)
+	if err != nil || port <= 0 || port > 65535 {
+		return errors.New("invalid node port")
+	}
+
+	node := cluster.NewNode("", host, port)
+	nodes, err := c.callNode(node.Addr(), ClusterNodeTimeout, message.NewRequest("CLUSTER", [][]byte{[]byte("NODES")}))
+	if err != nil {
+		return err
+	}
+
+	remote, err := cluster.ReadNodes(bytes.NewReader(nodes))
+	if err != nil {
+		return err
+	}
+
+	var slots []int
+	for _, r := range remote.SlotRanges() {
+		for slot := r.Start; r.Owner == remote.Myself() && slot <= r.End; slot++ {
+			slots = append(slots, slot)
+		}
+	}
+
+	node.Id = remote.Myself().Id
+	c.cluster.Meet(node)
+
+	return c.cluster.AddNodeSlots(node.Id, slots)
+}
+
+// clusterSetSlot handles CLUSTER SETSLOT slot IMPORTING|MIGRATING|NODE node-id and CLUSTER SETSLOT slot STABLE
+func (c *Controller) clusterSetSlot(args []string) error {
+	slot, err := parseSlots(args[:1])
+	if err != nil {
+		return err
+	}
+
+	switch action := strings.ToUpper(args[1]); {
+	case action == "IMPORTING" && len(args) == 3:
+		return c.cluster.SetSlotImporting(slot[0], args[2])
+	case action == "MIGRATING" && len(args) == 3:
+		return c.cluster.SetSlotMigrating(slot[0], args[2])
+	case action == "NODE" && len(args) == 3:
+		return c.cluster.SetSlotNode(slot[0], args[2])
+	case action == "STABLE" && len(args) == 2:
+		return c.cluster.SetSlotStable(slot[0])
+	default:
+		return errors.New("invalid CLUSTER SETSLOT action or number of arguments")
+	}
+}
+
+// processMigrateRequest handles MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE] [KEYS key [key ...]].
+// The keys are restored on the target node by RESTORE-ASKING, then removed from this node, unless COPY is specified.
+// Nothing interleaves with the migration, so clients never see a key on both nodes
+func (c *Controller) processMigrateRequest(request *message.Request) message.Response {
+	if request.ArgumentsLen() < 5 {
+		return getResponseInvalidArguments(request.Cmd, errors.New("wrong number of arguments"))
+	}
+
+	port, err := request.GetArgumentInt(1)
+	if err != nil || port <= 0 || port > 65535 {
+		return getResponseInvalidArguments(request.Cmd, errors.New("invalid target port"))
+	}
+	if db, err := request.GetArgumentInt(3); err != nil || db != 0 {
+		return getResponseInvalidArguments(request.Cmd, errors.New("only destination db 0 is supported"))
+	}
+	timeoutMs, err := request.GetArgumentInt(4)
+	if err != nil || timeoutMs < 0 {
+		return getResponseInvalidArguments(request.Cmd, errors.New("invalid timeout"))
+	}
+	timeout := time.Duration(timeoutMs) * time.Millisecond
+	if timeout == 0 {
+		timeout = ClusterNodeTimeout
+	}
+
+	var (
+		isCopy, isReplace bool
+		keys              []string
+	)
+	if key := string(request.Args[2]); key != "" {
+		keys = []string{key}
+	}
+	options := request.GetArgumentOptionalString(5)
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(options[i]) {
+		case "COPY":
+			isCopy = true
+		case "REPLACE":
+			isReplace = true
+		case "KEYS":
+			if len(keys) != 0 {
+				return getResponseInvalidArguments(request.Cmd, errors.New("when using MIGRATE KEYS option, the key argument must be set to the empty string"))
+			}
+			keys = options[i+1:]
+			i = len(options)
+		default:
+			return getResponseInvalidArguments(request.Cmd, core.ErrSyntax)
+		}
+	}
+
+	addr := net.JoinHostPort(string(request.Args[0]), strconv.Itoa(port))
+
+	return c.processAtomically(request.Cmd, func(process processFunc) message.Response {
+		migrated := 0
+		for _, key := range keys {
+			data, err := c.core.Dump(key)
+			if err != nil {
+				// not existing key is just skipped
+				continue
+			}
+
+			ttl, _ := c.core.PTtl(key)
+			switch {
+			case ttl < 0:
+				ttl = 0
+			case ttl == 0:
+				// the key expires right now, but zero TTL means no TTL for RESTORE
+				ttl = 1
+			}
+
+			args := [][]byte{[]byte(key), []byte(strconv.Itoa(ttl)), data}
+			if isReplace {
+				args = append(args, []byte("REPLACE"))
+			}
+			if _, err := c.callNode(addr, timeout, message.NewRequest(restoreAskingCmd, args)); err != nil {
+				return getResponseCommandError(request.Cmd, fmt.Errorf("target instance replied with error: %s", err))
+			}
+
+			if !isCopy {
+				process(message.NewRequest("DEL", [][]byte{[]byte(key)}))
+			}
+			migrated++
+		}
+
+		if migrated == 0 {
+			return message.NewResponseStatus(message.StatusOk, "NOKEY")
+		}
+
+		return getResponseStatusOkPayload()
+	})
+}
+
+// callNode sends the request to another node of the cluster and returns the payload of its reply.
+// Nodes of the cluster must serve the same API, so the node uses its own protocol
+func (c *Controller) callNode(addr string, timeout time.Duration, request *message.Request) ([]byte, error) {
+	if c.useHttp {
+		return callNodeHttp(addr, timeout, request)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "*%d\r\n$%d\r\n%s\r\n", len(request.Args)+1, len(request.Cmd), request.Cmd)
+	for _, arg := range request.Args {
+		fmt.Fprintf(w, "$%d\r\n", len(arg))
+		w.Write(arg)
+		w.WriteString("\r\n")
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return readNodeReply(bufio.NewReader(conn))
+}
+
+// readNodeReply reads simple string, error, integer or bulk string RESP reply
+func readNodeReply(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, ErrNodeReply
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, errors.New(line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, ErrNodeReply
+		}
+		if size < 0 {
+			return nil, nil
+		}
+
+		bulk := make([]byte, size+2)
+		if _, err := io.ReadFull(r, bulk); err != nil {
+			return nil, err
+		}
+		return bulk[:size], nil
+	default:
+		return nil, ErrNodeReply
+	}
+}
+
+// callNodeHttp sends the request to the node serving HTTP API: the first argument is passed in URL,
+// the rest ones are posted as multipart body
+func callNodeHttp(addr string, timeout time.Duration, request *message.Request) ([]byte, error) {
+	var firstArg string
+	if len(request.Args) > 0 {
+		firstArg = url.PathEscape(string(request.Args[0]))
+	}
+	requestUrl := "http://" + addr + "/" + url.PathEscape(request.Cmd) + "/" + firstArg
+
+	method, contentType, body := http.MethodGet, "", &bytes.Buffer{}
+	if len(request.Args) > 1 {
+		writer := multipart.NewWriter(body)
+		for _, arg := range request.Args[1:] {
+			part, err := writer.CreateFormField("arg")
+			if err != nil {
+				return nil, err
+			}
+			part.Write(arg)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		method, contentType = http.MethodPost, writer.FormDataContentType()
+	}
+
+	httpRequest, err := http.NewRequest(method, requestUrl, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		httpRequest.Header.Set("Content-Type", contentType)
+	}
+
+	client := http.Client{Timeout: timeout}
+	response, err := client.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	payload, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New(string(payload))
+	}
+
+	return payload, nil
+}
+
+// parseSlots parses slot numbers
+func parseSlots(args []string) (slots []int, err error) {
+	slots = make([]int, len(args))
+	for i, arg := range args {
+		if slots[i], err = strconv.Atoi(arg); err != nil || slots[i] < 0 || slots[i] >= cluster.SlotsCount {
+			return nil, cluster.ErrInvalidSlot
+		}
+	}
+
+	return slots, nil
+}
+
+// parseSlotRanges parses pairs of start and end slots into the list of slots
+func parseSlotRanges(args []string) (slots []int, err error) {
+	bounds, err := parseSlots(args)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(bounds); i += 2 {
+		if bounds[i] > bounds[i+1] {
+			return nil, cluster.ErrInvalidSlot
+		}
+		for slot := bounds[i]; slot <= bounds[i+1]; slot++ {
+			slots = append(slots, slot)
+		}
+	}
+
+	return slots, nil
+}
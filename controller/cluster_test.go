@@ -0,0 +1,143 @@
+package controller_test
+
+import (
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/message"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestController_Cluster(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "radish_cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	a, portA := startServer(t, dataDir, (*controller.Controller).EnableCluster)
+	defer a.Shutdown()
+	b, portB := startServer(t, "", (*controller.Controller).EnableCluster)
+	defer b.Shutdown()
+
+	addrA, addrB := "127.0.0.1:"+strconv.Itoa(portA), "127.0.0.1:"+strconv.Itoa(portB)
+	idA := string(a.HandleMessage(newRequest("CLUSTER", "MYID")).Bytes()[0])
+	idB := string(b.HandleMessage(newRequest("CLUSTER", "MYID")).Bytes()[0])
+
+	// "bar" is in slot 5061 and "foo" is in slot 12182
+	tests := []struct {
+		node    *controller.Controller
+		asking  bool
+		request *message.Request
+		status  message.Status
+		want    string
+	}{
+		{a, false, newRequest("SET", "bar", "A"), message.StatusClusterError, "CLUSTERDOWN Hash slot not served"},
+		{a, false, newRequest("CLUSTER", "ADDSLOTSRANGE", "0", "8191"), message.StatusOk, ""},
+		{a, false, newRequest("CLUSTER", "ADDSLOTS", "8191"), message.StatusInvalidArguments, "slot is already busy"},
+		{b, false, newRequest("CLUSTER", "ADDSLOTSRANGE", "8192", "16383"), message.StatusOk, ""},
+		{a, false, newRequest("CLUSTER", "MEET", "127.0.0.1", strconv.Itoa(portB)), message.StatusOk, ""},
+		{b, false, newRequest("CLUSTER", "MEET", "127.0.0.1", strconv.Itoa(portA)), message.StatusOk, ""},
+		{a, false, newRequest("CLUSTER", "KEYSLOT", "foo"), message.StatusOk, "12182"},
+		{a, false, newRequest("SET", "bar", "A"), message.StatusOk, ""},
+		{a, false, newRequest("SET", "{bar}2", "A2"), message.StatusOk, ""},
+		{a, false, newRequest("SET", "foo", "A"), message.StatusRedirect, "MOVED 12182 " + addrB},
+		{b, false, newRequest("GET", "bar"), message.StatusRedirect, "MOVED 5061 " + addrA},
+		{a, false, newRequest("MGET", "foo", "bar"), message.StatusClusterError, "CROSSSLOT Keys in request don't hash to the same slot"},
+		{a, false, newRequest("MGET", "bar", "{bar}2"), message.StatusOk, "A"},
+		{a, false, newRequest("BLPOP", "foo", "bar", "1"), message.StatusClusterError, "CROSSSLOT Keys in request don't hash to the same slot"},
+		{a, false, newRequest("CLUSTER", "COUNTKEYSINSLOT", "5061"), message.StatusOk, "2"},
+		{a, false, newRequest("CLUSTER", "GETKEYSINSLOT", "5061", "1"), message.StatusOk, ""},
+		{a, false, newRequest("CLUSTER", "INFO"), message.StatusOk, "cluster_enabled:1\r\ncluster_state:ok\r\ncluster_slots_assigned:16384\r\ncluster_known_nodes:2\r\ncluster_size:2\r\n"},
+
+		// migration of slot 5061 from A to B
+		{a, false, newRequest("CLUSTER", "SETSLOT", "5061", "IMPORTING", idB), message.StatusInvalidArguments, "I'm already the owner of hash slot"},
+		{b, false, newRequest("CLUSTER", "SETSLOT", "5061", "IMPORTING", idA), message.StatusOk, ""},
+		{a, false, newRequest("CLUSTER", "SETSLOT", "5061", "MIGRATING", idB), message.StatusOk, ""},
+		{a, false, newRequest("GET", "{bar}new"), message.StatusRedirect, "ASK 5061 " + addrB},
+		{b, true, newRequest("GET", "bar"), message.StatusNotFound, ""},
+		{a, false, newRequest("MIGRATE", "127.0.0.1", strconv.Itoa(portB), "bar", "0", "1000"), message.StatusOk, ""},
+		{a, false, newRequest("MGET", "bar", "{bar}2"), message.StatusClusterError, "TRYAGAIN Multiple keys request during rehashing of slot"},
+		{a, false, newRequest("GET", "bar"), message.StatusRedirect, "ASK 5061 " + addrB},
+		{a, false, newRequest("GET", "{bar}2"), message.StatusOk, "A2"},
+		{b, false, newRequest("GET", "bar"), message.StatusRedirect, "MOVED 5061 " + addrA},
+		{b, true, newRequest("GET", "bar"), message.StatusOk, "A"},
+		{a, false, newRequest("MIGRATE", "127.0.0.1", strconv.Itoa(portB), "", "0", "1000", "KEYS", "bar", "{bar}2"), message.StatusOk, ""},
+		{a, false, newRequest("MIGRATE", "127.0.0.1", strconv.Itoa(portB), "bar", "0", "1000"), message.StatusOk, "NOKEY"},
+		{b, false, newRequest("CLUSTER", "SETSLOT", "5061", "NODE", idB), message.StatusOk, ""},
+		{a, false, newRequest("CLUSTER", "SETSLOT", "5061", "NODE", idB), message.StatusOk, ""},
+		{a, false, newRequest("GET", "{bar}2"), message.StatusRedirect, "MOVED 5061 " + addrB},
+		{b, false, newRequest("GET", "{bar}2"), message.StatusOk, "A2"},
+		{b, false, newRequest("CLUSTER", "COUNTKEYSINSLOT", "5061"), message.StatusOk, "2"},
+	}
+
+	for _, tst := range tests {
+		var response message.Response
+		if tst.asking {
+			response = tst.node.HandleAskingMessage(tst.request)
+		} else {
+			response = tst.node.HandleMessage(tst.request)
+		}
+
+		if response.Status() != tst.status {
+			t.Errorf("%s %q: status %s != %s: %s", tst.request.Cmd, tst.request.Args, response.Status(), tst.status, response)
+			continue
+		}
+		if tst.want == "" {
+			continue
+		}
+		if got := response.Bytes(); len(got) == 0 || string(got[0]) != tst.want {
+			t.Errorf("%s %q: %q != %q", tst.request.Cmd, tst.request.Args, got, tst.want)
+		}
+	}
+
+	// the configuration is restored from nodes.conf after restart
+	restarted := controller.New("127.0.0.1", portA, dataDir, controller.SyncNever, 0, 0, false)
+	if err := restarted.EnableCluster(); err != nil {
+		t.Fatalf("EnableCluster(): %s", err)
+	}
+	if got := string(restarted.HandleMessage(newRequest("CLUSTER", "MYID")).Bytes()[0]); got != idA {
+		t.Errorf("restarted CLUSTER MYID: %q != %q", got, idA)
+	}
+	if got := restarted.HandleMessage(newRequest("GET", "{bar}2")); got.Status() != message.StatusRedirect {
+		t.Errorf("restarted GET: %s", got)
+	}
+
+	disabled := controller.New("127.0.0.1", portA, "", controller.SyncNever, 0, 0, false)
+	if got := disabled.HandleMessage(newRequest("CLUSTER", "INFO")); got.Status() != message.StatusError {
+		t.Errorf("CLUSTER INFO with cluster disabled: %s", got)
+	}
+}
+
+func TestController_KeysInSlot(t *testing.T) {
+	c, _ := startServer(t, "", (*controller.Controller).EnableCluster)
+	defer c.Shutdown()
+
+	c.HandleMessage(newRequest("CLUSTER", "ADDSLOTSRANGE", "0", "16383"))
+	// the keys of the slot span several pages of the keyspace scan
+	const count = 2500
+	for i := 0; i < count; i++ {
+		c.HandleMessage(newRequest("SET", "{bar}"+strconv.Itoa(i), "value"))
+		c.HandleMessage(newRequest("SET", "{foo}"+strconv.Itoa(i), "value"))
+	}
+
+	if got := c.HandleMessage(newRequest("CLUSTER", "COUNTKEYSINSLOT", "5061")).Bytes(); string(got[0]) != strconv.Itoa(count) {
+		t.Errorf("COUNTKEYSINSLOT: %q != %d", got, count)
+	}
+
+	got := c.HandleMessage(newRequest("CLUSTER", "GETKEYSINSLOT", "5061", "1500")).Bytes()
+	keys := make(map[string]struct{}, len(got))
+	for _, key := range got {
+		keys[string(key)] = struct{}{}
+	}
+	if len(got) != 1500 || len(keys) != len(got) {
+		t.Errorf("GETKEYSINSLOT: %d keys, %d distinct", len(got), len(keys))
+	}
+	for key := range keys {
+		if !strings.HasPrefix(key, "{bar}") {
+			t.Errorf("GETKEYSINSLOT: %q isn't in the slot", key)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/core"
+	"github.com/mshaverdo/radish/message"
+	"github.com/ryanuber/go-glob"
+	"strconv"
+	"strings"
+)
+
+const (
+	configNotifyKeyspaceEvents = "notify-keyspace-events"
+	configMaxMemory            = "maxmemory"
+	configMaxMemoryPolicy      = "maxmemory-policy"
+)
+
+var ErrMemoryValue = errors.New("argument must be a memory value")
+
+// memoryUnits maps units of memory values to count of bytes, like in Redis config
+var memoryUnits = []struct {
+	unit  string
+	bytes int64
+}{
+	{"kb", 1024},
+	{"mb", 1024 * 1024},
+	{"gb", 1024 * 1024 * 1024},
+	{"k", 1000},
+	{"m", 1000 * 1000},
+	{"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// configParameter is a parameter, supported by CONFIG GET and CONFIG SET
+type configParameter struct {
+	name string
+	get  func() string
+	set  func(value string) error
+}
+
+// SetKeyspaceEvents sets classes of published keyspace notifications, flags are the same as in Redis
+// notify-keyspace-events parameter, see core.ParseEventClasses(). Empty flags disable notifications
+func (c *Controller) SetKeyspaceEvents(flags string) error {
+	classes, err := core.ParseEventClasses(flags)
+	if err != nil {
+		return err
+	}
+
+	c.core.SetKeyspaceEvents(classes)
+
+	return nil
+}
+
+// SetMaxMemory sets maximum memory, used by the storage. The value is count of bytes,
+// optionally followed by unit, like in Redis maxmemory parameter: 100mb, 1gb, etc. Zero means no limit
+func (c *Controller) SetMaxMemory(value string) error {
+	bytes, err := parseMemory(value)
+	if err != nil {
+		return err
+	}
+
+	c.core.SetMaxMemory(bytes)
+
+	return nil
+}
+
+// SetEvictionPolicy sets policy of eviction keys, when used memory reaches maxmemory:
+// noeviction, allkeys-lru, allkeys-lfu, volatile-lru or volatile-ttl
+func (c *Controller) SetEvictionPolicy(name string) error {
+	policy, err := core.ParseEvictionPolicy(name)
+	if err != nil {
+		return err
+	}
+
+	c.core.SetEvictionPolicy(policy)
+
+	return nil
+}
+
+// configParameters returns parameters, supported by CONFIG GET and CONFIG SET
+func (c *Controller) configParameters() []configParameter {
+	return []configParameter{
+		{
+			name: configNotifyKeyspaceEvents,
+			get:  func() string { return c.core.KeyspaceEvents().String() },
+			set:  c.SetKeyspaceEvents,
+		},
+		{
+			name: configMaxMemory,
+			get:  func() string { return strconv.FormatInt(c.core.MaxMemory(), 10) },
+			set:  c.SetMaxMemory,
+		},
+		{
+			name: configMaxMemoryPolicy,
+			get:  func() string { return c.core.EvictionPolicy().String() },
+			set:  c.SetEvictionPolicy,
+		},
+	}
+}
+
+// isConfigRequest returns true, if request should be handled by processConfigRequest()
+func isConfigRequest(request *message.Request) bool {
+	return request.Cmd == "CONFIG"
+}
+
+// processConfigRequest handles CONFIG GET parameter and CONFIG SET parameter value.
+// Supported parameters are listed by configParameters(). The configuration isn't persisted, so it never reaches the WAL
+func (c *Controller) processConfigRequest(request *message.Request) message.Response {
+	argsLen := request.ArgumentsLen()
+	if argsLen == 0 {
+		return getResponseInvalidArguments(request.Cmd, errors.New("wrong number of arguments"))
+	}
+
+	switch subcommand := strings.ToUpper(string(request.Args[0])); {
+	case subcommand == "GET" && argsLen == 2:
+		// reply is flat list of matched parameters, each one followed by its value
+		result := [][]byte{}
+		pattern := strings.ToLower(string(request.Args[1]))
+		for _, parameter := range c.configParameters() {
+			if glob.Glob(pattern, parameter.name) {
+				result = append(result, []byte(parameter.name), []byte(parameter.get()))
+			}
+		}
+
+		return getResponseStringSlicePayload(result)
+	case subcommand == "SET" && argsLen == 3:
+		name := strings.ToLower(string(request.Args[1]))
+		for _, parameter := range c.configParameters() {
+			if parameter.name != name {
+				continue
+			}
+
+			if err := parameter.set(string(request.Args[2])); err != nil {
+				return getResponseInvalidArguments(request.Cmd, err)
+			}
+
+			return getResponseStatusOkPayload()
+		}
+
+		return getResponseInvalidArguments(request.Cmd, errors.New("unsupported parameter '"+name+"'"))
+	default:
+		return getResponseInvalidArguments(request.Cmd, errors.New("unknown subcommand or wrong number of arguments for '"+subcommand+"'"))
+	}
+}
+
+// parseMemory parses memory value: count of bytes, optionally followed by unit, like 100mb
+func parseMemory(value string) (bytes int64, err error) {
+	value = strings.ToLower(value)
+	multiplier := int64(1)
+	for _, v := range memoryUnits {
+		if strings.HasSuffix(value, v.unit) {
+			value, multiplier = strings.TrimSuffix(value, v.unit), v.bytes
+			break
+		}
+	}
+
+	bytes, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || bytes < 0 {
+		return 0, ErrMemoryValue
+	}
+
+	return bytes * multiplier, nil
+}
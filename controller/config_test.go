@@ -0,0 +1,81 @@
+package controller_test
+
+import (
+	"github.com/go-test/deep"
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/message"
+	"testing"
+)
+
+func TestController_MaxMemory(t *testing.T) {
+	c := controller.New("", 0, "", 0, 0, 0, false)
+
+	tests := []struct {
+		request    *message.Request
+		wantStatus message.Status
+		want       []string
+	}{
+		{newRequest("CONFIG", "GET", "maxmemory*"), message.StatusOk, []string{"maxmemory", "0", "maxmemory-policy", "noeviction"}},
+		{newRequest("CONFIG", "SET", "maxmemory", "1kb"), message.StatusOk, nil},
+		{newRequest("CONFIG", "GET", "maxmemory"), message.StatusOk, []string{"maxmemory", "1024"}},
+		{newRequest("CONFIG", "SET", "maxmemory", "1tb"), message.StatusInvalidArguments, nil},
+		{newRequest("CONFIG", "SET", "maxmemory", "-1"), message.StatusInvalidArguments, nil},
+		{newRequest("CONFIG", "SET", "maxmemory-policy", "volatile-random"), message.StatusInvalidArguments, nil},
+		{newRequest("SET", "a", "value"), message.StatusOk, nil},
+		{newRequest("SET", "b", "value"), message.StatusOk, nil},
+		{newRequest("CONFIG", "SET", "maxmemory", "1"), message.StatusOk, nil},
+		{newRequest("SET", "c", "value"), message.StatusOutOfMemory, nil},
+		{newRequest("EVAL", "return redis.call('SET', KEYS[1], 'value')", "1", "c"), message.StatusScriptError, nil},
+		{newRequest("GET", "a"), message.StatusOk, []string{"value"}},
+		{newRequest("DEL", "a"), message.StatusOk, []string{"1"}},
+		{newRequest("CONFIG", "SET", "maxmemory-policy", "ALLKEYS-LRU"), message.StatusOk, nil},
+		{newRequest("CONFIG", "GET", "maxmemory-policy"), message.StatusOk, []string{"maxmemory-policy", "allkeys-lru"}},
+		{newRequest("SET", "c", "value"), message.StatusOk, nil},
+		{newRequest("KEYS", "*"), message.StatusOk, []string{"c"}},
+	}
+
+	for _, tst := range tests {
+		response := c.HandleMessage(tst.request)
+		if response.Status() != tst.wantStatus {
+			t.Errorf("%s %q: status %s != %s", tst.request.Cmd, tst.request.Args, response.Status(), tst.wantStatus)
+		}
+
+		if tst.want == nil {
+			continue
+		}
+
+		got := make([]string, len(response.Bytes()))
+		for i, v := range response.Bytes() {
+			got[i] = string(v)
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("%s %q: %s\n\ngot:%v\n\nwant:%v", tst.request.Cmd, tst.request.Args, diff, got, tst.want)
+		}
+	}
+}
+
+func TestSetStorageEngine(t *testing.T) {
+	defer func() { controller.StorageEngine = controller.StorageEngineHash }()
+
+	if err := controller.SetStorageEngine("skiplist"); err != controller.ErrStorageEngine {
+		t.Errorf("SetStorageEngine(skiplist): %v != %v", err, controller.ErrStorageEngine)
+	}
+	if err := controller.SetStorageEngine("BTree"); err != nil || controller.StorageEngine != controller.StorageEngineBTree {
+		t.Fatalf("SetStorageEngine(BTree): %v, engine %q", err, controller.StorageEngine)
+	}
+
+	c := controller.New("", 0, "", 0, 0, 0, false)
+	for _, key := range []string{"c", "a", "b"} {
+		c.HandleMessage(newRequest("SET", key, "value"))
+	}
+
+	// b-tree keeps keys in lexicographic order
+	response := c.HandleMessage(newRequest("KEYS", "*"))
+	var got []string
+	for _, v := range response.Bytes() {
+		got = append(got, string(v))
+	}
+	if diff := deep.Equal(got, []string{"a", "b", "c"}); diff != nil {
+		t.Errorf("KEYS *: %s\n\ngot:%v", diff, got)
+	}
+}
@@ -2,16 +2,39 @@ package controller
 
 import (
 	"errors"
+	"github.com/OneOfOne/xxhash"
 	"github.com/mshaverdo/radish/api"
 	"github.com/mshaverdo/radish/api/resp"
 	"github.com/mshaverdo/radish/api/restless"
+	"github.com/mshaverdo/radish/cluster"
 	"github.com/mshaverdo/radish/core"
 	"github.com/mshaverdo/radish/log"
 	"github.com/mshaverdo/radish/message"
+	"github.com/mshaverdo/radish/pubsub"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
+// configuration
+var (
+	// StorageEngine is the engine of storages, created by the controller: StorageEngineHash or StorageEngineBTree
+	StorageEngine = StorageEngineHash
+)
+
+const (
+	// StorageEngineHash is the sharded hashmap, the fastest engine
+	StorageEngineHash = "hash"
+	// StorageEngineBTree is the b-tree, which keeps keys in lexicographic order, see core.OrderedStorage
+	StorageEngineBTree = "btree"
+
+	// keyMutexesCount is count of mutexes, keys of modifying requests are mapped to, see lockKeys()
+	keyMutexesCount = 1024
+)
+
+var ErrStorageEngine = errors.New("invalid storage engine")
+
 // ApiServer represents Radish API endpoint interface
 type ApiServer interface {
 	// ListenAndServe starts the server
@@ -39,7 +62,7 @@ type Core interface {
 	Get(key string) (result []byte, err error)
 
 	// Set key to hold the string value.
-	Set(key string, value []byte)
+	Set(key string, value []byte, options ...string) (result interface{}, err error)
 
 	// Set key to hold the string value and set key to timeout after a given number of seconds.
 	SetEx(key string, seconds int, value []byte)
@@ -47,8 +70,8 @@ type Core interface {
 	// Del Removes the specified keys, ignoring not existing and returns count of actually removed values.
 	Del(keys []string) (count int)
 
-	// DSet Sets field in the hash stored at key to value.
-	DSet(key, field string, value []byte) (count int, err error)
+	// DSet Sets fields in the hash stored at key to their respective values.
+	DSet(key string, fieldsValues [][]byte) (count int, err error)
 
 	// DGet Returns the value associated with field in the dict stored at key.
 	DGet(key, field string) (result []byte, err error)
@@ -62,6 +85,42 @@ type Core interface {
 	// DDel Removes the specified fields from the hash stored at key.
 	DDel(key string, fields []string) (count int, err error)
 
+	// DMGet Returns the values associated with the specified fields in the dict stored at key.
+	DMGet(key string, fields []string) (result [][]byte, err error)
+
+	// DExists Returns 1 if field is an existing field in the dict stored at key, 0 otherwise.
+	DExists(key, field string) (result int, err error)
+
+	// DLen Returns the number of fields contained in the dict stored at key.
+	DLen(key string) (count int, err error)
+
+	// DVals Returns all values in the dict stored at key.
+	DVals(key string) (result [][]byte, err error)
+
+	// DStrLen Returns the string length of the value associated with field in the dict stored at key.
+	DStrLen(key, field string) (length int, err error)
+
+	// DSetNX Sets field in the dict stored at key to value, only if field does not yet exist.
+	DSetNX(key, field string, value []byte) (result int, err error)
+
+	// DRandField Returns random fields from the dict stored at key.
+	DRandField(key string, options ...string) (result interface{}, err error)
+
+	// DExpire Sets TTL in seconds of the specified fields of the dict stored at key.
+	DExpire(key string, seconds int, options ...string) (result []int, err error)
+
+	// DPExpire Sets TTL in milliseconds of the specified fields of the dict stored at key.
+	DPExpire(key string, milliseconds int, options ...string) (result []int, err error)
+
+	// DPExpireAt Sets absolute Unix time in milliseconds, at which the specified fields of the dict stored at key will expire.
+	DPExpireAt(key string, timestamp int, options ...string) (result []int, err error)
+
+	// DTtl Returns the remaining TTL in seconds of the specified fields of the dict stored at key.
+	DTtl(key string, options ...string) (result []int, err error)
+
+	// DPersist Removes TTL of the specified fields of the dict stored at key.
+	DPersist(key string, options ...string) (result []int, err error)
+
 	// LLen Returns the length of the list stored at key.
 	LLen(key string) (count int, err error)
 
@@ -80,6 +139,27 @@ type Core interface {
 	// LPop Removes and returns the first element of the list stored at key.
 	LPop(key string) (result []byte, err error)
 
+	// RPush Insert all the specified values at the tail of the list stored at key.
+	RPush(key string, values [][]byte) (count int, err error)
+
+	// RPop Removes and returns the last element of the list stored at key.
+	RPop(key string) (result []byte, err error)
+
+	// LInsert Inserts value in the list stored at key either before or after the reference value pivot.
+	LInsert(key, where, pivot string, value []byte) (count int, err error)
+
+	// LRem Removes the first count occurrences of elements equal to value from the list stored at key.
+	LRem(key string, count int, value []byte) (removed int, err error)
+
+	// LTrim Trim an existing list so that it will contain only the specified range of elements specified.
+	LTrim(key string, start, stop int) (err error)
+
+	// RPopLPush Atomically moves the last element of the list stored at source to the head of destination.
+	RPopLPush(source, destination string) (result []byte, err error)
+
+	// LMove Atomically moves the first/last element of the list stored at source to the head/tail of destination.
+	LMove(source, destination, whereFrom, whereTo string) (result []byte, err error)
+
 	// Ttl Returns the remaining time to live of a key that has a timeout.
 	Ttl(key string) (ttl int, err error)
 
@@ -89,11 +169,230 @@ type Core interface {
 	// Persist Removes the existing timeout on key.
 	Persist(key string) (result int)
 
+	// PTtl Returns the remaining time to live of a key that has a timeout in milliseconds.
+	PTtl(key string) (ttl int, err error)
+
+	// ExpireTime Returns the absolute Unix timestamp in seconds at which the given key will expire.
+	ExpireTime(key string) (timestamp int, err error)
+
+	// PExpire Sets a timeout on key in milliseconds.
+	PExpire(key string, milliseconds int) (result int)
+
+	// ExpireAt Sets an absolute Unix timestamp in seconds, at which the key will expire.
+	ExpireAt(key string, timestamp int) (result int)
+
+	// PExpireAt Sets an absolute Unix timestamp in milliseconds, at which the key will expire.
+	PExpireAt(key string, timestamp int) (result int)
+
+	// PSetEx Set key to hold the string value and set key to timeout after a given number of milliseconds.
+	PSetEx(key string, milliseconds int, value []byte) (err error)
+
+	// SAdd Adds the specified members to the set stored at key.
+	SAdd(key string, members []string) (count int, err error)
+
+	// SRem Removes the specified members from the set stored at key.
+	SRem(key string, members []string) (count int, err error)
+
+	// SMembers Returns all the members of the set value stored at key.
+	SMembers(key string) (result []string, err error)
+
+	// SIsMember Returns 1 if member is a member of the set stored at key, 0 otherwise
+	SIsMember(key, member string) (result int, err error)
+
+	// SCard Returns the set cardinality (number of elements) of the set stored at key.
+	SCard(key string) (count int, err error)
+
+	// SPop Removes and returns a random member from the set value stored at key.
+	SPop(key string) (result []byte, err error)
+
+	// SRandMember Returns a random member from the set value stored at key.
+	SRandMember(key string) (result []byte, err error)
+
+	// SInter Returns the members of the set resulting from the intersection of all the given sets.
+	SInter(keys []string) (result []string, err error)
+
+	// SUnion Returns the members of the set resulting from the union of all the given sets.
+	SUnion(keys []string) (result []string, err error)
+
+	// SDiff Returns the members of the set resulting from the difference between the first set and all the successive sets.
+	SDiff(keys []string) (result []string, err error)
+
+	// SInterStore This command is equal to SINTER, but the resulting set is stored in destination.
+	SInterStore(destination string, keys []string) (count int, err error)
+
+	// SUnionStore This command is equal to SUNION, but the resulting set is stored in destination.
+	SUnionStore(destination string, keys []string) (count int, err error)
+
+	// SDiffStore This command is equal to SDIFF, but the resulting set is stored in destination.
+	SDiffStore(destination string, keys []string) (count int, err error)
+
+	// ZAdd Adds all the specified members with the specified scores to the sorted set stored at key.
+	ZAdd(key string, args []string) (result interface{}, err error)
+
+	// ZIncrBy Increments the score of member in the sorted set stored at key by increment.
+	ZIncrBy(key string, increment float64, member string) (score float64, err error)
+
+	// ZRem Removes the specified members from the sorted set stored at key.
+	ZRem(key string, members []string) (count int, err error)
+
+	// ZScore Returns the score of member in the sorted set at key.
+	ZScore(key, member string) (score float64, err error)
+
+	// ZCard Returns the sorted set cardinality (number of elements) of the sorted set stored at key.
+	ZCard(key string) (count int, err error)
+
+	// ZRank Returns the rank of member in the sorted set stored at key, with the scores ordered from low to high.
+	ZRank(key, member string) (rank int, err error)
+
+	// ZCount Returns the number of elements in the sorted set at key with a score between min and max.
+	ZCount(key, min, max string) (count int, err error)
+
+	// ZRange Returns the specified range of elements in the sorted set stored at key.
+	ZRange(key string, args []string) (result [][]byte, err error)
+
+	// ZRevRange Returns the specified range of elements in the sorted set stored at key in reverse order.
+	ZRevRange(key string, args []string) (result [][]byte, err error)
+
+	// ZRangeByScore Returns all the elements in the sorted set at key with a score between min and max.
+	ZRangeByScore(key string, args []string) (result [][]byte, err error)
+
+	// ZPopMin Removes and returns the member with the lowest score in the sorted set stored at key.
+	ZPopMin(key string) (result [][]byte, err error)
+
+	// ZPopMax Removes and returns the member with the highest score in the sorted set stored at key.
+	ZPopMax(key string) (result [][]byte, err error)
+
+	// Incr Increments the number stored at key by one.
+	Incr(key string) (result int, err error)
+
+	// Decr Decrements the number stored at key by one.
+	Decr(key string) (result int, err error)
+
+	// IncrBy Increments the number stored at key by increment.
+	IncrBy(key string, increment int) (result int, err error)
+
+	// DecrBy Decrements the number stored at key by decrement.
+	DecrBy(key string, decrement int) (result int, err error)
+
+	// IncrByFloat Increment the string representing a floating point number stored at key by the specified increment.
+	IncrByFloat(key string, increment float64) (result float64, err error)
+
+	// DIncrBy Increments the number stored at field in the dict stored at key by increment.
+	DIncrBy(key, field string, increment int) (result int, err error)
+
+	// DIncrByFloat Increment the specified field of a dict stored at key by the specified float increment.
+	DIncrByFloat(key, field string, increment float64) (result float64, err error)
+
+	// Append If key already exists and is a string, this command appends the value at the end of the string.
+	Append(key string, value []byte) (count int, err error)
+
+	// StrLen Returns the length of the string value stored at key.
+	StrLen(key string) (count int, err error)
+
+	// GetRange Returns the substring of the string value stored at key, determined by the offsets start and end.
+	GetRange(key string, start, end int) (result []byte, err error)
+
+	// SetRange Overwrites part of the string stored at key, starting at the specified offset, for the entire length of value.
+	SetRange(key string, offset int, value []byte) (count int, err error)
+
+	// GetSet Atomically sets key to value and returns the old value stored at key.
+	GetSet(key string, value []byte) (result []byte, err error)
+
+	// GetDel Get the value of key and delete the key.
+	GetDel(key string) (result []byte, err error)
+
+	// MGet Returns the values of all specified keys.
+	MGet(keys []string) (result [][]byte, err error)
+
+	// MSet Sets the given keys to their respective values.
+	MSet(pairs [][]byte) (err error)
+
+	// MSetNX Sets the given keys to their respective values, only if none of the keys exist.
+	MSetNX(pairs [][]byte) (result int, err error)
+
+	// SetNX Set key to hold string value if key does not exist.
+	SetNX(key string, value []byte) (result int, err error)
+
+	// Scan Incrementally iterates over the keyspace.
+	Scan(cursor int, options ...string) (result core.ScanResult, err error)
+
+	// DScan Incrementally iterates over fields and values of the dict stored at key.
+	DScan(key string, cursor int, options ...string) (result core.ScanResult, err error)
+
+	// SScan Incrementally iterates over members of the set stored at key.
+	SScan(key string, cursor int, options ...string) (result core.ScanResult, err error)
+
+	// ZScan Incrementally iterates over members and scores of the sorted set stored at key.
+	ZScan(key string, cursor int, options ...string) (result core.ScanResult, err error)
+
+	// Exists Returns the number of keys existing among the ones specified as arguments.
+	Exists(keys []string) (count int)
+
+	// Type Returns the string representation of the type of the value stored at key.
+	Type(key string) (result string)
+
+	// Rename Renames key to newkey atomically.
+	Rename(key, newKey string) (err error)
+
+	// RenameNX Renames key to newkey if newkey does not yet exist.
+	RenameNX(key, newKey string) (result int, err error)
+
+	// RandomKey Return a random key from the currently selected database.
+	RandomKey() (result string, err error)
+
+	// DbSize Return the number of keys in the database.
+	DbSize() (count int)
+
+	// Touch Alters the last access time of a key(s).
+	Touch(keys []string) (count int)
+
+	// Unlink Removes the specified keys, reclaiming memory in the background.
+	Unlink(keys []string) (count int)
+
+	// Dump Serialize the value stored at key and return it to the user.
+	Dump(key string) (result []byte, err error)
+
+	// Restore Create a key associated with a value that is obtained by deserializing the value, obtained via DUMP.
+	Restore(key string, ttl int, data []byte, options ...string) (err error)
+
+	// Versions returns versions of the items stored at keys, zero for not existing keys.
+	Versions(keys []string) (versions []uint64)
+
+	// WaitPush registers waiter for pushes into the lists stored at keys.
+	WaitPush(keys []string) (pushed <-chan struct{}, release func())
+
 	// Storage returns reference to underlying storage to persisting
 	Storage() core.Storage
 
 	// SetStorage sets storage after loading
 	SetStorage(core.Storage)
+
+	// SetPublisher sets publisher, used to deliver keyspace notifications
+	SetPublisher(publish core.Publisher)
+
+	// SetKeyspaceEvents sets classes of emitted keyspace notifications
+	SetKeyspaceEvents(classes core.EventClass)
+
+	// KeyspaceEvents returns classes of emitted keyspace notifications
+	KeyspaceEvents() core.EventClass
+
+	// SetMaxMemory sets maximum memory in bytes, used by the storage. Zero means no limit
+	SetMaxMemory(bytes int64)
+
+	// MaxMemory returns maximum memory in bytes, used by the storage
+	MaxMemory() (bytes int64)
+
+	// SetEvictionPolicy sets policy of eviction keys, when used memory reaches maxmemory
+	SetEvictionPolicy(policy core.EvictionPolicy)
+
+	// EvictionPolicy returns policy of eviction keys, when used memory reaches maxmemory
+	EvictionPolicy() core.EvictionPolicy
+
+	// UsedMemory returns approximate count of bytes, used by keys and items of the storage
+	UsedMemory() (bytes int64)
+
+	// FreeMemory evicts keys according to the eviction policy, until used memory fits maxmemory
+	FreeMemory(evict core.EvictFunc) (evicted []string, err error)
 }
 
 var _ Core = (*core.Core)(nil)
@@ -109,24 +408,50 @@ type Controller struct {
 	port                   int
 	dataDir                string
 	isPersistent           bool //if true, persists data on disk
+	useHttp                bool
 	collectExpiredInterval time.Duration
 
 	srv       ApiServer
 	core      Core
 	keeper    *Keeper
 	processor *Processor
+	scripts   *scriptCache
+	broker    *pubsub.Broker
 
 	// wg to wait for service storage-updating goroutines (CollectExpired(), etc)
 	serviceWg sync.WaitGroup
 	// wg to wait for request handlers
 	handlerWg sync.WaitGroup
 
+	// transactions are executed under the write lock, while other requests are processed under the read lock,
+	// so nothing interleaves with a transaction
+	txMutex sync.RWMutex
+
+	// keyMutexes serialize modifying requests to the same keys, so they are written into WAL
+	// in the same order as they're applied to the storage
+	keyMutexes [keyMutexesCount]sync.Mutex
+
+	// backlog keeps the latest WAL records for replicas, it's created by the first replica and guarded by txMutex
+	backlog *replicationBacklog
+
+	replicaMutex  sync.Mutex
+	replica       *replica
+	isReplicaFlag int32 // accessed atomically, 1 if the server is a read-only replica
+
+	// cluster is the configuration of the cluster, it's nil unless cluster mode is enabled by EnableCluster()
+	cluster          *cluster.Cluster
+	clusterFileMutex sync.Mutex
+
 	isRunningMutex sync.Mutex
 	isRunningFlag  bool
 	stopChan       chan struct{}
 }
 
 var _ api.MessageHandler = (*Controller)(nil)
+var _ api.TransactionHandler = (*Controller)(nil)
+var _ api.PubSubHandler = (*Controller)(nil)
+var _ api.ReplicationHandler = (*Controller)(nil)
+var _ api.ClusterHandler = (*Controller)(nil)
 
 // New Constructs new instance of Controller
 func New(
@@ -145,6 +470,9 @@ func New(
 		collectExpiredInterval: collectInterval,
 		dataDir:                dataDir,
 		isPersistent:           dataDir != "",
+		useHttp:                useHttp,
+		scripts:                newScriptCache(),
+		broker:                 pubsub.NewBroker(),
 	}
 
 	if useHttp {
@@ -155,6 +483,11 @@ func New(
 
 	c.processor = NewProcessor(c.core)
 
+	// keyspace notifications are delivered to subscribers like PUBLISHed messages
+	c.core.SetPublisher(func(channel string, message []byte) {
+		c.broker.Publish(channel, message)
+	})
+
 	if c.isPersistent {
 		c.keeper = NewKeeper(
 			c.core,
@@ -177,6 +510,7 @@ func (c *Controller) ListenAndServe() error {
 	}
 
 	c.start()
+	c.startReplica()
 
 	// Don't forget to add all background service processes to wg!
 	c.serviceWg.Add(1)
@@ -200,6 +534,7 @@ func (c *Controller) Shutdown() {
 	//wait other goroutines that may interact with storage
 	c.serviceWg.Wait()
 	c.handlerWg.Wait()
+	c.stopReplica()
 
 	//OK, no more concurrent threads working with storage
 	if c.isPersistent {
@@ -214,6 +549,11 @@ func (c *Controller) Shutdown() {
 
 // HandleMessage processes Request and return Response
 func (c *Controller) HandleMessage(request *message.Request) message.Response {
+	return c.handleMessage(request, false)
+}
+
+// handleMessage processes Request. If asking is true, keys of the slot, importing from another node, are served
+func (c *Controller) handleMessage(request *message.Request, asking bool) message.Response {
 	select {
 	case <-c.stopChan:
 		return getResponseCommandError(request.Cmd, ErrServerShutdown)
@@ -224,19 +564,143 @@ func (c *Controller) HandleMessage(request *message.Request) message.Response {
 	// It's OK to do wg.Add() inside a goroutine, due to c.stop() invoked BEFORE c.handlerWg.Wait()
 	c.handlerWg.Add(1)
 
+	if request.Cmd == restoreAskingCmd {
+		restoreRequest := *request
+		restoreRequest.Cmd = "RESTORE"
+		request, asking = &restoreRequest, true
+	}
+
+	var response message.Response
+	switch {
+	case isBlockingRequest(request):
+		response = c.processBlockingRequest(request)
+	case isScriptRequest(request):
+		response = c.processScriptRequest(request)
+	case isPubSubRequest(request):
+		response = c.processPubSubRequest(request)
+	case isConfigRequest(request):
+		response = c.processConfigRequest(request)
+	case isReplicationRequest(request):
+		response = c.processReplicationRequest(request)
+	case isClusterRequest(request):
+		response = c.processClusterRequest(request)
+	default:
+		response = c.processRequest(request, asking)
+	}
+
+	c.handlerWg.Done()
+	return response
+}
+
+// processRequest processes Request by core and writes it into WAL, if it modifies the storage.
+// In cluster mode, request for keys of another node is redirected, unless asking is true and the slot is importing
+func (c *Controller) processRequest(request *message.Request, asking bool) message.Response {
+	if c.isReadOnlyRequest(request) {
+		return getResponseCommandError(request.Cmd, ErrReadOnly)
+	}
+
+	c.txMutex.RLock()
+	defer c.txMutex.RUnlock()
+
+	keys := c.processor.Keys(request)
+	if response := c.routeRequest(keys, asking); response != nil {
+		return response
+	}
+	if response := c.freeMemory(request); response != nil {
+		return response
+	}
+
+	if c.isPersistent && c.processor.IsModifyingRequest(request) {
+		defer c.lockKeys(keys)()
+	}
+
 	response := c.processor.Process(request)
 
-	if c.isPersistent && response.Status() == message.StatusOk && c.processor.IsModifyingRequest(request) {
-		if err := c.keeper.WriteToWal(request); err != nil {
-			c.handlerWg.Done()
+	if c.isPersistent && c.isWalRequest(request, response) {
+		if err := c.keeper.WriteToWal(c.processor.WalRequest(request, response)); err != nil {
 			return getResponseCommandError(request.Cmd, err)
 		}
 	}
 
-	c.handlerWg.Done()
 	return response
 }
 
+// lockKeys locks mutexes of the keys in order of their indexes, so concurrent requests can't deadlock,
+// and returns function to unlock them
+func (c *Controller) lockKeys(keys []string) (unlock func()) {
+	indexes := make([]int, len(keys))
+	for i, key := range keys {
+		indexes[i] = int(xxhash.ChecksumString64(key) % keyMutexesCount)
+	}
+	sort.Ints(indexes)
+
+	var locked []int
+	for _, index := range indexes {
+		if len(locked) > 0 && locked[len(locked)-1] == index {
+			continue
+		}
+		c.keyMutexes[index].Lock()
+		locked = append(locked, index)
+	}
+
+	return func() {
+		for _, index := range locked {
+			c.keyMutexes[index].Unlock()
+		}
+	}
+}
+
+// isWalRequest returns true, if request modified the storage and should be written into WAL
+func (c *Controller) isWalRequest(request *message.Request, response message.Response) bool {
+	switch response.Status() {
+	case message.StatusOk:
+		return c.processor.IsModifyingRequest(request)
+	case message.StatusNotFound:
+		// NotFound is a successful response of a few commands: e.g. GETSET on not existing key sets the value and responds nil
+		return c.processor.IsModifyingNotFoundRequest(request)
+	default:
+		return false
+	}
+}
+
+// freeMemory evicts keys before the modifying request, if used memory exceeds maxmemory, see core.FreeMemory().
+// Evicted keys are written into WAL as DEL, so they are evicted on replicas and after restart too.
+// The key is locked, while it's evicted and written into WAL, like it's modified by a request, see lockKeys().
+// Returns OOM error response, if the memory can't be freed and the request may increase memory usage.
+// Requests, which only remove data, like DEL, are never rejected
+func (c *Controller) freeMemory(request *message.Request) message.Response {
+	if !c.processor.IsModifyingRequest(request) {
+		return nil
+	}
+
+	var evict core.EvictFunc
+	var walErr error
+	if c.isPersistent {
+		evict = func(key string, del func() bool) {
+			defer c.lockKeys([]string{key})()
+			if del() {
+				if err := c.keeper.WriteToWal(message.NewRequest("DEL", [][]byte{[]byte(key)})); err != nil && walErr == nil {
+					walErr = err
+				}
+			}
+		}
+	}
+
+	evicted, err := c.core.FreeMemory(evict)
+	if len(evicted) > 0 {
+		log.Debugf("Evicted %d items", len(evicted))
+	}
+	if walErr != nil {
+		return getResponseCommandError(request.Cmd, walErr)
+	}
+
+	if err != nil && c.processor.IsDenyOomRequest(request) {
+		return getResponseCommandError(request.Cmd, err)
+	}
+
+	return nil
+}
+
 func (c *Controller) runCollector() {
 	defer c.serviceWg.Done()
 
@@ -246,7 +710,10 @@ func (c *Controller) runCollector() {
 		case <-c.stopChan:
 			return
 		case <-tick:
+			// replica replaces the storage on full synchronization under the write lock
+			c.txMutex.RLock()
 			count := c.core.CollectExpired()
+			c.txMutex.RUnlock()
 			log.Debugf("Collected %d expired items", count)
 		}
 	}
@@ -271,6 +738,22 @@ func (c *Controller) isRunning() bool {
 	return c.isRunningFlag
 }
 
+// SetStorageEngine sets StorageEngine by name: hash or btree. It should be called before the controller is created
+func SetStorageEngine(name string) error {
+	switch name = strings.ToLower(name); name {
+	case StorageEngineHash, StorageEngineBTree:
+		StorageEngine = name
+		return nil
+	default:
+		return ErrStorageEngine
+	}
+}
+
+// storageFactory creates new empty storage of StorageEngine
 func storageFactory() core.Storage {
+	if StorageEngine == StorageEngineBTree {
+		return core.NewStorageBTree()
+	}
+
 	return core.NewStorageHash()
 }
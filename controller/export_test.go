@@ -0,0 +1,6 @@
+package controller
+
+var (
+	NewWalTransaction   = newWalTransaction
+	SplitWalTransaction = splitWalTransaction
+)
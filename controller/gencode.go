@@ -2,9 +2,11 @@ package controller
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"github.com/mshaverdo/assert"
+	"hash/crc32"
 	"io"
 )
 
@@ -16,6 +18,18 @@ type Unmarshaller interface {
 	Unmarshal(buf []byte) (uint64, error)
 }
 
+// gencodeChecksumFlag is set in the size of the record, followed by CRC32 checksum of the record body.
+// Records without the flag are written before checksums were added, so they're decoded without verification
+const gencodeChecksumFlag = 1 << 63
+
+// gencodeBufferSize is the initial size of the buffer for a decoded record body, it grows for bigger records
+const gencodeBufferSize = 64 * 1024
+
+var (
+	ErrRecordChecksum  = errors.New("record checksum mismatch")
+	ErrRecordMalformed = errors.New("malformed record")
+)
+
 type GencodeEncoder struct {
 	writer io.Writer
 	buf    []byte
@@ -25,6 +39,7 @@ func NewGencodeEncoder(writer io.Writer) *GencodeEncoder {
 	return &GencodeEncoder{writer: writer}
 }
 
+// Encode writes the record: size of the body with gencodeChecksumFlag, CRC32 checksum of the body and the body itself
 func (ge *GencodeEncoder) Encode(val Marshaller) error {
 	var err error
 	ge.buf, err = val.Marshal(ge.buf)
@@ -32,8 +47,10 @@ func (ge *GencodeEncoder) Encode(val Marshaller) error {
 		return err
 	}
 
-	err = binary.Write(ge.writer, binary.LittleEndian, uint64(len(ge.buf))) //it will write exactly 8 bytes
-	if err != nil {
+	var head [12]byte
+	binary.LittleEndian.PutUint64(head[:], uint64(len(ge.buf))|gencodeChecksumFlag)
+	binary.LittleEndian.PutUint32(head[8:], crc32.ChecksumIEEE(ge.buf))
+	if _, err := ge.writer.Write(head[:]); err != nil {
 		return err
 	}
 
@@ -50,41 +67,89 @@ func (ge *GencodeEncoder) Encode(val Marshaller) error {
 
 type GencodeDecoder struct {
 	reader io.Reader
+	// offset is count of bytes of the decoded records
+	offset int64
+	// checksummed is true, if a record with checksum is decoded, so the stream can't contain legacy records anymore
+	checksummed bool
 }
 
 func NewGencodeDecoder(reader io.Reader) *GencodeDecoder {
 	return &GencodeDecoder{reader: bufio.NewReader(reader)}
 }
 
+// Decode reads the next record. Returns io.EOF only if the stream ends at the record boundary,
+// io.ErrUnexpectedEOF if the stream ends with an incomplete record, e.g. torn by a crash,
+// ErrRecordChecksum if the record is corrupted, and ErrRecordMalformed if the record can't be unmarshalled,
+// e.g. zero-filled tail of the stream. Other errors of the reader are returned as is
 func (gd *GencodeDecoder) Decode(val Unmarshaller) error {
-	var sizeUint64 uint64
-	err := binary.Read(gd.reader, binary.LittleEndian, &sizeUint64)
-	if err != nil {
-		if err == io.ErrUnexpectedEOF {
-			err = io.EOF
-		}
+	var head [12]byte
+	if _, err := io.ReadFull(gd.reader, head[:8]); err != nil {
 		return err
 	}
-	size := int(sizeUint64)
-
-	buf := make([]byte, size)
-	read := 0
-	for read < size {
-		n, err := gd.reader.Read(buf[read:])
-		read += n
-		if err == bufio.ErrBufferFull {
-			continue
-		}
-		if err != nil {
-			return err
+
+	size := binary.LittleEndian.Uint64(head[:])
+	headSize := 8
+	if size&gencodeChecksumFlag != 0 {
+		size &^= gencodeChecksumFlag
+		headSize = len(head)
+		if _, err := io.ReadFull(gd.reader, head[8:]); err != nil {
+			return incompleteRecordError(err)
 		}
+	} else if gd.checksummed {
+		// legacy records are never written after records with checksum
+		return ErrRecordMalformed
 	}
-	assert.True(read == size, "Can't read full blob from buffer!")
 
-	_, err = val.Unmarshal(buf)
-	if err != nil {
+	// the buffer grows while the body is read, so a corrupted size can't allocate more memory than the stream has
+	capacity := size
+	if capacity > gencodeBufferSize {
+		capacity = gencodeBufferSize
+	}
+	body := bytes.NewBuffer(make([]byte, 0, capacity))
+	if _, err := io.CopyN(body, gd.reader, int64(size)); err != nil {
+		return incompleteRecordError(err)
+	}
+
+	if headSize == len(head) && crc32.ChecksumIEEE(body.Bytes()) != binary.LittleEndian.Uint32(head[8:]) {
+		return ErrRecordChecksum
+	}
+
+	if err := unmarshalRecord(val, body.Bytes()); err != nil {
 		return err
 	}
 
+	gd.offset += int64(headSize) + int64(size)
+	gd.checksummed = headSize == len(head)
+	return nil
+}
+
+// unmarshalRecord unmarshals the record body. Generated Unmarshal() doesn't check bounds of the buffer,
+// so a malformed body, e.g. of a legacy record without checksum, makes it panic
+func unmarshalRecord(val Unmarshaller, body []byte) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = ErrRecordMalformed
+		}
+	}()
+
+	if n, err := val.Unmarshal(body); err != nil || n != uint64(len(body)) {
+		return ErrRecordMalformed
+	}
+
 	return nil
 }
+
+// incompleteRecordError converts io.EOF, got in the middle of the record, into io.ErrUnexpectedEOF
+func incompleteRecordError(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// Offset returns count of bytes of the records, decoded successfully. After the last record is decoded,
+// offset less than the size of the stream means, that the stream ends with an incomplete record
+func (gd *GencodeDecoder) Offset() int64 {
+	return gd.offset
+}
@@ -2,7 +2,9 @@ package controller_test
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"github.com/go-test/deep"
 	"github.com/mshaverdo/radish/controller"
 	"github.com/mshaverdo/radish/message"
@@ -102,15 +104,95 @@ func TestGencodeEncoder_EncodeDecode(t *testing.T) {
 
 	requests := make([]*message.Request, 0)
 	request := new(message.Request)
-	for err = decoder.Decode(request); err != io.EOF; err = decoder.Decode(request) {
-		if err != nil {
-			t.Errorf("failed to read file: %s", err)
-		}
+	for err = decoder.Decode(request); err == nil; err = decoder.Decode(request) {
 		requests = append(requests, request)
 		request = new(message.Request)
 	}
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Decode() of broken entry: %v != %v", err, io.ErrUnexpectedEOF)
+	}
 
 	if diff := deep.Equal(requests, srcRequests); diff != nil {
 		t.Errorf("requests != srcRequests: %s", diff)
 	}
 }
+
+func TestGencodeDecoder_Checksum(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	// record, written before checksums were added, is just the size and the body
+	legacy := message.NewRequest("SET", [][]byte{[]byte("legacy"), []byte("XXX")})
+	body, _ := legacy.Marshal(nil)
+	binary.Write(buf, binary.LittleEndian, uint64(len(body)))
+	buf.Write(body)
+	legacySize := buf.Len()
+
+	encoder := controller.NewGencodeEncoder(buf)
+	encoder.Encode(message.NewRequest("SET", [][]byte{[]byte("valid"), []byte("XXX")}))
+	validSize := buf.Len()
+	encoder.Encode(message.NewRequest("SET", [][]byte{[]byte("corrupted"), []byte("XXX")}))
+
+	data := buf.Bytes()
+	data[len(data)-1]++
+
+	decoder := controller.NewGencodeDecoder(bytes.NewReader(data))
+	for _, want := range []string{"legacy", "valid"} {
+		request := new(message.Request)
+		if err := decoder.Decode(request); err != nil || string(request.Args[0]) != want {
+			t.Errorf("Decode(): %q, %v != %q", request.Args, err, want)
+		}
+	}
+	if decoder.Offset() != int64(validSize) || validSize <= legacySize {
+		t.Errorf("Offset(): %d != %d", decoder.Offset(), validSize)
+	}
+
+	if err := decoder.Decode(new(message.Request)); err != controller.ErrRecordChecksum {
+		t.Errorf("Decode() of corrupted record: %v != %v", err, controller.ErrRecordChecksum)
+	}
+	if decoder.Offset() != int64(validSize) {
+		t.Errorf("Offset() after corrupted record: %d != %d", decoder.Offset(), validSize)
+	}
+}
+
+// failingReader fails every read, like a file with an I/O error
+type failingReader struct{}
+
+var errRead = errors.New("read error")
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errRead
+}
+
+func TestGencodeDecoder_Errors(t *testing.T) {
+	buf := &bytes.Buffer{}
+	controller.NewGencodeEncoder(buf).Encode(message.NewRequest("SET", [][]byte{[]byte("key"), []byte("XXX")}))
+	record := buf.Bytes()
+
+	tests := []struct {
+		name   string
+		reader io.Reader
+		want   error
+	}{
+		{"record boundary", bytes.NewReader(record), io.EOF},
+		{"torn size", bytes.NewReader(append(append([]byte{}, record...), record[:3]...)), io.ErrUnexpectedEOF},
+		{"torn checksum", bytes.NewReader(append(append([]byte{}, record...), record[:10]...)), io.ErrUnexpectedEOF},
+		{"torn body", bytes.NewReader(append(append([]byte{}, record...), record[:len(record)-1]...)), io.ErrUnexpectedEOF},
+		{"zero-filled tail", bytes.NewReader(append(append([]byte{}, record...), make([]byte, 16)...)), controller.ErrRecordMalformed},
+		{"garbage tail", bytes.NewReader(append(append([]byte{}, record...), 1, 0, 0, 0, 0, 0, 0, 0, 0xff)), controller.ErrRecordMalformed},
+		{"read error", io.MultiReader(bytes.NewReader(record), failingReader{}), errRead},
+		{"read error in body", io.MultiReader(bytes.NewReader(record), bytes.NewReader(record[:14]), failingReader{}), errRead},
+	}
+
+	for _, tst := range tests {
+		decoder := controller.NewGencodeDecoder(tst.reader)
+		if err := decoder.Decode(new(message.Request)); err != nil {
+			t.Errorf("%s: Decode() of the first record: %v", tst.name, err)
+		}
+		if err := decoder.Decode(new(message.Request)); err != tst.want {
+			t.Errorf("%s: Decode(): %v != %v", tst.name, err, tst.want)
+		}
+		if decoder.Offset() != int64(len(record)) {
+			t.Errorf("%s: Offset(): %d != %d", tst.name, decoder.Offset(), len(record))
+		}
+	}
+}
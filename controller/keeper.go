@@ -15,9 +15,19 @@ import (
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// configuration
+var (
+	// WalStrict makes Keeper refuse to start, if the last WAL ends with a corrupted record, e.g. torn by a crash.
+	// Otherwise the WAL is truncated to the last valid record
+	WalStrict = false
+)
+
+var ErrWalIncomplete = errors.New("incomplete record at the end of WAL")
+
 type SyncPolicy int
 
 const (
@@ -31,6 +41,13 @@ const (
 	SyncAlways
 )
 
+// walBatch is a group of records, written into WAL with SyncAlways policy and synced by a single walFile.Sync().
+// done is closed, when the batch is synced, err is the sync result
+type walBatch struct {
+	done chan struct{}
+	err  error
+}
+
 const (
 	walFileName     = "wal_%v.dat"
 	storageFileName = "storage.gob"
@@ -45,6 +62,9 @@ const (
 type Persister interface {
 	// Persist dumps storage  data into provided Writer
 	Persist(w io.Writer, lastMessageId int64) error
+
+	// Snapshot captures point-in-time content of the storage, which could be persisted, while the storage is modified
+	Snapshot() *core.Snapshot
 }
 
 type Loader interface {
@@ -54,8 +74,20 @@ type Loader interface {
 
 var _ Persister = (*core.StorageHash)(nil)
 var _ Loader = (*core.StorageHash)(nil)
+var _ Persister = (*core.StorageBTree)(nil)
+var _ Loader = (*core.StorageBTree)(nil)
+
+// queuedRequest is a request, queued into Keeper.requestChan. If done isn't nil, it receives the result of the write
+type queuedRequest struct {
+	request *message.Request
+	done    chan error
+}
 
 type Keeper struct {
+	// queued is count of requests in requestChan, accessed atomically.
+	// It's the first field to guarantee 64-bit alignment for atomic operations
+	queued int64
+
 	mergeWalInterval time.Duration
 	syncPolicy       SyncPolicy
 	dataDir          string
@@ -70,7 +102,22 @@ type Keeper struct {
 	walEncoder  *GencodeEncoder
 	walBuffer   *bufio.Writer
 	lastSync    time.Time
-	requestChan chan *message.Request
+	requestChan chan queuedRequest
+
+	// queuedWg counts requests, queued into requestChan, but not written into WAL yet
+	queuedWg sync.WaitGroup
+	// walListener is called for every request written into WAL, e.g. to stream it to replicas
+	walListener func(request *message.Request)
+
+	// syncBatch collects SyncAlways records, written since the last sync, syncChan wakes up runWalSyncer to sync them
+	syncBatch *walBatch
+	syncChan  chan struct{}
+	// syncMutex prevents WAL file from being replaced, while it's synced outside of k.mutex.
+	// It MUST be locked before k.mutex
+	syncMutex sync.Mutex
+
+	// snapshotMutex prevents concurrent rewriting of the snapshot
+	snapshotMutex sync.Mutex
 
 	// wg to wait for service storage-updating goroutines (runSnapshotter, etc)
 	serviceWg sync.WaitGroup
@@ -85,26 +132,63 @@ func NewKeeper(core Core, dataDir string, policy SyncPolicy, mergeWalInterval ti
 		mergeWalInterval: mergeWalInterval,
 		processor:        NewProcessor(core),
 		stopChan:         make(chan struct{}),
-		requestChan:      make(chan *message.Request, requestChanSize),
+		requestChan:      make(chan queuedRequest, requestChanSize),
+		syncChan:         make(chan struct{}, 1),
 		storageFactory:   storageFactory,
 	}
 }
 
-// WriteToWal writes request to WAL
+// WriteToWal writes request to WAL. Requests are written in order of WriteToWal() calls,
+// so the caller could keep the order of requests, modifying the same keys
 func (k *Keeper) WriteToWal(request *message.Request) (err error) {
 	// if SyncAlways, we must return reliable error status
 	// or, if request was't PIPELINEd, and user waits for response, flush buffer to file
-	if !request.Unreliable || k.syncPolicy == SyncAlways {
+	isReliable := !request.Unreliable || k.syncPolicy == SyncAlways
+	if isReliable && atomic.LoadInt64(&k.queued) == 0 {
 		return k.writeToWalWorker(request)
 	}
 
+	// reliable request is written after the queued ones, and waits for the result
+	var done chan error
+	if isReliable {
+		done = make(chan error, 1)
+	}
+
 	select {
 	case <-k.stopChan:
 		return errors.New("trying to write WAL on stopped keeper")
 	default:
-		k.requestChan <- request
+		atomic.AddInt64(&k.queued, 1)
+		k.queuedWg.Add(1)
+		k.requestChan <- queuedRequest{request: request, done: done}
+	}
+
+	if done == nil {
 		return nil
 	}
+	return <-done
+}
+
+// WaitQueued waits until all the requests, queued by WriteToWal(), are written into WAL.
+// The caller must guarantee, that no requests are written concurrently
+func (k *Keeper) WaitQueued() {
+	k.queuedWg.Wait()
+}
+
+// LastMessageId returns Id of the last request, written into WAL
+func (k *Keeper) LastMessageId() int64 {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.messageId
+}
+
+// SetWalListener sets listener, called for every request written into WAL after it gets its Id
+func (k *Keeper) SetWalListener(listener func(request *message.Request)) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.walListener = listener
 }
 
 func (k *Keeper) runWalController() {
@@ -112,15 +196,19 @@ func (k *Keeper) runWalController() {
 	ticker := time.Tick(1 * time.Second)
 	for {
 		select {
-		case request, ok := <-k.requestChan:
+		case queued, ok := <-k.requestChan:
 			if !ok {
 				// keeper shutting down
 				return
 			}
-			err := k.writeToWalWorker(request)
-			if err != nil {
+			err := k.writeToWalWorker(queued.request)
+			if queued.done != nil {
+				queued.done <- err
+			} else if err != nil {
 				log.Errorf("Unable to write WAL: %s", err)
 			}
+			atomic.AddInt64(&k.queued, -1)
+			k.queuedWg.Done()
 		case <-ticker:
 			k.mutex.Lock()
 			//log.Debugf("Current WAL #: %d", k.messageId)
@@ -141,23 +229,91 @@ func (k *Keeper) writeToWalWorker(request *message.Request) (err error) {
 		return fmt.Errorf("Keeper.writeToWalWorker(): %s", err)
 	}
 
+	if k.walListener != nil {
+		k.walListener(request)
+	}
+
+	if k.syncPolicy == SyncAlways {
+		// group commit: the record is flushed and synced by runWalSyncer together with records of concurrent writers,
+		// so writers don't wait for each other's sync
+		if k.syncBatch == nil {
+			k.syncBatch = &walBatch{done: make(chan struct{})}
+		}
+		batch := k.syncBatch
+		k.mutex.Unlock()
+
+		select {
+		case k.syncChan <- struct{}{}:
+		default:
+			// runWalSyncer is already woken up
+		}
+
+		<-batch.done
+		return batch.err
+	}
+
 	err = k.flushBuffers(!request.Unreliable)
 
 	k.mutex.Unlock()
 	return err
 }
 
+// runWalSyncer syncs batches of records, written with SyncAlways policy.
+// While a batch is synced, the next one is collected, so the more concurrent writers, the bigger batches are
+func (k *Keeper) runWalSyncer() {
+	defer k.serviceWg.Done()
+	for {
+		select {
+		case <-k.syncChan:
+			k.syncWal()
+		case <-k.stopChan:
+			// records, written before stopping, still must be acknowledged
+			k.syncWal()
+			return
+		}
+	}
+}
+
+// syncWal flushes and syncs the current batch, then acknowledges all its writers
+func (k *Keeper) syncWal() {
+	k.syncMutex.Lock()
+	defer k.syncMutex.Unlock()
+
+	k.mutex.Lock()
+	batch := k.syncBatch
+	k.syncBatch = nil
+	if batch == nil {
+		k.mutex.Unlock()
+		return
+	}
+	err := k.walBuffer.Flush()
+	file := k.walFile
+	k.mutex.Unlock()
+
+	// file can't be closed meanwhile, since startNewWal() waits for syncMutex
+	if err == nil {
+		err = file.Sync()
+	}
+	// batch.err may be already set by startNewWal(), if it failed to sync the previous WAL
+	if err != nil {
+		batch.err = fmt.Errorf("Keeper.syncWal(): %s", err)
+	}
+
+	close(batch.done)
+}
+
 // flushBuffers MUST be invoked only while k.mutex locked!
 func (k *Keeper) flushBuffers(forceFlush bool) (err error) {
 	// if request was't PIPELINEd, and user waits for response, flush buffer to file for more durability
-	// if requests was pipelined, user don't care about responses, so we can flush records to disc just every second
-	if forceFlush || k.syncPolicy == SyncAlways {
-		k.walBuffer.Flush()
+	// if requests was pipelined, user don't care about responses, so we can flush records to disc just every second.
+	// with SyncAlways, records are flushed and synced by runWalSyncer
+	if forceFlush && k.syncPolicy != SyncAlways {
+		err = k.walBuffer.Flush()
 		if err != nil {
 			return fmt.Errorf("Keeper.flushBuffers(): %s", err)
 		}
 
-		if k.syncPolicy == SyncAlways || (k.syncPolicy == SyncSometimes && time.Since(k.lastSync) > 1*time.Second) {
+		if k.syncPolicy == SyncSometimes && time.Since(k.lastSync) > 1*time.Second {
 			err = k.walFile.Sync()
 			if err != nil {
 				return fmt.Errorf("Keeper.flushBuffers(): %s", err)
@@ -260,10 +416,19 @@ func (k *Keeper) processWals(wals []string) (processedWals []string, err error)
 
 	sort.Ints(messageIds)
 
+	// a torn write may corrupt only the latest records, so the corrupted WAL could be followed only by empty WALs,
+	// started just before the crash
+	lastWritten := len(messageIds) - 1
+	for ; lastWritten > 0; lastWritten-- {
+		if info, err := os.Stat(k.walFileName(messageIds[lastWritten])); err != nil || info.Size() != 0 {
+			break
+		}
+	}
+
 	// process all WALs from earliest to latest
-	for _, messageId := range messageIds {
+	for i, messageId := range messageIds {
 		filename := k.walFileName(messageId)
-		if err := k.processWal(filename); err != nil {
+		if err := k.processWal(filename, i >= lastWritten); err != nil {
 			return nil, err
 		}
 		processedWals = append(processedWals, filename)
@@ -272,7 +437,9 @@ func (k *Keeper) processWals(wals []string) (processedWals []string, err error)
 	return processedWals, nil
 }
 
-func (k *Keeper) processWal(filename string) error {
+// processWal applies records of the WAL to the storage. A torn write may corrupt only the tail of the last written WAL,
+// so it's truncated to the last valid record, unless WalStrict is set
+func (k *Keeper) processWal(filename string, last bool) error {
 	log.Infof("processing WAL %s...", filename)
 
 	file, err := os.Open(filename)
@@ -285,9 +452,11 @@ func (k *Keeper) processWal(filename string) error {
 	dec := NewGencodeDecoder(file)
 	req := new(message.Request)
 	processed := 0
+	var corrupted error
 	for err := dec.Decode(req); err != io.EOF; err = dec.Decode(req) {
 		if err != nil {
-			return fmt.Errorf("Keeper.processWal(): can't process %s: %s", filename, err)
+			corrupted = err
+			break
 		}
 
 		if req.Id <= k.messageId {
@@ -295,15 +464,18 @@ func (k *Keeper) processWal(filename string) error {
 			continue
 		}
 
-		err = k.processor.FixRequestTtl(req)
-		if err != nil {
-			return fmt.Errorf("Keeper.processWal(): can't process %s: %s \nrequest: %s", filename, err, req)
+		// transaction is written as a single record, so it is applied entirely or not applied at all
+		requests := []*message.Request{req}
+		if req.Cmd == walTransactionCmd {
+			if requests, err = splitWalTransaction(req); err != nil {
+				return fmt.Errorf("Keeper.processWal(): can't process %s: %s \nrequest: %s", filename, err, req)
+			}
 		}
 
-		resp := k.processor.Process(req)
-		if resp.Status() != message.StatusOk {
-			// we got an error, but this request was successful. Something went wrong
-			return fmt.Errorf("Keeper.processWal(): can't process %s: \nrequest: %s \nresponse: %s", filename, req, resp)
+		for _, request := range requests {
+			if err := k.processWalRequest(request); err != nil {
+				return fmt.Errorf("Keeper.processWal(): can't process %s: %s", filename, err)
+			}
 		}
 
 		k.messageId = req.Id
@@ -311,10 +483,55 @@ func (k *Keeper) processWal(filename string) error {
 		processed++
 	}
 
+	if info, err := file.Stat(); corrupted == nil && err == nil && info.Size() > dec.Offset() {
+		corrupted = ErrWalIncomplete
+	}
+
+	if corrupted != nil {
+		if !isWalTorn(corrupted) {
+			// the WAL can't be read, so it isn't known whether it's corrupted
+			return fmt.Errorf("Keeper.processWal(): can't read %s at offset %d: %s", filename, dec.Offset(), corrupted)
+		}
+
+		if WalStrict || !last {
+			return fmt.Errorf("Keeper.processWal(): can't process %s at offset %d: %s", filename, dec.Offset(), corrupted)
+		}
+
+		log.Warningf("WAL %s is corrupted at offset %d: %s. Truncating it to the last valid record", filename, dec.Offset(), corrupted)
+		if err := os.Truncate(filename, dec.Offset()); err != nil {
+			return fmt.Errorf("Keeper.processWal(): can't truncate %s: %s", filename, err)
+		}
+	}
+
 	log.Infof("%d requests processed if WAL %s", processed, filename)
 	return nil
 }
 
+// isWalTorn returns true, if err means that the WAL ends with a record, torn or corrupted by a crash
+func isWalTorn(err error) bool {
+	return err == io.ErrUnexpectedEOF || err == ErrRecordChecksum || err == ErrRecordMalformed || err == ErrWalIncomplete
+}
+
+// processWalRequest applies request, restored from WAL, to the storage
+func (k *Keeper) processWalRequest(request *message.Request) error {
+	return processWalRequest(k.processor, request)
+}
+
+// processWalRequest applies request, restored from WAL or received from the master, to the storage by processor
+func processWalRequest(processor *Processor, request *message.Request) error {
+	if err := processor.FixRequestTtl(request); err != nil {
+		return fmt.Errorf("%s \nrequest: %s", err, request)
+	}
+
+	resp := processor.Process(request)
+	if resp.Status() != message.StatusOk && resp.Status() != message.StatusNotFound {
+		// we got an error, but this request was successful. Something went wrong
+		return fmt.Errorf("\nrequest: %s \nresponse: %s", request, resp)
+	}
+
+	return nil
+}
+
 func (k *Keeper) persistStorage() error {
 	//remove expired items to decrease dump size
 	k.core.CollectExpired()
@@ -326,7 +543,7 @@ func (k *Keeper) persistStorage() error {
 		return fmt.Errorf("Keeper.persistStorage(): %s", err)
 	}
 
-	// ensure exclusive access to storage during encoding
+	// storage is persisted from a snapshot, so it isn't locked during encoding
 	persistable, ok := k.core.Storage().(Persister)
 	if !ok {
 		return fmt.Errorf("Keeper.persistStorage(): Failed to persist data: Storage not support persistence")
@@ -388,11 +605,18 @@ func (k *Keeper) Start() (err error) {
 	k.serviceWg.Add(1)
 	go k.runWalController()
 
+	if k.syncPolicy == SyncAlways {
+		k.serviceWg.Add(1)
+		go k.runWalSyncer()
+	}
+
 	return err
 }
 
 // startNewWal closes current WAL file and starts new
 func (k *Keeper) startNewWal() (oldWalFilename, newWalFilename string, err error) {
+	k.syncMutex.Lock()
+	defer k.syncMutex.Unlock()
 	k.mutex.Lock()
 	defer k.mutex.Unlock()
 
@@ -415,6 +639,12 @@ func (k *Keeper) startNewWal() (oldWalFilename, newWalFilename string, err error
 	if k.walFile != nil {
 		oldWalFilename = k.walFile.Name()
 		k.walBuffer.Flush()
+		// writers of the current batch are acknowledged after the sync of the new WAL, so the old one is synced here
+		if k.syncBatch != nil {
+			if err := k.walFile.Sync(); err != nil {
+				k.syncBatch.err = fmt.Errorf("Keeper.startNewWal(): %s", err)
+			}
+		}
 		k.walFile.Close()
 	}
 
@@ -463,6 +693,9 @@ func (k *Keeper) runSnapshotUpdater() {
 // copy-on-write, implemented on Storage level causes more than 300 ms stalls while copying a hashmap,
 // so, merging WAL into separate copy of storage is least RPS-affecting technique.
 func (k *Keeper) updateSnapshot() error {
+	k.snapshotMutex.Lock()
+	defer k.snapshotMutex.Unlock()
+
 	log.Info("Updating a snapshot")
 	_, newWal, err := k.startNewWal()
 	if err != nil {
@@ -519,3 +752,37 @@ func (k *Keeper) updateSnapshot() error {
 
 	return nil
 }
+
+// ResetSnapshot replaces the snapshot with the current storage and removes all the previous WALs.
+// It's used, when the storage is replaced entirely, e.g. by the full synchronization with the master,
+// so the previous WALs are not applicable to it. The caller must guarantee, that no requests are written concurrently
+func (k *Keeper) ResetSnapshot() error {
+	k.snapshotMutex.Lock()
+	defer k.snapshotMutex.Unlock()
+
+	_, newWal, err := k.startNewWal()
+	if err != nil {
+		return err
+	}
+
+	// the snapshot gets Id of the new WAL, so records of the previous WALs would be skipped anyway
+	if err := k.persistStorage(); err != nil {
+		return err
+	}
+
+	wals, err := k.getDataDirWals()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range wals {
+		if v == newWal {
+			continue
+		}
+		if err := os.Remove(v); err != nil {
+			log.Warningf("Unable to remove WAL %s: %s", v, err)
+		}
+	}
+
+	return nil
+}
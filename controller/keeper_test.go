@@ -0,0 +1,311 @@
+package controller_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/go-test/deep"
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/core"
+	"github.com/mshaverdo/radish/message"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestKeeper_StartCorruptedWal(t *testing.T) {
+	defer func() { controller.WalStrict = false }()
+
+	wal := &bytes.Buffer{}
+	encoder := controller.NewGencodeEncoder(wal)
+	var offsets []int
+	for i, key := range []string{"a", "b", "c"} {
+		request := message.NewRequest("SET", [][]byte{[]byte(key), []byte("value")})
+		request.Id = int64(i + 1)
+		encoder.Encode(request)
+		offsets = append(offsets, wal.Len())
+	}
+	data := wal.Bytes()
+
+	tests := []struct {
+		name     string
+		wal      []byte
+		strict   bool
+		wantErr  bool
+		wantKeys []string
+		wantSize int
+	}{
+		{"valid", data, false, false, []string{"a", "b", "c"}, len(data)},
+		{"torn", data[:len(data)-3], false, false, []string{"a", "b"}, offsets[1]},
+		{"torn strict", data[:len(data)-3], true, true, nil, len(data) - 3},
+		{"corrupted", append(append([]byte{}, data[:offsets[1]-1]...), 0xFF), false, false, []string{"a"}, offsets[0]},
+		{"corrupted strict", append(append([]byte{}, data[:offsets[1]-1]...), 0xFF), true, true, nil, offsets[1]},
+		{"zero-filled tail", append(append([]byte{}, data...), make([]byte, 16)...), false, false, []string{"a", "b", "c"}, len(data)},
+		{"zero-filled tail strict", append(append([]byte{}, data...), make([]byte, 16)...), true, true, nil, len(data) + 16},
+		{"zero-filled", make([]byte, 16), false, false, []string{}, 0},
+		{"garbage legacy record", []byte{3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, false, false, []string{}, 0},
+	}
+
+	for _, tst := range tests {
+		dataDir, err := ioutil.TempDir("", "radish_keeper")
+		if err != nil {
+			t.Fatal(err)
+		}
+		walFile := filepath.Join(dataDir, "wal_1.dat")
+		ioutil.WriteFile(walFile, tst.wal, 0644)
+		// empty WAL, started just before the crash, doesn't prevent truncation of the previous one
+		ioutil.WriteFile(filepath.Join(dataDir, "wal_2.dat"), nil, 0644)
+
+		controller.WalStrict = tst.strict
+		c := core.New(core.NewStorageHash())
+		k := controller.NewKeeper(c, dataDir, controller.SyncNever, 0, func() core.Storage { return core.NewStorageHash() })
+		err = k.Start()
+
+		if (err != nil) != tst.wantErr {
+			t.Errorf("%s: Start(): unexpected error %v", tst.name, err)
+		}
+		if err != nil {
+			if info, _ := os.Stat(walFile); info == nil || info.Size() != int64(tst.wantSize) {
+				t.Errorf("%s: WAL is modified", tst.name)
+			}
+			os.RemoveAll(dataDir)
+			continue
+		}
+
+		got := c.Keys("*")
+		sort.Strings(got)
+		if diff := deep.Equal(got, tst.wantKeys); diff != nil {
+			t.Errorf("%s: %s\n\ngot:%v\n\nwant:%v", tst.name, diff, got, tst.wantKeys)
+		}
+
+		k.Shutdown()
+		os.RemoveAll(dataDir)
+	}
+}
+
+func TestKeeper_WriteToWalSyncAlways(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "radish_keeper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	storageFactory := func() core.Storage { return core.NewStorageHash() }
+	k := controller.NewKeeper(core.New(storageFactory()), dataDir, controller.SyncAlways, 0, storageFactory)
+	if err := k.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer k.Shutdown()
+
+	var want []string
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		want = append(want, key)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := k.WriteToWal(message.NewRequest("SET", [][]byte{[]byte(key), []byte("value")})); err != nil {
+				t.Errorf("WriteToWal(%s): %s", key, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// acknowledged records are in WAL, so they are restored by another keeper without shutting down the first one
+	c := core.New(storageFactory())
+	restored := controller.NewKeeper(c, dataDir, controller.SyncNever, 0, storageFactory)
+	if err := restored.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Shutdown()
+
+	got := c.Keys("*")
+	sort.Strings(got)
+	sort.Strings(want)
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("%s\n\ngot:%v\n\nwant:%v", diff, got, want)
+	}
+}
+
+func BenchmarkKeeper_WriteToWalSyncAlways(b *testing.B) {
+	dataDir, err := ioutil.TempDir("", "radish_keeper")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	storageFactory := func() core.Storage { return core.NewStorageHash() }
+	k := controller.NewKeeper(core.New(storageFactory()), dataDir, controller.SyncAlways, 0, storageFactory)
+	if err := k.Start(); err != nil {
+		b.Fatal(err)
+	}
+	defer k.Shutdown()
+
+	// writers are concurrent like client connections, which wait for the sync
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := k.WriteToWal(message.NewRequest("SET", [][]byte{[]byte("key"), []byte("value")})); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func TestController_WalNotFound(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "radish_wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	c, _ := startServer(t, dataDir)
+	defer c.Shutdown()
+
+	// only the requests, which modified the storage, are written into WAL, even if they respond NotFound
+	requests := []*message.Request{
+		newRequest("SPOP", "404"),
+		newRequest("GETSET", "a", "1"),
+		newRequest("SET", "a", "2", "NX"),
+		newRequest("SET", "b", "2", "GET"),
+		newRequest("SADD", "set", "member"),
+		newRequest("SPOP", "set"),
+		newRequest("SPOP", "set"),
+	}
+	for _, request := range requests {
+		c.HandleMessage(request)
+	}
+
+	var got []string
+	for _, request := range readWals(dataDir) {
+		got = append(got, fmt.Sprintf("%s %s", request.Cmd, bytes.Join(request.Args, []byte(" "))))
+	}
+
+	want := []string{"GETSET a 1", "SET b 2 GET", "SADD set member", "SREM set member"}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("%s\n\ngot:%v\n\nwant:%v", diff, got, want)
+	}
+}
+
+func TestController_WalOrder(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "radish_wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	c, _ := startServer(t, dataDir)
+	defer c.Shutdown()
+
+	// concurrent writes of the same key, pipelined or not, are written into WAL in the same order as they're applied.
+	// Writers must be preempted between applying and writing into WAL, even on a single CPU
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				request := newRequest("SET", "key", fmt.Sprintf("%d:%d", w, i))
+				request.Unreliable = i%2 == 0
+				c.HandleMessage(request)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// reliable request is written after the queued ones
+	c.HandleMessage(newRequest("SET", "done", "1"))
+	want := string(c.HandleMessage(newRequest("GET", "key")).Bytes()[0])
+
+	var got string
+	for _, request := range readWals(dataDir) {
+		if request.Cmd == "SET" && string(request.Args[0]) == "key" {
+			got = string(request.Args[1])
+		}
+	}
+
+	if got != want {
+		t.Errorf("the last value in WAL: %q != %q", got, want)
+	}
+}
+
+func TestController_WalEvictionOrder(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "radish_wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	c, _ := startServer(t, dataDir)
+	defer c.Shutdown()
+
+	c.HandleMessage(newRequest("CONFIG", "SET", "maxmemory", "1kb"))
+	c.HandleMessage(newRequest("CONFIG", "SET", "maxmemory-policy", "allkeys-lru"))
+
+	// eviction of the key, concurrent with its writing, is written into WAL in the same order as it's applied
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				c.HandleMessage(newRequest("SET", strconv.Itoa(i%200), fmt.Sprintf("%d:%d", w, i)))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	c.HandleMessage(newRequest("CONFIG", "SET", "maxmemory", "0"))
+	c.HandleMessage(newRequest("SET", "done", "1"))
+
+	replayed := make(map[string]bool)
+	for _, request := range readWals(dataDir) {
+		for i, key := range request.Args {
+			if request.Cmd == "DEL" {
+				delete(replayed, string(key))
+			} else if request.Cmd == "SET" && i == 0 {
+				replayed[string(key)] = true
+			}
+		}
+	}
+
+	var got []string
+	for key := range replayed {
+		got = append(got, key)
+	}
+	sort.Strings(got)
+	var want []string
+	for _, key := range c.HandleMessage(newRequest("KEYS", "*")).Bytes() {
+		want = append(want, string(key))
+	}
+	sort.Strings(want)
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("keys replayed from WAL: %s\n\ngot:%v\n\nwant:%v", diff, got, want)
+	}
+}
+
+// readWals returns requests, written into WALs of dataDir
+func readWals(dataDir string) (requests []*message.Request) {
+	wals, _ := filepath.Glob(filepath.Join(dataDir, "wal_*.dat"))
+	for _, wal := range wals {
+		data, _ := ioutil.ReadFile(wal)
+		decoder := controller.NewGencodeDecoder(bytes.NewReader(data))
+		for {
+			request := &message.Request{}
+			if err := decoder.Decode(request); err != nil {
+				break
+			}
+			requests = append(requests, request)
+		}
+	}
+
+	return requests
+}
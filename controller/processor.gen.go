@@ -54,9 +54,6 @@ func (p *Processor) Process(request *message.Request) message.Response {
 
 		return getResponseStringPayload(result)
 	case "SET":
-		if request.ArgumentsLen() != 2 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
-		}
 
 		arg0, err := request.GetArgumentString(0)
 		if err != nil {
@@ -66,10 +63,14 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		if err != nil {
 			return getResponseInvalidArguments(request.Cmd, err)
 		}
+		arg2 := request.GetArgumentOptionalString(2)
 
-		p.core.Set(arg0, arg1)
+		result, err := p.core.Set(arg0, arg1, arg2...)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
 
-		return getResponseStatusOkPayload()
+		return getResponseInterfacePayload(result)
 	case "SETEX":
 		if request.ArgumentsLen() != 3 {
 			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
@@ -102,24 +103,17 @@ func (p *Processor) Process(request *message.Request) message.Response {
 
 		return getResponseIntPayload(result)
 	case "HSET":
-		if request.ArgumentsLen() != 3 {
-			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
-		}
 
 		arg0, err := request.GetArgumentString(0)
 		if err != nil {
 			return getResponseInvalidArguments(request.Cmd, err)
 		}
-		arg1, err := request.GetArgumentString(1)
-		if err != nil {
-			return getResponseInvalidArguments(request.Cmd, err)
-		}
-		arg2, err := request.GetArgumentBytes(2)
+		arg1, err := request.GetArgumentVariadicBytes(1)
 		if err != nil {
 			return getResponseInvalidArguments(request.Cmd, err)
 		}
 
-		result, err := p.core.DSet(arg0, arg1, arg2)
+		result, err := p.core.DSet(arg0, arg1)
 		if err != nil {
 			return getResponseCommandError(request.Cmd, err)
 		}
@@ -357,44 +351,1553 @@ func (p *Processor) Process(request *message.Request) message.Response {
 		result := p.core.Persist(arg0)
 
 		return getResponseIntPayload(result)
+	case "INCR":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
 
-	default:
-		return message.NewResponseStatus(message.StatusInvalidCommand, "unknown command: "+request.Cmd)
-	}
-}
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
 
-// IsModifyingRequest returns true, if request modifies a storage
-func (p *Processor) IsModifyingRequest(request *message.Request) bool {
-	switch request.Cmd {
-	case "SET", "SETEX", "DEL", "HSET", "HDEL", "LSET", "LPUSH", "LPOP", "EXPIRE", "PERSIST":
-		return true
-	default:
-		return false
-	}
-}
+		result, err := p.core.Incr(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
 
-// FixWalRequestTtl Correct TTL value for TTL-related requests due to ttl is time.Now() -related value
-func (p *Processor) FixRequestTtl(request *message.Request) error {
-	switch request.Cmd {
-	case "SETEX":
-		seconds, err := request.GetArgumentInt(1)
+		return getResponseIntPayload(result)
+	case "DECR":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
 		if err != nil {
-			return err
+			return getResponseInvalidArguments(request.Cmd, err)
 		}
 
-		seconds -= int(time.Now().Unix() - request.Timestamp)
-		request.Args[1] = []byte(strconv.Itoa(seconds))
-	case "EXPIRE":
-		seconds, err := request.GetArgumentInt(1)
+		result, err := p.core.Decr(arg0)
 		if err != nil {
-			return err
+			return getResponseCommandError(request.Cmd, err)
 		}
 
-		seconds -= int(time.Now().Unix() - request.Timestamp)
-		request.Args[1] = []byte(strconv.Itoa(seconds))
-	default:
-		//do nothing. Just a placeholder to save correct syntax w/o ttl-related commands
-	}
+		return getResponseIntPayload(result)
+	case "DECRBY":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
 
-	return nil
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.DecrBy(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "INCRBY":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.IncrBy(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "INCRBYFLOAT":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentFloat(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.IncrByFloat(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseFloatPayload(result)
+	case "HINCRBY":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentInt(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.DIncrBy(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "HINCRBYFLOAT":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentFloat(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.DIncrByFloat(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseFloatPayload(result)
+	case "HMGET":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.DMGet(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(result)
+	case "HEXISTS":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.DExists(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "HLEN":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.DLen(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "HVALS":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.DVals(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(result)
+	case "HSTRLEN":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.DStrLen(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "HSETNX":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentBytes(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.DSetNX(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "HRANDFIELD":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1 := request.GetArgumentOptionalString(1)
+
+		result, err := p.core.DRandField(arg0, arg1...)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseInterfacePayload(result)
+	case "HEXPIRE":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2 := request.GetArgumentOptionalString(2)
+
+		result, err := p.core.DExpire(arg0, arg1, arg2...)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntSlicePayload(result)
+	case "HPEXPIRE":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2 := request.GetArgumentOptionalString(2)
+
+		result, err := p.core.DPExpire(arg0, arg1, arg2...)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntSlicePayload(result)
+	case "HPEXPIREAT":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2 := request.GetArgumentOptionalString(2)
+
+		result, err := p.core.DPExpireAt(arg0, arg1, arg2...)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntSlicePayload(result)
+	case "HTTL":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1 := request.GetArgumentOptionalString(1)
+
+		result, err := p.core.DTtl(arg0, arg1...)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntSlicePayload(result)
+	case "HPERSIST":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1 := request.GetArgumentOptionalString(1)
+
+		result, err := p.core.DPersist(arg0, arg1...)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntSlicePayload(result)
+	case "DUMP":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.Dump(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "RESTORE":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentBytes(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg3 := request.GetArgumentOptionalString(3)
+
+		err = p.core.Restore(arg0, arg1, arg2, arg3...)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStatusOkPayload()
+	case "EXISTS":
+
+		arg0, err := request.GetArgumentVariadicString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result := p.core.Exists(arg0)
+
+		return getResponseIntPayload(result)
+	case "TYPE":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result := p.core.Type(arg0)
+
+		return getResponseStringPayload([]byte(result))
+	case "RENAME":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		err = p.core.Rename(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStatusOkPayload()
+	case "RENAMENX":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.RenameNX(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "RANDOMKEY":
+		if request.ArgumentsLen() != 0 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		result, err := p.core.RandomKey()
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload([]byte(result))
+	case "DBSIZE":
+		if request.ArgumentsLen() != 0 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		result := p.core.DbSize()
+
+		return getResponseIntPayload(result)
+	case "TOUCH":
+
+		arg0, err := request.GetArgumentVariadicString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result := p.core.Touch(arg0)
+
+		return getResponseIntPayload(result)
+	case "UNLINK":
+
+		arg0, err := request.GetArgumentVariadicString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result := p.core.Unlink(arg0)
+
+		return getResponseIntPayload(result)
+	case "RPUSH":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicBytes(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.RPush(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "RPOP":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.RPop(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "LINSERT":
+		if request.ArgumentsLen() != 4 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentString(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg3, err := request.GetArgumentBytes(3)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.LInsert(arg0, arg1, arg2, arg3)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "LREM":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentBytes(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.LRem(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "LTRIM":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentInt(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		err = p.core.LTrim(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStatusOkPayload()
+	case "RPOPLPUSH":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.RPopLPush(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "LMOVE":
+		if request.ArgumentsLen() != 4 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentString(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg3, err := request.GetArgumentString(3)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.LMove(arg0, arg1, arg2, arg3)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "SCAN":
+
+		arg0, err := request.GetArgumentInt(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1 := request.GetArgumentOptionalString(1)
+
+		result, err := p.core.Scan(arg0, arg1...)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseScanPayload(result)
+	case "HSCAN":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2 := request.GetArgumentOptionalString(2)
+
+		result, err := p.core.DScan(arg0, arg1, arg2...)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseScanPayload(result)
+	case "SSCAN":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2 := request.GetArgumentOptionalString(2)
+
+		result, err := p.core.SScan(arg0, arg1, arg2...)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseScanPayload(result)
+	case "ZSCAN":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2 := request.GetArgumentOptionalString(2)
+
+		result, err := p.core.ZScan(arg0, arg1, arg2...)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseScanPayload(result)
+	case "SADD":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SAdd(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "SREM":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SRem(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "SMEMBERS":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SMembers(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(stringsSliceToBytesSlise(result))
+	case "SISMEMBER":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SIsMember(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "SCARD":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SCard(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "SPOP":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SPop(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "SRANDMEMBER":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SRandMember(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "SINTER":
+
+		arg0, err := request.GetArgumentVariadicString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SInter(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(stringsSliceToBytesSlise(result))
+	case "SUNION":
+
+		arg0, err := request.GetArgumentVariadicString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SUnion(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(stringsSliceToBytesSlise(result))
+	case "SDIFF":
+
+		arg0, err := request.GetArgumentVariadicString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SDiff(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(stringsSliceToBytesSlise(result))
+	case "SINTERSTORE":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SInterStore(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "SUNIONSTORE":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SUnionStore(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "SDIFFSTORE":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SDiffStore(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "APPEND":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentBytes(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.Append(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "STRLEN":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.StrLen(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "GETRANGE":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentInt(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.GetRange(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "SETRANGE":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentBytes(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SetRange(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "GETSET":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentBytes(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.GetSet(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "GETDEL":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.GetDel(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringPayload(result)
+	case "MGET":
+
+		arg0, err := request.GetArgumentVariadicString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.MGet(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(result)
+	case "MSET":
+
+		arg0, err := request.GetArgumentVariadicBytes(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		err = p.core.MSet(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStatusOkPayload()
+	case "MSETNX":
+
+		arg0, err := request.GetArgumentVariadicBytes(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.MSetNX(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "SETNX":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentBytes(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.SetNX(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "PTTL":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.PTtl(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "EXPIRETIME":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ExpireTime(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "PEXPIRE":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result := p.core.PExpire(arg0, arg1)
+
+		return getResponseIntPayload(result)
+	case "EXPIREAT":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result := p.core.ExpireAt(arg0, arg1)
+
+		return getResponseIntPayload(result)
+	case "PEXPIREAT":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result := p.core.PExpireAt(arg0, arg1)
+
+		return getResponseIntPayload(result)
+	case "PSETEX":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentInt(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentBytes(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		err = p.core.PSetEx(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStatusOkPayload()
+	case "ZADD":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZAdd(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseInterfacePayload(result)
+	case "ZINCRBY":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentFloat(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentString(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZIncrBy(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseFloatPayload(result)
+	case "ZREM":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZRem(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "ZSCORE":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZScore(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseFloatPayload(result)
+	case "ZCARD":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZCard(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "ZRANK":
+		if request.ArgumentsLen() != 2 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZRank(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "ZCOUNT":
+		if request.ArgumentsLen() != 3 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg2, err := request.GetArgumentString(2)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZCount(arg0, arg1, arg2)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseIntPayload(result)
+	case "ZRANGE":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZRange(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(result)
+	case "ZREVRANGE":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZRevRange(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(result)
+	case "ZRANGEBYSCORE":
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+		arg1, err := request.GetArgumentVariadicString(1)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZRangeByScore(arg0, arg1)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(result)
+	case "ZPOPMIN":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZPopMin(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(result)
+	case "ZPOPMAX":
+		if request.ArgumentsLen() != 1 {
+			return getResponseInvalidArguments(request.Cmd, fmt.Errorf("wrong number of arguments for '%s' command: %d", request.Cmd, request.ArgumentsLen()))
+		}
+
+		arg0, err := request.GetArgumentString(0)
+		if err != nil {
+			return getResponseInvalidArguments(request.Cmd, err)
+		}
+
+		result, err := p.core.ZPopMax(arg0)
+		if err != nil {
+			return getResponseCommandError(request.Cmd, err)
+		}
+
+		return getResponseStringSlicePayload(result)
+
+	default:
+		return message.NewResponseStatus(message.StatusInvalidCommand, "unknown command: "+request.Cmd)
+	}
+}
+
+// IsModifyingRequest returns true, if request modifies a storage
+func (p *Processor) IsModifyingRequest(request *message.Request) bool {
+	switch request.Cmd {
+	case "SET", "SETEX", "DEL", "HSET", "HDEL", "LSET", "LPUSH", "LPOP", "EXPIRE", "PERSIST", "INCR", "DECR", "DECRBY", "INCRBY", "INCRBYFLOAT", "HINCRBY", "HINCRBYFLOAT", "HSETNX", "HEXPIRE", "HPEXPIRE", "HPEXPIREAT", "HPERSIST", "RESTORE", "RENAME", "RENAMENX", "UNLINK", "RPUSH", "RPOP", "LINSERT", "LREM", "LTRIM", "RPOPLPUSH", "LMOVE", "SADD", "SREM", "SPOP", "SINTERSTORE", "SUNIONSTORE", "SDIFFSTORE", "APPEND", "SETRANGE", "GETSET", "GETDEL", "MSET", "MSETNX", "SETNX", "PEXPIRE", "EXPIREAT", "PEXPIREAT", "PSETEX", "ZADD", "ZINCRBY", "ZREM", "ZPOPMIN", "ZPOPMAX":
+		return true
+	default:
+		return false
+	}
+}
+
+// IsDenyOomRequest returns true, if request may increase memory usage, so it's rejected when memory is full
+func (p *Processor) IsDenyOomRequest(request *message.Request) bool {
+	switch request.Cmd {
+	case "SET", "SETEX", "HSET", "LSET", "LPUSH", "INCR", "DECR", "DECRBY", "INCRBY", "INCRBYFLOAT", "HINCRBY", "HINCRBYFLOAT", "HSETNX", "RESTORE", "RPUSH", "LINSERT", "RPOPLPUSH", "LMOVE", "SADD", "SINTERSTORE", "SUNIONSTORE", "SDIFFSTORE", "APPEND", "SETRANGE", "GETSET", "MSET", "MSETNX", "SETNX", "PSETEX", "ZADD", "ZINCRBY":
+		return true
+	default:
+		return false
+	}
+}
+
+// IsModifyingNotFoundRequest returns true, if request modifies a storage even though it responds NotFound,
+// like GETSET of not existing key
+func (p *Processor) IsModifyingNotFoundRequest(request *message.Request) bool {
+	switch request.Cmd {
+	case "SET":
+		return hasRequestOption(request, 2, "GET")
+	case "GETSET":
+		return true
+	default:
+		return false
+	}
+}
+
+// FixWalRequestTtl Correct TTL value for TTL-related requests due to ttl is time.Now() -related value
+func (p *Processor) FixRequestTtl(request *message.Request) error {
+	switch request.Cmd {
+	case "SET":
+		if err := fixRequestTtlOption(request, 2); err != nil {
+			return err
+		}
+	case "SETEX":
+		seconds, err := request.GetArgumentInt(1)
+		if err != nil {
+			return err
+		}
+
+		seconds -= int(time.Now().Unix() - request.Timestamp)
+		request.Args[1] = []byte(strconv.Itoa(seconds))
+	case "EXPIRE":
+		seconds, err := request.GetArgumentInt(1)
+		if err != nil {
+			return err
+		}
+
+		seconds -= int(time.Now().Unix() - request.Timestamp)
+		request.Args[1] = []byte(strconv.Itoa(seconds))
+	default:
+		//do nothing. Just a placeholder to save correct syntax w/o ttl-related commands
+	}
+
+	return nil
+}
+
+// WalRequest returns request that should be logged into WAL instead of provided one.
+// Non-deterministic requests are replaced with deterministic equivalent, built from the response,
+// requests with relative TTL are replaced with equivalent with absolute expiration time
+func (p *Processor) WalRequest(request *message.Request, response message.Response) *message.Request {
+	switch request.Cmd {
+	case "SPOP":
+		if response.Status() != message.StatusOk {
+			// the response isn't a result to replay, e.g. SPOP of not existing key
+			return request
+		}
+		walRequest := *request
+		walRequest.Cmd = "SREM"
+		walRequest.Args = append(append([][]byte{}, request.Args...), response.Bytes()...)
+		return &walRequest
+	case "SET":
+		return walRequestAbsoluteTtlOption(request, 2)
+	case "SETEX":
+		return walRequestAbsoluteTtl(request, 1, time.Second, "SET $0 $2 PXAT $1")
+	case "EXPIRE":
+		return walRequestAbsoluteTtl(request, 1, time.Second, "PEXPIREAT $0 $1")
+	case "HEXPIRE":
+		return walRequestAbsoluteTtl(request, 1, time.Second, "HPEXPIREAT $0 $1 $2...")
+	case "HPEXPIRE":
+		return walRequestAbsoluteTtl(request, 1, time.Millisecond, "HPEXPIREAT $0 $1 $2...")
+	case "RESTORE":
+		return walRequestAbsoluteTtl(request, 1, time.Millisecond, "RESTORE $0 $1 $2... ABSTTL")
+	case "PEXPIRE":
+		return walRequestAbsoluteTtl(request, 1, time.Millisecond, "PEXPIREAT $0 $1")
+	case "PSETEX":
+		return walRequestAbsoluteTtl(request, 1, time.Millisecond, "SET $0 $2 PXAT $1")
+	default:
+		return request
+	}
+}
+
+// Keys returns keys of the request, e.g. to find out a node of the cluster, which serves them
+func (p *Processor) Keys(request *message.Request) []string {
+	switch request.Cmd {
+	case "GET", "SET", "SETEX", "HSET", "HGET", "HKEYS", "HGETALL", "HDEL", "LLEN", "LRANGE", "LINDEX", "LSET", "LPUSH", "LPOP", "TTL", "EXPIRE", "PERSIST", "INCR", "DECR", "DECRBY", "INCRBY", "INCRBYFLOAT", "HINCRBY", "HINCRBYFLOAT", "HMGET", "HEXISTS", "HLEN", "HVALS", "HSTRLEN", "HSETNX", "HRANDFIELD", "HEXPIRE", "HPEXPIRE", "HPEXPIREAT", "HTTL", "HPERSIST", "DUMP", "RESTORE", "TYPE", "RPUSH", "RPOP", "LINSERT", "LREM", "LTRIM", "HSCAN", "SSCAN", "ZSCAN", "SADD", "SREM", "SMEMBERS", "SISMEMBER", "SCARD", "SPOP", "SRANDMEMBER", "APPEND", "STRLEN", "GETRANGE", "SETRANGE", "GETSET", "GETDEL", "SETNX", "PTTL", "EXPIRETIME", "PEXPIRE", "EXPIREAT", "PEXPIREAT", "PSETEX", "ZADD", "ZINCRBY", "ZREM", "ZSCORE", "ZCARD", "ZRANK", "ZCOUNT", "ZRANGE", "ZREVRANGE", "ZRANGEBYSCORE", "ZPOPMIN", "ZPOPMAX":
+		return requestKeys(request, []int{0}, 0, 0)
+	case "DEL", "EXISTS", "TOUCH", "UNLINK", "SINTER", "SUNION", "SDIFF", "MGET":
+		return requestKeys(request, nil, 0, 1)
+	case "RENAME", "RENAMENX", "RPOPLPUSH", "LMOVE":
+		return requestKeys(request, []int{0, 1}, 0, 0)
+	case "SINTERSTORE", "SUNIONSTORE", "SDIFFSTORE":
+		return requestKeys(request, []int{0}, 1, 1)
+	case "MSET", "MSETNX":
+		return requestKeys(request, nil, 0, 2)
+	default:
+		return nil
+	}
 }
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"github.com/mshaverdo/radish/core"
+	"github.com/mshaverdo/radish/message"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fixRequestTtlOption corrects TTL passed as optional keyword argument, like SET key value EX 10, beginning from index i.
+// Relative EX/PX options are replaced with absolute PXAT, calculated from request timestamp,
+// so already expired values will be restored as expired ones. Absolute EXAT/PXAT don't need any correction.
+func fixRequestTtlOption(request *message.Request, i int) error {
+	return absoluteTtlOption(request.Args, i, request.Timestamp*1000)
+}
+
+// walRequestAbsoluteTtl replaces request with relative TTL at argument i in unit by the equivalent one
+// with absolute expiration time, built from template, so WAL replay doesn't depend on the time passed
+// since the request was processed. Template is a command label followed by arguments: $N is N-th argument
+// of the request, $N... is the rest of arguments beginning from N, and others are keywords. $i is replaced
+// with milliseconds-timestamp. Request with non-positive TTL doesn't depend on time, so it's returned as is,
+// as well as request, which rest arguments already contain a keyword, that template appends, e.g. RESTORE ABSTTL
+func walRequestAbsoluteTtl(request *message.Request, i int, unit time.Duration, template string) *message.Request {
+	ttl, err := request.GetArgumentInt(i)
+	if err != nil || ttl <= 0 {
+		return request
+	}
+
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+	expireAt := []byte(strconv.FormatInt(nowMs+int64(ttl)*int64(unit/time.Millisecond), 10))
+
+	words := strings.Fields(template)
+	walRequest := *request
+	walRequest.Cmd = words[0]
+	walRequest.Args = nil
+
+	var rest [][]byte
+	for _, word := range words[1:] {
+		if !strings.HasPrefix(word, "$") {
+			for _, v := range rest {
+				if strings.ToUpper(string(v)) == word {
+					return request
+				}
+			}
+			walRequest.Args = append(walRequest.Args, []byte(word))
+			continue
+		}
+
+		isRest := strings.HasSuffix(word, "...")
+		n, _ := strconv.Atoi(strings.TrimSuffix(word[1:], "..."))
+		switch {
+		case n == i:
+			walRequest.Args = append(walRequest.Args, expireAt)
+		case isRest && n <= request.ArgumentsLen():
+			rest = request.Args[n:]
+			walRequest.Args = append(walRequest.Args, rest...)
+		case n < request.ArgumentsLen():
+			walRequest.Args = append(walRequest.Args, request.Args[n])
+		default:
+			// malformed request isn't processed successfully, so it shouldn't get here
+			return request
+		}
+	}
+
+	return &walRequest
+}
+
+// walRequestAbsoluteTtlOption replaces relative EX/PX options of request, beginning from index i,
+// with absolute PXAT, so WAL replay doesn't depend on the time passed since the request was processed
+func walRequestAbsoluteTtlOption(request *message.Request, i int) *message.Request {
+	walRequest := *request
+	walRequest.Args = append([][]byte{}, request.Args...)
+	if err := absoluteTtlOption(walRequest.Args, i, time.Now().UnixNano()/int64(time.Millisecond)); err != nil {
+		return request
+	}
+
+	return &walRequest
+}
+
+// hasRequestOption returns true, if optional keyword arguments of the request, beginning from index i, contain option
+func hasRequestOption(request *message.Request, i int, option string) bool {
+	for _, v := range request.GetArgumentOptionalString(i) {
+		if strings.ToUpper(v) == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requestKeys returns keys of the request: arguments at keyArgs indexes and the rest arguments
+// beginning from keysFrom with keysStep, if keysStep isn't zero
+func requestKeys(request *message.Request, keyArgs []int, keysFrom, keysStep int) (keys []string) {
+	for _, i := range keyArgs {
+		if i < request.ArgumentsLen() {
+			keys = append(keys, string(request.Args[i]))
+		}
+	}
+
+	if keysStep > 0 {
+		for i := keysFrom; i < request.ArgumentsLen(); i += keysStep {
+			keys = append(keys, string(request.Args[i]))
+		}
+	}
+
+	return keys
+}
+
+// absoluteTtlOption replaces relative EX/PX options in args beginning from index i
+// with absolute PXAT, calculated from baseMs. Absolute EXAT/PXAT options are left as is.
+func absoluteTtlOption(args [][]byte, i int, baseMs int64) error {
+	for ; i < len(args); i++ {
+		switch option := strings.ToUpper(string(args[i])); option {
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return core.ErrSyntax
+			}
+
+			ttl, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return err
+			}
+
+			if option == "EX" {
+				ttl *= 1000
+			}
+
+			args[i] = []byte("PXAT")
+			args[i+1] = []byte(strconv.FormatInt(baseMs+ttl, 10))
+			i++
+		case "EXAT", "PXAT":
+			i++
+		}
+	}
+
+	return nil
+}
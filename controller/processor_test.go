@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/mshaverdo/radish/controller"
 	"github.com/mshaverdo/radish/message"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -31,6 +32,30 @@ func TestProcessor_FixRequestTtl(t *testing.T) {
 			},
 			[]string{"KEY", "10", "DATA"},
 		},
+		{
+			&message.Request{
+				Timestamp: nowMinus5.Unix(),
+				Cmd:       "SET",
+				Args:      [][]byte{[]byte("KEY"), []byte("EX"), []byte("NX"), []byte("ex"), []byte("15")},
+			},
+			[]string{"KEY", "EX", "NX", "PXAT", fmt.Sprint(nowMinus5.Unix()*1000 + 15000)},
+		},
+		{
+			&message.Request{
+				Timestamp: nowMinus5.Unix(),
+				Cmd:       "SET",
+				Args:      [][]byte{[]byte("KEY"), []byte("DATA"), []byte("PX"), []byte("1500"), []byte("GET")},
+			},
+			[]string{"KEY", "DATA", "PXAT", fmt.Sprint(nowMinus5.Unix()*1000 + 1500), "GET"},
+		},
+		{
+			&message.Request{
+				Timestamp: nowMinus5.Unix(),
+				Cmd:       "SET",
+				Args:      [][]byte{[]byte("KEY"), []byte("DATA"), []byte("EXAT"), []byte("1500")},
+			},
+			[]string{"KEY", "DATA", "EXAT", "1500"},
+		},
 		{
 			&message.Request{
 				Timestamp: nowMinus5.Unix(),
@@ -52,3 +77,120 @@ func TestProcessor_FixRequestTtl(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessor_WalRequest(t *testing.T) {
+	tests := []struct {
+		request  *message.Request
+		response message.Response
+		wantCmd  string
+		wantArgs []string
+	}{
+		{
+			message.NewRequest("SPOP", [][]byte{[]byte("KEY")}),
+			message.NewResponseString(message.StatusOk, []byte("MEMBER")),
+			"SREM",
+			[]string{"KEY", "MEMBER"},
+		},
+		{
+			message.NewRequest("SPOP", [][]byte{[]byte("KEY")}),
+			message.NewResponseStatus(message.StatusNotFound, "item not found"),
+			"SPOP",
+			[]string{"KEY"},
+		},
+		{
+			message.NewRequest("SADD", [][]byte{[]byte("KEY"), []byte("MEMBER")}),
+			message.NewResponseInt(message.StatusOk, 1),
+			"SADD",
+			[]string{"KEY", "MEMBER"},
+		},
+	}
+
+	for _, tst := range tests {
+		p := controller.NewProcessor(nil)
+		got := p.WalRequest(tst.request, tst.response)
+
+		if got.Cmd != tst.wantCmd {
+			t.Errorf("WalRequest(%q): %q != %q", tst.request.Cmd, got.Cmd, tst.wantCmd)
+		}
+		if gotArgs, wantArgs := fmt.Sprintf("%q", got.Args), fmt.Sprintf("%q", tst.wantArgs); gotArgs != wantArgs {
+			t.Errorf("WalRequest(%q): %s != %s", tst.request.Cmd, gotArgs, wantArgs)
+		}
+		if got.Timestamp != tst.request.Timestamp {
+			t.Errorf("WalRequest(%q) timestamp: %d != %d", tst.request.Cmd, got.Timestamp, tst.request.Timestamp)
+		}
+	}
+}
+
+func TestProcessor_WalRequestAbsoluteTtl(t *testing.T) {
+	tests := []struct {
+		request  *message.Request
+		wantCmd  string
+		wantArgs []string
+		ttlIndex int
+		ttl      int64
+	}{
+		{newRequest("EXPIRE", "KEY", "15"), "PEXPIREAT", []string{"KEY", ""}, 1, 15000},
+		{newRequest("PEXPIRE", "KEY", "1500"), "PEXPIREAT", []string{"KEY", ""}, 1, 1500},
+		{newRequest("SETEX", "KEY", "15", "DATA"), "SET", []string{"KEY", "DATA", "PXAT", ""}, 3, 15000},
+		{newRequest("PSETEX", "KEY", "1500", "DATA"), "SET", []string{"KEY", "DATA", "PXAT", ""}, 3, 1500},
+		{newRequest("SETEX", "KEY", "-1", "DATA"), "SETEX", []string{"KEY", "-1", "DATA"}, -1, 0},
+		{newRequest("SET", "KEY", "DATA", "NX", "ex", "15"), "SET", []string{"KEY", "DATA", "NX", "PXAT", ""}, 4, 15000},
+		{newRequest("SET", "KEY", "DATA", "PXAT", "15"), "SET", []string{"KEY", "DATA", "PXAT", "15"}, -1, 0},
+		{newRequest("PEXPIREAT", "KEY", "15"), "PEXPIREAT", []string{"KEY", "15"}, -1, 0},
+		{newRequest("HEXPIRE", "KEY", "15", "NX", "FIELDS", "1", "F"), "HPEXPIREAT", []string{"KEY", "", "NX", "FIELDS", "1", "F"}, 1, 15000},
+		{newRequest("HPEXPIRE", "KEY", "1500", "FIELDS", "1", "F"), "HPEXPIREAT", []string{"KEY", "", "FIELDS", "1", "F"}, 1, 1500},
+		{newRequest("RESTORE", "KEY", "1500", "DATA", "REPLACE"), "RESTORE", []string{"KEY", "", "DATA", "REPLACE", "ABSTTL"}, 1, 1500},
+		{newRequest("RESTORE", "KEY", "0", "DATA"), "RESTORE", []string{"KEY", "0", "DATA"}, -1, 0},
+		{newRequest("RESTORE", "KEY", "15", "DATA", "absttl"), "RESTORE", []string{"KEY", "15", "DATA", "absttl"}, -1, 0},
+	}
+
+	for _, tst := range tests {
+		p := controller.NewProcessor(nil)
+		before := time.Now().UnixNano() / int64(time.Millisecond)
+		got := p.WalRequest(tst.request, message.NewResponseInt(message.StatusOk, 1))
+		after := time.Now().UnixNano() / int64(time.Millisecond)
+
+		if got.Cmd != tst.wantCmd {
+			t.Errorf("WalRequest(%q): %q != %q", tst.request.Cmd, got.Cmd, tst.wantCmd)
+		}
+		if len(got.Args) != len(tst.wantArgs) {
+			t.Errorf("WalRequest(%q): %q != %q", tst.request.Cmd, got.Args, tst.wantArgs)
+			continue
+		}
+
+		for i, want := range tst.wantArgs {
+			if i == tst.ttlIndex {
+				expireAt, _ := strconv.ParseInt(string(got.Args[i]), 10, 64)
+				if expireAt < before+tst.ttl || expireAt > after+tst.ttl {
+					t.Errorf("WalRequest(%q) expire at: %d not in [%d, %d]", tst.request.Cmd, expireAt, before+tst.ttl, after+tst.ttl)
+				}
+			} else if string(got.Args[i]) != want {
+				t.Errorf("WalRequest(%q): %q != %q", tst.request.Cmd, got.Args, tst.wantArgs)
+			}
+		}
+	}
+}
+
+func TestProcessor_Keys(t *testing.T) {
+	tests := []struct {
+		request *message.Request
+		want    []string
+	}{
+		{newRequest("GET", "KEY"), []string{"KEY"}},
+		{newRequest("SET", "KEY", "DATA", "EX", "15"), []string{"KEY"}},
+		{newRequest("MGET", "K1", "K2", "K3"), []string{"K1", "K2", "K3"}},
+		{newRequest("MSET", "K1", "V1", "K2", "V2"), []string{"K1", "K2"}},
+		{newRequest("RENAME", "K1", "K2"), []string{"K1", "K2"}},
+		{newRequest("SDIFFSTORE", "DEST", "K1", "K2"), []string{"DEST", "K1", "K2"}},
+		{newRequest("GET"), nil},
+		{newRequest("KEYS", "*"), nil},
+		{newRequest("DBSIZE"), nil},
+	}
+
+	p := controller.NewProcessor(nil)
+	for _, tst := range tests {
+		if got := p.Keys(tst.request); fmt.Sprint(got) != fmt.Sprint(tst.want) {
+			t.Errorf("Keys(%s %q): %q != %q", tst.request.Cmd, tst.request.Args, got, tst.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/message"
+	"github.com/mshaverdo/radish/pubsub"
+	"strings"
+)
+
+// NewSubscriber returns subscriber without subscriptions. It should be closed, when it isn't needed anymore
+func (c *Controller) NewSubscriber() *pubsub.Subscriber {
+	return c.broker.NewSubscriber()
+}
+
+// isPubSubRequest returns true, if request should be handled by processPubSubRequest()
+func isPubSubRequest(request *message.Request) bool {
+	return request.Cmd == "PUBLISH" || request.Cmd == "PUBSUB"
+}
+
+// processPubSubRequest handles PUBLISH channel message and PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT.
+// Published messages aren't stored, so they never reach the WAL
+func (c *Controller) processPubSubRequest(request *message.Request) message.Response {
+	argsLen := request.ArgumentsLen()
+	if request.Cmd == "PUBLISH" {
+		if argsLen != 2 {
+			return getResponseInvalidArguments(request.Cmd, errors.New("wrong number of arguments"))
+		}
+
+		return getResponseIntPayload(c.broker.Publish(string(request.Args[0]), request.Args[1]))
+	}
+
+	if argsLen == 0 {
+		return getResponseInvalidArguments(request.Cmd, errors.New("wrong number of arguments"))
+	}
+
+	switch subcommand := strings.ToUpper(string(request.Args[0])); {
+	case subcommand == "CHANNELS" && argsLen <= 2:
+		pattern := ""
+		if argsLen == 2 {
+			pattern = string(request.Args[1])
+		}
+
+		return getResponseStringSlicePayload(stringsSliceToBytesSlise(c.broker.Channels(pattern)))
+	case subcommand == "NUMSUB":
+		// reply is flat list of channels, each one followed by the number of its subscribers
+		responses := []message.Response{}
+		for _, channel := range request.Args[1:] {
+			responses = append(
+				responses,
+				getResponseStringPayload(channel),
+				getResponseIntPayload(c.broker.NumSub(string(channel))),
+			)
+		}
+
+		return message.NewResponseSlice(message.StatusOk, responses)
+	case subcommand == "NUMPAT" && argsLen == 1:
+		return getResponseIntPayload(c.broker.NumPat())
+	default:
+		return getResponseInvalidArguments(request.Cmd, errors.New("unknown subcommand or wrong number of arguments for '"+subcommand+"'"))
+	}
+}
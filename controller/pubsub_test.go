@@ -0,0 +1,115 @@
+package controller_test
+
+import (
+	"github.com/go-test/deep"
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/message"
+	"testing"
+)
+
+func TestController_PubSub(t *testing.T) {
+	c := controller.New("", 0, "", 0, 0, 0, false)
+
+	subscriber := c.NewSubscriber()
+	defer subscriber.Close()
+	subscriber.Subscribe([]string{"news"})
+	subscriber.PSubscribe([]string{"n*"})
+
+	tests := []struct {
+		request    *message.Request
+		wantStatus message.Status
+		want       []string
+	}{
+		{newRequest("PUBLISH", "news", "hello"), message.StatusOk, []string{"2"}},
+		{newRequest("PUBLISH", "sport", "hello"), message.StatusOk, []string{"0"}},
+		{newRequest("EVAL", "return redis.call('PUBLISH', 'news', 'from script')", "0"), message.StatusOk, []string{"2"}},
+		{newRequest("PUBLISH", "news"), message.StatusInvalidArguments, nil},
+		{newRequest("PUBSUB", "CHANNELS"), message.StatusOk, []string{"news"}},
+		{newRequest("PUBSUB", "CHANNELS", "s*"), message.StatusOk, []string{}},
+		{newRequest("PUBSUB", "NUMSUB", "news", "sport"), message.StatusOk, []string{"news", "1", "sport", "0"}},
+		{newRequest("PUBSUB", "NUMPAT"), message.StatusOk, []string{"1"}},
+		{newRequest("PUBSUB", "HELP"), message.StatusInvalidArguments, nil},
+	}
+
+	for _, tst := range tests {
+		response := c.HandleMessage(tst.request)
+		if response.Status() != tst.wantStatus {
+			t.Errorf("%s %q: status %s != %s", tst.request.Cmd, tst.request.Args, response.Status(), tst.wantStatus)
+		}
+
+		if tst.want == nil {
+			continue
+		}
+
+		got := make([]string, len(response.Bytes()))
+		for i, v := range response.Bytes() {
+			got[i] = string(v)
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("%s %q: %s\n\ngot:%v\n\nwant:%v", tst.request.Cmd, tst.request.Args, diff, got, tst.want)
+		}
+	}
+
+	if got := len(subscriber.Messages()); got != 4 {
+		t.Errorf("received %d messages != 4", got)
+	}
+}
+
+func TestController_KeyspaceNotifications(t *testing.T) {
+	c := controller.New("", 0, "", 0, 0, 0, false)
+
+	subscriber := c.NewSubscriber()
+	defer subscriber.Close()
+	subscriber.PSubscribe([]string{"__key*@0__:*"})
+
+	tests := []struct {
+		request    *message.Request
+		wantStatus message.Status
+		want       []string
+	}{
+		{newRequest("CONFIG", "GET", "notify-*"), message.StatusOk, []string{"notify-keyspace-events", ""}},
+		{newRequest("SET", "key", "value"), message.StatusOk, nil},
+		{newRequest("CONFIG", "SET", "notify-keyspace-events", "Kt"), message.StatusInvalidArguments, nil},
+		{newRequest("CONFIG", "SET", "save", "1"), message.StatusInvalidArguments, nil},
+		{newRequest("CONFIG", "SET", "NOTIFY-KEYSPACE-EVENTS", "KEg$"), message.StatusOk, nil},
+		{newRequest("CONFIG", "GET", "notify-keyspace-events"), message.StatusOk, []string{"notify-keyspace-events", "KEg$"}},
+		{newRequest("CONFIG", "GET", "save"), message.StatusOk, []string{}},
+		{newRequest("SET", "key", "value"), message.StatusOk, nil},
+		{newRequest("LPUSH", "list", "value"), message.StatusOk, nil},
+		{newRequest("EVAL", "return redis.call('DEL', KEYS[1])", "1", "key"), message.StatusOk, []string{"1"}},
+	}
+
+	for _, tst := range tests {
+		response := c.HandleMessage(tst.request)
+		if response.Status() != tst.wantStatus {
+			t.Errorf("%s %q: status %s != %s", tst.request.Cmd, tst.request.Args, response.Status(), tst.wantStatus)
+		}
+
+		if tst.want == nil {
+			continue
+		}
+
+		got := make([]string, len(response.Bytes()))
+		for i, v := range response.Bytes() {
+			got[i] = string(v)
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("%s %q: %s\n\ngot:%v\n\nwant:%v", tst.request.Cmd, tst.request.Args, diff, got, tst.want)
+		}
+	}
+
+	want := []string{
+		"__keyspace@0__:key set",
+		"__keyevent@0__:set key",
+		"__keyspace@0__:key del",
+		"__keyevent@0__:del key",
+	}
+	var got []string
+	for len(subscriber.Messages()) > 0 {
+		msg := <-subscriber.Messages()
+		got = append(got, msg.Channel+" "+string(msg.Payload))
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("%s\n\ngot:%q\n\nwant:%q", diff, got, want)
+	}
+}
@@ -0,0 +1,439 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// configuration
+var (
+	// ReplicaReconnectInterval is the delay before the replica reconnects to the master after a failure
+	ReplicaReconnectInterval = 1 * time.Second
+
+	// ReplicaTimeout is the time of silence of the master, after which the replica reconnects.
+	// It must be greater than ReplicationPingInterval
+	ReplicaTimeout = 5 * time.Second
+)
+
+const (
+	replicaStateConnect   = "connect"
+	replicaStateSync      = "sync"
+	replicaStateConnected = "connected"
+)
+
+var (
+	ErrReadOnly            = errors.New("You can't write against a read only replica.")
+	ErrReplicationProtocol = errors.New("malformed replication stream")
+)
+
+// replica is a state of the replication from the master
+type replica struct {
+	host string
+	port int
+
+	// lastMessageId is Id of the last master's WAL record, applied by the replica. Accessed atomically
+	lastMessageId int64
+
+	stateMutex sync.Mutex
+	state      string
+
+	isStarted bool
+	stopChan  chan struct{}
+	doneChan  chan struct{}
+}
+
+func newReplica(host string, port int) *replica {
+	return &replica{
+		host:     host,
+		port:     port,
+		state:    replicaStateConnect,
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+}
+
+func (r *replica) addr() string {
+	return net.JoinHostPort(r.host, strconv.Itoa(r.port))
+}
+
+func (r *replica) setState(state string) {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	r.state = state
+}
+
+func (r *replica) getState() string {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	return r.state
+}
+
+// stop stops the replication and waits until it finishes
+func (r *replica) stop() {
+	close(r.stopChan)
+	if r.isStarted {
+		<-r.doneChan
+	}
+}
+
+// ReplicaOf makes the server a read-only replica of the master at host:port.
+// Empty host stops the replication and makes the server a master, keeping the replicated data
+func (c *Controller) ReplicaOf(host string, port int) {
+	c.replicaMutex.Lock()
+	defer c.replicaMutex.Unlock()
+
+	if c.replica != nil {
+		if c.replica.host == host && c.replica.port == port {
+			return
+		}
+
+		c.replica.stop()
+		c.replica = nil
+	}
+
+	if host == "" {
+		atomic.StoreInt32(&c.isReplicaFlag, 0)
+		log.Notice("Replication stopped, serving as a master")
+		return
+	}
+
+	c.replica = newReplica(host, port)
+	atomic.StoreInt32(&c.isReplicaFlag, 1)
+
+	if c.isRunning() {
+		c.startReplicaLocked()
+	}
+}
+
+// startReplica starts replication, requested by ReplicaOf() before the server started
+func (c *Controller) startReplica() {
+	c.replicaMutex.Lock()
+	defer c.replicaMutex.Unlock()
+
+	c.startReplicaLocked()
+}
+
+// startReplicaLocked MUST be invoked only while c.replicaMutex locked!
+func (c *Controller) startReplicaLocked() {
+	if c.replica == nil || c.replica.isStarted {
+		return
+	}
+
+	c.replica.isStarted = true
+	go c.runReplica(c.replica)
+}
+
+// stopReplica stops replication, keeping the server a read-only replica
+func (c *Controller) stopReplica() {
+	c.replicaMutex.Lock()
+	defer c.replicaMutex.Unlock()
+
+	if c.replica != nil {
+		c.replica.stop()
+		c.replica = nil
+	}
+}
+
+// isReadOnlyRequest returns true, if request modifies the storage and the server is a replica
+func (c *Controller) isReadOnlyRequest(request *message.Request) bool {
+	return atomic.LoadInt32(&c.isReplicaFlag) == 1 && c.processor.IsModifyingRequest(request)
+}
+
+// isReplicationRequest returns true, if request should be handled by processReplicationRequest()
+func isReplicationRequest(request *message.Request) bool {
+	switch request.Cmd {
+	case "REPLICAOF", "SLAVEOF", "ROLE":
+		return true
+	default:
+		return false
+	}
+}
+
+// processReplicationRequest handles REPLICAOF host port, REPLICAOF NO ONE and ROLE
+func (c *Controller) processReplicationRequest(request *message.Request) message.Response {
+	// arguments of ROLE are ignored, since HTTP API passes an empty one
+	if request.Cmd == "ROLE" {
+		return c.role()
+	}
+
+	if request.ArgumentsLen() != 2 {
+		return getResponseInvalidArguments(request.Cmd, errors.New("wrong number of arguments"))
+	}
+
+	host := string(request.Args[0])
+	if strings.ToUpper(host) == "NO" && strings.ToUpper(string(request.Args[1])) == "ONE" {
+		c.ReplicaOf("", 0)
+		return getResponseStatusOkPayload()
+	}
+
+	port, err := request.GetArgumentInt(1)
+	if err != nil || port <= 0 || port > 65535 {
+		return getResponseInvalidArguments(request.Cmd, errors.New("invalid master port"))
+	}
+
+	c.ReplicaOf(host, port)
+
+	return getResponseStatusOkPayload()
+}
+
+// role builds ROLE response: "master" and Id of the last WAL record for a master,
+// "slave", master host, master port, replication state and Id of the last applied master's record for a replica
+func (c *Controller) role() message.Response {
+	c.replicaMutex.Lock()
+	defer c.replicaMutex.Unlock()
+
+	if c.replica == nil {
+		var lastMessageId int64
+		if c.isPersistent && c.isRunning() {
+			lastMessageId = c.keeper.LastMessageId()
+		}
+
+		return message.NewResponseSlice(message.StatusOk, []message.Response{
+			getResponseStringPayload([]byte("master")),
+			getResponseIntPayload(int(lastMessageId)),
+		})
+	}
+
+	return message.NewResponseSlice(message.StatusOk, []message.Response{
+		getResponseStringPayload([]byte("slave")),
+		getResponseStringPayload([]byte(c.replica.host)),
+		getResponseIntPayload(c.replica.port),
+		getResponseStringPayload([]byte(c.replica.getState())),
+		getResponseIntPayload(int(atomic.LoadInt64(&c.replica.lastMessageId))),
+	})
+}
+
+// runReplica replicates the master until the replication is stopped, reconnecting after failures
+func (c *Controller) runReplica(r *replica) {
+	defer close(r.doneChan)
+
+	for {
+		err := c.syncWithMaster(r)
+
+		select {
+		case <-r.stopChan:
+			return
+		default:
+		}
+
+		log.Warningf("Replication from %s failed: %s", r.addr(), err)
+		r.setState(replicaStateConnect)
+
+		select {
+		case <-r.stopChan:
+			return
+		case <-time.After(ReplicaReconnectInterval):
+		}
+	}
+}
+
+// syncWithMaster requests the master to continue replication from the last applied record,
+// loads the snapshot, if the master responded with the full synchronization, and applies received records
+func (c *Controller) syncWithMaster(r *replica) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-r.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// the master sends keepalive records, so the silence means the connection is lost
+	watchdog := time.AfterFunc(ReplicaTimeout, cancel)
+	defer watchdog.Stop()
+
+	r.setState(replicaStateConnect)
+	stream, err := c.dialMaster(ctx, r.addr(), atomic.LoadInt64(&r.lastMessageId))
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	reader := bufio.NewReader(&watchedReader{stream, watchdog})
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(header)
+	switch {
+	case strings.HasPrefix(header, "-"):
+		return errors.New(strings.TrimSpace(header[1:]))
+	case len(fields) == 3 && fields[0] == "+"+replicationFullResync:
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return ErrReplicationProtocol
+		}
+
+		r.setState(replicaStateSync)
+		log.Infof("Full synchronization with master %s...", r.addr())
+		if err := c.loadMasterSnapshot(r, io.LimitReader(reader, size)); err != nil {
+			return err
+		}
+	case len(fields) == 1 && fields[0] == "+"+replicationContinue:
+		log.Infof("Continue replication from master %s at %d", r.addr(), atomic.LoadInt64(&r.lastMessageId))
+	default:
+		return ErrReplicationProtocol
+	}
+
+	r.setState(replicaStateConnected)
+
+	dec := NewGencodeDecoder(reader)
+	for {
+		record := new(message.Request)
+		if err := dec.Decode(record); err != nil {
+			return err
+		}
+
+		if record.Id == 0 && record.Cmd == replicationPingCmd {
+			continue
+		}
+
+		id := record.Id
+		if err := c.applyReplicated(record); err != nil {
+			return err
+		}
+		atomic.StoreInt64(&r.lastMessageId, id)
+	}
+}
+
+// dialMaster sends PSYNC request to the master and returns the replication stream.
+// Master and replica must serve the same API, so the replica uses its own protocol
+func (c *Controller) dialMaster(ctx context.Context, addr string, lastMessageId int64) (io.ReadCloser, error) {
+	id := strconv.FormatInt(lastMessageId, 10)
+
+	if c.useHttp {
+		request, err := http.NewRequest(http.MethodGet, "http://"+addr+"/PSYNC/"+id, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := http.DefaultClient.Do(request.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		if response.StatusCode != http.StatusOK {
+			body, _ := ioutil.ReadAll(response.Body)
+			response.Body.Close()
+			return nil, fmt.Errorf("master responded %s: %s", response.Status, body)
+		}
+
+		return response.Body, nil
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// closing the connection interrupts reading, when the replication is stopped or timed out
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	if _, err := fmt.Fprintf(conn, "*2\r\n$5\r\nPSYNC\r\n$%d\r\n%s\r\n", len(id), id); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// loadMasterSnapshot replaces the storage with the snapshot, received from the master
+func (c *Controller) loadMasterSnapshot(r *replica, snapshot io.Reader) error {
+	storage := storageFactory()
+	loader, ok := storage.(Loader)
+	if !ok {
+		return errors.New("storage not support loading")
+	}
+
+	messageId, err := loader.Load(snapshot)
+	if err != nil {
+		return err
+	}
+
+	// the rest of the snapshot must not be taken for WAL records
+	if _, err := io.Copy(ioutil.Discard, snapshot); err != nil {
+		return err
+	}
+
+	// the storage is replaced at once, so clients never see a partially loaded snapshot
+	c.txMutex.Lock()
+	defer c.txMutex.Unlock()
+
+	c.core.SetStorage(storage)
+	atomic.StoreInt64(&r.lastMessageId, messageId)
+
+	if c.isPersistent {
+		c.keeper.WaitQueued()
+		return c.keeper.ResetSnapshot()
+	}
+
+	return nil
+}
+
+// applyReplicated applies WAL record, received from the master, and writes it into the own WAL
+func (c *Controller) applyReplicated(record *message.Request) error {
+	lock, unlock := c.txMutex.RLock, c.txMutex.RUnlock
+
+	// transaction is applied under the write lock, so nothing interleaves with it like on the master
+	requests := []*message.Request{record}
+	if record.Cmd == walTransactionCmd {
+		var err error
+		if requests, err = splitWalTransaction(record); err != nil {
+			return err
+		}
+		lock, unlock = c.txMutex.Lock, c.txMutex.Unlock
+	}
+
+	lock()
+	defer unlock()
+
+	for _, request := range requests {
+		if err := processWalRequest(c.processor, request); err != nil {
+			return err
+		}
+	}
+
+	if !c.isPersistent {
+		return nil
+	}
+
+	// the replica doesn't wait for disk, like for pipelined requests
+	record.Unreliable = true
+	return c.keeper.WriteToWal(record)
+}
+
+// watchedReader postpones the watchdog on every successful read
+type watchedReader struct {
+	io.Reader
+	watchdog *time.Timer
+}
+
+func (r *watchedReader) Read(p []byte) (n int, err error) {
+	n, err = r.Reader.Read(p)
+	if n > 0 {
+		r.watchdog.Reset(ReplicaTimeout)
+	}
+
+	return n, err
+}
@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mshaverdo/radish/log"
+	"github.com/mshaverdo/radish/message"
+	"io"
+	"sync"
+	"time"
+)
+
+// configuration
+var (
+	// ReplicationBacklogSize is the size in bytes of the latest WAL records, kept in memory
+	// to let reconnected replicas continue replication without the full synchronization
+	ReplicationBacklogSize = 16 * 1024 * 1024
+
+	// ReplicaBufferSize is the count of records, buffered for a replica. A replica, which can't keep up, is disconnected
+	ReplicaBufferSize = 10000
+
+	// ReplicationPingInterval is the interval of keepalive records, sent to replicas
+	ReplicationPingInterval = 1 * time.Second
+)
+
+const (
+	replicationFullResync = "FULLRESYNC"
+	replicationContinue   = "CONTINUE"
+
+	// replicationPingCmd is the command of keepalive records. They have zero Id and are never applied
+	replicationPingCmd = "PING"
+
+	replicationBufferSize = 64 * 1024
+)
+
+var (
+	ErrReplicationNotPersistent = errors.New("replication requires persistence, the master should be run with data dir")
+	ErrReplicaOverflow          = errors.New("replica can't keep up with the master")
+)
+
+// backlogRecord is a WAL record, encoded for the replication stream
+type backlogRecord struct {
+	id    int64
+	frame []byte
+}
+
+// replicationBacklog keeps the latest WAL records and delivers new records to the replication streams
+type replicationBacklog struct {
+	mutex   sync.Mutex
+	records []backlogRecord
+	size    int
+
+	// floorId is Id of the last record evicted from the backlog, so the backlog contains all the records after it
+	floorId int64
+	streams map[chan []byte]struct{}
+}
+
+func newReplicationBacklog(lastMessageId int64) *replicationBacklog {
+	return &replicationBacklog{floorId: lastMessageId, streams: make(map[chan []byte]struct{})}
+}
+
+// append adds the record into the backlog and delivers it to the streams. Overflowed streams are closed
+func (b *replicationBacklog) append(request *message.Request) {
+	frame, err := encodeReplicationRecord(request)
+	if err != nil {
+		log.Errorf("Unable to encode replication record: %s", err)
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.records = append(b.records, backlogRecord{id: request.Id, frame: frame})
+	b.size += len(frame)
+	for b.size > ReplicationBacklogSize && len(b.records) > 0 {
+		b.floorId = b.records[0].id
+		b.size -= len(b.records[0].frame)
+		b.records = b.records[1:]
+	}
+
+	for stream := range b.streams {
+		select {
+		case stream <- frame:
+		default:
+			delete(b.streams, stream)
+			close(stream)
+		}
+	}
+}
+
+// subscribe returns encoded records after lastMessageId and the stream of the following records.
+// ok is false, if the backlog doesn't contain all the records between lastMessageId and currentMessageId
+func (b *replicationBacklog) subscribe(lastMessageId, currentMessageId int64) (frames [][]byte, stream chan []byte, ok bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if lastMessageId < b.floorId || lastMessageId > currentMessageId {
+		return nil, nil, false
+	}
+
+	for _, record := range b.records {
+		if record.id > lastMessageId {
+			frames = append(frames, record.frame)
+		}
+	}
+
+	stream = make(chan []byte, ReplicaBufferSize)
+	b.streams[stream] = struct{}{}
+
+	return frames, stream, true
+}
+
+// unsubscribe stops delivering records to the stream
+func (b *replicationBacklog) unsubscribe(stream chan []byte) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.streams[stream]; ok {
+		delete(b.streams, stream)
+		close(stream)
+	}
+}
+
+// Replicate streams modifications of the storage to the replica, which has applied WAL records up to lastMessageId.
+// The stream begins with "+CONTINUE\r\n" line, if the replica could continue from lastMessageId,
+// or with "+FULLRESYNC <message id> <size>\r\n" line followed by the snapshot of the storage,
+// and goes on with WAL records, encoded like in WAL files. Error is written as "-ERR <message>\r\n" line
+func (c *Controller) Replicate(w io.Writer, lastMessageId int64) error {
+	if !c.isPersistent {
+		fmt.Fprintf(w, "-ERR %s\r\n", ErrReplicationNotPersistent)
+		return ErrReplicationNotPersistent
+	}
+
+	header, snapshot, frames, stream, err := c.startReplication(lastMessageId)
+	if err != nil {
+		fmt.Fprintf(w, "-ERR %s\r\n", err)
+		return err
+	}
+	defer c.backlog.unsubscribe(stream)
+
+	pingFrame, err := encodeReplicationRecord(message.NewRequest(replicationPingCmd, nil))
+	if err != nil {
+		return err
+	}
+
+	// write errors are sticky, so they are checked by Flush()
+	bw := bufio.NewWriterSize(w, replicationBufferSize)
+	bw.WriteString(header)
+	bw.Write(snapshot)
+	for _, frame := range frames {
+		bw.Write(frame)
+	}
+
+	ping := time.NewTicker(ReplicationPingInterval)
+	defer ping.Stop()
+
+	for {
+		if len(stream) == 0 {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case frame, ok := <-stream:
+			if !ok {
+				return ErrReplicaOverflow
+			}
+			bw.Write(frame)
+		case <-ping.C:
+			bw.Write(pingFrame)
+		case <-c.stopChan:
+			bw.Flush()
+			return ErrServerShutdown
+		}
+	}
+}
+
+// startReplication returns header of the replication stream, the snapshot for the full synchronization,
+// WAL records after lastMessageId, if the replica could continue replication, and the stream of the following records
+func (c *Controller) startReplication(lastMessageId int64) (header string, snapshot []byte, frames [][]byte, stream chan []byte, err error) {
+	// nothing is processed, while the snapshot is captured and the stream is subscribed, so the replica misses no records
+	c.txMutex.Lock()
+
+	c.keeper.WaitQueued()
+	currentMessageId := c.keeper.LastMessageId()
+
+	if c.backlog == nil {
+		c.backlog = newReplicationBacklog(currentMessageId)
+		c.keeper.SetWalListener(c.backlog.append)
+	}
+
+	if frames, stream, ok := c.backlog.subscribe(lastMessageId, currentMessageId); ok {
+		c.txMutex.Unlock()
+		return "+" + replicationContinue + "\r\n", nil, frames, stream, nil
+	}
+
+	persister, ok := c.core.Storage().(Persister)
+	if !ok {
+		c.txMutex.Unlock()
+		return "", nil, nil, nil, errors.New("storage not support persistence")
+	}
+
+	captured := persister.Snapshot()
+	frames, stream, _ = c.backlog.subscribe(currentMessageId, currentMessageId)
+	c.txMutex.Unlock()
+
+	// the snapshot is encoded, while requests are processed again
+	buf := &bytes.Buffer{}
+	if err := captured.Persist(buf, currentMessageId); err != nil {
+		c.backlog.unsubscribe(stream)
+		return "", nil, nil, nil, err
+	}
+
+	header = fmt.Sprintf("+%s %d %d\r\n", replicationFullResync, currentMessageId, buf.Len())
+
+	return header, buf.Bytes(), frames, stream, nil
+}
+
+// encodeReplicationRecord encodes request like it's encoded in WAL files
+func encodeReplicationRecord(request *message.Request) (frame []byte, err error) {
+	buf := &bytes.Buffer{}
+	if err := NewGencodeEncoder(buf).Encode(request); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
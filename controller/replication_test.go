@@ -0,0 +1,186 @@
+package controller_test
+
+import (
+	"bufio"
+	"errors"
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/message"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServer starts controller at a free port and waits until it accepts connections.
+// configure functions are invoked before the controller starts
+func startServer(t *testing.T, dataDir string, configure ...func(c *controller.Controller) error) (c *controller.Controller, port int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port = l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	c = controller.New("127.0.0.1", port, dataDir, controller.SyncNever, time.Hour, time.Hour, false)
+	for _, f := range configure {
+		if err := f(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go c.ListenAndServe()
+
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port)); err == nil {
+			conn.Close()
+			return c, port
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("server at %d not started", port)
+	return nil, 0
+}
+
+// waitValue waits until GET key responds value
+func waitValue(c *controller.Controller, key, value string) bool {
+	for i := 0; i < 300; i++ {
+		if response := c.HandleMessage(newRequest("GET", key)); len(response.Bytes()) > 0 && string(response.Bytes()[0]) == value {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return false
+}
+
+func TestController_Replication(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "radish_master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	master, masterPort := startServer(t, dataDir)
+	defer master.Shutdown()
+	replica, _ := startServer(t, "")
+	defer replica.Shutdown()
+
+	master.HandleMessage(newRequest("SET", "snapshot", "1"))
+	master.HandleMessage(newRequest("LPUSH", "list", "a", "b"))
+
+	if response := replica.HandleMessage(newRequest("REPLICAOF", "127.0.0.1", strconv.Itoa(masterPort))); response.Status() != message.StatusOk {
+		t.Fatalf("REPLICAOF: %s", response)
+	}
+	if !waitValue(replica, "snapshot", "1") {
+		t.Fatalf("snapshot is not replicated")
+	}
+
+	master.HandleMessage(newRequest("SET", "stream", "2", "EX", "100"))
+	master.HandleTransaction(
+		[]*message.Request{newRequest("LPOP", "list"), newRequest("SET", "transaction", "3")},
+		nil,
+	)
+	if !waitValue(replica, "transaction", "3") {
+		t.Fatalf("stream is not replicated")
+	}
+
+	tests := []struct {
+		request    *message.Request
+		wantStatus message.Status
+		want       string
+	}{
+		{newRequest("GET", "stream"), message.StatusOk, "2"},
+		{newRequest("LRANGE", "list", "0", "-1"), message.StatusOk, "a"},
+		{newRequest("TTL", "stream"), message.StatusOk, "100"},
+		{newRequest("SET", "snapshot", "replica"), message.StatusReadOnly, ""},
+		{newRequest("EVAL", "return redis.call('DEL', KEYS[1])", "1", "snapshot"), message.StatusScriptError, ""},
+		{newRequest("ROLE"), message.StatusOk, "slave 127.0.0.1 " + strconv.Itoa(masterPort) + " connected"},
+		{newRequest("REPLICAOF", "NO", "ONE"), message.StatusOk, ""},
+		{newRequest("SET", "snapshot", "master"), message.StatusOk, ""},
+		{newRequest("ROLE"), message.StatusOk, "master 0"},
+	}
+
+	for _, tst := range tests {
+		response := replica.HandleMessage(tst.request)
+		if response.Status() != tst.wantStatus {
+			t.Errorf("%s %q: status %s != %s", tst.request.Cmd, tst.request.Args, response.Status(), tst.wantStatus)
+		}
+
+		if tst.want == "" {
+			continue
+		}
+
+		got := make([]string, len(response.Bytes()))
+		for i, v := range response.Bytes() {
+			got[i] = string(v)
+		}
+		if !strings.HasPrefix(strings.Join(got, " "), tst.want) {
+			t.Errorf("%s %q: %q doesn't start with %q", tst.request.Cmd, tst.request.Args, got, tst.want)
+		}
+	}
+}
+
+// headWriter keeps the first written chunk and fails, so Replicate() returns at once
+type headWriter struct {
+	head []byte
+}
+
+func (w *headWriter) Write(p []byte) (n int, err error) {
+	w.head = append([]byte{}, p...)
+	return 0, errors.New("closed")
+}
+
+func TestController_Replicate(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "radish_master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	master, _ := startServer(t, dataDir)
+	defer master.Shutdown()
+
+	master.HandleMessage(newRequest("SET", "key", "1"))
+
+	// the first replica creates the backlog, so the records after it could be resumed
+	w := &headWriter{}
+	master.Replicate(w, 0)
+	if !strings.HasPrefix(string(w.head), "+FULLRESYNC ") {
+		t.Errorf("Replicate(0): %q is not full synchronization", w.head)
+	}
+
+	role := master.HandleMessage(newRequest("ROLE")).Bytes()
+	lastMessageId, _ := strconv.ParseInt(string(role[1]), 10, 64)
+
+	master.HandleMessage(newRequest("SET", "key", "2"))
+
+	w = &headWriter{}
+	master.Replicate(w, lastMessageId)
+	reader := bufio.NewReader(strings.NewReader(string(w.head)))
+	if header, _ := reader.ReadString('\n'); header != "+CONTINUE\r\n" {
+		t.Fatalf("Replicate(%d): %q != +CONTINUE", lastMessageId, header)
+	}
+
+	record := new(message.Request)
+	if err := controller.NewGencodeDecoder(reader).Decode(record); err != nil {
+		t.Fatalf("Replicate(%d): %s", lastMessageId, err)
+	}
+	if record.Id <= lastMessageId || record.Cmd != "SET" || string(record.Args[1]) != "2" {
+		t.Errorf("Replicate(%d): unexpected record %s", lastMessageId, record)
+	}
+
+	w = &headWriter{}
+	master.Replicate(w, lastMessageId+100)
+	if !strings.HasPrefix(string(w.head), "+FULLRESYNC ") {
+		t.Errorf("Replicate(%d): %q is not full synchronization", lastMessageId+100, w.head)
+	}
+
+	w = &headWriter{}
+	controller.New("", 0, "", 0, 0, 0, false).Replicate(w, 0)
+	if !strings.HasPrefix(string(w.head), "-ERR ") {
+		t.Errorf("Replicate() without persistence: %q is not error", w.head)
+	}
+}
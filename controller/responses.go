@@ -1,9 +1,13 @@
 package controller
 
 import (
+	"fmt"
+	"github.com/mshaverdo/radish/cluster"
 	"github.com/mshaverdo/radish/core"
 	"github.com/mshaverdo/radish/log"
 	"github.com/mshaverdo/radish/message"
+	"math"
+	"strconv"
 )
 
 func getResponseInvalidArguments(cmd string, err error) message.Response {
@@ -16,11 +20,37 @@ func getResponseInvalidArguments(cmd string, err error) message.Response {
 func getResponseCommandError(cmd string, err error) message.Response {
 	statusMap := map[error]message.Status{
 		//nil: message.StatusOk,
-		core.ErrInvalidIndex: message.StatusInvalidArguments,
-		core.ErrWrongType:    message.StatusTypeMismatch,
-		core.ErrNotFound:     message.StatusNotFound,
-		core.ErrNoSuchKey:    message.StatusInvalidArguments,
-		ErrServerShutdown:    message.StatusError,
+		core.ErrInvalidIndex:   message.StatusInvalidArguments,
+		core.ErrWrongType:      message.StatusTypeMismatch,
+		core.ErrNotFound:       message.StatusNotFound,
+		core.ErrNoSuchKey:      message.StatusInvalidArguments,
+		core.ErrSyntax:         message.StatusInvalidArguments,
+		core.ErrNotInteger:     message.StatusInvalidArguments,
+		core.ErrNotFloat:       message.StatusInvalidArguments,
+		core.ErrNaN:            message.StatusInvalidArguments,
+		core.ErrInvalidRange:   message.StatusInvalidArguments,
+		core.ErrOverflow:       message.StatusInvalidArguments,
+		core.ErrIncrNaN:        message.StatusInvalidArguments,
+		core.ErrStringLength:   message.StatusInvalidArguments,
+		core.ErrOffset:         message.StatusInvalidArguments,
+		core.ErrExpireTime:     message.StatusInvalidArguments,
+		core.ErrCursor:         message.StatusInvalidArguments,
+		core.ErrBusyKey:        message.StatusInvalidArguments,
+		core.ErrDumpPayload:    message.StatusInvalidArguments,
+		core.ErrOutOfMemory:    message.StatusOutOfMemory,
+		core.ErrEvictionPolicy: message.StatusInvalidArguments,
+		ErrServerShutdown:      message.StatusError,
+		ErrReadOnly:            message.StatusReadOnly,
+		ErrClusterDisabled:     message.StatusError,
+		ErrMemoryValue:         message.StatusInvalidArguments,
+
+		cluster.ErrInvalidSlot:    message.StatusInvalidArguments,
+		cluster.ErrSlotBusy:       message.StatusInvalidArguments,
+		cluster.ErrSlotUnassigned: message.StatusInvalidArguments,
+		cluster.ErrUnknownNode:    message.StatusInvalidArguments,
+		cluster.ErrForgetMyself:   message.StatusInvalidArguments,
+		cluster.ErrNotOwner:       message.StatusInvalidArguments,
+		cluster.ErrAlreadyOwner:   message.StatusInvalidArguments,
 	}
 
 	status, ok := statusMap[err]
@@ -35,6 +65,30 @@ func getResponseCommandError(cmd string, err error) message.Response {
 	)
 }
 
+// getResponseScriptError builds script error response, which message starts with its own error code, like NOSCRIPT
+func getResponseScriptError(errorMessage string) message.Response {
+	return message.NewResponseStatus(
+		message.StatusScriptError,
+		errorMessage,
+	)
+}
+
+// getResponseRedirect builds MOVED or ASK redirect to another node of the cluster
+func getResponseRedirect(redirect string) message.Response {
+	return message.NewResponseStatus(
+		message.StatusRedirect,
+		redirect,
+	)
+}
+
+// getResponseClusterError builds cluster error response, which message starts with its own error code, like CROSSSLOT
+func getResponseClusterError(errorMessage string) message.Response {
+	return message.NewResponseStatus(
+		message.StatusClusterError,
+		errorMessage,
+	)
+}
+
 func getResponseStringPayload(payload []byte) message.Response {
 	return message.NewResponseString(
 		message.StatusOk,
@@ -49,6 +103,41 @@ func getResponseIntPayload(value int) message.Response {
 	)
 }
 
+func getResponseIntSlicePayload(values []int) message.Response {
+	return message.NewResponseIntSlice(
+		message.StatusOk,
+		values,
+	)
+}
+
+func getResponseFloatPayload(value float64) message.Response {
+	return message.NewResponseString(
+		message.StatusOk,
+		[]byte(formatFloat(value)),
+	)
+}
+
+// getResponseInterfacePayload builds response for commands, which result type depends on arguments, e.g. ZADD with INCR
+func getResponseInterfacePayload(value interface{}) message.Response {
+	switch v := value.(type) {
+	case int:
+		return getResponseIntPayload(v)
+	case float64:
+		return getResponseFloatPayload(v)
+	case []byte:
+		return getResponseStringPayload(v)
+	case [][]byte:
+		return getResponseStringSlicePayload(v)
+	case nil:
+		return getResponseStatusOkPayload()
+	default:
+		return message.NewResponseStatus(
+			message.StatusError,
+			fmt.Sprintf("unknown result type: %T", value),
+		)
+	}
+}
+
 func getResponseStringSlicePayload(payloads [][]byte) message.Response {
 	return message.NewResponseStringSlice(
 		message.StatusOk,
@@ -56,6 +145,14 @@ func getResponseStringSlicePayload(payloads [][]byte) message.Response {
 	)
 }
 
+func getResponseScanPayload(result core.ScanResult) message.Response {
+	return message.NewResponseCursor(
+		message.StatusOk,
+		result.Cursor,
+		result.Elements,
+	)
+}
+
 func getResponseStatusOkPayload() message.Response {
 	return message.NewResponseStatus(
 		message.StatusOk,
@@ -63,6 +160,18 @@ func getResponseStatusOkPayload() message.Response {
 	)
 }
 
+// formatFloat formats float in the redis way: as short as possible and with inf instead of +Inf
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+}
+
 func stringsSliceToBytesSlise(s []string) [][]byte {
 	result := make([][]byte, len(s))
 	for i, v := range s {
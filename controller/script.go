@@ -0,0 +1,421 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"github.com/mshaverdo/radish/message"
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScriptTimeout is the max execution time of a script. Scripts are executed under the transaction write lock,
+// so a stuck script would stall all the other requests
+const ScriptTimeout = 5 * time.Second
+
+const (
+	scriptErrNoScript   = "NOSCRIPT No matching script. Please use EVAL."
+	scriptErrNotAllowed = "ERR This Redis command is not allowed from script"
+	scriptErrArguments  = "ERR Lua redis() command arguments must be strings or integers"
+	scriptErrNoCommand  = "ERR Please specify at least one argument for redis.call()"
+	scriptErrWrongType  = "WRONGTYPE Operation against a key holding the wrong kind of value"
+)
+
+var (
+	ErrScriptNumKeys         = errors.New("Number of keys can't be greater than number of args")
+	ErrScriptNegativeNumKeys = errors.New("Number of keys can't be negative")
+)
+
+// scriptCache contains compiled scripts by SHA1 hex digest of their sources.
+// Compiled script is immutable, so it's shared between all executions of the script
+type scriptCache struct {
+	mutex  sync.RWMutex
+	protos map[string]*lua.FunctionProto
+}
+
+func newScriptCache() *scriptCache {
+	return &scriptCache{protos: make(map[string]*lua.FunctionProto)}
+}
+
+// load compiles the script, if it isn't cached yet, and returns its SHA1 digest
+func (s *scriptCache) load(source string) (sha string, proto *lua.FunctionProto, err error) {
+	sha = sha1hex(source)
+	if proto = s.get(sha); proto != nil {
+		return sha, proto, nil
+	}
+
+	chunk, err := parse.Parse(strings.NewReader(source), "user_script")
+	if err != nil {
+		return "", nil, err
+	}
+
+	proto, err = lua.Compile(chunk, "user_script")
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.mutex.Lock()
+	s.protos[sha] = proto
+	s.mutex.Unlock()
+
+	return sha, proto, nil
+}
+
+// get returns compiled script by its SHA1 digest, or nil if there is no such script
+func (s *scriptCache) get(sha string) *lua.FunctionProto {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.protos[strings.ToLower(sha)]
+}
+
+// flush removes all the scripts from the cache
+func (s *scriptCache) flush() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.protos = make(map[string]*lua.FunctionProto)
+}
+
+// isScriptRequest returns true, if request should be handled by processScriptRequest()
+func isScriptRequest(request *message.Request) bool {
+	switch request.Cmd {
+	case "EVAL", "EVALSHA", "SCRIPT":
+		return true
+	default:
+		return false
+	}
+}
+
+// processScriptRequest handles EVAL script numkeys [key ...] [arg ...], EVALSHA sha1 numkeys [key ...] [arg ...]
+// and SCRIPT LOAD|EXISTS|FLUSH commands.
+// Script is executed atomically: nothing interleaves with it, like with a transaction.
+// Requests of the script are written into WAL instead of the script itself as a single record,
+// so WAL replay gets the same result even if the script isn't deterministic
+func (c *Controller) processScriptRequest(request *message.Request) message.Response {
+	if request.Cmd == "SCRIPT" {
+		return c.processScriptCommand(request)
+	}
+
+	return c.processAtomically(request.Cmd, func(process processFunc) message.Response {
+		return c.evalScript(request, process)
+	})
+}
+
+// processScriptRequestNested handles script requests inside a transaction, where process() collects WAL requests
+func (c *Controller) processScriptRequestNested(request *message.Request, process processFunc) message.Response {
+	if request.Cmd == "SCRIPT" {
+		return c.processScriptCommand(request)
+	}
+
+	return c.evalScript(request, process)
+}
+
+// processScriptCommand handles SCRIPT LOAD script, SCRIPT EXISTS sha1 [sha1 ...] and SCRIPT FLUSH [ASYNC|SYNC]
+func (c *Controller) processScriptCommand(request *message.Request) message.Response {
+	if request.ArgumentsLen() == 0 {
+		return getResponseInvalidArguments(request.Cmd, errors.New("wrong number of arguments"))
+	}
+
+	argsLen := request.ArgumentsLen()
+	switch subcommand := strings.ToUpper(string(request.Args[0])); {
+	case subcommand == "LOAD" && argsLen == 2:
+		sha, _, err := c.scripts.load(string(request.Args[1]))
+		if err != nil {
+			return getResponseScriptError("ERR Error compiling script: " + err.Error())
+		}
+
+		return getResponseStringPayload([]byte(sha))
+	case subcommand == "EXISTS" && argsLen > 1:
+		result := make([]int, argsLen-1)
+		for i, sha := range request.Args[1:] {
+			if c.scripts.get(string(sha)) != nil {
+				result[i] = 1
+			}
+		}
+
+		return getResponseIntSlicePayload(result)
+	case subcommand == "FLUSH" && argsLen <= 2:
+		// compiled scripts are just dropped, so ASYNC and SYNC modes are the same
+		c.scripts.flush()
+		return getResponseStatusOkPayload()
+	default:
+		return getResponseInvalidArguments(request.Cmd, errors.New("unknown subcommand or wrong number of arguments for '"+subcommand+"'"))
+	}
+}
+
+// evalScript executes EVAL or EVALSHA script. Radish commands, called by the script, are processed by process()
+func (c *Controller) evalScript(request *message.Request, process processFunc) message.Response {
+	source, keys, args, err := parseEvalRequest(request)
+	if err != nil {
+		return getResponseInvalidArguments(request.Cmd, err)
+	}
+
+	var proto *lua.FunctionProto
+	if request.Cmd == "EVAL" {
+		if _, proto, err = c.scripts.load(source); err != nil {
+			return getResponseScriptError("ERR Error compiling script: " + err.Error())
+		}
+	} else if proto = c.scripts.get(source); proto == nil {
+		return getResponseScriptError(scriptErrNoScript)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ScriptTimeout)
+	defer cancel()
+
+	L := c.newScriptState(process)
+	defer L.Close()
+	L.SetContext(ctx)
+
+	L.SetGlobal("KEYS", bytesToLuaTable(L, keys))
+	L.SetGlobal("ARGV", bytesToLuaTable(L, args))
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 1, nil); err != nil {
+		return getResponseScriptRuntimeError(err)
+	}
+
+	return luaToResponse(L.Get(-1))
+}
+
+// newScriptState creates sandboxed Lua state with redis.call() and redis.pcall(), processing requests by process()
+func (c *Controller) newScriptState(process processFunc) *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+
+	libs := []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	}
+	for _, lib := range libs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	// scripts have no access to the file system
+	L.SetGlobal("dofile", lua.LNil)
+	L.SetGlobal("loadfile", lua.LNil)
+
+	call := func(L *lua.LState, raise bool) int {
+		response := c.processScriptCall(L, process)
+		if isScriptErrorResponse(response) && raise {
+			L.Error(responseToLua(L, response), 1)
+			return 0
+		}
+
+		L.Push(responseToLua(L, response))
+		return 1
+	}
+
+	L.SetGlobal("redis", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"call": func(L *lua.LState) int {
+			return call(L, true)
+		},
+		"pcall": func(L *lua.LState) int {
+			return call(L, false)
+		},
+		"sha1hex": func(L *lua.LState) int {
+			L.Push(lua.LString(sha1hex(L.CheckString(1))))
+			return 1
+		},
+		"error_reply": func(L *lua.LState) int {
+			L.Push(luaReplyTable(L, "err", L.CheckString(1)))
+			return 1
+		},
+		"status_reply": func(L *lua.LState) int {
+			L.Push(luaReplyTable(L, "ok", L.CheckString(1)))
+			return 1
+		},
+	}))
+
+	return L
+}
+
+// processScriptCall builds request from arguments of redis.call() and processes it by process()
+func (c *Controller) processScriptCall(L *lua.LState, process processFunc) message.Response {
+	if L.GetTop() == 0 {
+		return getResponseScriptError(scriptErrNoCommand)
+	}
+
+	args := make([][]byte, L.GetTop())
+	for i := range args {
+		switch v := L.Get(i + 1).(type) {
+		case lua.LString, lua.LNumber:
+			args[i] = []byte(lua.LVAsString(v))
+		default:
+			return getResponseScriptError(scriptErrArguments)
+		}
+	}
+
+	request := message.NewRequest(strings.ToUpper(string(args[0])), args[1:])
+	if isScriptRequest(request) {
+		return getResponseScriptError(scriptErrNotAllowed)
+	}
+
+	return c.processNestedRequest(request, process)
+}
+
+// parseEvalRequest returns script source or SHA1 digest, keys and args of EVAL or EVALSHA request
+func parseEvalRequest(request *message.Request) (source string, keys, args [][]byte, err error) {
+	if request.ArgumentsLen() < 2 {
+		return "", nil, nil, errors.New("wrong number of arguments")
+	}
+
+	numKeys, err := strconv.Atoi(string(request.Args[1]))
+	switch {
+	case err != nil:
+		return "", nil, nil, errors.New("value is not an integer or out of range")
+	case numKeys < 0:
+		return "", nil, nil, ErrScriptNegativeNumKeys
+	case numKeys > request.ArgumentsLen()-2:
+		return "", nil, nil, ErrScriptNumKeys
+	}
+
+	return string(request.Args[0]), request.Args[2 : 2+numKeys], request.Args[2+numKeys:], nil
+}
+
+// isScriptErrorResponse returns true, if redis.call() should raise the error of the response
+func isScriptErrorResponse(response message.Response) bool {
+	return response.Status() != message.StatusOk && response.Status() != message.StatusNotFound
+}
+
+// responseToLua converts response to Lua value in the Redis way: status reply becomes {ok=status},
+// error becomes {err=message}, nil becomes false and arrays become tables
+func responseToLua(L *lua.LState, response message.Response) lua.LValue {
+	switch r := response.(type) {
+	case *message.ResponseStatus:
+		switch r.Status() {
+		case message.StatusOk:
+			status := r.Payload()
+			if status == "" {
+				status = "OK"
+			}
+			return luaReplyTable(L, "ok", status)
+		case message.StatusNotFound:
+			return lua.LFalse
+		default:
+			return luaReplyTable(L, "err", scriptErrorMessage(r))
+		}
+	case *message.ResponseInt:
+		return lua.LNumber(r.Payload())
+	case *message.ResponseString:
+		return lua.LString(r.Payload())
+	case *message.ResponseStringSlice:
+		return bytesToLuaTable(L, r.Payload())
+	case *message.ResponseIntSlice:
+		table := L.NewTable()
+		for _, v := range r.Payload() {
+			table.Append(lua.LNumber(v))
+		}
+		return table
+	case *message.ResponseCursor:
+		table := L.NewTable()
+		table.Append(lua.LString(strconv.Itoa(r.Cursor())))
+		table.Append(bytesToLuaTable(L, r.Payload()))
+		return table
+	case *message.ResponseSlice:
+		table := L.NewTable()
+		for _, v := range r.Payload() {
+			table.Append(responseToLua(L, v))
+		}
+		return table
+	default:
+		return luaReplyTable(L, "err", "ERR unknown response type")
+	}
+}
+
+// luaToResponse converts value, returned by a script, to response in the Redis way:
+// number is truncated to integer, true becomes 1, false and nil become nil, and array part of table becomes array
+func luaToResponse(value lua.LValue) message.Response {
+	switch v := value.(type) {
+	case lua.LNumber:
+		return getResponseIntPayload(int(v))
+	case lua.LString:
+		return getResponseStringPayload([]byte(v))
+	case lua.LBool:
+		if v {
+			return getResponseIntPayload(1)
+		}
+		return message.NewResponseStatus(message.StatusNotFound, "")
+	case *lua.LTable:
+		if status, ok := v.RawGetString("ok").(lua.LString); ok {
+			return message.NewResponseStatus(message.StatusOk, string(status))
+		}
+		if errorMessage, ok := v.RawGetString("err").(lua.LString); ok {
+			return getResponseScriptError(string(errorMessage))
+		}
+
+		// like in Redis, array ends at the first nil
+		responses := []message.Response{}
+		for i := 1; v.RawGetInt(i) != lua.LNil; i++ {
+			responses = append(responses, luaToResponse(v.RawGetInt(i)))
+		}
+		return message.NewResponseSlice(message.StatusOk, responses)
+	default:
+		return message.NewResponseStatus(message.StatusNotFound, "")
+	}
+}
+
+// getResponseScriptRuntimeError builds response for an error, raised by a script.
+// Errors raised by redis.call() and error({err=...}) are passed to the client as is
+func getResponseScriptRuntimeError(err error) message.Response {
+	if apiErr, ok := err.(*lua.ApiError); ok {
+		if table, ok := apiErr.Object.(*lua.LTable); ok {
+			if errorMessage, ok := table.RawGetString("err").(lua.LString); ok {
+				return getResponseScriptError(string(errorMessage))
+			}
+		}
+		return getResponseScriptError("ERR Error running script: " + apiErr.Object.String())
+	}
+
+	return getResponseScriptError("ERR Error running script: " + err.Error())
+}
+
+// scriptErrorMessage returns error message of the response with error code prefix, like the client receives it
+func scriptErrorMessage(response *message.ResponseStatus) string {
+	switch response.Status() {
+	case message.StatusScriptError, message.StatusRedirect, message.StatusClusterError:
+		return response.Payload()
+	case message.StatusTypeMismatch:
+		return scriptErrWrongType
+	case message.StatusOutOfMemory:
+		return "OOM " + response.Payload()
+	default:
+		return "ERR " + response.Payload()
+	}
+}
+
+func luaReplyTable(L *lua.LState, field, value string) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString(field, lua.LString(value))
+	return table
+}
+
+// bytesToLuaTable converts values to Lua array, nil values become false
+func bytesToLuaTable(L *lua.LState, values [][]byte) *lua.LTable {
+	table := L.CreateTable(len(values), 0)
+	for _, v := range values {
+		if v == nil {
+			table.Append(lua.LFalse)
+		} else {
+			table.Append(lua.LString(v))
+		}
+	}
+
+	return table
+}
+
+func sha1hex(source string) string {
+	sum := sha1.Sum([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
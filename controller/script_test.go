@@ -0,0 +1,89 @@
+package controller_test
+
+import (
+	"github.com/go-test/deep"
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/message"
+	"testing"
+)
+
+func TestController_Script(t *testing.T) {
+	const sha = "e0e1f9fabfc9d4800c877a703b823ac0578ff8db" // sha1 of "return 1"
+
+	tests := []struct {
+		request    *message.Request
+		wantStatus message.Status
+		want       []string
+	}{
+		{newRequest("EVAL", "return 1", "0"), message.StatusOk, []string{"1"}},
+		{newRequest("EVALSHA", sha, "0"), message.StatusOk, []string{"1"}},
+		{newRequest("EVALSHA", "ffffffffffffffffffffffffffffffffffffffff", "0"), message.StatusScriptError, []string{"NOSCRIPT No matching script. Please use EVAL."}},
+		{newRequest("SCRIPT", "EXISTS", sha, "ffffffffffffffffffffffffffffffffffffffff"), message.StatusOk, []string{"1", "0"}},
+		{newRequest("SCRIPT", "LOAD", "return 'loaded'"), message.StatusOk, []string{"b534286061d4b9e4026607613b95c06c06015ae8"}},
+		{newRequest("EVALSHA", "B534286061D4B9E4026607613B95C06C06015AE8", "0"), message.StatusOk, []string{"loaded"}},
+		{
+			newRequest("EVAL", "redis.call('SET', KEYS[1], ARGV[1]); return redis.call('GET', KEYS[1])", "1", "key", "value"),
+			message.StatusOk, []string{"value"},
+		},
+		{
+			newRequest("EVAL", "return {1, 'two', false, {3}, redis.call('RPUSH', KEYS[1], 'a', 'b')}", "1", "list"),
+			message.StatusOk, []string{"1", "two", "", "3", "2"},
+		},
+		{newRequest("EVAL", "return redis.call('SET', 'key', 'value')", "0"), message.StatusOk, []string{"OK"}},
+		{newRequest("EVAL", "return redis.call('GET', 'missing')", "0"), message.StatusNotFound, []string{""}},
+		{newRequest("EVAL", "return redis.status_reply('PONG')", "0"), message.StatusOk, []string{"PONG"}},
+		{newRequest("EVAL", "return redis.error_reply('MY error')", "0"), message.StatusScriptError, []string{"MY error"}},
+		{newRequest("EVAL", "return redis.call('LPOP', 'key')", "0"), message.StatusScriptError, []string{"WRONGTYPE Operation against a key holding the wrong kind of value"}},
+		{newRequest("EVAL", "return redis.pcall('LPOP', 'key')['err']", "0"), message.StatusOk, []string{"WRONGTYPE Operation against a key holding the wrong kind of value"}},
+		{newRequest("EVAL", "return redis.call('INCR', 'counter') + ARGV[1]", "0", "10"), message.StatusOk, []string{"11"}},
+		{newRequest("EVAL", "return redis.call('BLPOP', 'list', 0)", "0"), message.StatusOk, []string{"list", "a"}},
+		{newRequest("EVAL", "return redis.call('EVAL', 'return 1', 0)", "0"), message.StatusScriptError, []string{"ERR This Redis command is not allowed from script"}},
+		{newRequest("EVAL", "return redis.sha1hex('return 1')", "0"), message.StatusOk, []string{sha}},
+		{newRequest("EVAL", "return 1", "2", "key"), message.StatusInvalidArguments, []string{"EVAL: Number of keys can't be greater than number of args"}},
+		{newRequest("EVAL", "return 1", "-1"), message.StatusInvalidArguments, []string{"EVAL: Number of keys can't be negative"}},
+		{newRequest("EVAL", "return dofile('/etc/passwd')", "0"), message.StatusScriptError, nil},
+		{newRequest("EVAL", "return (", "0"), message.StatusScriptError, nil},
+		{newRequest("SCRIPT", "FLUSH"), message.StatusOk, []string{""}},
+		{newRequest("EVALSHA", sha, "0"), message.StatusScriptError, []string{"NOSCRIPT No matching script. Please use EVAL."}},
+	}
+
+	c := controller.New("", 0, "", 0, 0, 0, false)
+
+	for _, tst := range tests {
+		response := c.HandleMessage(tst.request)
+		if response.Status() != tst.wantStatus {
+			t.Errorf("%q: status %s != %s: %q", tst.request.Args, response.Status(), tst.wantStatus, response.Bytes())
+		}
+
+		if tst.want == nil {
+			continue
+		}
+
+		got := make([]string, len(response.Bytes()))
+		for i, v := range response.Bytes() {
+			got[i] = string(v)
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("%q: %s\n\ngot:%v\n\nwant:%v", tst.request.Args, diff, got, tst.want)
+		}
+	}
+}
+
+func TestController_ScriptInTransaction(t *testing.T) {
+	c := controller.New("", 0, "", 0, 0, 0, false)
+
+	requests := []*message.Request{
+		newRequest("SET", "key", "1"),
+		newRequest("EVAL", "return redis.call('INCRBY', KEYS[1], ARGV[1])", "1", "key", "10"),
+		newRequest("GET", "key"),
+	}
+
+	response := c.HandleTransaction(requests, nil)
+	got := make([]string, len(response.Bytes()))
+	for i, v := range response.Bytes() {
+		got[i] = string(v)
+	}
+	if diff := deep.Equal(got, []string{"", "11", "11"}); diff != nil {
+		t.Errorf("%s\n\ngot:%v", diff, got)
+	}
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"errors"
+	"github.com/mshaverdo/radish/message"
+	"strconv"
+)
+
+// walTransactionCmd is the command of WAL record, containing all modifying requests of a transaction
+const walTransactionCmd = "EXEC"
+
+// processFunc processes a single request inside a transaction or a script
+type processFunc func(request *message.Request) message.Response
+
+var (
+	ErrMalformedTransaction = errors.New("malformed transaction record")
+)
+
+// Watch returns versions of the keys to check them when the transaction is executed
+func (c *Controller) Watch(keys []string) (versions []uint64) {
+	c.txMutex.RLock()
+	defer c.txMutex.RUnlock()
+
+	return c.core.Versions(keys)
+}
+
+// HandleTransaction processes requests atomically: nothing interleaves with them,
+// and all the modifying requests are written into WAL as a single record.
+// If any of watched keys was modified since Watch(), no request is processed and StatusNotFound response is returned.
+// Like in Redis, failed request doesn't roll the transaction back: its response just contains an error
+func (c *Controller) HandleTransaction(requests []*message.Request, watched map[string]uint64) message.Response {
+	select {
+	case <-c.stopChan:
+		return getResponseCommandError(walTransactionCmd, ErrServerShutdown)
+	default:
+		//all ok, handle transaction
+	}
+
+	c.handlerWg.Add(1)
+	defer c.handlerWg.Done()
+
+	return c.processAtomically(walTransactionCmd, func(process processFunc) message.Response {
+		if !c.isWatchedIntact(watched) {
+			return message.NewResponseStatus(message.StatusNotFound, "")
+		}
+
+		responses := make([]message.Response, len(requests))
+		for i, request := range requests {
+			responses[i] = c.processNestedRequest(request, process)
+		}
+
+		return message.NewResponseSlice(message.StatusOk, responses)
+	})
+}
+
+// processAtomically calls run() under the transaction write lock, so nothing interleaves with it.
+// Requests, processed by process() passed to run(), are written into WAL as a single record after run() returns
+func (c *Controller) processAtomically(cmd string, run func(process processFunc) message.Response) message.Response {
+	c.txMutex.Lock()
+	defer c.txMutex.Unlock()
+
+	var walRequests []*message.Request
+	process := func(request *message.Request) message.Response {
+		if c.isReadOnlyRequest(request) {
+			return getResponseCommandError(request.Cmd, ErrReadOnly)
+		}
+		if response := c.routeRequest(c.processor.Keys(request), false); response != nil {
+			return response
+		}
+		if response := c.freeMemory(request); response != nil {
+			return response
+		}
+
+		response := c.processor.Process(request)
+		if c.isPersistent && c.isWalRequest(request, response) {
+			walRequests = append(walRequests, c.processor.WalRequest(request, response))
+		}
+
+		return response
+	}
+
+	response := run(process)
+
+	if len(walRequests) > 0 {
+		if err := c.keeper.WriteToWal(newWalTransaction(walRequests)); err != nil {
+			return getResponseCommandError(cmd, err)
+		}
+	}
+
+	return response
+}
+
+// processNestedRequest processes request of a transaction or a script by process().
+// Blocking requests never block there, scripts are executed with the same process(), so they reach the same WAL record,
+// and published messages are delivered at once
+func (c *Controller) processNestedRequest(request *message.Request, process processFunc) message.Response {
+	switch {
+	case isBlockingRequest(request):
+		return processBlockingRequestNowait(request, process)
+	case isScriptRequest(request):
+		return c.processScriptRequestNested(request, process)
+	case isPubSubRequest(request):
+		return c.processPubSubRequest(request)
+	case isConfigRequest(request):
+		return c.processConfigRequest(request)
+	default:
+		return process(request)
+	}
+}
+
+// isWatchedIntact returns true, if versions of the watched keys are the same as they were at Watch()
+func (c *Controller) isWatchedIntact(watched map[string]uint64) bool {
+	keys := make([]string, 0, len(watched))
+	for key := range watched {
+		keys = append(keys, key)
+	}
+
+	for i, version := range c.core.Versions(keys) {
+		if version != watched[keys[i]] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newWalTransaction packs requests into a single WAL record, so WAL replay never applies a part of a transaction.
+// Every request is stored in the record arguments as its command, count of arguments and arguments
+func newWalTransaction(requests []*message.Request) *message.Request {
+	if len(requests) == 1 {
+		return requests[0]
+	}
+
+	var args [][]byte
+	for _, request := range requests {
+		args = append(args, []byte(request.Cmd), []byte(strconv.Itoa(len(request.Args))))
+		args = append(args, request.Args...)
+	}
+
+	return message.NewRequest(walTransactionCmd, args)
+}
+
+// splitWalTransaction unpacks requests of the transaction, packed by newWalTransaction()
+func splitWalTransaction(transaction *message.Request) (requests []*message.Request, err error) {
+	args := transaction.Args
+	for len(args) > 0 {
+		if len(args) < 2 {
+			return nil, ErrMalformedTransaction
+		}
+
+		count, err := strconv.Atoi(string(args[1]))
+		if err != nil || count < 0 || count > len(args)-2 {
+			return nil, ErrMalformedTransaction
+		}
+
+		request := message.NewRequest(string(args[0]), args[2:2+count])
+		request.Timestamp = transaction.Timestamp
+		requests = append(requests, request)
+		args = args[2+count:]
+	}
+
+	return requests, nil
+}
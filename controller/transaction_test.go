@@ -0,0 +1,127 @@
+package controller_test
+
+import (
+	"github.com/go-test/deep"
+	"github.com/mshaverdo/radish/controller"
+	"github.com/mshaverdo/radish/message"
+	"testing"
+)
+
+func TestController_HandleTransaction(t *testing.T) {
+	tests := []struct {
+		requests   []*message.Request
+		watch      []string
+		modify     *message.Request
+		wantStatus message.Status
+		want       []string
+	}{
+		{
+			[]*message.Request{newRequest("SET", "key", "value"), newRequest("RPUSH", "list", "a", "b"), newRequest("GET", "key")},
+			nil, nil, message.StatusOk, []string{"", "2", "value"},
+		},
+		{
+			[]*message.Request{newRequest("INCR", "key"), newRequest("LPOP", "list")},
+			nil, nil, message.StatusOk, []string{"value is not an integer or out of range", "a"},
+		},
+		{
+			[]*message.Request{newRequest("BLPOP", "empty", "0"), newRequest("BLPOP", "list", "0")},
+			nil, nil, message.StatusOk, []string{"", "list", "b"},
+		},
+		{
+			[]*message.Request{newRequest("SET", "key", "new")},
+			[]string{"key", "404"}, nil, message.StatusOk, []string{""},
+		},
+		{
+			[]*message.Request{newRequest("SET", "key", "aborted")},
+			[]string{"key"}, newRequest("APPEND", "key", "!"), message.StatusNotFound, nil,
+		},
+		{
+			[]*message.Request{newRequest("SET", "key", "aborted")},
+			[]string{"key"}, newRequest("DEL", "key"), message.StatusNotFound, nil,
+		},
+		{
+			[]*message.Request{newRequest("SET", "key", "aborted")},
+			[]string{"key"}, newRequest("SET", "key", "new!"), message.StatusNotFound, nil,
+		},
+		{
+			[]*message.Request{newRequest("SET", "key", "committed")},
+			[]string{"key"}, newRequest("GET", "key"), message.StatusOk, []string{""},
+		},
+	}
+
+	c := controller.New("", 0, "", 0, 0, 0, false)
+
+	for _, tst := range tests {
+		watched := map[string]uint64{}
+		for i, version := range c.Watch(tst.watch) {
+			watched[tst.watch[i]] = version
+		}
+
+		if tst.modify != nil {
+			c.HandleMessage(tst.modify)
+		}
+
+		response := c.HandleTransaction(tst.requests, watched)
+		if response.Status() != tst.wantStatus {
+			t.Errorf("%s: status %s != %s", tst.requests, response.Status(), tst.wantStatus)
+		}
+
+		if tst.want == nil {
+			continue
+		}
+
+		got := make([]string, len(response.Bytes()))
+		for i, v := range response.Bytes() {
+			got[i] = string(v)
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("%s: %s\n\ngot:%v\n\nwant:%v", tst.requests, diff, got, tst.want)
+		}
+	}
+
+	if got := c.HandleMessage(newRequest("GET", "key")).Bytes(); string(got[0]) != "committed" {
+		t.Errorf("GET after transactions: %q != %q", got[0], "committed")
+	}
+}
+
+func TestController_WalTransaction(t *testing.T) {
+	requests := []*message.Request{
+		newRequest("SET", "key", "value"),
+		newRequest("DEL"),
+		newRequest("RPUSH", "list", "a", "b"),
+	}
+
+	transaction := controller.NewWalTransaction(requests)
+	if transaction.Cmd != "EXEC" {
+		t.Errorf("NewWalTransaction(): cmd %q != EXEC", transaction.Cmd)
+	}
+
+	got, err := controller.SplitWalTransaction(transaction)
+	if err != nil {
+		t.Errorf("SplitWalTransaction(): %s", err)
+	}
+	if len(got) != len(requests) {
+		t.Fatalf("SplitWalTransaction(): %d requests != %d", len(got), len(requests))
+	}
+	for i, request := range requests {
+		if got[i].Cmd != request.Cmd || deep.Equal(got[i].Args, request.Args) != nil || got[i].Timestamp != transaction.Timestamp {
+			t.Errorf("SplitWalTransaction(): %s != %s", got[i], request)
+		}
+	}
+
+	single := controller.NewWalTransaction(requests[:1])
+	if single != requests[0] {
+		t.Errorf("NewWalTransaction() of single request: %s != %s", single, requests[0])
+	}
+
+	malformed := []*message.Request{
+		newRequest("EXEC", "SET"),
+		newRequest("EXEC", "SET", "3", "key", "value"),
+		newRequest("EXEC", "SET", "x", "key"),
+	}
+	for _, request := range malformed {
+		if _, err := controller.SplitWalTransaction(request); err != controller.ErrMalformedTransaction {
+			t.Errorf("SplitWalTransaction(%s): %v != %v", request, err, controller.ErrMalformedTransaction)
+		}
+	}
+}
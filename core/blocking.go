@@ -0,0 +1,80 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// pushWaiters is a registry of clients blocked until a push into one of the lists
+type pushWaiters struct {
+	// count of registered waiters, allows pushes to skip mutex lock if nobody waits
+	count int32
+
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+func newPushWaiters() *pushWaiters {
+	return &pushWaiters{waiters: make(map[string]map[chan struct{}]struct{})}
+}
+
+// add registers new waiter for keys and returns channel to wait for a push
+func (w *pushWaiters) add(keys []string) chan struct{} {
+	ch := make(chan struct{}, 1)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, key := range keys {
+		if w.waiters[key] == nil {
+			w.waiters[key] = make(map[chan struct{}]struct{})
+		}
+		w.waiters[key][ch] = struct{}{}
+	}
+	atomic.AddInt32(&w.count, 1)
+
+	return ch
+}
+
+// remove unregisters waiter, added by add()
+func (w *pushWaiters) remove(keys []string, ch chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, key := range keys {
+		delete(w.waiters[key], ch)
+		if len(w.waiters[key]) == 0 {
+			delete(w.waiters, key)
+		}
+	}
+	atomic.AddInt32(&w.count, -1)
+}
+
+// notify wakes up all waiters of the key
+func (w *pushWaiters) notify(key string) {
+	if atomic.LoadInt32(&w.count) == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.waiters[key] {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// waiter already notified
+		}
+	}
+}
+
+// WaitPush registers waiter for pushes into the lists stored at keys.
+// pushed receives a value after every push into one of the lists since registration.
+// release must be called, when the waiter doesn't need notifications anymore
+func (c *Core) WaitPush(keys []string) (pushed <-chan struct{}, release func()) {
+	ch := c.pushWaiters.add(keys)
+
+	return ch, func() {
+		c.pushWaiters.remove(keys, ch)
+	}
+}
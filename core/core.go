@@ -21,6 +21,20 @@ var (
 	ErrNoSuchKey    = errors.New("no such key")
 	ErrWrongType    = errors.New("operation against a key holding the wrong kind of value")
 	ErrInvalidIndex = errors.New("index out of range")
+	ErrSyntax       = errors.New("syntax error")
+	ErrNotInteger   = errors.New("value is not an integer or out of range")
+	ErrNotFloat     = errors.New("value is not a valid float")
+	ErrNaN          = errors.New("resulting score is not a number (NaN)")
+	ErrInvalidRange = errors.New("min or max is not a float")
+	ErrOverflow     = errors.New("increment or decrement would overflow")
+	ErrIncrNaN      = errors.New("increment would produce NaN or Infinity")
+	ErrStringLength = errors.New("string exceeds maximum allowed size (512MB)")
+	ErrOffset       = errors.New("offset is out of range")
+	ErrExpireTime   = errors.New("invalid expire time")
+	ErrCursor       = errors.New("invalid cursor")
+
+	// ErrUnorderedStorage returned by Core API methods, which need keys in lexicographic order, see OrderedStorage
+	ErrUnorderedStorage = errors.New("storage engine doesn't keep keys in order")
 )
 
 // Storage encapsulates concrete concurrency-safe storage engine  -- Btree, hashmap, etc
@@ -34,6 +48,15 @@ type Storage interface {
 	// AddOrReplaceOne adds new or replaces one existing Item in the storage. It much faster than AddOrReplace with single items
 	AddOrReplaceOne(key string, item *Item)
 
+	// CompareAndSwap replaces Item only if existing Item equals to old, nil old means key not exists in the storage
+	// returns true if item was swapped
+	CompareAndSwap(key string, old, new *Item) (swapped bool)
+
+	// AtomicUpdate locks provided keys and calls update with Items mapped to these keys.
+	// update may replace or remove (set nil) Items in the map, all changes are applied atomically.
+	// Keys absent in the keys slice are ignored
+	AtomicUpdate(keys []string, update func(items map[string]*Item))
+
 	// Del removes Items from storage and returns count of actually removed values
 	// if key not found in the storage, just skip it
 	Del(keys []string) (count int)
@@ -44,48 +67,134 @@ type Storage interface {
 
 	// Keys returns all keys existing in the
 	Keys() (keys []string)
+
+	// Len returns count of keys existing in the Storage
+	Len() (count int)
+
+	// RandomKey returns random key from the Storage, ok is false if the Storage is empty
+	RandomKey() (key string, ok bool)
+
+	// UsedMemory returns approximate count of bytes, used by keys and items of the Storage
+	UsedMemory() (bytes int64)
+
+	// IndexVolatile adds key to the index of keys with TTL, scanned by ScanVolatile(). Items with TTL are indexed
+	// when they are added to the Storage, so it should be called only after TTL is set to the stored item
+	IndexVolatile(key string)
+
+	// ScanVolatile works like Scan, but returns only indexed keys, which items have TTL or dict fields with TTL.
+	// Keys, which items have no TTL anymore, are removed from the index
+	ScanVolatile(cursor, count int) (next int, keys []string)
+
+	// Scan returns keys of the next part of the storage, beginning from cursor, and the cursor to continue iteration.
+	// count is a hint, how many keys should be returned. Returned cursor 0 means the iteration is finished
+	Scan(cursor, count int) (next int, keys []string)
 }
 
 var _ Storage = (*StorageHash)(nil)
 
+// OrderedStorage is a Storage, which keeps keys in lexicographic order, like b-tree
+type OrderedStorage interface {
+	Storage
+
+	// AscendRange calls iterator for keys in the range [from, to) in lexicographic order, until iterator returns false.
+	// Empty to means the range has no upper bound. iterator shouldn't modify the Storage
+	AscendRange(from, to string, iterator func(key string, item *Item) bool)
+}
+
 // Core provides domain operations on the storage -- get, set, keys, hset, hdel, etc
 type Core struct {
-	storage Storage
+	// maxMemory and evictionPolicy are accessed atomically, see FreeMemory().
+	// It's the first field to guarantee 64-bit alignment for atomic operations
+	maxMemory      int64
+	evictionPolicy EvictionPolicy
+
+	storage     Storage
+	pushWaiters *pushWaiters
+
+	// keyspaceEvents is EventClass of published keyspace notifications, accessed atomically
+	keyspaceEvents uint32
+	publish        Publisher
 }
 
 // New constructs new core instance
 func New(storage Storage) *Core {
-	return &Core{storage: storage}
+	return &Core{storage: storage, pushWaiters: newPushWaiters()}
 }
 
-// CollectExpired checks all keys from storage and removes items with expired TTL and return count of actually removed items
+// CollectExpired checks keys with TTL and removes items with expired TTL and return count of actually removed items.
+// It also removes expired fields of dicts, and dicts emptied this way are removed like expired items.
+// Only keys from the volatile index of the storage are checked, so it takes time proportional to count of keys with TTL
 func (c *Core) CollectExpired() (count int) {
-	allKeys := c.storage.Keys()
-
 	expiredItems := map[string]*Item{}
-	for len(allKeys) > 0 {
-		batchLen := int(math.Min(float64(CollectExpiredBatchSize), float64(len(allKeys))))
-		batch := allKeys[:batchLen]
-		allKeys = allKeys[batchLen:]
+	for cursor := 0; ; {
+		var batch []string
+		cursor, batch = c.storage.ScanVolatile(cursor, CollectExpiredBatchSize)
 
 		items := c.storage.GetSubmap(batch)
 		for key, item := range items {
 			item.RLock()
-			if item.IsExpired() {
+			isExpired := item.IsExpired()
+			hasFieldsTtl := !isExpired && len(item.dictExpireAt) > 0
+			item.RUnlock()
+
+			if isExpired {
 				expiredItems[key] = item
+			} else if hasFieldsTtl {
+				count += c.collectExpiredDictFields(key, item)
 			}
-			item.RUnlock()
 		}
 
 		if len(expiredItems) > CollectExpiredBatchSize {
-			deleted := c.storage.DelSubmap(expiredItems)
+			deleted := c.deleteExpired(expiredItems)
 			//log.Debugf("%d KEYS deleted", deleted)
 			count += deleted
 			expiredItems = map[string]*Item{}
 		}
+
+		if cursor == 0 {
+			break
+		}
 	}
 
-	count += c.storage.DelSubmap(expiredItems)
+	count += c.deleteExpired(expiredItems)
+
+	return count
+}
+
+// collectExpiredDictFields removes expired fields of the dict item and removes the item, if all its fields are expired.
+// Returns 1 if the item was removed
+func (c *Core) collectExpiredDictFields(key string, item *Item) (count int) {
+	item.Lock()
+	collected := item.collectExpiredDictFields()
+	isEmptied := collected > 0 && len(item.dict) == 0
+	item.Unlock()
+
+	if collected > 0 {
+		c.notify(EventHash, "hexpired", key)
+	}
+
+	if !isEmptied {
+		return 0
+	}
+
+	// somebody could add new fields after the item was unlocked, so check it again under the storage lock
+	c.storage.AtomicUpdate([]string{key}, func(items map[string]*Item) {
+		if items[key] != item {
+			return
+		}
+
+		item.RLock()
+		defer item.RUnlock()
+
+		if len(item.dict) == 0 {
+			items[key] = nil
+			count = 1
+		}
+	})
+
+	if count > 0 {
+		c.notify(EventGeneric, "del", key)
+	}
 
 	return count
 }
@@ -96,9 +205,25 @@ func (c *Core) CollectExpired() (count int) {
 
   @command <LABEL>			- feature method as command with label <LABEL>. E.g. KEYS, GET, SET...
   @modifying				- command modifies storage and should be logged into WAL
+  @modifyingnotfound [OPTION]
+							- command modifies storage even though it responds NotFound, e.g. GETSET of not existing key,
+							so NotFound response should be logged into WAL too. If OPTION is set, it's true only if
+							the OPTION is passed among optional arguments, e.g. SET has tag `@modifyingnotfound GET`
   @ttl <ARGUMENT_INDEX>		- command has int TTL argument in seconds, in  ARGUMENT_INDEX zero-based position.
 							E.g. Expire(key, seconds) has tag `@ttl 1` due to <seconds> in position 1
 							It used to fix TTL-argument during restore from WAL
+  @absttl <ARGUMENT_INDEX> <seconds|milliseconds> <REQUEST>
+							- command has relative TTL argument in ARGUMENT_INDEX position, so it should be logged into WAL
+							as REQUEST with absolute expiration time. REQUEST is a command label followed by arguments:
+							$N is N-th argument of the original command, $N... is the rest of arguments beginning from N,
+							and others are keywords. $ARGUMENT_INDEX is replaced with milliseconds-timestamp.
+							E.g. Expire(key, seconds) has tag `@absttl 1 seconds PEXPIREAT $0 $1`
+  @absttl <ARGUMENT_INDEX> options
+							- command has relative EX/PX TTL options, beginning from ARGUMENT_INDEX, so they should be
+							logged into WAL as absolute PXAT option
+  @replay <LABEL>			- command result is non-deterministic, so it should be logged into WAL as <LABEL> command
+							with arguments of the original command followed by the command result.
+							E.g. SPop(key) has tag `@replay SREM` due to SPOP key logged as SREM key <popped member>
 */
 
 // About performance:
@@ -140,6 +265,31 @@ func (c *Core) Keys(pattern string) (result []string) {
 	return filteredKeys
 }
 
+// KeysRange returns up to count keys in the range [from, to) in lexicographic order, excluding expired ones.
+// Empty to means the range has no upper bound, count <= 0 means no limit.
+// Returns ErrUnorderedStorage, if the storage isn't OrderedStorage
+func (c *Core) KeysRange(from, to string, count int) (keys []string, err error) {
+	storage, ok := c.storage.(OrderedStorage)
+	if !ok {
+		return nil, ErrUnorderedStorage
+	}
+
+	keys = []string{}
+	storage.AscendRange(from, to, func(key string, item *Item) bool {
+		item.RLock()
+		expired := item.IsExpired()
+		item.RUnlock()
+
+		if !expired {
+			keys = append(keys, key)
+		}
+
+		return count <= 0 || len(keys) < count
+	})
+
+	return keys, nil
+}
+
 // Get the value of key. If the key does not exist the special value nil is returned.
 // An error is returned if the value stored at key is not a string, because GET only handles string values.
 // @command GET
@@ -163,14 +313,77 @@ func (c *Core) Get(key string) (result []byte, err error) {
 	return result, nil
 }
 
-// Set key to hold the string value.
+// Set key to hold the string value: SET key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|KEEPTTL]
 // If key already holds a value, it is overwritten, regardless of its type.
-// Any previous time to live associated with the key is discarded on successful SET operation.
+// Any previous time to live associated with the key is discarded on successful SET operation, unless KEEPTTL specified.
+// NX/XX set the key only if it does not already exist / already exists, otherwise ErrNotFound returned.
+// GET returns the old string stored at key, or ErrNotFound if key did not exist.
 // @command SET
 // @modifying
-func (c *Core) Set(key string, value []byte) {
-	item := NewItemBytes(value)
-	c.storage.AddOrReplaceOne(key, item)
+// @modifyingnotfound GET
+// @denyoom
+// @ttl 2
+// @absttl 2 options
+func (c *Core) Set(key string, value []byte, options ...string) (result interface{}, err error) {
+	opts, err := parseSetOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.nx && !opts.xx && !opts.get && !opts.keepTtl {
+		// fast path: unconditional SET doesn't depend on the existing value
+		item := NewItemBytes(value)
+		if !opts.expireAt.IsZero() {
+			item.SetExpireAt(opts.expireAt)
+		}
+		c.storage.AddOrReplaceOne(key, item)
+		c.notifySet(key, !opts.expireAt.IsZero())
+		return nil, nil
+	}
+
+	isSet := false
+	c.storage.AtomicUpdate([]string{key}, func(items map[string]*Item) {
+		existing := items[key]
+		old, oldErr := getItemBytes(existing)
+		if opts.get && oldErr == ErrWrongType {
+			err = ErrWrongType
+			return
+		}
+
+		exists := oldErr != ErrNotFound
+		if opts.get {
+			if exists {
+				result = old
+			} else {
+				err = ErrNotFound
+			}
+		}
+
+		if opts.nx && exists || opts.xx && !exists {
+			if !opts.get {
+				err = ErrNotFound
+			}
+			return
+		}
+
+		item := NewItemBytes(value)
+		switch {
+		case opts.keepTtl && exists:
+			existing.RLock()
+			item.SetExpireAt(existing.expireAt)
+			existing.RUnlock()
+		case !opts.expireAt.IsZero():
+			item.SetExpireAt(opts.expireAt)
+		}
+		items[key] = item
+		isSet = true
+	})
+
+	if isSet {
+		c.notifySet(key, !opts.keepTtl && !opts.expireAt.IsZero())
+	}
+
+	return result, err
 }
 
 // Set key to hold the string value and set key to timeout after a given number of seconds.
@@ -178,7 +391,9 @@ func (c *Core) Set(key string, value []byte) {
 // ttl <= 0 leads to deleting record
 // @command SETEX
 // @modifying
+// @denyoom
 // @ttl 1
+// @absttl 1 seconds SET $0 $2 PXAT $1
 func (c *Core) SetEx(key string, seconds int, value []byte) {
 	if seconds <= 0 {
 		//item expired before set, just remove it
@@ -189,6 +404,7 @@ func (c *Core) SetEx(key string, seconds int, value []byte) {
 	item := NewItemBytes(value)
 	item.SetTtl(seconds)
 	c.storage.AddOrReplaceOne(key, item)
+	c.notifySet(key, true)
 }
 
 // Del Removes the specified keys, ignoring not existing and returns count of actually removed values.
@@ -198,40 +414,73 @@ func (c *Core) SetEx(key string, seconds int, value []byte) {
 // @command DEL
 // @modifying
 func (c *Core) Del(keys []string) (count int) {
-	return c.storage.Del(keys)
+	return c.del(EventGeneric, "del", keys)
 }
 
-// DSet Sets field in the hash stored at key to value.
+// DSet Sets fields in the hash stored at key to their respective values: HSET key field value [field value ...].
 // If key does not exist, a new key holding a hash is created.
 // If field already exists in the dict, it is overwritten.
-// returns 1 if f field is a new field in the hash and value was set.
-// returns 0 if field already exists in the hash and the value was updated.
+// Returns the number of fields that were added, not including fields, which values were updated.
 // @command HSET
 // @modifying
-func (c *Core) DSet(key, field string, value []byte) (count int, err error) {
-	item := c.getItem(key)
-	if item == nil {
-		item = NewItemDict(map[string][]byte{})
-		defer func() {
-			c.storage.AddOrReplaceOne(key, item)
-		}()
+// @denyoom
+func (c *Core) DSet(key string, fieldsValues [][]byte) (count int, err error) {
+	if len(fieldsValues) == 0 || len(fieldsValues)%2 != 0 {
+		return 0, ErrSyntax
+	}
+
+	defer c.notifyOnSuccess(&err, EventHash, "hset", key)
+
+	for {
+		var added int
+		item := c.addItemIfAbsent(key, func() *Item {
+			item := NewItemDict(make(map[string][]byte, len(fieldsValues)/2))
+			added = setDictFields(item, fieldsValues)
+			return item
+		})
+		if item == nil {
+			return added, nil
+		}
+
+		count, err := setItemDictFields(item, fieldsValues)
+		if err != errItemExpired {
+			return count, err
+		}
 	}
+}
 
+// setItemDictFields sets fields of Dict item under the item lock and returns count of added fields.
+// errItemExpired is returned if item expired before it was locked, so the caller should retry with a fresh item
+func setItemDictFields(item *Item, fieldsValues [][]byte) (count int, err error) {
 	item.Lock()
 	defer item.Unlock()
 
+	if item.IsExpired() {
+		return 0, errItemExpired
+	}
+
 	if item.kind != Dict {
 		return 0, ErrWrongType
 	}
 
+	return setDictFields(item, fieldsValues), nil
+}
+
+// setDictFields sets fields of Dict item, which should be locked for writing, and returns count of added fields
+func setDictFields(item *Item, fieldsValues [][]byte) (count int) {
 	dict := item.Dict()
-	count = 1
-	if _, ok := dict[field]; ok {
-		count = 0
+	for i := 0; i < len(fieldsValues); i += 2 {
+		field := string(fieldsValues[i])
+		item.expireDictField(field)
+		if _, ok := dict[field]; !ok {
+			count++
+		}
+		dict[field] = fieldsValues[i+1]
+		// like in Redis, overwritten field loses its TTL
+		item.persistDictField(field)
 	}
-	dict[field] = value
 
-	return count, nil
+	return count
 }
 
 // DGet Returns the value associated with field in the dict stored at key.
@@ -249,7 +498,7 @@ func (c *Core) DGet(key, field string) (result []byte, err error) {
 		return nil, ErrWrongType
 	}
 
-	dict := item.Dict()
+	dict := item.liveDict()
 	value, ok := dict[field]
 	if !ok {
 		return nil, ErrNotFound
@@ -261,10 +510,9 @@ func (c *Core) DGet(key, field string) (result []byte, err error) {
 	return result, nil
 }
 
-// Returns all field names in the dict stored at key.
+// DKeys Returns all field names in the dict stored at key.
 // @command HKEYS
 func (c *Core) DKeys(key string) (result []string, err error) {
-	pattern := "*"
 	item := c.getItem(key)
 	if item == nil {
 		// In Redis, LRange on non-exists key returns empty list, not <nil> aka NotFound
@@ -278,17 +526,13 @@ func (c *Core) DKeys(key string) (result []string, err error) {
 		return nil, ErrWrongType
 	}
 
-	dict := item.Dict()
-
-	// pre-allocate slice to avoid reallocation
-	filteredKeys := make([]string, 0, len(dict))
-	for key := range dict {
-		if glob.Glob(pattern, key) {
-			filteredKeys = append(filteredKeys, key)
-		}
+	dict := item.liveDict()
+	result = make([]string, 0, len(dict))
+	for field := range dict {
+		result = append(result, field)
 	}
 
-	return filteredKeys, nil
+	return result, nil
 }
 
 // DGetAll Returns all fields and values of the hash stored at key.
@@ -309,7 +553,7 @@ func (c *Core) DGetAll(key string) (result [][]byte, err error) {
 		return nil, ErrWrongType
 	}
 
-	dict := item.Dict()
+	dict := item.liveDict()
 	result = make([][]byte, 0, 2*len(dict))
 	for k, v := range dict {
 		keyBytes := []byte(k)
@@ -341,12 +585,18 @@ func (c *Core) DDel(key string, fields []string) (count int, err error) {
 
 	dict := item.Dict()
 	for _, field := range fields {
+		item.expireDictField(field)
 		if _, ok := dict[field]; ok {
 			count++
 			delete(dict, field)
+			item.persistDictField(field)
 		}
 	}
 
+	if count > 0 {
+		c.notify(EventHash, "hdel", key)
+	}
+
 	return count, nil
 }
 
@@ -368,7 +618,7 @@ func (c *Core) LLen(key string) (count int, err error) {
 		return 0, ErrWrongType
 	}
 
-	return len(item.List()), nil
+	return item.list.len(), nil
 }
 
 // LRange returns the specified elements of the list stored at key.
@@ -390,8 +640,8 @@ func (c *Core) LRange(key string, start, stop int) (result [][]byte, err error)
 		return nil, ErrWrongType
 	}
 
-	list := item.List()
-	lLen := len(list)
+	list := item.list
+	lLen := list.len()
 
 	// just return on empty list to avoid further index checks
 	if lLen == 0 {
@@ -413,24 +663,11 @@ func (c *Core) LRange(key string, start, stop int) (result [][]byte, err error)
 		return [][]byte{}, nil
 	}
 
-	//IMPORTANT: by proto, HEAD of the list has index 0, but in the slice storage it is the LAST element of the slice
-	startIndex := lLen - 1 - stop
-	// don't do -1 due to in GO slicing stops BEFORE stop, and in radish proto range stops AT stop
-	stopIndex := lLen - start
-
-	slice := list[startIndex:stopIndex]
-	// just return on empty list to avoid further index checks
-	if len(slice) == 0 {
-		return [][]byte{}, nil
-	}
-
-	result = make([][]byte, len(slice))
-
-	// due to in radish HEAD of list has index 0, reverse actual items order in the slice
-	for i, v := range slice {
-		resultI := len(slice) - 1 - i
-		result[resultI] = make([]byte, len(v))
-		copy(result[resultI], v)
+	result = make([][]byte, stop-start+1)
+	for i := range result {
+		value := list.at(start + i)
+		result[i] = make([]byte, len(value))
+		copy(result[i], value)
 	}
 
 	return result, nil
@@ -455,8 +692,7 @@ func (c *Core) LIndex(key string, index int) (result []byte, err error) {
 		return nil, ErrWrongType
 	}
 
-	list := item.List()
-	lLen := len(list)
+	lLen := item.list.len()
 
 	if index < 0 {
 		index += lLen
@@ -467,10 +703,7 @@ func (c *Core) LIndex(key string, index int) (result []byte, err error) {
 		return []byte{}, ErrNotFound
 	}
 
-	//IMPORTANT: by proto, HEAD of the list has index 0, but in the slice storage it is the LAST element of the slice
-	sliceIndex := lLen - 1 - index
-
-	value := list[sliceIndex]
+	value := item.list.at(index)
 
 	result = make([]byte, len(value))
 	copy(result, value)
@@ -485,6 +718,7 @@ func (c *Core) LIndex(key string, index int) (result []byte, err error) {
 // An error is returned for out of range indexes.
 // @command LSET
 // @modifying
+// @denyoom
 func (c *Core) LSet(key string, index int, value []byte) (err error) {
 	item := c.getItem(key)
 	if item == nil {
@@ -499,8 +733,7 @@ func (c *Core) LSet(key string, index int, value []byte) (err error) {
 		return ErrWrongType
 	}
 
-	list := item.List()
-	lLen := len(list)
+	lLen := item.list.len()
 
 	if index < 0 {
 		index += lLen
@@ -511,10 +744,8 @@ func (c *Core) LSet(key string, index int, value []byte) (err error) {
 		return ErrInvalidIndex
 	}
 
-	//IMPORTANT: by proto, HEAD of the list has index 0, but in the slice storage it is the LAST element of the slice
-	sliceIndex := lLen - 1 - index
-
-	list[sliceIndex] = value
+	item.list.set(index, value)
+	c.notify(EventList, "lset", key)
 
 	return nil
 }
@@ -527,28 +758,12 @@ func (c *Core) LSet(key string, index int, value []byte) (err error) {
 // So for instance the command LPush("mylist",  []byte[a b c]) will result into a list containing [c, b, a]
 // @command LPUSH
 // @modifying
+// @denyoom
 func (c *Core) LPush(key string, values [][]byte) (count int, err error) {
-	item := c.getItem(key)
-	if item == nil {
-		item = NewItemList([][]byte{})
-		defer func() {
-			c.storage.AddOrReplaceOne(key, item)
-		}()
-	}
-
-	item.Lock()
-	defer item.Unlock()
-
-	if item.kind != List {
-		return 0, ErrWrongType
-	}
-
-	list := item.List()
+	defer c.pushWaiters.notify(key)
+	defer c.notifyOnSuccess(&err, EventList, "lpush", key)
 
-	list = append(list, values...)
-	item.SetList(list)
-
-	return len(list), nil
+	return c.push(key, values, true)
 }
 
 // LPop Removes and returns the first element of the list stored at key.
@@ -567,16 +782,13 @@ func (c *Core) LPop(key string) (result []byte, err error) {
 		return nil, ErrWrongType
 	}
 
-	list := item.List()
-
-	if len(list) == 0 {
+	if item.list.len() == 0 {
 		return nil, ErrNotFound
 	}
 
 	// don't copy result ,due to it will be removed from list
-	result = list[len(list)-1]
-	list = list[:len(list)-1]
-	item.SetList(list)
+	result = item.list.popFront()
+	c.notify(EventList, "lpop", key)
 
 	return result, nil
 }
@@ -606,6 +818,7 @@ func (c *Core) Ttl(key string) (ttl int, err error) {
 // @command EXPIRE
 // @modifying
 // @ttl 1
+// @absttl 1 seconds PEXPIREAT $0 $1
 func (c *Core) Expire(key string, seconds int) (result int) {
 	item := c.getItem(key)
 	if item == nil {
@@ -617,6 +830,9 @@ func (c *Core) Expire(key string, seconds int) (result int) {
 		return 1
 	}
 
+	// deferred first to index the key after the item is unlocked: the storage is never locked under the item lock
+	defer c.storage.IndexVolatile(key)
+
 	item.Lock()
 	defer item.Unlock()
 
@@ -627,6 +843,7 @@ func (c *Core) Expire(key string, seconds int) (result int) {
 	}
 
 	item.SetTtl(seconds)
+	c.notify(EventGeneric, "expire", key)
 
 	return 1
 }
@@ -654,6 +871,7 @@ func (c *Core) Persist(key string) (result int) {
 	}
 
 	item.RemoveTtl()
+	c.notify(EventGeneric, "persist", key)
 
 	return 1
 }
@@ -665,11 +883,63 @@ func (c *Core) Storage() Storage {
 }
 
 // SetStorage sets storage storage after loading
-// Except Storage, Core is stateless by design, so it's enough to persist Storage to save all Core state
+// Except Storage, Core is stateless by design, so it's enough to persist Storage to save all Core state.
+// The storage isn't guarded, so the caller must guarantee, that no other Core method is running
 func (c *Core) SetStorage(storage Storage) {
 	c.storage = storage
 }
 
+// addItemIfAbsent atomically adds item built by newItem, if key not exists or holds expired item, and returns nil.
+// If key holds not expired item, returns it.
+func (c *Core) addItemIfAbsent(key string, newItem func() *Item) (existing *Item) {
+	for {
+		existing = c.storage.Get(key)
+		if existing != nil {
+			existing.RLock()
+			isExpired := existing.IsExpired()
+			existing.RUnlock()
+
+			if !isExpired {
+				return existing
+			}
+		}
+
+		if c.storage.CompareAndSwap(key, existing, newItem()) {
+			return nil
+		}
+	}
+}
+
+// lockItems locks all distinct not nil items and returns function to unlock them.
+// It should be called only inside Storage.AtomicUpdate(): the storage lock guarantees
+// that no one else locks several of these items at once, so locking order doesn't matter
+func lockItems(items ...*Item) (unlock func()) {
+	var locked []*Item
+	for _, item := range items {
+		if item == nil || containsItem(locked, item) {
+			continue
+		}
+		item.Lock()
+		locked = append(locked, item)
+	}
+
+	return func() {
+		for _, item := range locked {
+			item.Unlock()
+		}
+	}
+}
+
+func containsItem(items []*Item, item *Item) bool {
+	for _, v := range items {
+		if v == item {
+			return true
+		}
+	}
+
+	return false
+}
+
 // warning: it could affect performance due to extra mutex lock.
 // if it makes perf. penalty, move  IsExpired() check inside existing Lock() in every API func
 func (c *Core) getItem(key string) *Item {
@@ -686,5 +956,6 @@ func (c *Core) getItem(key string) *Item {
 	}
 
 	item.RUnlock()
+	item.touch()
 	return item
 }
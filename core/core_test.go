@@ -5,6 +5,7 @@ import (
 	"github.com/go-test/deep"
 	. "github.com/mshaverdo/radish/core"
 	"math/rand"
+	"runtime"
 	"sort"
 	"sync"
 	"testing"
@@ -61,6 +62,76 @@ func (e *MockStorage) AddOrReplaceOne(key string, item *Item) {
 	e.data[key] = item
 }
 
+func (e *MockStorage) CompareAndSwap(key string, old, new *Item) (swapped bool) {
+	if e.data[key] != old {
+		return false
+	}
+
+	e.data[key] = new
+	return true
+}
+
+func (e *MockStorage) AtomicUpdate(keys []string, update func(items map[string]*Item)) {
+	items := make(map[string]*Item, len(keys))
+	for _, key := range keys {
+		if item, ok := e.data[key]; ok {
+			items[key] = item
+		}
+	}
+
+	update(items)
+
+	for _, key := range keys {
+		if item := items[key]; item != nil {
+			e.data[key] = item
+		} else {
+			delete(e.data, key)
+		}
+	}
+}
+
+func (e *MockStorage) Len() (count int) {
+	return len(e.data)
+}
+
+func (e *MockStorage) RandomKey() (key string, ok bool) {
+	for key = range e.data {
+		return key, true
+	}
+
+	return "", false
+}
+
+func (e *MockStorage) UsedMemory() (bytes int64) {
+	for k, v := range e.data {
+		bytes += int64(len(k)) + v.MemoryUsage()
+	}
+
+	return bytes
+}
+
+func (e *MockStorage) IndexVolatile(key string) {
+}
+
+// ScanVolatile returns all the keys, so every item is checked by CollectExpired()
+func (e *MockStorage) ScanVolatile(cursor, count int) (next int, keys []string) {
+	return e.Scan(cursor, count)
+}
+
+func (e *MockStorage) Scan(cursor, count int) (next int, keys []string) {
+	allKeys := e.Keys()
+	sort.Strings(allKeys)
+
+	if cursor > len(allKeys) {
+		return 0, nil
+	}
+	if cursor+count >= len(allKeys) {
+		return 0, allKeys[cursor:]
+	}
+
+	return cursor + count, allKeys[cursor : cursor+count]
+}
+
 func (e *MockStorage) Del(keys []string) (count int) {
 	for _, k := range keys {
 		if _, ok := e.data[k]; ok {
@@ -121,6 +192,39 @@ func TestCore_Keys(t *testing.T) {
 	}
 }
 
+func TestCore_KeysRange(t *testing.T) {
+	tests := []struct {
+		from, to string
+		count    int
+		want     []string
+	}{
+		{"", "", 0, []string{"bytes", "dict", "list", "測"}},
+		{"c", "m", 0, []string{"dict", "list"}},
+		{"dict", "list", 0, []string{"dict"}},
+		{"a", "", 2, []string{"bytes", "dict"}},
+		{"e", "l", 0, []string{}},
+	}
+
+	storage := NewStorageBTree()
+	storage.SetData(getSampleDataCore())
+	c := New(storage)
+
+	for _, tst := range tests {
+		got, err := c.KeysRange(tst.from, tst.to, tst.count)
+		if err != nil {
+			t.Errorf("KeysRange(%q, %q, %d): unexpected error %q", tst.from, tst.to, tst.count, err)
+		}
+
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("KeysRange(%q, %q, %d): %s\n\ngot:%v\n\nwant:%v", tst.from, tst.to, tst.count, diff, got, tst.want)
+		}
+	}
+
+	if _, err := New(NewMockStorage()).KeysRange("", "", 0); err != ErrUnorderedStorage {
+		t.Errorf("KeysRange() on unordered storage: %v != %v", err, ErrUnorderedStorage)
+	}
+}
+
 func TestCore_Get(t *testing.T) {
 	tests := []struct {
 		key  string
@@ -171,6 +275,58 @@ func TestCore_Set(t *testing.T) {
 	}
 }
 
+func TestCore_SetOptions(t *testing.T) {
+	tests := []struct {
+		key, value string
+		options    []string
+		err        error
+		want       interface{}
+		wantValue  string
+		wantTtl    int
+	}{
+		{"new", "v", []string{"NX", "XX"}, ErrSyntax, nil, "", -2},
+		{"new", "v", []string{"EX"}, ErrSyntax, nil, "", -2},
+		{"new", "v", []string{"EX", "10", "PX", "100"}, ErrSyntax, nil, "", -2},
+		{"new", "v", []string{"KEEPTTL", "EX", "10"}, ErrSyntax, nil, "", -2},
+		{"new", "v", []string{"EX", "ten"}, ErrNotInteger, nil, "", -2},
+		{"new", "v", []string{"EX", "0"}, ErrExpireTime, nil, "", -2},
+		{"new", "v", []string{"UNKNOWN"}, ErrSyntax, nil, "", -2},
+		{"new", "v", []string{"XX"}, ErrNotFound, nil, "", -2},
+		{"new", "v", []string{"nx", "ex", "10"}, nil, nil, "v", 10},
+		{"new", "v2", []string{"NX"}, ErrNotFound, nil, "v", 10},
+		{"new", "v2", []string{"XX", "KEEPTTL"}, nil, nil, "v2", 10},
+		{"new", "v3", []string{"XX", "GET"}, nil, []byte("v2"), "v3", -1},
+		{"new", "v4", []string{"NX", "GET"}, nil, []byte("v3"), "v3", -1},
+		{"new", "v5", []string{"PX", "20700"}, nil, nil, "v5", 21},
+		{"new", "v6", []string{"PXAT", "1"}, nil, nil, "", -2},
+		{"expired", "v", []string{"GET", "EXAT", "4102444800"}, ErrNotFound, nil, "v", int(time.Unix(4102444800, 0).Sub(time.Now()).Seconds() + 0.5)},
+		{"dict", "v", []string{"GET"}, ErrWrongType, nil, "", -1},
+		{"dict", "v", []string{"XX", "KEEPTTL"}, nil, nil, "v", -1},
+		{"bytes", "v", []string{"KEEPTTL"}, nil, nil, "v", 1000},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		result, err := c.Set(tst.key, []byte(tst.value), tst.options...)
+		value, _ := c.Get(tst.key)
+		ttl, _ := c.Ttl(tst.key)
+
+		if err != tst.err {
+			t.Errorf("Set(%q, %q, %q) err: %q != %q", tst.key, tst.value, tst.options, err, tst.err)
+		}
+		if diff := deep.Equal(result, tst.want); diff != nil {
+			t.Errorf("Set(%q, %q, %q): %s\n\ngot:%q\n\nwant:%q", tst.key, tst.value, tst.options, diff, result, tst.want)
+		}
+		if string(value) != tst.wantValue {
+			t.Errorf("Set(%q, %q, %q) value: %q != %q", tst.key, tst.value, tst.options, value, tst.wantValue)
+		}
+		if ttl != tst.wantTtl {
+			t.Errorf("Set(%q, %q, %q) ttl: %d != %d", tst.key, tst.value, tst.options, ttl, tst.wantTtl)
+		}
+	}
+}
+
 func TestCore_Del(t *testing.T) {
 	tests := []struct {
 		keys []string
@@ -251,33 +407,39 @@ func TestCore_DKeys(t *testing.T) {
 
 func TestCore_DSet(t *testing.T) {
 	tests := []struct {
-		key, field, value string
-		err               error
-		count             int
+		key          string
+		fieldsValues []string
+		err          error
+		count        int
 	}{
-		{"bytes", "", "", ErrWrongType, 0},
-		{"404", "共", "共産主義の幽霊", nil, 1},
-		{"expired", "not expired", "not expired", nil, 1},
-		{"dict", "共", "共産主義の幽霊", nil, 1},
-		{"dict", "banana", "mango", nil, 0},
+		{"bytes", []string{"", ""}, ErrWrongType, 0},
+		{"404", []string{"共", "共産主義の幽霊"}, nil, 1},
+		{"expired", []string{"not expired", "not expired"}, nil, 1},
+		{"dict", []string{"共", "共産主義の幽霊"}, nil, 1},
+		{"dict", []string{"banana", "mango"}, nil, 0},
+		{"dict", []string{"banana", "kiwi", "apple", "pear", "plum", "cherry"}, nil, 2},
+		{"dict", []string{"banana"}, ErrSyntax, 0},
+		{"dict", []string{}, ErrSyntax, 0},
 	}
 
 	c := New(NewMockStorage())
 
 	for _, tst := range tests {
-		count, err := c.DSet(tst.key, tst.field, []byte(tst.value))
-		got, getErr := c.DGet(tst.key, tst.field)
+		count, err := c.DSet(tst.key, stringsToBytes(tst.fieldsValues))
 		if err != tst.err {
-			t.Errorf("DSet(%q, %q) err: %q != %q", tst.key, tst.field, err, tst.err)
+			t.Errorf("DSet(%q, %q) err: %q != %q", tst.key, tst.fieldsValues, err, tst.err)
 		}
-		if err == nil && err != nil {
-			t.Errorf("DSet(%q, %q) getErr: %q ", tst.key, tst.field, getErr)
+		if err != nil {
+			continue
 		}
-		if err == nil && count != tst.count {
-			t.Errorf("DSet(%q, %q) count: %d != %d", tst.key, tst.field, count, tst.count)
+		if count != tst.count {
+			t.Errorf("DSet(%q, %q) count: %d != %d", tst.key, tst.fieldsValues, count, tst.count)
 		}
-		if err == nil && string(got) != tst.value {
-			t.Errorf("DSet(%q, %q) got: %q != %q", tst.key, tst.field, string(got), tst.value)
+		for i := 0; i < len(tst.fieldsValues); i += 2 {
+			got, getErr := c.DGet(tst.key, tst.fieldsValues[i])
+			if getErr != nil || string(got) != tst.fieldsValues[i+1] {
+				t.Errorf("DSet(%q, %q) got: %q, %v", tst.key, tst.fieldsValues, string(got), getErr)
+			}
 		}
 	}
 }
@@ -651,7 +813,7 @@ func coreConcurrencyWorker(wg *sync.WaitGroup, c *Core, tests []TestCoreConcurre
 		}
 		for _, key := range t.dict {
 			for _, field := range t.dictFields {
-				c.DSet(key, field, []byte(time.Now().String()))
+				c.DSet(key, [][]byte{[]byte(field), []byte(time.Now().String())})
 				c.DGet(key, field)
 			}
 			c.DKeys(key)
@@ -687,7 +849,7 @@ func coreConcurrencyWorker(wg *sync.WaitGroup, c *Core, tests []TestCoreConcurre
 		c.Set(key, []byte(time.Now().String()))
 	}
 	for _, key := range t.dict {
-		c.DSet(key, "f", []byte(time.Now().String()))
+		c.DSet(key, [][]byte{[]byte("f"), []byte(time.Now().String())})
 	}
 	for _, key := range t.list {
 		c.LPush(key, [][]byte{[]byte("val")})
@@ -931,3 +1093,48 @@ func TestCore_Ttl(t *testing.T) {
 		}
 	}
 }
+
+func TestCore_CreateConcurrency(t *testing.T) {
+	const rounds, workers = 100, 8
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(workers))
+
+	c := New(NewStorageHash())
+
+	for i := 0; i < rounds; i++ {
+		// every round writes to new keys, so the workers race to create them
+		list, set, zset := fmt.Sprint("list", i), fmt.Sprint("set", i), fmt.Sprint("zset", i)
+		dict := fmt.Sprint("dict", i)
+
+		var wg sync.WaitGroup
+		for j := 0; j < workers; j++ {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				member := fmt.Sprint(j)
+				c.RPush(list, [][]byte{[]byte(member)})
+				c.LPush(list, [][]byte{[]byte(member)})
+				c.SAdd(set, []string{member})
+				c.ZAdd(zset, []string{"1", member})
+				c.ZIncrBy(zset, 1, "counter")
+				c.DSet(dict, [][]byte{[]byte(member), []byte("value"), []byte(member + "x"), []byte("value")})
+			}(j)
+		}
+		wg.Wait()
+
+		if got, _ := c.LLen(list); got != 2*workers {
+			t.Fatalf("RPush()/LPush() lost values: %d != %d", got, 2*workers)
+		}
+		if got, _ := c.SCard(set); got != workers {
+			t.Fatalf("SAdd() lost members: %d != %d", got, workers)
+		}
+		if got, _ := c.ZCard(zset); got != workers+1 {
+			t.Fatalf("ZAdd() lost members: %d != %d", got, workers+1)
+		}
+		if got, _ := c.ZScore(zset, "counter"); got != workers {
+			t.Fatalf("ZIncrBy() lost increments: %v != %v", got, workers)
+		}
+		if got, _ := c.DLen(dict); got != 2*workers {
+			t.Fatalf("DSet() lost fields: %d != %d", got, 2*workers)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package core
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// errItemExpired signals that the item expired between lookup and locking
+var errItemExpired = errors.New("item expired")
+
+// Incr Increments the number stored at key by one.
+// If the key does not exist, it is set to 0 before performing the operation.
+// An error is returned if the key contains a value of the wrong type
+// or contains a string that can not be represented as integer.
+// @command INCR
+// @modifying
+// @denyoom
+func (c *Core) Incr(key string) (result int, err error) {
+	return c.IncrBy(key, 1)
+}
+
+// Decr Decrements the number stored at key by one.
+// If the key does not exist, it is set to 0 before performing the operation.
+// @command DECR
+// @modifying
+// @denyoom
+func (c *Core) Decr(key string) (result int, err error) {
+	return c.IncrBy(key, -1)
+}
+
+// DecrBy Decrements the number stored at key by decrement.
+// If the key does not exist, it is set to 0 before performing the operation.
+// @command DECRBY
+// @modifying
+// @denyoom
+func (c *Core) DecrBy(key string, decrement int) (result int, err error) {
+	if int64(decrement) == math.MinInt64 {
+		return 0, ErrOverflow
+	}
+
+	return c.IncrBy(key, -decrement)
+}
+
+// IncrBy Increments the number stored at key by increment.
+// If the key does not exist, it is set to 0 before performing the operation.
+// An error is returned if the key contains a value of the wrong type
+// or contains a string that can not be represented as integer.
+// @command INCRBY
+// @modifying
+// @denyoom
+func (c *Core) IncrBy(key string, increment int) (result int, err error) {
+	defer c.notifyOnSuccess(&err, EventString, "incrby", key)
+
+	for {
+		item := c.addItemIfAbsent(key, func() *Item {
+			return NewItemBytes([]byte(strconv.Itoa(increment)))
+		})
+		if item == nil {
+			return increment, nil
+		}
+
+		result, err := incrItemBytes(item, int64(increment))
+		if err != errItemExpired {
+			return result, err
+		}
+	}
+}
+
+// IncrByFloat Increment the string representing a floating point number stored at key by the specified increment.
+// If the key does not exist, it is set to 0 before performing the operation.
+// The value is stored in the shortest form that parses back to the same float64,
+// so replaying the command from WAL gives exactly the same result.
+// @command INCRBYFLOAT
+// @modifying
+// @denyoom
+func (c *Core) IncrByFloat(key string, increment float64) (result float64, err error) {
+	if math.IsInf(increment, 0) {
+		return 0, ErrIncrNaN
+	}
+
+	defer c.notifyOnSuccess(&err, EventString, "incrbyfloat", key)
+
+	for {
+		item := c.addItemIfAbsent(key, func() *Item {
+			return NewItemBytes([]byte(formatFloat(increment)))
+		})
+		if item == nil {
+			return increment, nil
+		}
+
+		result, err := incrFloatItemBytes(item, increment)
+		if err != errItemExpired {
+			return result, err
+		}
+	}
+}
+
+// DIncrBy Increments the number stored at field in the dict stored at key by increment.
+// If key does not exist, a new key holding a dict is created.
+// If field does not exist the value is set to 0 before the operation is performed.
+// @command HINCRBY
+// @modifying
+// @denyoom
+func (c *Core) DIncrBy(key, field string, increment int) (result int, err error) {
+	defer c.notifyOnSuccess(&err, EventHash, "hincrby", key)
+
+	for {
+		item := c.addItemIfAbsent(key, func() *Item {
+			return NewItemDict(map[string][]byte{field: []byte(strconv.Itoa(increment))})
+		})
+		if item == nil {
+			return increment, nil
+		}
+
+		result, err := incrItemDictField(item, field, int64(increment))
+		if err != errItemExpired {
+			return result, err
+		}
+	}
+}
+
+// DIncrByFloat Increment the specified field of a dict stored at key,
+// and representing a floating point number, by the specified increment.
+// If the field does not exist, it is set to 0 before performing the operation.
+// @command HINCRBYFLOAT
+// @modifying
+// @denyoom
+func (c *Core) DIncrByFloat(key, field string, increment float64) (result float64, err error) {
+	if math.IsInf(increment, 0) {
+		return 0, ErrIncrNaN
+	}
+
+	defer c.notifyOnSuccess(&err, EventHash, "hincrbyfloat", key)
+
+	for {
+		item := c.addItemIfAbsent(key, func() *Item {
+			return NewItemDict(map[string][]byte{field: []byte(formatFloat(increment))})
+		})
+		if item == nil {
+			return increment, nil
+		}
+
+		result, err := incrFloatItemDictField(item, field, increment)
+		if err != errItemExpired {
+			return result, err
+		}
+	}
+}
+
+// incrItemBytes increments integer value of Bytes item under the item lock.
+// errItemExpired is returned if item expired before it was locked, so the caller should retry with a fresh item
+func incrItemBytes(item *Item, increment int64) (result int, err error) {
+	item.Lock()
+	defer item.Unlock()
+
+	if item.IsExpired() {
+		return 0, errItemExpired
+	}
+
+	if item.kind != Bytes {
+		return 0, ErrWrongType
+	}
+
+	value, err := incrInt(item.bytes, increment)
+	if err != nil {
+		return 0, err
+	}
+
+	item.bytes = []byte(strconv.FormatInt(value, 10))
+	return int(value), nil
+}
+
+// incrFloatItemBytes increments float value of Bytes item under the item lock.
+// errItemExpired is returned if item expired before it was locked, so the caller should retry with a fresh item
+func incrFloatItemBytes(item *Item, increment float64) (result float64, err error) {
+	item.Lock()
+	defer item.Unlock()
+
+	if item.IsExpired() {
+		return 0, errItemExpired
+	}
+
+	if item.kind != Bytes {
+		return 0, ErrWrongType
+	}
+
+	result, err = incrFloat(item.bytes, increment)
+	if err != nil {
+		return 0, err
+	}
+
+	item.bytes = []byte(formatFloat(result))
+	return result, nil
+}
+
+// incrItemDictField increments integer value of the field of Dict item under the item lock.
+// errItemExpired is returned if item expired before it was locked, so the caller should retry with a fresh item
+func incrItemDictField(item *Item, field string, increment int64) (result int, err error) {
+	item.Lock()
+	defer item.Unlock()
+
+	if item.IsExpired() {
+		return 0, errItemExpired
+	}
+
+	if item.kind != Dict {
+		return 0, ErrWrongType
+	}
+
+	value := increment
+	item.expireDictField(field)
+	if current, exists := item.dict[field]; exists {
+		value, err = incrInt(current, increment)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	item.dict[field] = []byte(strconv.FormatInt(value, 10))
+	return int(value), nil
+}
+
+// incrFloatItemDictField increments float value of the field of Dict item under the item lock.
+// errItemExpired is returned if item expired before it was locked, so the caller should retry with a fresh item
+func incrFloatItemDictField(item *Item, field string, increment float64) (result float64, err error) {
+	item.Lock()
+	defer item.Unlock()
+
+	if item.IsExpired() {
+		return 0, errItemExpired
+	}
+
+	if item.kind != Dict {
+		return 0, ErrWrongType
+	}
+
+	result = increment
+	item.expireDictField(field)
+	if current, exists := item.dict[field]; exists {
+		result, err = incrFloat(current, increment)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	item.dict[field] = []byte(formatFloat(result))
+	return result, nil
+}
+
+// incrInt parses value as 64-bit signed integer and adds increment, checking for overflow
+func incrInt(value []byte, increment int64) (result int64, err error) {
+	current, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+
+	if (increment > 0 && current > math.MaxInt64-increment) || (increment < 0 && current < math.MinInt64-increment) {
+		return 0, ErrOverflow
+	}
+
+	return current + increment, nil
+}
+
+// incrFloat parses value as float and adds increment. NaN and Infinity results are rejected
+func incrFloat(value []byte, increment float64) (result float64, err error) {
+	current, err := strconv.ParseFloat(string(value), 64)
+	if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+		return 0, ErrNotFloat
+	}
+
+	result = current + increment
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, ErrIncrNaN
+	}
+
+	return result, nil
+}
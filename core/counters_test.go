@@ -0,0 +1,202 @@
+package core_test
+
+import (
+	. "github.com/mshaverdo/radish/core"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func getSampleDataCounters() map[string]*Item {
+	data := getSampleDataCore()
+	data["int"] = NewItemBytes([]byte("10"))
+	data["max"] = NewItemBytes([]byte(strconv.FormatInt(math.MaxInt64, 10)))
+	data["float"] = NewItemBytes([]byte("10.5"))
+	data["huge"] = NewItemBytes([]byte("1e308"))
+	data["counters"] = NewItemDict(map[string][]byte{
+		"int":   []byte("10"),
+		"float": []byte("10.5"),
+		"str":   []byte("mama"),
+	})
+
+	return data
+}
+
+func NewMockStorageCounters() *MockStorage {
+	return &MockStorage{data: getSampleDataCounters()}
+}
+
+func TestCore_IncrBy(t *testing.T) {
+	tests := []struct {
+		key       string
+		increment int
+		err       error
+		want      int
+	}{
+		{"dict", 1, ErrWrongType, 0},
+		{"bytes", 1, ErrNotInteger, 0},
+		{"float", 1, ErrNotInteger, 0},
+		{"max", 1, ErrOverflow, 0},
+		{"max", -1, nil, math.MaxInt64 - 1},
+		{"404", 5, nil, 5},
+		{"expired", -5, nil, -5},
+		{"int", 5, nil, 15},
+		{"int", -20, nil, -5},
+	}
+
+	c := New(NewMockStorageCounters())
+
+	for _, tst := range tests {
+		result, err := c.IncrBy(tst.key, tst.increment)
+		if err != tst.err {
+			t.Errorf("IncrBy(%q, %d) err: %q != %q", tst.key, tst.increment, err, tst.err)
+		}
+		if result != tst.want {
+			t.Errorf("IncrBy(%q, %d): %d != %d", tst.key, tst.increment, result, tst.want)
+		}
+		if got, _ := c.Get(tst.key); err == nil && string(got) != strconv.Itoa(tst.want) {
+			t.Errorf("IncrBy(%q, %d) stored: %q != %d", tst.key, tst.increment, got, tst.want)
+		}
+	}
+}
+
+func TestCore_IncrDecr(t *testing.T) {
+	c := New(NewMockStorageCounters())
+
+	if result, err := c.Incr("int"); err != nil || result != 11 {
+		t.Errorf("Incr(): %d, %q", result, err)
+	}
+	if result, err := c.Decr("int"); err != nil || result != 10 {
+		t.Errorf("Decr(): %d, %q", result, err)
+	}
+	if result, err := c.DecrBy("int", 15); err != nil || result != -5 {
+		t.Errorf("DecrBy(): %d, %q", result, err)
+	}
+	if _, err := c.DecrBy("int", math.MinInt64); err != ErrOverflow {
+		t.Errorf("DecrBy(MinInt64) err: %q != %q", err, ErrOverflow)
+	}
+}
+
+func TestCore_IncrByFloat(t *testing.T) {
+	tests := []struct {
+		key       string
+		increment float64
+		err       error
+		want      float64
+		wantValue string
+	}{
+		{"dict", 1, ErrWrongType, 0, ""},
+		{"bytes", 1, ErrNotFloat, 0, ""},
+		{"404", 0.1, nil, 0.1, "0.1"},
+		{"expired", 3, nil, 3, "3"},
+		{"float", 0.1, nil, 10.6, "10.6"},
+		{"float", -10.6, nil, 0, "0"},
+		{"int", 0.5, nil, 10.5, "10.5"},
+		{"huge", 1e308, ErrIncrNaN, 0, ""},
+		{"int", math.Inf(1), ErrIncrNaN, 0, ""},
+	}
+
+	c := New(NewMockStorageCounters())
+
+	for _, tst := range tests {
+		result, err := c.IncrByFloat(tst.key, tst.increment)
+		if err != tst.err {
+			t.Errorf("IncrByFloat(%q, %v) err: %q != %q", tst.key, tst.increment, err, tst.err)
+		}
+		if result != tst.want {
+			t.Errorf("IncrByFloat(%q, %v): %v != %v", tst.key, tst.increment, result, tst.want)
+		}
+		if got, _ := c.Get(tst.key); err == nil && string(got) != tst.wantValue {
+			t.Errorf("IncrByFloat(%q, %v) stored: %q != %q", tst.key, tst.increment, got, tst.wantValue)
+		}
+	}
+}
+
+func TestCore_DIncrBy(t *testing.T) {
+	tests := []struct {
+		key, field string
+		increment  int
+		err        error
+		want       int
+	}{
+		{"bytes", "int", 1, ErrWrongType, 0},
+		{"counters", "str", 1, ErrNotInteger, 0},
+		{"counters", "float", 1, ErrNotInteger, 0},
+		{"counters", "int", 5, nil, 15},
+		{"counters", "404", -5, nil, -5},
+		{"404", "int", 7, nil, 7},
+		{"expired", "int", 3, nil, 3},
+	}
+
+	c := New(NewMockStorageCounters())
+
+	for _, tst := range tests {
+		result, err := c.DIncrBy(tst.key, tst.field, tst.increment)
+		if err != tst.err {
+			t.Errorf("DIncrBy(%q, %q, %d) err: %q != %q", tst.key, tst.field, tst.increment, err, tst.err)
+		}
+		if result != tst.want {
+			t.Errorf("DIncrBy(%q, %q, %d): %d != %d", tst.key, tst.field, tst.increment, result, tst.want)
+		}
+		if got, _ := c.DGet(tst.key, tst.field); err == nil && string(got) != strconv.Itoa(tst.want) {
+			t.Errorf("DIncrBy(%q, %q, %d) stored: %q != %d", tst.key, tst.field, tst.increment, got, tst.want)
+		}
+	}
+}
+
+func TestCore_DIncrByFloat(t *testing.T) {
+	tests := []struct {
+		key, field string
+		increment  float64
+		err        error
+		want       float64
+	}{
+		{"bytes", "float", 1, ErrWrongType, 0},
+		{"counters", "str", 1, ErrNotFloat, 0},
+		{"counters", "float", 0.25, nil, 10.75},
+		{"counters", "int", 0.5, nil, 10.5},
+		{"counters", "404", 2.5, nil, 2.5},
+		{"404", "float", 1.5, nil, 1.5},
+	}
+
+	c := New(NewMockStorageCounters())
+
+	for _, tst := range tests {
+		result, err := c.DIncrByFloat(tst.key, tst.field, tst.increment)
+		if err != tst.err {
+			t.Errorf("DIncrByFloat(%q, %q, %v) err: %q != %q", tst.key, tst.field, tst.increment, err, tst.err)
+		}
+		if result != tst.want {
+			t.Errorf("DIncrByFloat(%q, %q, %v): %v != %v", tst.key, tst.field, tst.increment, result, tst.want)
+		}
+	}
+}
+
+func TestCore_IncrConcurrency(t *testing.T) {
+	const workers, increments = 50, 200
+
+	c := New(NewStorageHash())
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				c.Incr("counter")
+				c.DIncrBy("dict", "field", 1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	want := strconv.Itoa(workers * increments)
+	if got, _ := c.Get("counter"); string(got) != want {
+		t.Errorf("Incr() lost updates: %q != %q", got, want)
+	}
+	if got, _ := c.DGet("dict", "field"); string(got) != want {
+		t.Errorf("DIncrBy() lost updates: %q != %q", got, want)
+	}
+}
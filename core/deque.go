@@ -0,0 +1,143 @@
+package core
+
+// dequeMinCapacity is a minimal ring buffer size, deque never shrinks below it
+const dequeMinCapacity = 8
+
+// deque is a double-ended queue of values, backed by a growable ring buffer.
+// Push and pop at both ends take amortized O(1), access by index takes O(1).
+// Index 0 points to the HEAD of the list.
+type deque struct {
+	buf   [][]byte
+	head  int // position of the HEAD element in buf
+	count int
+}
+
+// newDeque constructs deque holding values, HEAD of the list is values[0]
+func newDeque(values [][]byte) *deque {
+	capacity := dequeMinCapacity
+	for capacity < len(values) {
+		capacity <<= 1
+	}
+
+	d := &deque{buf: make([][]byte, capacity), count: len(values)}
+	copy(d.buf, values)
+
+	return d
+}
+
+// len returns count of elements in the deque
+func (d *deque) len() int {
+	return d.count
+}
+
+// at returns element at index i, 0 <= i < len()
+func (d *deque) at(i int) []byte {
+	return d.buf[d.pos(i)]
+}
+
+// set replaces element at index i, 0 <= i < len()
+func (d *deque) set(i int, value []byte) {
+	d.buf[d.pos(i)] = value
+}
+
+// pushFront inserts value before the HEAD
+func (d *deque) pushFront(value []byte) {
+	d.grow()
+	d.head = (d.head - 1 + len(d.buf)) % len(d.buf)
+	d.buf[d.head] = value
+	d.count++
+}
+
+// pushBack inserts value after the TAIL
+func (d *deque) pushBack(value []byte) {
+	d.grow()
+	d.buf[d.pos(d.count)] = value
+	d.count++
+}
+
+// popFront removes and returns the HEAD element. Deque must not be empty
+func (d *deque) popFront() (value []byte) {
+	value = d.buf[d.head]
+	d.buf[d.head] = nil
+	d.head = (d.head + 1) % len(d.buf)
+	d.count--
+	d.shrink()
+
+	return value
+}
+
+// popBack removes and returns the TAIL element. Deque must not be empty
+func (d *deque) popBack() (value []byte) {
+	p := d.pos(d.count - 1)
+	value = d.buf[p]
+	d.buf[p] = nil
+	d.count--
+	d.shrink()
+
+	return value
+}
+
+// insert inserts value before element at index i, 0 <= i <= len(). It shifts the shorter side of the deque
+func (d *deque) insert(i int, value []byte) {
+	if i < d.count/2 {
+		d.pushFront(value)
+		for j := 0; j < i; j++ {
+			d.set(j, d.at(j+1))
+		}
+	} else {
+		d.pushBack(value)
+		for j := d.count - 1; j > i; j-- {
+			d.set(j, d.at(j-1))
+		}
+	}
+	d.set(i, value)
+}
+
+// values returns all elements from HEAD to TAIL
+func (d *deque) values() [][]byte {
+	result := make([][]byte, d.count)
+	for i := range result {
+		result[i] = d.at(i)
+	}
+
+	return result
+}
+
+// pos converts index of the element into position in the ring buffer
+func (d *deque) pos(i int) int {
+	return (d.head + i) % len(d.buf)
+}
+
+// grow doubles ring buffer if it is full
+func (d *deque) grow() {
+	if d.count == len(d.buf) {
+		d.resize(len(d.buf) * 2)
+	}
+}
+
+// shrink halves ring buffer if it is mostly empty
+func (d *deque) shrink() {
+	if len(d.buf) > dequeMinCapacity && d.count <= len(d.buf)/4 {
+		d.resize(len(d.buf) / 2)
+	}
+}
+
+func (d *deque) resize(capacity int) {
+	buf := make([][]byte, capacity)
+	for i := 0; i < d.count; i++ {
+		buf[i] = d.at(i)
+	}
+
+	d.buf = buf
+	d.head = 0
+}
+
+// reverseValues returns new slice holding values in reversed order
+func reverseValues(values [][]byte) [][]byte {
+	result := make([][]byte, len(values))
+	for i, v := range values {
+		result[len(values)-1-i] = v
+	}
+
+	return result
+}
@@ -0,0 +1,464 @@
+package core
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DMGet Returns the values associated with the specified fields in the dict stored at key.
+// For every field that does not exist in the dict, nil value is returned.
+// @command HMGET
+func (c *Core) DMGet(key string, fields []string) (result [][]byte, err error) {
+	result = make([][]byte, len(fields))
+	item := c.getItem(key)
+	if item == nil {
+		// not existing key is treated as an empty dict
+		return result, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Dict {
+		return nil, ErrWrongType
+	}
+
+	dict := item.liveDict()
+	for i, field := range fields {
+		if value, ok := dict[field]; ok {
+			result[i] = copyBytes(value)
+		}
+	}
+
+	return result, nil
+}
+
+// DExists Returns 1 if field is an existing field in the dict stored at key, 0 otherwise.
+// @command HEXISTS
+func (c *Core) DExists(key, field string) (result int, err error) {
+	err = c.readDict(key, func(dict map[string][]byte) {
+		if _, ok := dict[field]; ok {
+			result = 1
+		}
+	})
+
+	return result, err
+}
+
+// DLen Returns the number of fields contained in the dict stored at key.
+// @command HLEN
+func (c *Core) DLen(key string) (count int, err error) {
+	err = c.readDict(key, func(dict map[string][]byte) {
+		count = len(dict)
+	})
+
+	return count, err
+}
+
+// DVals Returns all values in the dict stored at key.
+// @command HVALS
+func (c *Core) DVals(key string) (result [][]byte, err error) {
+	err = c.readDict(key, func(dict map[string][]byte) {
+		result = make([][]byte, 0, len(dict))
+		for _, value := range dict {
+			result = append(result, copyBytes(value))
+		}
+	})
+
+	return result, err
+}
+
+// DStrLen Returns the string length of the value associated with field in the dict stored at key.
+// If the key or the field do not exist, 0 is returned.
+// @command HSTRLEN
+func (c *Core) DStrLen(key, field string) (length int, err error) {
+	err = c.readDict(key, func(dict map[string][]byte) {
+		length = len(dict[field])
+	})
+
+	return length, err
+}
+
+// DSetNX Sets field in the dict stored at key to value, only if field does not yet exist.
+// If key does not exist, a new key holding a dict is created.
+// Returns 1 if field is a new field in the dict and value was set, 0 if field already exists and no operation was performed.
+// @command HSETNX
+// @modifying
+// @denyoom
+func (c *Core) DSetNX(key, field string, value []byte) (result int, err error) {
+	for {
+		item := c.addItemIfAbsent(key, func() *Item {
+			return NewItemDict(map[string][]byte{field: value})
+		})
+		if item == nil {
+			c.notify(EventHash, "hset", key)
+			return 1, nil
+		}
+
+		result, err := setItemDictFieldNX(item, field, value)
+		if err != errItemExpired {
+			if result == 1 {
+				c.notify(EventHash, "hset", key)
+			}
+			return result, err
+		}
+	}
+}
+
+// DRandField Returns random fields from the dict stored at key: HRANDFIELD key [count [WITHVALUES]].
+// Without count a single field is returned, or ErrNotFound if the key does not exist.
+// If count is positive, an array of count distinct fields is returned, or the whole dict if it is smaller.
+// If count is negative, the same field could be returned multiple times, and exactly -count fields are returned.
+// With WITHVALUES option every field is followed by its value.
+// @command HRANDFIELD
+func (c *Core) DRandField(key string, options ...string) (result interface{}, err error) {
+	if len(options) == 0 {
+		var field []byte
+		err = c.readDict(key, func(dict map[string][]byte) {
+			if len(dict) > 0 {
+				field = []byte(randomDictField(dict))
+			}
+		})
+		if err == nil && field == nil {
+			err = ErrNotFound
+		}
+
+		return field, err
+	}
+
+	count, err := strconv.Atoi(options[0])
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+
+	withValues := false
+	switch {
+	case len(options) == 2 && strings.ToUpper(options[1]) == "WITHVALUES":
+		withValues = true
+	case len(options) > 1:
+		return nil, ErrSyntax
+	}
+
+	var fields [][]byte
+	err = c.readDict(key, func(dict map[string][]byte) {
+		fields = randomDictFields(dict, count, withValues)
+	})
+
+	return fields, err
+}
+
+// DExpire Sets TTL in seconds of the specified fields of the dict stored at key:
+// HEXPIRE key seconds [NX|XX|GT|LT] FIELDS numfields field [field ...].
+// NX sets TTL only if the field has no TTL, XX only if the field has TTL,
+// GT only if the new TTL is greater than current one, LT only if the new TTL is less than current one.
+// For every field returns -2 if the field does not exist, 0 if the condition is not met, 1 if TTL was set
+// and 2 if the field was deleted because of zero TTL.
+// WAL records it as HPEXPIREAT, so it doesn't need TTL correction on replay
+// @command HEXPIRE
+// @modifying
+// @absttl 1 seconds HPEXPIREAT $0 $1 $2...
+func (c *Core) DExpire(key string, seconds int, options ...string) (result []int, err error) {
+	if seconds < 0 {
+		return nil, ErrExpireTime
+	}
+
+	return c.dictExpireAt(key, time.Now().Add(time.Duration(seconds)*time.Second), options)
+}
+
+// DPExpire This command works exactly like HEXPIRE but the TTL of the fields is specified in milliseconds.
+// WAL records it as HPEXPIREAT, so it doesn't need TTL correction on replay
+// @command HPEXPIRE
+// @modifying
+// @absttl 1 milliseconds HPEXPIREAT $0 $1 $2...
+func (c *Core) DPExpire(key string, milliseconds int, options ...string) (result []int, err error) {
+	if milliseconds < 0 {
+		return nil, ErrExpireTime
+	}
+
+	return c.dictExpireAt(key, time.Now().Add(time.Duration(milliseconds)*time.Millisecond), options)
+}
+
+// DPExpireAt has the same effect and semantic as HPEXPIRE, but instead of specifying the TTL,
+// it takes an absolute Unix time in milliseconds. A timestamp in the past deletes the fields immediately.
+// @command HPEXPIREAT
+// @modifying
+func (c *Core) DPExpireAt(key string, timestamp int, options ...string) (result []int, err error) {
+	if timestamp < 0 {
+		return nil, ErrExpireTime
+	}
+
+	return c.dictExpireAt(key, time.Unix(0, 0).Add(time.Duration(timestamp)*time.Millisecond), options)
+}
+
+// DTtl Returns the remaining TTL in seconds of the specified fields of the dict stored at key:
+// HTTL key FIELDS numfields field [field ...].
+// For every field returns -2 if the field does not exist, -1 if the field exists but has no TTL.
+// @command HTTL
+func (c *Core) DTtl(key string, options ...string) (result []int, err error) {
+	_, fields, err := parseFieldsOptions(options, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result = make([]int, len(fields))
+	for i := range result {
+		result[i] = -2
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		return result, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Dict {
+		return nil, ErrWrongType
+	}
+
+	for i, field := range fields {
+		if _, ok := item.dict[field]; !ok || item.IsDictFieldExpired(field) {
+			continue
+		}
+
+		result[i] = -1
+		if expireAt, ok := item.dictExpireAt[field]; ok {
+			result[i] = int(expireAt.Sub(time.Now()).Seconds() + 0.5) //round value
+		}
+	}
+
+	return result, nil
+}
+
+// DPersist Removes TTL of the specified fields of the dict stored at key:
+// HPERSIST key FIELDS numfields field [field ...].
+// For every field returns -2 if the field does not exist, -1 if the field has no TTL, 1 if TTL was removed.
+// @command HPERSIST
+// @modifying
+func (c *Core) DPersist(key string, options ...string) (result []int, err error) {
+	_, fields, err := parseFieldsOptions(options, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = c.updateDictFields(key, fields, func(item *Item, field string) int {
+		if item.persistDictField(field) {
+			return 1
+		}
+
+		return -1
+	})
+
+	if containsInt(result, 1) {
+		c.notify(EventHash, "hpersist", key)
+	}
+
+	return result, err
+}
+
+// readDict calls read() with the dict stored at key under the item read lock.
+// Not existing key is treated as an empty dict
+func (c *Core) readDict(key string, read func(dict map[string][]byte)) error {
+	item := c.getItem(key)
+	if item == nil {
+		read(nil)
+		return nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Dict {
+		return ErrWrongType
+	}
+
+	read(item.liveDict())
+
+	return nil
+}
+
+// dictExpireAt sets expiration time of the dict fields, passed in options with optional condition, see DExpire()
+func (c *Core) dictExpireAt(key string, expireAt time.Time, options []string) (result []int, err error) {
+	condition, fields, err := parseFieldsOptions(options, true)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = c.updateDictFields(key, fields, func(item *Item, field string) int {
+		current, hasTtl := item.dictExpireAt[field]
+		switch {
+		case condition == "NX" && hasTtl,
+			condition == "XX" && !hasTtl,
+			// field without TTL has infinite TTL, so it's always greater
+			condition == "GT" && (!hasTtl || !expireAt.After(current)),
+			condition == "LT" && hasTtl && !expireAt.Before(current):
+			return 0
+		}
+
+		if !expireAt.After(time.Now()) {
+			delete(item.dict, field)
+			item.persistDictField(field)
+			return 2
+		}
+
+		item.SetDictFieldExpireAt(field, expireAt)
+		return 1
+	})
+
+	if containsInt(result, 1) {
+		c.storage.IndexVolatile(key)
+		c.notify(EventHash, "hexpire", key)
+	}
+	if containsInt(result, 2) {
+		c.notify(EventHash, "hdel", key)
+	}
+
+	return result, err
+}
+
+// updateDictFields calls update() under the item lock for every existing field of the dict stored at key
+// and returns slice of update() results. Result for not existing field is -2
+func (c *Core) updateDictFields(key string, fields []string, update func(item *Item, field string) int) (result []int, err error) {
+	result = make([]int, len(fields))
+	for i := range result {
+		result[i] = -2
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		return result, nil
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != Dict {
+		return nil, ErrWrongType
+	}
+
+	for i, field := range fields {
+		item.expireDictField(field)
+		if _, ok := item.dict[field]; ok {
+			result[i] = update(item, field)
+		}
+	}
+
+	return result, nil
+}
+
+// parseFieldsOptions parses [NX|XX|GT|LT] FIELDS numfields field [field ...] options of the dict field TTL commands
+func parseFieldsOptions(options []string, allowCondition bool) (condition string, fields []string, err error) {
+	if allowCondition && len(options) > 0 {
+		switch option := strings.ToUpper(options[0]); option {
+		case "NX", "XX", "GT", "LT":
+			condition = option
+			options = options[1:]
+		}
+	}
+
+	if len(options) < 3 || strings.ToUpper(options[0]) != "FIELDS" {
+		return "", nil, ErrSyntax
+	}
+
+	count, err := strconv.Atoi(options[1])
+	if err != nil {
+		return "", nil, ErrNotInteger
+	}
+
+	if count != len(options)-2 {
+		return "", nil, ErrSyntax
+	}
+
+	return condition, options[2:], nil
+}
+
+// setItemDictFieldNX sets the field of Dict item under the item lock, if the field does not exist yet.
+// errItemExpired is returned if item expired before it was locked, so the caller should retry with a fresh item
+func setItemDictFieldNX(item *Item, field string, value []byte) (result int, err error) {
+	item.Lock()
+	defer item.Unlock()
+
+	if item.IsExpired() {
+		return 0, errItemExpired
+	}
+
+	if item.kind != Dict {
+		return 0, ErrWrongType
+	}
+
+	item.expireDictField(field)
+	if _, ok := item.dict[field]; ok {
+		return 0, nil
+	}
+
+	item.dict[field] = value
+	return 1, nil
+}
+
+// randomDictFields returns count random fields of the dict, optionally followed by their values.
+// Positive count means distinct fields, negative one allows repetitions
+func randomDictFields(dict map[string][]byte, count int, withValues bool) (result [][]byte) {
+	if len(dict) == 0 || count == 0 {
+		return [][]byte{}
+	}
+
+	appendField := func(field string) {
+		result = append(result, []byte(field))
+		if withValues {
+			result = append(result, copyBytes(dict[field]))
+		}
+	}
+
+	if count < 0 {
+		for i := 0; i < -count; i++ {
+			appendField(randomDictField(dict))
+		}
+
+		return result
+	}
+
+	// Go map iteration order is random, but not uniformly distributed,
+	// so pick fields from the random permutation of all the fields
+	fields := make([]string, 0, len(dict))
+	for field := range dict {
+		fields = append(fields, field)
+	}
+
+	if count > len(fields) {
+		count = len(fields)
+	}
+
+	for _, i := range rand.Perm(len(fields))[:count] {
+		appendField(fields[i])
+	}
+
+	return result
+}
+
+// randomDictField returns random field of non-empty dict
+func randomDictField(dict map[string][]byte) string {
+	n := rand.Intn(len(dict))
+	for field := range dict {
+		if n == 0 {
+			return field
+		}
+		n--
+	}
+
+	// unreachable for non-empty dict
+	return ""
+}
+
+// containsInt returns true, if values contain value
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
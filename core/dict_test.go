@@ -0,0 +1,368 @@
+package core_test
+
+import (
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/core"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCore_DMGet(t *testing.T) {
+	tests := []struct {
+		key    string
+		fields []string
+		err    error
+		want   [][]byte
+	}{
+		{"bytes", []string{"banana"}, ErrWrongType, nil},
+		{"404", []string{"banana", "測試"}, nil, [][]byte{nil, nil}},
+		{"expired", []string{"banana"}, nil, [][]byte{nil}},
+		{"dict", []string{"banana", "404", "測試"}, nil, [][]byte{[]byte("mama"), nil, []byte("別れ、比類のない")}},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		got, err := c.DMGet(tst.key, tst.fields)
+		if err != tst.err {
+			t.Errorf("DMGet(%q, %q) err: %q != %q", tst.key, tst.fields, err, tst.err)
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("DMGet(%q, %q): %s", tst.key, tst.fields, diff)
+		}
+	}
+}
+
+func TestCore_DExistsLenStrLen(t *testing.T) {
+	tests := []struct {
+		key, field          string
+		err                 error
+		exists, len, strLen int
+	}{
+		{"bytes", "banana", ErrWrongType, 0, 0, 0},
+		{"404", "banana", nil, 0, 0, 0},
+		{"expired", "banana", nil, 0, 0, 0},
+		{"dict", "404", nil, 0, 2, 0},
+		{"dict", "banana", nil, 1, 2, 4},
+		{"dict", "測試", nil, 1, 2, len("別れ、比類のない")},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		exists, err := c.DExists(tst.key, tst.field)
+		if err != tst.err || exists != tst.exists {
+			t.Errorf("DExists(%q, %q): %d, %v != %d, %v", tst.key, tst.field, exists, err, tst.exists, tst.err)
+		}
+		length, err := c.DLen(tst.key)
+		if err != tst.err || length != tst.len {
+			t.Errorf("DLen(%q): %d, %v != %d, %v", tst.key, length, err, tst.len, tst.err)
+		}
+		strLen, err := c.DStrLen(tst.key, tst.field)
+		if err != tst.err || strLen != tst.strLen {
+			t.Errorf("DStrLen(%q, %q): %d, %v != %d, %v", tst.key, tst.field, strLen, err, tst.strLen, tst.err)
+		}
+	}
+}
+
+func TestCore_DVals(t *testing.T) {
+	tests := []struct {
+		key  string
+		err  error
+		want []string
+	}{
+		{"bytes", ErrWrongType, nil},
+		{"404", nil, []string{}},
+		{"expired", nil, []string{}},
+		{"dict", nil, []string{"mama", "別れ、比類のない"}},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		values, err := c.DVals(tst.key)
+		if err != tst.err {
+			t.Errorf("DVals(%q) err: %q != %q", tst.key, err, tst.err)
+		}
+		got := bytesToStrings(values)
+		sort.Strings(got)
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("DVals(%q): %s", tst.key, diff)
+		}
+	}
+}
+
+func TestCore_DSetNX(t *testing.T) {
+	tests := []struct {
+		key, field, value string
+		err               error
+		want              int
+		wantValue         string
+	}{
+		{"bytes", "banana", "kiwi", ErrWrongType, 0, ""},
+		{"404", "banana", "kiwi", nil, 1, "kiwi"},
+		{"expired", "banana", "kiwi", nil, 1, "kiwi"},
+		{"dict", "banana", "kiwi", nil, 0, "mama"},
+		{"dict", "apple", "kiwi", nil, 1, "kiwi"},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		got, err := c.DSetNX(tst.key, tst.field, []byte(tst.value))
+		if err != tst.err || got != tst.want {
+			t.Errorf("DSetNX(%q, %q): %d, %v != %d, %v", tst.key, tst.field, got, err, tst.want, tst.err)
+		}
+		if err != nil {
+			continue
+		}
+		if value, _ := c.DGet(tst.key, tst.field); string(value) != tst.wantValue {
+			t.Errorf("DSetNX(%q, %q) value: %q != %q", tst.key, tst.field, value, tst.wantValue)
+		}
+	}
+}
+
+func TestCore_DRandField(t *testing.T) {
+	tests := []struct {
+		key     string
+		options []string
+		err     error
+		wantLen int
+	}{
+		{"bytes", nil, ErrWrongType, 0},
+		{"404", nil, ErrNotFound, 0},
+		{"expired", nil, ErrNotFound, 0},
+		{"dict", nil, nil, 1},
+		{"404", []string{"5"}, nil, 0},
+		{"dict", []string{"0"}, nil, 0},
+		{"dict", []string{"1"}, nil, 1},
+		{"dict", []string{"5"}, nil, 2},
+		{"dict", []string{"-5"}, nil, 5},
+		{"dict", []string{"5", "withvalues"}, nil, 4},
+		{"dict", []string{"-3", "WITHVALUES"}, nil, 6},
+		{"dict", []string{"banana"}, ErrNotInteger, 0},
+		{"dict", []string{"5", "WITHSCORES"}, ErrSyntax, 0},
+	}
+
+	c := New(NewMockStorage())
+	sample := getSampleDataCore()["dict"].Dict()
+
+	for _, tst := range tests {
+		result, err := c.DRandField(tst.key, tst.options...)
+		if err != tst.err {
+			t.Errorf("DRandField(%q, %q) err: %q != %q", tst.key, tst.options, err, tst.err)
+		}
+		if err != nil {
+			continue
+		}
+
+		var fields [][]byte
+		switch v := result.(type) {
+		case []byte:
+			fields = [][]byte{v}
+		case [][]byte:
+			fields = v
+		}
+
+		if len(fields) != tst.wantLen {
+			t.Errorf("DRandField(%q, %q) len: %d != %d", tst.key, tst.options, len(fields), tst.wantLen)
+		}
+
+		withValues := len(tst.options) == 2
+		distinct := map[string]bool{}
+		for i := 0; i < len(fields); i++ {
+			field := string(fields[i])
+			value, ok := sample[field]
+			if !ok {
+				t.Errorf("DRandField(%q, %q) unknown field: %q", tst.key, tst.options, field)
+			}
+			if withValues {
+				i++
+				if string(fields[i]) != string(value) {
+					t.Errorf("DRandField(%q, %q) value: %q != %q", tst.key, tst.options, fields[i], value)
+				}
+			}
+			distinct[field] = true
+		}
+
+		if len(tst.options) > 0 && tst.options[0] == "5" && len(distinct)*len(tst.options) != len(fields) {
+			t.Errorf("DRandField(%q, %q) fields are not distinct: %q", tst.key, tst.options, fields)
+		}
+	}
+}
+
+func TestCore_DExpire(t *testing.T) {
+	tests := []struct {
+		cmd     string
+		ttl     int
+		options []string
+		err     error
+		want    []int
+		wantTtl []int
+	}{
+		{"HEXPIRE", 100, []string{"FIELDS", "1", "banana"}, ErrWrongType, nil, nil},
+		{"HEXPIRE", 100, []string{"FIELDS", "2", "banana"}, ErrSyntax, nil, nil},
+		{"HEXPIRE", 100, []string{"FIELDS", "x", "banana"}, ErrNotInteger, nil, nil},
+		{"HEXPIRE", 100, []string{"GT", "banana"}, ErrSyntax, nil, nil},
+		{"HEXPIRE", -1, []string{"FIELDS", "1", "banana"}, ErrExpireTime, nil, nil},
+		{"HEXPIRE", 100, []string{"XX", "FIELDS", "2", "banana", "404"}, nil, []int{0, -2}, []int{-1, -2}},
+		{"HEXPIRE", 100, []string{"GT", "FIELDS", "1", "banana"}, nil, []int{0}, []int{-1}},
+		{"HEXPIRE", 100, []string{"LT", "FIELDS", "1", "banana"}, nil, []int{1}, []int{100}},
+		{"HEXPIRE", 50, []string{"NX", "FIELDS", "1", "banana"}, nil, []int{0}, []int{100}},
+		{"HEXPIRE", 50, []string{"GT", "FIELDS", "1", "banana"}, nil, []int{0}, []int{100}},
+		{"HEXPIRE", 200, []string{"gt", "FIELDS", "1", "banana"}, nil, []int{1}, []int{200}},
+		{"HEXPIRE", 300, []string{"LT", "FIELDS", "1", "banana"}, nil, []int{0}, []int{200}},
+		{"HPEXPIRE", 150000, []string{"XX", "fields", "1", "banana"}, nil, []int{1}, []int{150}},
+		{"HPEXPIREAT", int(time.Now().Add(time.Hour).UnixNano() / int64(time.Millisecond)), []string{"FIELDS", "1", "測試"}, nil, []int{1}, []int{3600}},
+		{"HEXPIRE", 0, []string{"FIELDS", "2", "banana", "404"}, nil, []int{2, -2}, []int{-2, -2}},
+		{"HPEXPIREAT", 1, []string{"FIELDS", "1", "測試"}, nil, []int{2}, []int{-2}},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		key := "dict"
+		if tst.err == ErrWrongType {
+			key = "bytes"
+		}
+
+		var (
+			got []int
+			err error
+		)
+		switch tst.cmd {
+		case "HEXPIRE":
+			got, err = c.DExpire(key, tst.ttl, tst.options...)
+		case "HPEXPIRE":
+			got, err = c.DPExpire(key, tst.ttl, tst.options...)
+		case "HPEXPIREAT":
+			got, err = c.DPExpireAt(key, tst.ttl, tst.options...)
+		}
+
+		if err != tst.err {
+			t.Errorf("%s(%d, %q) err: %v != %v", tst.cmd, tst.ttl, tst.options, err, tst.err)
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("%s(%d, %q): %s", tst.cmd, tst.ttl, tst.options, diff)
+		}
+		if err != nil {
+			continue
+		}
+
+		fields := tst.options[len(tst.options)-len(tst.want):]
+		ttl, _ := c.DTtl(key, append([]string{"FIELDS", strconv.Itoa(len(fields))}, fields...)...)
+		if diff := deep.Equal(ttl, tst.wantTtl); diff != nil {
+			t.Errorf("%s(%d, %q) TTL: %s", tst.cmd, tst.ttl, tst.options, diff)
+		}
+	}
+
+	if got, _ := c.DLen("dict"); got != 0 {
+		t.Errorf("DLen() after all fields expired: %d != 0", got)
+	}
+}
+
+func TestCore_DTtlPersist(t *testing.T) {
+	c := New(NewMockStorage())
+	c.DExpire("dict", 100, "FIELDS", "1", "banana")
+
+	tests := []struct {
+		key    string
+		fields []string
+		err    error
+		ttl    []int
+		result []int
+	}{
+		{"bytes", []string{"banana"}, ErrWrongType, nil, nil},
+		{"404", []string{"banana"}, nil, []int{-2}, []int{-2}},
+		{"dict", []string{"banana", "測試", "404"}, nil, []int{100, -1, -2}, []int{1, -1, -2}},
+		{"dict", []string{"banana"}, nil, []int{-1}, []int{-1}},
+	}
+
+	for _, tst := range tests {
+		options := append([]string{"FIELDS", strconv.Itoa(len(tst.fields))}, tst.fields...)
+
+		ttl, err := c.DTtl(tst.key, options...)
+		if err != tst.err {
+			t.Errorf("DTtl(%q, %q) err: %v != %v", tst.key, tst.fields, err, tst.err)
+		}
+		if diff := deep.Equal(ttl, tst.ttl); diff != nil {
+			t.Errorf("DTtl(%q, %q): %s", tst.key, tst.fields, diff)
+		}
+
+		result, err := c.DPersist(tst.key, options...)
+		if err != tst.err {
+			t.Errorf("DPersist(%q, %q) err: %v != %v", tst.key, tst.fields, err, tst.err)
+		}
+		if diff := deep.Equal(result, tst.result); diff != nil {
+			t.Errorf("DPersist(%q, %q): %s", tst.key, tst.fields, diff)
+		}
+	}
+
+	if _, err := c.DTtl("dict", "banana"); err != ErrSyntax {
+		t.Errorf("DTtl() without FIELDS err: %v != %v", err, ErrSyntax)
+	}
+}
+
+func TestCore_DictFieldExpired(t *testing.T) {
+	item := NewItemDict(map[string][]byte{"expired": []byte("Abba"), "alive": []byte("KMFDM")})
+	item.SetDictFieldExpireAt("expired", time.Now().Add(-time.Millisecond))
+	item.SetDictFieldExpireAt("alive", time.Now().Add(time.Hour))
+
+	c := New(NewMockStorage())
+	c.Storage().AddOrReplaceOne("fieldsTtl", item)
+
+	if got, _ := c.DGet("fieldsTtl", "expired"); got != nil {
+		t.Errorf("DGet() expired field: %q", got)
+	}
+	if got, _ := c.DKeys("fieldsTtl"); !reflect.DeepEqual(got, []string{"alive"}) {
+		t.Errorf("DKeys() with expired field: %q", got)
+	}
+	if got, _ := c.DLen("fieldsTtl"); got != 1 {
+		t.Errorf("DLen() with expired field: %d != 1", got)
+	}
+	if got, _ := c.DExists("fieldsTtl", "expired"); got != 0 {
+		t.Errorf("DExists() expired field: %d != 0", got)
+	}
+	if got, _ := c.DSetNX("fieldsTtl", "expired", []byte("Rammstein")); got != 1 {
+		t.Errorf("DSetNX() expired field: %d != 1", got)
+	}
+	if got, _ := c.DTtl("fieldsTtl", "FIELDS", "1", "expired"); !reflect.DeepEqual(got, []int{-1}) {
+		t.Errorf("DSetNX() expired field TTL: %d != [-1]", got)
+	}
+
+	// HSET removes TTL of the overwritten field
+	c.DSet("fieldsTtl", [][]byte{[]byte("alive"), []byte("Abba")})
+	if got, _ := c.DTtl("fieldsTtl", "FIELDS", "1", "alive"); !reflect.DeepEqual(got, []int{-1}) {
+		t.Errorf("DSet() overwritten field TTL: %d != [-1]", got)
+	}
+}
+
+func TestCore_CollectExpiredDictFields(t *testing.T) {
+	partially := NewItemDict(map[string][]byte{"expired": []byte("Abba"), "alive": []byte("KMFDM")})
+	partially.SetDictFieldExpireAt("expired", time.Now().Add(-time.Millisecond))
+	partially.SetDictFieldExpireAt("alive", time.Now().Add(time.Hour))
+
+	fully := NewItemDict(map[string][]byte{"expired": []byte("Abba")})
+	fully.SetDictFieldExpireAt("expired", time.Now().Add(-time.Millisecond))
+
+	s := NewStorageHash()
+	s.AddOrReplaceOne("partially", partially)
+	s.AddOrReplaceOne("fully", fully)
+	c := New(s)
+
+	if count := c.CollectExpired(); count != 1 {
+		t.Errorf("CollectExpired(): %d != 1", count)
+	}
+
+	if got := s.Get("fully"); got != nil {
+		t.Errorf("CollectExpired() dict with all fields expired isn't removed: %s", got)
+	}
+
+	wantDict := map[string][]byte{"alive": []byte("KMFDM")}
+	if got := s.Get("partially"); got == nil || !reflect.DeepEqual(got.Dict(), wantDict) || len(got.DictExpireAt()) != 1 {
+		t.Errorf("CollectExpired() expired fields aren't removed: %s", got)
+	}
+}
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"strings"
+	"time"
+)
+
+// dumpVersion is the version of DUMP payload format, it's written before the checksum
+const dumpVersion = 1
+
+var (
+	ErrBusyKey     = errors.New("target key name already exists")
+	ErrDumpPayload = errors.New("DUMP payload version or checksum are wrong")
+)
+
+// Dump Serialize the value stored at key in a Radish-specific format and return it to the user.
+// The returned value can be synthesized back into a Radish key using the RESTORE command.
+// The payload is gob-encoded value, followed by the format version and CRC32 checksum.
+// Returns ErrNotFound if the key does not exist
+// @command DUMP
+func (c *Core) Dump(key string) (result []byte, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return nil, ErrNotFound
+	}
+
+	buf := &bytes.Buffer{}
+	item.RLock()
+	exp := exportItem("", item)
+	// TTL isn't a part of the payload, it's passed to RESTORE separately
+	exp.ExpireAt = time.Time{}
+	err = gob.NewEncoder(buf).Encode(exp)
+	item.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	trailer := make([]byte, 6)
+	binary.LittleEndian.PutUint16(trailer, dumpVersion)
+	buf.Write(trailer[:2])
+	binary.LittleEndian.PutUint32(trailer[2:], crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(trailer[2:])
+
+	return buf.Bytes(), nil
+}
+
+// Restore Create a key associated with a value that is obtained by deserializing the provided serialized value,
+// obtained via DUMP: RESTORE key ttl serialized-value [REPLACE] [ABSTTL].
+// If ttl is 0 the key is created without any expire, otherwise the specified expire time (in milliseconds) is set.
+// If ABSTTL modifier was used, ttl should represent an absolute Unix timestamp (in milliseconds).
+// Returns ErrBusyKey if key already exists, unless REPLACE modifier is used
+// @command RESTORE
+// @modifying
+// @denyoom
+// @absttl 1 milliseconds RESTORE $0 $1 $2... ABSTTL
+func (c *Core) Restore(key string, ttl int, data []byte, options ...string) (err error) {
+	var replace, absTtl bool
+	for _, option := range options {
+		switch strings.ToUpper(option) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTtl = true
+		default:
+			return ErrSyntax
+		}
+	}
+
+	if ttl < 0 {
+		return ErrExpireTime
+	}
+
+	exp, err := decodeDump(data)
+	if err != nil {
+		return err
+	}
+
+	var expireAt time.Time
+	switch {
+	case ttl == 0:
+	case absTtl:
+		expireAt = time.Unix(0, 0).Add(time.Duration(ttl) * time.Millisecond)
+	default:
+		expireAt = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+	}
+
+	isRestored := false
+	c.storage.AtomicUpdate([]string{key}, func(items map[string]*Item) {
+		if !replace && items[key] != nil && !isExpired(items[key]) {
+			err = ErrBusyKey
+			return
+		}
+
+		if !expireAt.IsZero() && expireAt.Before(time.Now()) {
+			// like in Redis, already expired key is just not created
+			if replace {
+				items[key] = nil
+			}
+			return
+		}
+
+		item := importItem(exp)
+		item.SetExpireAt(expireAt)
+		items[key] = item
+		isRestored = true
+	})
+
+	if isRestored {
+		c.notify(EventGeneric, "restore", key)
+		c.pushWaiters.notify(key)
+	}
+
+	return err
+}
+
+// decodeDump checks version and checksum of DUMP payload and decodes the value
+func decodeDump(data []byte) (*gobExportItem, error) {
+	if len(data) < 6 {
+		return nil, ErrDumpPayload
+	}
+
+	body, trailer := data[:len(data)-6], data[len(data)-6:]
+	if binary.LittleEndian.Uint16(trailer) != dumpVersion ||
+		binary.LittleEndian.Uint32(trailer[2:]) != crc32.ChecksumIEEE(data[:len(data)-4]) {
+		return nil, ErrDumpPayload
+	}
+
+	exp := new(gobExportItem)
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(exp); err != nil {
+		return nil, ErrDumpPayload
+	}
+
+	return exp, nil
+}
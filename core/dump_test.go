@@ -0,0 +1,110 @@
+package core_test
+
+import (
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/core"
+	"testing"
+	"time"
+)
+
+func TestCore_DumpRestore(t *testing.T) {
+	c := New(NewMockStorage())
+	c.SAdd("set", []string{"a", "b"})
+	c.ZAdd("zset", []string{"1", "a", "2", "b"})
+
+	dumps := map[string][]byte{}
+	for _, key := range []string{"bytes", "dict", "list", "set", "zset"} {
+		dump, err := c.Dump(key)
+		if err != nil {
+			t.Fatalf("Dump(%q): %s", key, err)
+		}
+		dumps[key] = dump
+	}
+
+	if _, err := c.Dump("expired"); err != ErrNotFound {
+		t.Errorf("Dump(expired): %v != %v", err, ErrNotFound)
+	}
+
+	corrupted := append([]byte{}, dumps["bytes"]...)
+	corrupted[0]++
+	future := int(time.Now().Add(time.Hour).UnixNano() / int64(time.Millisecond))
+	past := int(time.Now().Add(-time.Hour).UnixNano() / int64(time.Millisecond))
+
+	tests := []struct {
+		key     string
+		ttl     int
+		data    []byte
+		options []string
+		err     error
+		exists  bool
+		wantTtl int
+	}{
+		{"bytes", 0, dumps["bytes"], nil, ErrBusyKey, true, 1000},
+		{"expired", 0, dumps["bytes"], nil, nil, true, -1},
+		{"bytes", 5000, dumps["list"], []string{"REPLACE"}, nil, true, 5},
+		{"new", 0, corrupted, nil, ErrDumpPayload, false, -2},
+		{"new", 0, []byte("1"), nil, ErrDumpPayload, false, -2},
+		{"new", -1, dumps["bytes"], nil, ErrExpireTime, false, -2},
+		{"new", 0, dumps["bytes"], []string{"IDLETIME"}, ErrSyntax, false, -2},
+		{"new", 0, dumps["set"], []string{"replace", "absttl"}, nil, true, -1},
+		{"dict", 0, dumps["zset"], []string{"REPLACE", "ABSTTL"}, nil, true, -1},
+		{"abs", future, dumps["dict"], []string{"ABSTTL"}, nil, true, 3600},
+		{"past", past, dumps["dict"], []string{"ABSTTL"}, nil, false, -2},
+	}
+
+	for _, tst := range tests {
+		err := c.Restore(tst.key, tst.ttl, tst.data, tst.options...)
+		if err != tst.err {
+			t.Errorf("Restore(%q, %d, %q): err %v != %v", tst.key, tst.ttl, tst.options, err, tst.err)
+		}
+		if got := c.Exists([]string{tst.key}) == 1; got != tst.exists {
+			t.Errorf("Restore(%q, %d, %q): exists %t != %t", tst.key, tst.ttl, tst.options, got, tst.exists)
+		}
+		if got, _ := c.Ttl(tst.key); got != tst.wantTtl {
+			t.Errorf("Restore(%q, %d, %q): ttl %d != %d", tst.key, tst.ttl, tst.options, got, tst.wantTtl)
+		}
+	}
+
+	checks := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"expired", get(c, "expired"), []byte("Призрак бродит по Европе - призрак коммунизма.")},
+		{"bytes", lrange(c, "bytes"), [][]byte{[]byte("KMFDM"), []byte("Rammstein"), []byte("Abba")}},
+		{"new", scard(c, "new"), 2},
+		{"dict", zcard(c, "dict"), 2},
+		{"abs", dget(c, "abs", "測試"), []byte("別れ、比類のない")},
+	}
+
+	for _, chk := range checks {
+		if diff := deep.Equal(chk.got, chk.want); diff != nil {
+			t.Errorf("restored %q: %s\n\ngot:%v\n\nwant:%v", chk.name, diff, chk.got, chk.want)
+		}
+	}
+}
+
+func get(c *Core, key string) []byte {
+	result, _ := c.Get(key)
+	return result
+}
+
+func lrange(c *Core, key string) [][]byte {
+	result, _ := c.LRange(key, 0, -1)
+	return result
+}
+
+func scard(c *Core, key string) int {
+	result, _ := c.SCard(key)
+	return result
+}
+
+func zcard(c *Core, key string) int {
+	result, _ := c.ZCard(key)
+	return result
+}
+
+func dget(c *Core, key, field string) []byte {
+	result, _ := c.DGet(key, field)
+	return result
+}
@@ -1,5 +1,10 @@
 package core
 
+import (
+	"encoding/gob"
+	"io"
+)
+
 func (e *StorageHash) SetData(data map[string]*Item) {
 	for k, v := range data {
 		e.AddOrReplaceOne(k, v)
@@ -16,3 +21,40 @@ func (e *StorageHash) Data() map[string]*Item {
 
 	return result
 }
+
+func (e *StorageBTree) SetData(data map[string]*Item) {
+	for k, v := range data {
+		e.AddOrReplaceOne(k, v)
+	}
+}
+
+func (e *StorageBTree) Data() map[string]*Item {
+	result := make(map[string]*Item)
+	for _, k := range e.Keys() {
+		result[k] = e.Get(k)
+	}
+
+	return result
+}
+
+// ResetStats clears memory usage, access statistics and snapshot epoch of the item, so items could be compared by content
+func (i *Item) ResetStats() {
+	i.size, i.accessedAt, i.usedMemory, i.lfuCounter = 0, 0, nil, 0
+	i.epoch, i.storageEpoch = 0, nil
+}
+
+// WriteLegacySnapshot writes the data in the snapshot format, used before the format was versioned
+func WriteLegacySnapshot(w io.Writer, lastMessageId int64, data map[string]*Item) error {
+	encoder := gob.NewEncoder(w)
+	if err := encoder.Encode(lastMessageId); err != nil {
+		return err
+	}
+
+	for k, v := range data {
+		if err := encoder.Encode(exportItem(k, v)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -5,7 +5,9 @@ import (
 	"github.com/mshaverdo/assert"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
 )
 
 //go:generate stringer -type=ItemKind
@@ -15,26 +17,67 @@ const (
 	Bytes ItemKind = iota
 	List
 	Dict
+	Set
+	ZSet
 )
 
+// lastItemVersion is the last version, assigned to an Item
+var lastItemVersion uint64
+
 type Item struct {
 	sync.RWMutex
 
+	// version is assigned by the first Version() call and renewed at every write unlock, so WATCH could detect
+	// modifications of the item. Zero means the version was never requested, so nobody watches the item
+	version uint64
+
+	// size is approximate memory usage of the item in bytes, it's renewed at every write unlock
+	size int64
+
+	// accessedAt is Unix time in nanoseconds of the last access to the item, used by LRU eviction
+	accessedAt int64
+
+	// epoch is the snapshot epoch, in which content of the item is already preserved or persisted,
+	// or in which the item is added to the storage, accessed atomically. See snapshotEpoch
+	epoch int64
+
+	// usedMemory points to the memory counter of the storage, containing the item, it's nil if the item isn't stored
+	usedMemory unsafe.Pointer
+
+	// storageEpoch points to the snapshotEpoch of the storage, the item was added to, it's never reset
+	storageEpoch unsafe.Pointer
+
+	// lfuCounter is logarithmic counter of accesses to the item, used by LFU eviction
+	lfuCounter uint32
+
+	// volatile is 1 if the item has TTL or dict fields with TTL, accessed atomically. See Storage.ScanVolatile()
+	volatile int32
+
+	// frozen is content of the item at the start of the snapshot epoch, preserved by the first modification in it
+	frozen *gobExportItem
+
 	expireAt time.Time
 
 	kind  ItemKind
 	bytes []byte
-	list  [][]byte
+	list  *deque
 	dict  map[string][]byte
+	set   map[string]struct{}
+	zset  *zset
+
+	// dictExpireAt contains expiration time of dict fields with TTL, it's nil if no field has TTL
+	dictExpireAt map[string]time.Time
 }
 
 func NewItemBytes(value []byte) *Item {
-	return &Item{
+	return initItem(&Item{
 		kind:  Bytes,
 		bytes: value,
 		list:  nil,
 		dict:  nil,
-	}
+		set:   nil,
+		zset:  nil,
+	})
 }
 
 // NewItemString constructs Bytes Item from string argument
@@ -42,22 +85,78 @@ func NewItemString(value string) *Item {
 	return NewItemBytes([]byte(value))
 }
 
+// NewItemList constructs List Item.
+// IMPORTANT: for compatibility with snapshots, HEAD of the list is the LAST element of the value slice
 func NewItemList(value [][]byte) *Item {
-	return &Item{
+	return initItem(&Item{
 		kind:  List,
 		bytes: nil,
-		list:  value,
+		list:  newDeque(reverseValues(value)),
 		dict:  nil,
-	}
+		set:   nil,
+		zset:  nil,
+	})
 }
 
 func NewItemDict(value map[string][]byte) *Item {
-	return &Item{
+	return initItem(&Item{
 		kind:  Dict,
 		bytes: nil,
 		list:  nil,
 		dict:  value,
+		set:   nil,
+		zset:  nil,
+	})
+}
+
+func NewItemSet(value map[string]struct{}) *Item {
+	return initItem(&Item{
+		kind:  Set,
+		bytes: nil,
+		list:  nil,
+		dict:  nil,
+		set:   value,
+		zset:  nil,
+	})
+}
+
+// NewItemZSet constructs ZSet Item from member->score map
+func NewItemZSet(value map[string]float64) *Item {
+	return initItem(&Item{
+		kind:  ZSet,
+		bytes: nil,
+		list:  nil,
+		dict:  nil,
+		set:   nil,
+		zset:  newZset(value),
+	})
+}
+
+// Lock locks the item for writing. Content of the item, captured by a Snapshot, is preserved before it's modified,
+// see snapshotEpoch
+func (i *Item) Lock() {
+	i.RWMutex.Lock()
+	i.freeze()
+}
+
+// Unlock unlocks the item, locked for writing, renews the version of the watched item and its memory usage
+func (i *Item) Unlock() {
+	if atomic.LoadUint64(&i.version) != 0 {
+		atomic.StoreUint64(&i.version, atomic.AddUint64(&lastItemVersion, 1))
+	}
+	i.updateMemoryUsage()
+	i.RWMutex.Unlock()
+}
+
+// Version returns version of the item, which is unique among all items and changes at every modification of the item.
+// It should be called under the item read lock
+func (i *Item) Version() uint64 {
+	if version := atomic.LoadUint64(&i.version); version != 0 {
+		return version
 	}
+
+	atomic.CompareAndSwapUint64(&i.version, 0, atomic.AddUint64(&lastItemVersion, 1))
+	return atomic.LoadUint64(&i.version)
 }
 
 func (i *Item) Kind() ItemKind {
@@ -72,12 +171,14 @@ func (i *Item) SetBytes(v []byte) {
 	i.bytes = v
 }
 
+// List returns list elements, the HEAD of the list is the LAST element of the slice
 func (i *Item) List() [][]byte {
-	return i.list
+	return reverseValues(i.list.values())
 }
 
+// SetList sets list elements, the HEAD of the list is the LAST element of the slice
 func (i *Item) SetList(v [][]byte) {
-	i.list = v
+	i.list = newDeque(reverseValues(v))
 }
 
 func (i *Item) Dict() map[string][]byte {
@@ -88,12 +189,111 @@ func (i *Item) SetDict(v map[string][]byte) {
 	i.dict = v
 }
 
+// DictExpireAt returns expiration time of dict fields with TTL
+func (i *Item) DictExpireAt() map[string]time.Time {
+	return i.dictExpireAt
+}
+
+func (i *Item) SetDictExpireAt(v map[string]time.Time) {
+	i.dictExpireAt = v
+	i.updateVolatile()
+}
+
+// SetDictFieldExpireAt sets expiration time of the dict field, zero time removes field TTL
+func (i *Item) SetDictFieldExpireAt(field string, expireAt time.Time) {
+	if expireAt.IsZero() {
+		delete(i.dictExpireAt, field)
+		i.updateVolatile()
+		return
+	}
+
+	if i.dictExpireAt == nil {
+		i.dictExpireAt = make(map[string]time.Time)
+	}
+	i.dictExpireAt[field] = expireAt
+	i.updateVolatile()
+}
+
+// persistDictField removes TTL of the dict field and returns true, if the field had TTL
+func (i *Item) persistDictField(field string) (hadTtl bool) {
+	if _, hadTtl = i.dictExpireAt[field]; hadTtl {
+		delete(i.dictExpireAt, field)
+		i.updateVolatile()
+	}
+
+	return hadTtl
+}
+
+// IsDictFieldExpired returns true if the dict field has TTL and it's expired
+func (i *Item) IsDictFieldExpired(field string) bool {
+	expireAt, ok := i.dictExpireAt[field]
+	return ok && expireAt.Before(time.Now())
+}
+
+// expireDictField removes the dict field, if it's expired.
+// Modifying commands call it under the item lock before they touch the field, so expired fields are never resurrected
+func (i *Item) expireDictField(field string) {
+	if i.IsDictFieldExpired(field) {
+		delete(i.dict, field)
+		delete(i.dictExpireAt, field)
+	}
+}
+
+// collectExpiredDictFields removes all expired dict fields and returns count of removed fields
+func (i *Item) collectExpiredDictFields() (count int) {
+	now := time.Now()
+	for field, expireAt := range i.dictExpireAt {
+		if expireAt.Before(now) {
+			delete(i.dict, field)
+			delete(i.dictExpireAt, field)
+			count++
+		}
+	}
+	i.updateVolatile()
+
+	return count
+}
+
+// liveDict returns dict without expired fields. Read-only commands can't remove expired fields under the read lock,
+// so the dict is copied, if it contains expired but not collected yet fields
+func (i *Item) liveDict() map[string][]byte {
+	now := time.Now()
+	var live map[string][]byte
+	for field, expireAt := range i.dictExpireAt {
+		if !expireAt.Before(now) {
+			continue
+		}
+
+		if live == nil {
+			live = make(map[string][]byte, len(i.dict))
+			for k, v := range i.dict {
+				live[k] = v
+			}
+		}
+		delete(live, field)
+	}
+
+	if live == nil {
+		return i.dict
+	}
+
+	return live
+}
+
+func (i *Item) Set() map[string]struct{} {
+	return i.set
+}
+
+func (i *Item) SetSet(v map[string]struct{}) {
+	i.set = v
+}
+
 func (i *Item) String() string {
 	switch i.kind {
 	case Bytes:
 		return string(i.bytes)
 	case List:
-		return fmt.Sprintf("%v", i.list)
+		return fmt.Sprintf("%v", i.List())
 	case Dict:
 		keys := make([]string, 0, len(i.dict))
 		for k := range i.dict {
@@ -109,6 +309,10 @@ func (i *Item) String() string {
 		result += "]"
 
 		return result
+	case Set:
+		return fmt.Sprintf("%q", setMembers(i.set))
+	case ZSet:
+		return i.zset.String()
 	default:
 		assert.True(false, "unknown Item.kind: "+i.kind.String())
 		return ""
@@ -116,15 +320,34 @@ func (i *Item) String() string {
 }
 
 func (i *Item) SetTtl(seconds int) {
-	i.expireAt = time.Now().Add(time.Duration(seconds) * time.Second)
+	i.SetExpireAt(time.Now().Add(time.Duration(seconds) * time.Second))
 }
 
 func (i *Item) SetMilliTtl(milliseconds int) {
-	i.expireAt = time.Now().Add(time.Duration(milliseconds) * time.Millisecond)
+	i.SetExpireAt(time.Now().Add(time.Duration(milliseconds) * time.Millisecond))
+}
+
+func (i *Item) SetExpireAt(expireAt time.Time) {
+	i.expireAt = expireAt
+	i.updateVolatile()
 }
 
 func (i *Item) RemoveTtl() {
-	i.expireAt = time.Time{}
+	i.SetExpireAt(time.Time{})
+}
+
+// updateVolatile renews the volatile flag of the item. It should be called, when TTL of the item or its dict fields is changed
+func (i *Item) updateVolatile() {
+	var volatile int32
+	if !i.expireAt.IsZero() || len(i.dictExpireAt) > 0 {
+		volatile = 1
+	}
+	atomic.StoreInt32(&i.volatile, volatile)
+}
+
+// isVolatile returns true, if the item has TTL or dict fields with TTL
+func (i *Item) isVolatile() bool {
+	return atomic.LoadInt32(&i.volatile) == 1
 }
 
 func (i *Item) Ttl() (seconds int) {
@@ -136,6 +359,19 @@ func (i *Item) Ttl() (seconds int) {
 	return seconds
 }
 
+func (i *Item) MilliTtl() (milliseconds int) {
+	milliseconds = int(i.expireAt.Sub(time.Now()) / time.Millisecond)
+	if milliseconds < 0 {
+		milliseconds = 0
+	}
+
+	return milliseconds
+}
+
+func (i *Item) ExpireAt() time.Time {
+	return i.expireAt
+}
+
 func (i *Item) IsExpired() bool {
 	return i.HasTtl() && i.expireAt.Before(time.Now())
 }
@@ -152,4 +388,57 @@ type gobExportItem struct {
 	Bytes    []byte
 	List     [][]byte
 	Dict     map[string][]byte
+	// DictExpireAt is added later, so older snapshots are decoded with nil field TTLs
+	DictExpireAt map[string]time.Time
+	// gob can't encode empty structs, so set is stored as a members slice
+	Set  []string
+	ZSet map[string]float64
+}
+
+// exportItem converts the item into gobExportItem. MUST be invoked only while the item locked!
+func exportItem(key string, item *Item) *gobExportItem {
+	exp := &gobExportItem{
+		Key:          key,
+		ExpireAt:     item.expireAt,
+		Kind:         item.kind,
+		Bytes:        item.bytes,
+		Dict:         item.dict,
+		DictExpireAt: item.dictExpireAt,
+	}
+
+	switch item.kind {
+	case List:
+		exp.List = item.List()
+	case Set:
+		exp.Set = setMembers(item.set)
+	case ZSet:
+		exp.ZSet = item.zset.dict
+	}
+
+	return exp
+}
+
+// importItem converts gobExportItem, made by exportItem(), back into the item
+func importItem(exp *gobExportItem) *Item {
+	item := &Item{
+		expireAt:     exp.ExpireAt,
+		kind:         exp.Kind,
+		bytes:        exp.Bytes,
+		dict:         exp.Dict,
+		dictExpireAt: exp.DictExpireAt,
+	}
+
+	switch exp.Kind {
+	case List:
+		item.SetList(exp.List)
+	case Set:
+		item.set = make(map[string]struct{}, len(exp.Set))
+		for _, member := range exp.Set {
+			item.set[member] = struct{}{}
+		}
+	case ZSet:
+		item.zset = newZset(exp.ZSet)
+	}
+
+	return initItem(item)
 }
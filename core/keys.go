@@ -0,0 +1,143 @@
+package core
+
+// RandomKeyAttempts is the max count of attempts to find not expired key in RandomKey()
+const RandomKeyAttempts = 100
+
+// Exists Returns the number of keys existing among the ones specified as arguments.
+// If the same existing key is mentioned in the arguments multiple times, it will be counted multiple times.
+// @command EXISTS
+func (c *Core) Exists(keys []string) (count int) {
+	for _, key := range keys {
+		if c.getItem(key) != nil {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Type Returns the string representation of the type of the value stored at key:
+// string, list, set, zset or hash. Returns none if key does not exist
+// @command TYPE
+func (c *Core) Type(key string) (result string) {
+	item := c.getItem(key)
+	if item == nil {
+		return "none"
+	}
+
+	return typeName(item)
+}
+
+// Rename Renames key to newkey atomically, with the value and TTL. Returns ErrNoSuchKey when key does not exist.
+// If newkey already exists it is overwritten.
+// @command RENAME
+// @modifying
+func (c *Core) Rename(key, newKey string) (err error) {
+	_, err = c.rename(key, newKey, false)
+	return err
+}
+
+// RenameNX Renames key to newkey if newkey does not yet exist. Returns ErrNoSuchKey when key does not exist.
+// Returns 1 if key was renamed to newkey, 0 if newkey already exists.
+// @command RENAMENX
+// @modifying
+func (c *Core) RenameNX(key, newKey string) (result int, err error) {
+	return c.rename(key, newKey, true)
+}
+
+// RandomKey Return a random key from the currently selected database. Returns ErrNotFound if the database is empty
+// @command RANDOMKEY
+func (c *Core) RandomKey() (result string, err error) {
+	for i := 0; i < RandomKeyAttempts; i++ {
+		key, ok := c.storage.RandomKey()
+		if !ok {
+			return "", ErrNotFound
+		}
+
+		if c.getItem(key) != nil {
+			return key, nil
+		}
+	}
+
+	// almost all keys are expired, but not collected yet
+	return "", ErrNotFound
+}
+
+// DbSize Return the number of keys in the database.
+// Like in Redis, expired, but not collected yet keys are counted too
+// @command DBSIZE
+func (c *Core) DbSize() (count int) {
+	return c.storage.Len()
+}
+
+// Touch Alters the last access time of a key(s). A key is ignored if it does not exist.
+// Returns the number of keys that were touched. Like any other access, it affects LRU and LFU eviction
+// @command TOUCH
+func (c *Core) Touch(keys []string) (count int) {
+	return c.Exists(keys)
+}
+
+// Unlink This command is very similar to DEL: it removes the specified keys and returns count of actually removed values.
+// The keys are unlinked from the keyspace immediately, and memory of the values is reclaimed later
+// by Go GC, which frees unreachable values concurrently, in the background.
+// So UNLINK of a huge value takes the same time as UNLINK of a small one and never blocks the storage
+// @command UNLINK
+// @modifying
+func (c *Core) Unlink(keys []string) (count int) {
+	return c.del(EventGeneric, "del", keys)
+}
+
+// Versions returns versions of the items stored at keys, zero for not existing keys.
+// The version changes at every modification of the item, so it's used by WATCH to implement optimistic locking
+func (c *Core) Versions(keys []string) (versions []uint64) {
+	versions = make([]uint64, len(keys))
+	for i, key := range keys {
+		if item := c.getItem(key); item != nil {
+			item.RLock()
+			versions[i] = item.Version()
+			item.RUnlock()
+		}
+	}
+
+	return versions
+}
+
+// rename moves item from key to newKey atomically, so nobody could see both keys or no one of them
+func (c *Core) rename(key, newKey string, nx bool) (result int, err error) {
+	c.storage.AtomicUpdate([]string{key, newKey}, func(items map[string]*Item) {
+		item := items[key]
+		if item == nil || isExpired(item) {
+			err = ErrNoSuchKey
+			return
+		}
+
+		if nx && items[newKey] != nil && !isExpired(items[newKey]) {
+			return
+		}
+
+		result = 1
+		if key == newKey {
+			return
+		}
+
+		items[newKey] = item
+		items[key] = nil
+	})
+
+	if result == 1 {
+		c.notify(EventGeneric, "rename_from", key)
+		c.notify(EventGeneric, "rename_to", newKey)
+		// the renamed list could unblock clients, waiting for a push into newKey
+		c.pushWaiters.notify(newKey)
+	}
+
+	return result, err
+}
+
+// isExpired checks if the item expired under the item lock
+func isExpired(item *Item) bool {
+	item.RLock()
+	defer item.RUnlock()
+
+	return item.IsExpired()
+}
@@ -0,0 +1,182 @@
+package core_test
+
+import (
+	. "github.com/mshaverdo/radish/core"
+	"testing"
+)
+
+func TestCore_Exists(t *testing.T) {
+	tests := []struct {
+		keys []string
+		want int
+	}{
+		{[]string{"404"}, 0},
+		{[]string{"expired"}, 0},
+		{[]string{"bytes", "dict", "404"}, 2},
+		{[]string{"list", "list", "expired"}, 2},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		if got := c.Exists(tst.keys); got != tst.want {
+			t.Errorf("Exists(%q): %d != %d", tst.keys, got, tst.want)
+		}
+		if got := c.Touch(tst.keys); got != tst.want {
+			t.Errorf("Touch(%q): %d != %d", tst.keys, got, tst.want)
+		}
+	}
+}
+
+func TestCore_Type(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"bytes", "string"},
+		{"dict", "hash"},
+		{"list", "list"},
+		{"set", "set"},
+		{"zset", "zset"},
+		{"404", "none"},
+		{"expired", "none"},
+	}
+
+	c := New(NewMockStorage())
+	c.SAdd("set", []string{"member"})
+	c.ZAdd("zset", []string{"1", "member"})
+
+	for _, tst := range tests {
+		if got := c.Type(tst.key); got != tst.want {
+			t.Errorf("Type(%q): %q != %q", tst.key, got, tst.want)
+		}
+	}
+}
+
+func TestCore_Rename(t *testing.T) {
+	tests := []struct {
+		key, newKey string
+		nx          bool
+		err         error
+		want        int
+		wantKeys    []string
+	}{
+		{"404", "new", false, ErrNoSuchKey, 0, []string{"bytes", "dict", "list", "測"}},
+		{"expired", "new", true, ErrNoSuchKey, 0, []string{"bytes", "dict", "list", "測"}},
+		{"bytes", "bytes", false, nil, 1, []string{"bytes", "dict", "list", "測"}},
+		{"bytes", "dict", true, nil, 0, []string{"bytes", "dict", "list", "測"}},
+		{"bytes", "expired", true, nil, 1, []string{"expired", "dict", "list", "測"}},
+		{"dict", "expired", false, nil, 1, []string{"expired", "list", "測"}},
+		{"list", "new", true, nil, 1, []string{"expired", "new", "測"}},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		var (
+			got int
+			err error
+		)
+		if tst.nx {
+			got, err = c.RenameNX(tst.key, tst.newKey)
+		} else {
+			err = c.Rename(tst.key, tst.newKey)
+			if err == nil {
+				got = 1
+			}
+		}
+
+		if err != tst.err {
+			t.Errorf("Rename(%q, %q, nx: %t) err: %q != %q", tst.key, tst.newKey, tst.nx, err, tst.err)
+		}
+		if got != tst.want {
+			t.Errorf("Rename(%q, %q, nx: %t): %d != %d", tst.key, tst.newKey, tst.nx, got, tst.want)
+		}
+		if count := c.Exists(tst.wantKeys); count != len(tst.wantKeys) || len(c.Keys("*")) != len(tst.wantKeys) {
+			t.Errorf("Rename(%q, %q, nx: %t) keys: %q != %q", tst.key, tst.newKey, tst.nx, c.Keys("*"), tst.wantKeys)
+		}
+	}
+
+	// value and TTL are moved with the key
+	if ttl, _ := c.Ttl("expired"); ttl != -1 {
+		t.Errorf("Rename() ttl: %d != -1", ttl)
+	}
+	if value, _ := c.LRange("new", 0, -1); len(value) != 3 {
+		t.Errorf("Rename() value: %q", value)
+	}
+}
+
+func TestCore_RandomKey(t *testing.T) {
+	c := New(NewStorageHash())
+	if _, err := c.RandomKey(); err != ErrNotFound {
+		t.Errorf("RandomKey() on empty storage err: %q != %q", err, ErrNotFound)
+	}
+
+	expired := NewItemString("value")
+	expired.SetMilliTtl(-1)
+	c.Storage().AddOrReplaceOne("expired", expired)
+	if _, err := c.RandomKey(); err != ErrNotFound {
+		t.Errorf("RandomKey() on expired storage err: %q != %q", err, ErrNotFound)
+	}
+
+	want := map[string]bool{"a": true, "b": true, "c": true}
+	for key := range want {
+		c.Set(key, []byte(key))
+	}
+
+	got := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		key, err := c.RandomKey()
+		if err != nil {
+			t.Fatalf("RandomKey() err: %q", err)
+		}
+		got[key] = true
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("RandomKey(): %v != %v", got, want)
+	}
+	for key := range got {
+		if !want[key] {
+			t.Errorf("RandomKey(): unexpected key %q", key)
+		}
+	}
+}
+
+func TestCore_DbSize(t *testing.T) {
+	c := New(NewStorageHash())
+
+	steps := []struct {
+		name string
+		do   func()
+		want int
+	}{
+		{"SET", func() { c.Set("a", []byte("1")) }, 1},
+		{"SET existing", func() { c.Set("a", []byte("2")) }, 1},
+		{"MSET", func() { c.MSet(stringsToBytes([]string{"a", "1", "b", "2", "c", "3"})) }, 3},
+		{"INCR", func() { c.Incr("counter") }, 4},
+		{"RENAME", func() { c.Rename("a", "b") }, 3},
+		{"RENAMENX", func() { c.RenameNX("b", "d") }, 3},
+		{"GETDEL", func() { c.GetDel("d") }, 2},
+		{"DEL", func() { c.Del([]string{"c", "404"}) }, 1},
+		{"UNLINK", func() { c.Unlink([]string{"counter"}) }, 0},
+	}
+
+	for _, step := range steps {
+		step.do()
+		if got := c.DbSize(); got != step.want {
+			t.Errorf("DbSize() after %s: %d != %d", step.name, got, step.want)
+		}
+	}
+}
+
+func TestCore_Unlink(t *testing.T) {
+	c := New(NewMockStorage())
+
+	if got := c.Unlink([]string{"bytes", "list", "404"}); got != 2 {
+		t.Errorf("Unlink(): %d != 2", got)
+	}
+	if got := c.Exists([]string{"bytes", "list", "dict"}); got != 1 {
+		t.Errorf("Unlink(): %d keys still exist", got-1)
+	}
+}
@@ -0,0 +1,339 @@
+package core
+
+import (
+	"bytes"
+	"math"
+	"strings"
+)
+
+// RPush Insert all the specified values at the tail of the list stored at key.
+// If key does not exist, it is created as empty list before performing the push operations.
+// When key holds a value that is not a list, an error is returned.
+// @command RPUSH
+// @modifying
+// @denyoom
+func (c *Core) RPush(key string, values [][]byte) (count int, err error) {
+	defer c.pushWaiters.notify(key)
+	defer c.notifyOnSuccess(&err, EventList, "rpush", key)
+
+	return c.push(key, values, false)
+}
+
+// push inserts values at the head or at the tail of the list stored at key, creating the list if key does not exist.
+// Returns the length of the list after the push operation
+func (c *Core) push(key string, values [][]byte, toHead bool) (count int, err error) {
+	for {
+		item := c.addItemIfAbsent(key, func() *Item {
+			list := newDeque(nil)
+			pushListValues(list, values, toHead)
+			return initItem(&Item{kind: List, list: list})
+		})
+		if item == nil {
+			return len(values), nil
+		}
+
+		count, err := pushItemList(item, values, toHead)
+		if err != errItemExpired {
+			return count, err
+		}
+	}
+}
+
+// pushItemList pushes values into List item under the item lock and returns new length of the list.
+// errItemExpired is returned if item expired before it was locked, so the caller should retry with a fresh item
+func pushItemList(item *Item, values [][]byte, toHead bool) (count int, err error) {
+	item.Lock()
+	defer item.Unlock()
+
+	if item.IsExpired() {
+		return 0, errItemExpired
+	}
+
+	if item.kind != List {
+		return 0, ErrWrongType
+	}
+
+	pushListValues(item.list, values, toHead)
+
+	return item.list.len(), nil
+}
+
+// pushListValues pushes values one by one at the head or at the tail of the list
+func pushListValues(list *deque, values [][]byte, toHead bool) {
+	for _, value := range values {
+		if toHead {
+			list.pushFront(value)
+		} else {
+			list.pushBack(value)
+		}
+	}
+}
+
+// RPop Removes and returns the last element of the list stored at key.
+// @command RPOP
+// @modifying
+func (c *Core) RPop(key string) (result []byte, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return nil, ErrNotFound
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != List {
+		return nil, ErrWrongType
+	}
+
+	if item.list.len() == 0 {
+		return nil, ErrNotFound
+	}
+
+	// don't copy result ,due to it will be removed from list
+	result = item.list.popBack()
+	c.notify(EventList, "rpop", key)
+
+	return result, nil
+}
+
+// LInsert Inserts value in the list stored at key either before or after the reference value pivot.
+// When key does not exist, it is considered an empty list and no operation is performed.
+// Returns the length of the list after the insert operation, or -1 when the value pivot was not found.
+// @command LINSERT
+// @modifying
+// @denyoom
+func (c *Core) LInsert(key, where, pivot string, value []byte) (count int, err error) {
+	var after bool
+	switch strings.ToUpper(where) {
+	case "BEFORE":
+		after = false
+	case "AFTER":
+		after = true
+	default:
+		return 0, ErrSyntax
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != List {
+		return 0, ErrWrongType
+	}
+
+	list := item.list
+	for i := 0; i < list.len(); i++ {
+		if string(list.at(i)) != pivot {
+			continue
+		}
+
+		if after {
+			i++
+		}
+		list.insert(i, value)
+		c.notify(EventList, "linsert", key)
+
+		return list.len(), nil
+	}
+
+	return -1, nil
+}
+
+// LRem Removes the first count occurrences of elements equal to value from the list stored at key.
+// count > 0: Remove elements equal to value moving from head to tail.
+// count < 0: Remove elements equal to value moving from tail to head.
+// count = 0: Remove all elements equal to value.
+// Returns the number of removed elements.
+// @command LREM
+// @modifying
+func (c *Core) LRem(key string, count int, value []byte) (removed int, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != List {
+		return 0, ErrWrongType
+	}
+
+	values := item.list.values()
+	if count < 0 {
+		values = reverseValues(values)
+	}
+
+	limit := int(math.Abs(float64(count)))
+	kept := values[:0]
+	for _, v := range values {
+		if (limit == 0 || removed < limit) && bytes.Equal(v, value) {
+			removed++
+			continue
+		}
+		kept = append(kept, v)
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if count < 0 {
+		kept = reverseValues(kept)
+	}
+	item.list = newDeque(kept)
+	c.notify(EventList, "lrem", key)
+
+	return removed, nil
+}
+
+// LTrim Trim an existing list so that it will contain only the specified range of elements specified.
+// Both start and stop are zero-based indexes, where 0 is the first element of the list (the head).
+// Out of range indexes will not produce an error: if start is larger than the end of the list,
+// or start > end, the result will be an empty list.
+// @command LTRIM
+// @modifying
+func (c *Core) LTrim(key string, start, stop int) (err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return nil
+	}
+
+	defer c.notifyOnSuccess(&err, EventList, "ltrim", key)
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != List {
+		return ErrWrongType
+	}
+
+	list := item.list
+	lLen := list.len()
+
+	if start < 0 {
+		start += lLen
+	}
+	if stop < 0 {
+		stop += lLen
+	}
+
+	start = int(math.Max(float64(start), 0.0))
+	stop = int(math.Min(float64(stop), float64(lLen-1)))
+
+	if start > stop {
+		item.list = newDeque(nil)
+		return nil
+	}
+
+	for i := lLen - 1; i > stop; i-- {
+		list.popBack()
+	}
+	for i := 0; i < start; i++ {
+		list.popFront()
+	}
+
+	return nil
+}
+
+// RPopLPush Atomically returns and removes the last element (tail) of the list stored at source,
+// and pushes the element at the first element (head) of the list stored at destination.
+// @command RPOPLPUSH
+// @modifying
+// @denyoom
+func (c *Core) RPopLPush(source, destination string) (result []byte, err error) {
+	return c.LMove(source, destination, "RIGHT", "LEFT")
+}
+
+// LMove Atomically returns and removes the first/last element (head/tail depending on the whereFrom argument)
+// of the list stored at source, and pushes the element at the first/last element
+// (head/tail depending on the whereTo argument) of the list stored at destination.
+// If source does not exist, ErrNotFound returned and no operation is performed.
+// If source and destination are the same, the operation is equivalent to rotating the list.
+// @command LMOVE
+// @modifying
+// @denyoom
+func (c *Core) LMove(source, destination, whereFrom, whereTo string) (result []byte, err error) {
+	fromHead, err := parseListEnd(whereFrom)
+	if err != nil {
+		return nil, err
+	}
+	toHead, err := parseListEnd(whereTo)
+	if err != nil {
+		return nil, err
+	}
+
+	c.storage.AtomicUpdate([]string{source, destination}, func(items map[string]*Item) {
+		src, dst := items[source], items[destination]
+
+		unlock := lockItems(src, dst)
+		defer unlock()
+
+		if src == nil || src.IsExpired() {
+			err = ErrNotFound
+			return
+		}
+		if src.kind != List || (dst != nil && !dst.IsExpired() && dst.kind != List) {
+			err = ErrWrongType
+			return
+		}
+		if src.list.len() == 0 {
+			err = ErrNotFound
+			return
+		}
+
+		if dst == nil || dst.IsExpired() {
+			dst = NewItemList([][]byte{})
+			items[destination] = dst
+		}
+
+		if fromHead {
+			result = src.list.popFront()
+		} else {
+			result = src.list.popBack()
+		}
+
+		if toHead {
+			dst.list.pushFront(result)
+		} else {
+			dst.list.pushBack(result)
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	c.notify(EventList, listEndEvent(fromHead, "lpop", "rpop"), source)
+	c.notify(EventList, listEndEvent(toHead, "lpush", "rpush"), destination)
+	c.pushWaiters.notify(destination)
+
+	returned := make([]byte, len(result))
+	copy(returned, result)
+
+	return returned, nil
+}
+
+// parseListEnd parses LEFT|RIGHT argument, returns true for the LEFT (HEAD) end of the list
+func parseListEnd(where string) (head bool, err error) {
+	switch strings.ToUpper(where) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	default:
+		return false, ErrSyntax
+	}
+}
+
+// listEndEvent returns headEvent for the HEAD end of the list and tailEvent for the TAIL
+func listEndEvent(head bool, headEvent, tailEvent string) string {
+	if head {
+		return headEvent
+	}
+
+	return tailEvent
+}
@@ -0,0 +1,338 @@
+package core_test
+
+import (
+	"fmt"
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/core"
+	"math/rand"
+	"testing"
+)
+
+func stringsToBytes(values []string) [][]byte {
+	result := make([][]byte, len(values))
+	for i, v := range values {
+		result[i] = []byte(v)
+	}
+
+	return result
+}
+
+func getListValues(c *Core, key string) []string {
+	result, _ := c.LRange(key, 0, -1)
+	return bytesToStrings(result)
+}
+
+func TestCore_RPush(t *testing.T) {
+	tests := []struct {
+		key          string
+		err          error
+		values, want []string
+	}{
+		{"bytes", ErrWrongType, nil, nil},
+		{"404", nil, []string{"a", "b", "c"}, []string{"a", "b", "c"}},
+		{"expired", nil, []string{"a"}, []string{"a"}},
+		{"list", nil, []string{"a", "b"}, []string{"KMFDM", "Rammstein", "Abba", "a", "b"}},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		count, err := c.RPush(tst.key, stringsToBytes(tst.values))
+		got := getListValues(c, tst.key)
+
+		if err != tst.err {
+			t.Errorf("RPush(%q, %q) err: %q != %q", tst.key, tst.values, err, tst.err)
+		}
+		if err == nil && count != len(tst.want) {
+			t.Errorf("RPush(%q, %q) count: %d != %d", tst.key, tst.values, count, len(tst.want))
+		}
+		if diff := deep.Equal(got, tst.want); err == nil && diff != nil {
+			t.Errorf("RPush(%q, %q): %s\n\ngot:%v\n\nwant:%v", tst.key, tst.values, diff, got, tst.want)
+		}
+	}
+}
+
+func TestCore_RPop(t *testing.T) {
+	tests := []struct {
+		key, want string
+		err       error
+	}{
+		{"bytes", "", ErrWrongType},
+		{"404", "", ErrNotFound},
+		{"expired", "", ErrNotFound},
+		{"list", "Abba", nil},
+		{"list", "Rammstein", nil},
+		{"list", "KMFDM", nil},
+		{"list", "", ErrNotFound},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		got, err := c.RPop(tst.key)
+		if err != tst.err {
+			t.Errorf("RPop(%q) err: %q != %q", tst.key, err, tst.err)
+		}
+		if string(got) != tst.want {
+			t.Errorf("RPop(%q): %q != %q", tst.key, got, tst.want)
+		}
+	}
+}
+
+func TestCore_LInsert(t *testing.T) {
+	tests := []struct {
+		key, where, pivot, value string
+		err                      error
+		wantCount                int
+		want                     []string
+	}{
+		{"bytes", "BEFORE", "a", "b", ErrWrongType, 0, nil},
+		{"list", "UNDER", "Abba", "b", ErrSyntax, 0, nil},
+		{"404", "BEFORE", "a", "b", nil, 0, nil},
+		{"list", "BEFORE", "404", "b", nil, -1, []string{"KMFDM", "Rammstein", "Abba"}},
+		{"list", "BEFORE", "KMFDM", "a", nil, 4, []string{"a", "KMFDM", "Rammstein", "Abba"}},
+		{"list", "after", "Abba", "z", nil, 5, []string{"a", "KMFDM", "Rammstein", "Abba", "z"}},
+		{"list", "AFTER", "KMFDM", "k", nil, 6, []string{"a", "KMFDM", "k", "Rammstein", "Abba", "z"}},
+		{"list", "BEFORE", "Abba", "r", nil, 7, []string{"a", "KMFDM", "k", "Rammstein", "r", "Abba", "z"}},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		count, err := c.LInsert(tst.key, tst.where, tst.pivot, []byte(tst.value))
+		got := getListValues(c, tst.key)
+
+		if err != tst.err {
+			t.Errorf("LInsert(%q, %q, %q) err: %q != %q", tst.key, tst.where, tst.pivot, err, tst.err)
+		}
+		if count != tst.wantCount {
+			t.Errorf("LInsert(%q, %q, %q) count: %d != %d", tst.key, tst.where, tst.pivot, count, tst.wantCount)
+		}
+		if diff := deep.Equal(got, tst.want); err == nil && diff != nil {
+			t.Errorf("LInsert(%q, %q, %q): %s\n\ngot:%v\n\nwant:%v", tst.key, tst.where, tst.pivot, diff, got, tst.want)
+		}
+	}
+}
+
+func TestCore_LRem(t *testing.T) {
+	values := []string{"a", "b", "a", "c", "a", "b"}
+	tests := []struct {
+		key         string
+		count       int
+		value       string
+		err         error
+		wantRemoved int
+		want        []string
+	}{
+		{"bytes", 0, "a", ErrWrongType, 0, nil},
+		{"404", 0, "a", nil, 0, nil},
+		{"list", 0, "z", nil, 0, values},
+		{"list", 0, "a", nil, 3, []string{"b", "c", "b"}},
+		{"list", 2, "a", nil, 2, []string{"b", "c", "a", "b"}},
+		{"list", -2, "a", nil, 2, []string{"a", "b", "c", "b"}},
+		{"list", -1, "b", nil, 1, []string{"a", "b", "a", "c", "a"}},
+		{"list", 10, "b", nil, 2, []string{"a", "a", "c", "a"}},
+	}
+
+	for _, tst := range tests {
+		c := New(NewMockStorage())
+		c.Del([]string{"list"})
+		c.RPush("list", stringsToBytes(values))
+
+		removed, err := c.LRem(tst.key, tst.count, []byte(tst.value))
+		got := getListValues(c, tst.key)
+
+		if err != tst.err {
+			t.Errorf("LRem(%q, %d, %q) err: %q != %q", tst.key, tst.count, tst.value, err, tst.err)
+		}
+		if removed != tst.wantRemoved {
+			t.Errorf("LRem(%q, %d, %q) removed: %d != %d", tst.key, tst.count, tst.value, removed, tst.wantRemoved)
+		}
+		if diff := deep.Equal(got, tst.want); err == nil && diff != nil {
+			t.Errorf("LRem(%q, %d, %q): %s\n\ngot:%v\n\nwant:%v", tst.key, tst.count, tst.value, diff, got, tst.want)
+		}
+	}
+}
+
+func TestCore_LTrim(t *testing.T) {
+	values := []string{"a", "b", "c", "d", "e"}
+	tests := []struct {
+		key         string
+		start, stop int
+		err         error
+		want        []string
+	}{
+		{"bytes", 0, 1, ErrWrongType, nil},
+		{"404", 0, 1, nil, nil},
+		{"list", 0, -1, nil, values},
+		{"list", 1, 2, nil, []string{"b", "c"}},
+		{"list", -2, 100, nil, []string{"d", "e"}},
+		{"list", -100, 0, nil, []string{"a"}},
+		{"list", 3, 1, nil, []string{}},
+		{"list", 10, 20, nil, []string{}},
+	}
+
+	for _, tst := range tests {
+		c := New(NewMockStorage())
+		c.Del([]string{"list"})
+		c.RPush("list", stringsToBytes(values))
+
+		err := c.LTrim(tst.key, tst.start, tst.stop)
+		got := getListValues(c, tst.key)
+
+		if err != tst.err {
+			t.Errorf("LTrim(%q, %d, %d) err: %q != %q", tst.key, tst.start, tst.stop, err, tst.err)
+		}
+		if diff := deep.Equal(got, tst.want); err == nil && diff != nil {
+			t.Errorf("LTrim(%q, %d, %d): %s\n\ngot:%v\n\nwant:%v", tst.key, tst.start, tst.stop, diff, got, tst.want)
+		}
+	}
+}
+
+func TestCore_LMove(t *testing.T) {
+	tests := []struct {
+		source, destination, whereFrom, whereTo string
+		err                                     error
+		want                                    string
+		wantSource, wantDestination             []string
+	}{
+		{"bytes", "list", "LEFT", "LEFT", ErrWrongType, "", nil, nil},
+		{"list", "bytes", "LEFT", "LEFT", ErrWrongType, "", nil, nil},
+		{"list", "dst", "UP", "LEFT", ErrSyntax, "", nil, nil},
+		{"404", "dst", "LEFT", "LEFT", ErrNotFound, "", nil, nil},
+		{"list", "dst", "LEFT", "LEFT", nil, "KMFDM", []string{"Rammstein", "Abba"}, []string{"KMFDM"}},
+		{"list", "dst", "RIGHT", "right", nil, "Abba", []string{"Rammstein"}, []string{"KMFDM", "Abba"}},
+		{"list", "list", "LEFT", "RIGHT", nil, "Rammstein", []string{"Rammstein"}, []string{"Rammstein"}},
+		{"list", "expired", "LEFT", "RIGHT", nil, "Rammstein", []string{}, []string{"Rammstein"}},
+		{"list", "dst", "LEFT", "LEFT", ErrNotFound, "", []string{}, []string{"KMFDM", "Abba"}},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		got, err := c.LMove(tst.source, tst.destination, tst.whereFrom, tst.whereTo)
+		if err != tst.err {
+			t.Errorf("LMove(%q, %q, %q, %q) err: %q != %q", tst.source, tst.destination, tst.whereFrom, tst.whereTo, err, tst.err)
+		}
+		if string(got) != tst.want {
+			t.Errorf("LMove(%q, %q, %q, %q): %q != %q", tst.source, tst.destination, tst.whereFrom, tst.whereTo, got, tst.want)
+		}
+		if tst.wantSource == nil {
+			continue
+		}
+		if diff := deep.Equal(getListValues(c, tst.source), tst.wantSource); diff != nil {
+			t.Errorf("LMove(%q, %q, %q, %q) source: %s", tst.source, tst.destination, tst.whereFrom, tst.whereTo, diff)
+		}
+		if diff := deep.Equal(getListValues(c, tst.destination), tst.wantDestination); diff != nil {
+			t.Errorf("LMove(%q, %q, %q, %q) destination: %s", tst.source, tst.destination, tst.whereFrom, tst.whereTo, diff)
+		}
+	}
+}
+
+func TestCore_RPopLPush(t *testing.T) {
+	c := New(NewMockStorage())
+
+	got, err := c.RPopLPush("list", "list")
+	if err != nil || string(got) != "Abba" {
+		t.Errorf("RPopLPush(): %q, %q", got, err)
+	}
+
+	want := []string{"Abba", "KMFDM", "Rammstein"}
+	if diff := deep.Equal(getListValues(c, "list"), want); diff != nil {
+		t.Errorf("RPopLPush(): %s", diff)
+	}
+}
+
+// TestCore_ListDeque checks list commands against plain slice model on ring buffer wrap-arounds, grows and shrinks
+func TestCore_ListDeque(t *testing.T) {
+	c := New(NewStorageHash())
+	var model []string
+
+	for i := 0; i < 10000; i++ {
+		value := fmt.Sprintf("%d", i)
+		switch op := rand.Intn(10); {
+		case op < 3:
+			c.LPush("deque", [][]byte{[]byte(value)})
+			model = append([]string{value}, model...)
+		case op < 6:
+			c.RPush("deque", [][]byte{[]byte(value)})
+			model = append(model, value)
+		case op < 8:
+			got, _ := c.LPop("deque")
+			if len(model) > 0 {
+				if string(got) != model[0] {
+					t.Fatalf("LPop() step %d: %q != %q", i, got, model[0])
+				}
+				model = model[1:]
+			}
+		default:
+			got, _ := c.RPop("deque")
+			if len(model) > 0 {
+				if string(got) != model[len(model)-1] {
+					t.Fatalf("RPop() step %d: %q != %q", i, got, model[len(model)-1])
+				}
+				model = model[:len(model)-1]
+			}
+		}
+
+		if i%100 == 0 {
+			if count, _ := c.LLen("deque"); count != len(model) {
+				t.Fatalf("LLen() step %d: %d != %d", i, count, len(model))
+			}
+			if len(model) > 0 {
+				index := rand.Intn(len(model))
+				if got, _ := c.LIndex("deque", index); string(got) != model[index] {
+					t.Fatalf("LIndex(%d) step %d: %q != %q", index, i, got, model[index])
+				}
+			}
+		}
+	}
+
+	got := getListValues(c, "deque")
+	if len(model) == 0 {
+		model = []string{}
+	}
+	if diff := deep.Equal(got, model); diff != nil {
+		t.Errorf("LRange(): %s", diff)
+	}
+
+	// drain list to check shrinking
+	for len(model) > 0 {
+		got, _ := c.RPop("deque")
+		if string(got) != model[len(model)-1] {
+			t.Fatalf("RPop(): %q != %q", got, model[len(model)-1])
+		}
+		model = model[:len(model)-1]
+	}
+}
+
+func TestCore_WaitPush(t *testing.T) {
+	c := New(NewMockStorage())
+
+	pushed, release := c.WaitPush([]string{"404", "dst"})
+	defer release()
+
+	isPushed := func() bool {
+		select {
+		case <-pushed:
+			return true
+		default:
+			return false
+		}
+	}
+
+	c.RPush("other", stringsToBytes([]string{"a"}))
+	if isPushed() {
+		t.Errorf("WaitPush(): notified on push into not watched key")
+	}
+
+	c.LPush("404", stringsToBytes([]string{"a"}))
+	if !isPushed() {
+		t.Errorf("WaitPush(): not notified on LPush")
+	}
+
+	c.LMove("list", "dst", "LEFT", "LEFT")
+	if !isPushed() {
+		t.Errorf("WaitPush(): not notified on LMove")
+	}
+}
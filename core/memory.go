@@ -0,0 +1,313 @@
+package core
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// EvictionPolicy defines, which keys are evicted when used memory reaches maxmemory, like maxmemory-policy in Redis
+type EvictionPolicy int32
+
+const (
+	// NoEviction rejects modifying commands with ErrOutOfMemory instead of evicting keys
+	NoEviction EvictionPolicy = iota
+	// AllKeysLru evicts least recently used keys
+	AllKeysLru
+	// AllKeysLfu evicts least frequently used keys
+	AllKeysLfu
+	// VolatileLru evicts least recently used keys among keys with TTL
+	VolatileLru
+	// VolatileTtl evicts keys with the nearest expiration time
+	VolatileTtl
+)
+
+var evictionPolicyNames = []string{"noeviction", "allkeys-lru", "allkeys-lfu", "volatile-lru", "volatile-ttl"}
+
+const (
+	// evictionSamples is count of eviction candidates, the best of them is evicted
+	evictionSamples = 5
+	// evictionMaxSamples is count of random keys checked to find candidates for volatile policies
+	evictionMaxSamples = 10 * evictionSamples
+
+	// lfuInitValue is initial value of LFU counter, so new keys aren't evicted before they had a chance to be accessed
+	lfuInitValue = 5
+	// lfuLogFactor controls how fast LFU counter grows: 255 is reached after ~1M accesses
+	lfuLogFactor = 10
+	// lfuDecayTime is period, after which idle item LFU counter is decremented
+	lfuDecayTime = time.Minute
+)
+
+// Approximate overheads of Go data structures, used to estimate memory usage of the items
+const (
+	// memorySamples is count of collection elements, sampled to estimate memory usage of the collection
+	memorySamples = 5
+
+	itemOverhead     = int64(unsafe.Sizeof(Item{}))
+	stringOverhead   = 16
+	sliceOverhead    = 24
+	mapEntryOverhead = 16
+	timeOverhead     = int64(unsafe.Sizeof(time.Time{}))
+	// skiplistNodeOverhead includes node itself and two levels in average
+	skiplistNodeOverhead = int64(unsafe.Sizeof(skiplistNode{})) + 2*int64(unsafe.Sizeof(skiplistLevel{}))
+
+	// keyOverhead is memory used by the storage for every key besides the key itself
+	keyOverhead = stringOverhead + 8 + mapEntryOverhead
+)
+
+var (
+	ErrOutOfMemory    = errors.New("command not allowed when used memory > 'maxmemory'")
+	ErrEvictionPolicy = errors.New("invalid eviction policy")
+)
+
+// ParseEvictionPolicy parses maxmemory-policy name: noeviction, allkeys-lru, allkeys-lfu, volatile-lru or volatile-ttl
+func ParseEvictionPolicy(name string) (policy EvictionPolicy, err error) {
+	for i, v := range evictionPolicyNames {
+		if strings.ToLower(name) == v {
+			return EvictionPolicy(i), nil
+		}
+	}
+
+	return NoEviction, ErrEvictionPolicy
+}
+
+// String returns maxmemory-policy name of the policy
+func (p EvictionPolicy) String() string {
+	return evictionPolicyNames[p]
+}
+
+// SetMaxMemory sets maximum memory in bytes, used by the storage. Zero means no limit
+func (c *Core) SetMaxMemory(bytes int64) {
+	atomic.StoreInt64(&c.maxMemory, bytes)
+}
+
+// MaxMemory returns maximum memory in bytes, used by the storage
+func (c *Core) MaxMemory() (bytes int64) {
+	return atomic.LoadInt64(&c.maxMemory)
+}
+
+// SetEvictionPolicy sets policy of eviction keys, when used memory reaches maxmemory
+func (c *Core) SetEvictionPolicy(policy EvictionPolicy) {
+	atomic.StoreInt32((*int32)(&c.evictionPolicy), int32(policy))
+}
+
+// EvictionPolicy returns policy of eviction keys, when used memory reaches maxmemory
+func (c *Core) EvictionPolicy() EvictionPolicy {
+	return EvictionPolicy(atomic.LoadInt32((*int32)(&c.evictionPolicy)))
+}
+
+// UsedMemory returns approximate count of bytes, used by keys and items of the storage
+func (c *Core) UsedMemory() (bytes int64) {
+	return c.storage.UsedMemory()
+}
+
+// EvictFunc evicts the candidate key by calling del(), which returns false, if the key was replaced since sampling.
+// It lets the caller do something atomically with the eviction, e.g. lock the key and write the eviction into WAL
+type EvictFunc func(key string, del func() bool)
+
+// FreeMemory evicts keys according to the eviction policy, until used memory fits maxmemory,
+// and returns evicted keys. It should be called before modifying commands. Every candidate is evicted by evict,
+// nil evict just deletes it. Returns ErrOutOfMemory, if the memory can't be freed:
+// the policy is noeviction or there are no keys to evict
+func (c *Core) FreeMemory(evict EvictFunc) (evicted []string, err error) {
+	maxMemory := c.MaxMemory()
+	if maxMemory == 0 {
+		return nil, nil
+	}
+
+	policy := c.EvictionPolicy()
+	for c.storage.UsedMemory() > maxMemory {
+		if policy == NoEviction {
+			return evicted, ErrOutOfMemory
+		}
+
+		key, item := c.evictionCandidate(policy)
+		if item == nil {
+			return evicted, ErrOutOfMemory
+		}
+
+		// the candidate is removed only if it wasn't replaced since sampling
+		deleted := false
+		del := func() bool {
+			deleted = c.storage.DelSubmap(map[string]*Item{key: item}) != 0
+			return deleted
+		}
+		if evict != nil {
+			evict(key, del)
+		} else {
+			del()
+		}
+
+		if deleted {
+			evicted = append(evicted, key)
+			c.notify(EventEvicted, "evicted", key)
+		}
+	}
+
+	return evicted, nil
+}
+
+// evictionCandidate samples random keys and returns the best one to evict according to the policy.
+// Returns nil item, if there are no suitable keys
+func (c *Core) evictionCandidate(policy EvictionPolicy) (key string, item *Item) {
+	var bestScore int64
+	now := time.Now().UnixNano()
+	for found, i := 0, 0; found < evictionSamples && i < evictionMaxSamples; i++ {
+		sampleKey, ok := c.storage.RandomKey()
+		if !ok {
+			break
+		}
+
+		sample := c.storage.Get(sampleKey)
+		if sample == nil {
+			continue
+		}
+
+		sample.RLock()
+		volatile := !sample.expireAt.IsZero()
+		expireAt := sample.expireAt.UnixNano()
+		sample.RUnlock()
+
+		if (policy == VolatileLru || policy == VolatileTtl) && !volatile {
+			continue
+		}
+		found++
+
+		// the higher score, the better candidate
+		var score int64
+		switch policy {
+		case AllKeysLru, VolatileLru:
+			score = now - atomic.LoadInt64(&sample.accessedAt)
+		case AllKeysLfu:
+			score = -int64(sample.lfuCount(now))
+		case VolatileTtl:
+			score = -expireAt
+		}
+
+		if item == nil || score > bestScore {
+			key, item, bestScore = sampleKey, sample, score
+		}
+	}
+
+	return key, item
+}
+
+// initItem initializes memory usage, access statistics and volatile flag of the new item
+func initItem(item *Item) *Item {
+	item.size = item.estimateMemoryUsage()
+	item.accessedAt = time.Now().UnixNano()
+	item.lfuCounter = lfuInitValue
+	item.updateVolatile()
+
+	return item
+}
+
+// touch updates access statistics of the item, used by LRU and LFU eviction
+func (i *Item) touch() {
+	now := time.Now().UnixNano()
+	counter := i.lfuCount(now)
+	// logarithmic increment: the bigger counter is, the less probable it's incremented
+	if counter < 255 {
+		base := 0.0
+		if counter > lfuInitValue {
+			base = float64(counter - lfuInitValue)
+		}
+		if rand.Float64() < 1/(base*lfuLogFactor+1) {
+			counter++
+		}
+	}
+
+	atomic.StoreUint32(&i.lfuCounter, counter)
+	atomic.StoreInt64(&i.accessedAt, now)
+}
+
+// lfuCount returns LFU counter of the item, decremented once per lfuDecayTime of the item idle time
+func (i *Item) lfuCount(now int64) uint32 {
+	counter := atomic.LoadUint32(&i.lfuCounter)
+	periods := (now - atomic.LoadInt64(&i.accessedAt)) / int64(lfuDecayTime)
+	if periods >= int64(counter) {
+		return 0
+	}
+
+	return counter - uint32(periods)
+}
+
+// MemoryUsage returns approximate count of bytes, used by the item. It's renewed at every write unlock of the item
+func (i *Item) MemoryUsage() (bytes int64) {
+	return atomic.LoadInt64(&i.size)
+}
+
+// updateMemoryUsage estimates memory usage of the item and adds the difference to the memory counter of the storage.
+// It should be called under the item write lock
+func (i *Item) updateMemoryUsage() {
+	size := i.estimateMemoryUsage()
+	delta := size - atomic.SwapInt64(&i.size, size)
+	if usedMemory := (*int64)(atomic.LoadPointer(&i.usedMemory)); usedMemory != nil && delta != 0 {
+		atomic.AddInt64(usedMemory, delta)
+	}
+}
+
+// estimateMemoryUsage returns approximate memory usage of the item.
+// Like MEMORY USAGE in Redis, size of a collection is extrapolated from sizes of a few sampled elements, so it takes O(1)
+func (i *Item) estimateMemoryUsage() (size int64) {
+	size = itemOverhead + int64(len(i.bytes))
+
+	var count, sampled, sampledSize int
+	switch i.kind {
+	case List:
+		count = i.list.len()
+		for ; sampled < count && sampled < memorySamples; sampled++ {
+			sampledSize += len(i.list.at(sampled*count/memorySamples)) + sliceOverhead
+		}
+		size += int64(len(i.list.buf)-count) * sliceOverhead
+	case Dict:
+		count = len(i.dict)
+		for field, value := range i.dict {
+			sampledSize += len(field) + len(value) + stringOverhead + sliceOverhead + mapEntryOverhead
+			if sampled++; sampled == memorySamples {
+				break
+			}
+		}
+		size += int64(len(i.dictExpireAt)) * (stringOverhead + timeOverhead + mapEntryOverhead)
+	case Set:
+		count = len(i.set)
+		for member := range i.set {
+			sampledSize += len(member) + stringOverhead + mapEntryOverhead
+			if sampled++; sampled == memorySamples {
+				break
+			}
+		}
+	case ZSet:
+		count = i.zset.len()
+		for member := range i.zset.dict {
+			sampledSize += len(member) + stringOverhead + 8 + mapEntryOverhead
+			if sampled++; sampled == memorySamples {
+				break
+			}
+		}
+		size += int64(count) * skiplistNodeOverhead
+	}
+
+	if sampled > 0 {
+		size += int64(count) * int64(sampledSize) / int64(sampled)
+	}
+
+	return size
+}
+
+// attachItem adds memory, used by the key and the item, to the memory counter of the storage
+// and keeps the counter updated at every write unlock of the item. It should be called when the item is added to the storage
+func attachItem(usedMemory *int64, key string, item *Item) {
+	atomic.StorePointer(&item.usedMemory, unsafe.Pointer(usedMemory))
+	atomic.AddInt64(usedMemory, int64(len(key))+keyOverhead+item.MemoryUsage())
+}
+
+// detachItem subtracts memory, used by the key and the item, from the memory counter of the storage.
+// It should be called when the item is removed from the storage
+func detachItem(usedMemory *int64, key string, item *Item) {
+	atomic.StorePointer(&item.usedMemory, nil)
+	atomic.AddInt64(usedMemory, -int64(len(key))-keyOverhead-item.MemoryUsage())
+}
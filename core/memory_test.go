@@ -0,0 +1,135 @@
+package core_test
+
+import (
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/core"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// cyclicStorage returns keys of MockStorage in turn from RandomKey(), so eviction sampling is deterministic
+type cyclicStorage struct {
+	*MockStorage
+	next int
+}
+
+func (e *cyclicStorage) RandomKey() (key string, ok bool) {
+	keys := e.Keys()
+	if len(keys) == 0 {
+		return "", false
+	}
+	sort.Strings(keys)
+
+	e.next++
+	return keys[e.next%len(keys)], true
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy EvictionPolicy
+		err    error
+	}{
+		{"noeviction", NoEviction, nil},
+		{"ALLKEYS-LRU", AllKeysLru, nil},
+		{"allkeys-lfu", AllKeysLfu, nil},
+		{"volatile-lru", VolatileLru, nil},
+		{"volatile-ttl", VolatileTtl, nil},
+		{"volatile-random", NoEviction, ErrEvictionPolicy},
+	}
+
+	for _, tst := range tests {
+		policy, err := ParseEvictionPolicy(tst.name)
+		if policy != tst.policy || err != tst.err {
+			t.Errorf("ParseEvictionPolicy(%q): %s, %v != %s, %v", tst.name, policy, err, tst.policy, tst.err)
+		}
+		if err == nil && policy.String() != strings.ToLower(tst.name) {
+			t.Errorf("%s.String() != %q", policy, strings.ToLower(tst.name))
+		}
+	}
+}
+
+func TestCore_FreeMemory(t *testing.T) {
+	tests := []struct {
+		policy    EvictionPolicy
+		evictAll  bool
+		wantErr   error
+		wantKeys  []string
+		wantEvent []string
+	}{
+		{NoEviction, false, ErrOutOfMemory, nil, []string{}},
+		{AllKeysLru, false, nil, []string{"persistent"}, []string{"__keyevent@0__:evicted persistent"}},
+		{AllKeysLfu, false, nil, []string{"persistent"}, []string{"__keyevent@0__:evicted persistent"}},
+		{VolatileLru, false, nil, []string{"far"}, []string{"__keyevent@0__:evicted far"}},
+		{VolatileTtl, false, nil, []string{"near"}, []string{"__keyevent@0__:evicted near"}},
+		{VolatileTtl, true, ErrOutOfMemory, []string{"near", "far"}, []string{"__keyevent@0__:evicted near", "__keyevent@0__:evicted far"}},
+		{AllKeysLru, true, nil, []string{"persistent", "far", "near"}, nil},
+	}
+
+	for _, tst := range tests {
+		c, events := newNotifiedCore(&cyclicStorage{MockStorage: &MockStorage{data: map[string]*Item{}}}, "Ee")
+		c.Set("persistent", []byte("value"))
+		c.SetEx("near", 100, []byte("value"))
+		c.SetEx("far", 1000, []byte("value"))
+		// persistent is the least recently and the least frequently used key, far is used before near
+		c.Get("far")
+		c.Get("near")
+
+		c.SetEvictionPolicy(tst.policy)
+		if tst.evictAll {
+			c.SetMaxMemory(1)
+		} else {
+			c.SetMaxMemory(c.UsedMemory() - 1)
+		}
+
+		evicted, err := c.FreeMemory(nil)
+		if err != tst.wantErr {
+			t.Errorf("FreeMemory() %s: err %v != %v", tst.policy, err, tst.wantErr)
+		}
+		if diff := deep.Equal(evicted, tst.wantKeys); diff != nil {
+			t.Errorf("FreeMemory() %s: %s\n\ngot:%q\n\nwant:%q", tst.policy, diff, evicted, tst.wantKeys)
+		}
+		if tst.wantEvent == nil {
+			continue
+		}
+		if diff := deep.Equal(*events, tst.wantEvent); diff != nil {
+			t.Errorf("FreeMemory() %s events: %s\n\ngot:%q\n\nwant:%q", tst.policy, diff, *events, tst.wantEvent)
+		}
+	}
+}
+
+func TestCore_UsedMemory(t *testing.T) {
+	c := New(NewStorageHash())
+
+	values := make([][]byte, 100)
+	for i := range values {
+		values[i] = []byte(strings.Repeat("x", 100))
+	}
+
+	steps := []struct {
+		name string
+		run  func()
+		cmp  func(used, previous int64) bool
+	}{
+		{"SET", func() { c.Set("string", []byte("value")) }, func(used, previous int64) bool { return used > previous }},
+		{"RPUSH", func() { c.RPush("list", values) }, func(used, previous int64) bool { return used-previous > 100*100 }},
+		{"LTRIM", func() { c.LTrim("list", 0, 9) }, func(used, previous int64) bool { return previous-used > 90*100 }},
+		{"HSET", func() { c.DSet("dict", [][]byte{[]byte("field"), values[0]}) }, func(used, previous int64) bool { return used-previous > 100 }},
+		{"SADD", func() { c.SAdd("set", []string{"a", "b", "c"}) }, func(used, previous int64) bool { return used > previous }},
+		{"ZADD", func() { c.ZAdd("zset", []string{"1", "a", "2", "b"}) }, func(used, previous int64) bool { return used > previous }},
+		{"RENAME", func() { c.Rename("list", "renamed") }, func(used, previous int64) bool { return used == previous-int64(len("list")-len("renamed")) }},
+		{"APPEND", func() { c.Append("string", values[0]) }, func(used, previous int64) bool { return used-previous == 100 }},
+		{"DEL", func() { c.Del([]string{"string", "renamed", "dict", "set", "zset"}) }, func(used, previous int64) bool { return used == 0 }},
+	}
+
+	previous := c.UsedMemory()
+	for _, step := range steps {
+		step.run()
+		used := c.UsedMemory()
+		if !step.cmp(used, previous) {
+			t.Errorf("%s: used memory %d, previously %d", step.name, used, previous)
+		}
+		previous = used
+	}
+}
@@ -0,0 +1,199 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// EventClass is a set of keyspace notification classes, like notify-keyspace-events flags in Redis
+type EventClass uint32
+
+const (
+	// EventKeyspace enables events published to __keyspace@0__:<key> channel with event name as payload
+	EventKeyspace EventClass = 1 << iota
+	// EventKeyevent enables events published to __keyevent@0__:<event> channel with key as payload
+	EventKeyevent
+	// EventGeneric is a class of type-independent commands: DEL, EXPIRE, RENAME, ...
+	EventGeneric
+	// EventString is a class of string commands
+	EventString
+	// EventList is a class of list commands
+	EventList
+	// EventSet is a class of set commands
+	EventSet
+	// EventHash is a class of hash commands
+	EventHash
+	// EventZSet is a class of sorted set commands
+	EventZSet
+	// EventExpired is a class of events generated when a key is removed due to expiration
+	EventExpired
+	// EventEvicted is a class of events generated when a key is evicted due to maxmemory
+	EventEvicted
+
+	// EventAll is an alias for all classes except EventKeyspace and EventKeyevent, "A" flag
+	EventAll = EventGeneric | EventString | EventList | EventSet | EventHash | EventZSet | EventExpired | EventEvicted
+)
+
+const (
+	keyspaceChannelPrefix = "__keyspace@0__:"
+	keyeventChannelPrefix = "__keyevent@0__:"
+)
+
+// eventClassFlags maps notify-keyspace-events flags to event classes, in the canonical order
+var eventClassFlags = []struct {
+	flag  byte
+	class EventClass
+}{
+	{'K', EventKeyspace},
+	{'E', EventKeyevent},
+	{'g', EventGeneric},
+	{'$', EventString},
+	{'l', EventList},
+	{'s', EventSet},
+	{'h', EventHash},
+	{'z', EventZSet},
+	{'x', EventExpired},
+	{'e', EventEvicted},
+}
+
+var ErrEventClass = errors.New("invalid event class")
+
+// ParseEventClasses parses notify-keyspace-events flags: K, E, g, $, l, s, h, z, x, e and A as alias for "g$lshzxe".
+// Empty string disables notifications
+func ParseEventClasses(flags string) (classes EventClass, err error) {
+flagsLoop:
+	for i := 0; i < len(flags); i++ {
+		if flags[i] == 'A' {
+			classes |= EventAll
+			continue
+		}
+
+		for _, v := range eventClassFlags {
+			if flags[i] == v.flag {
+				classes |= v.class
+				continue flagsLoop
+			}
+		}
+
+		return 0, ErrEventClass
+	}
+
+	return classes, nil
+}
+
+// String returns classes as notify-keyspace-events flags
+func (e EventClass) String() string {
+	var flags strings.Builder
+	for _, v := range eventClassFlags {
+		if e&v.class != 0 {
+			flags.WriteByte(v.flag)
+		}
+	}
+
+	return flags.String()
+}
+
+// Publisher delivers message to subscribers of the channel
+type Publisher func(channel string, message []byte)
+
+// SetPublisher sets publisher, used to deliver keyspace notifications. It should be called before serving requests
+func (c *Core) SetPublisher(publish Publisher) {
+	c.publish = publish
+}
+
+// SetKeyspaceEvents sets classes of emitted keyspace notifications
+func (c *Core) SetKeyspaceEvents(classes EventClass) {
+	atomic.StoreUint32(&c.keyspaceEvents, uint32(classes))
+}
+
+// KeyspaceEvents returns classes of emitted keyspace notifications
+func (c *Core) KeyspaceEvents() EventClass {
+	return EventClass(atomic.LoadUint32(&c.keyspaceEvents))
+}
+
+// isNotifying returns true, if events of the class are published
+func (c *Core) isNotifying(class EventClass) bool {
+	classes := c.KeyspaceEvents()
+	return c.publish != nil && classes&class != 0 && classes&(EventKeyspace|EventKeyevent) != 0
+}
+
+// notify publishes the event of the class for every key, if the class is enabled
+func (c *Core) notify(class EventClass, event string, keys ...string) {
+	if !c.isNotifying(class) {
+		return
+	}
+
+	classes := c.KeyspaceEvents()
+	for _, key := range keys {
+		if classes&EventKeyspace != 0 {
+			c.publish(keyspaceChannelPrefix+key, []byte(event))
+		}
+		if classes&EventKeyevent != 0 {
+			c.publish(keyeventChannelPrefix+event, []byte(key))
+		}
+	}
+}
+
+// notifyOnSuccess publishes the event, if the command hasn't failed with *err. It's intended to be deferred:
+// defer c.notifyOnSuccess(&err, EventString, "set", key)
+func (c *Core) notifyOnSuccess(err *error, class EventClass, event string, key string) {
+	if *err == nil {
+		c.notify(class, event, key)
+	}
+}
+
+// del removes keys like Storage.Del() and publishes the event for every actually removed key
+func (c *Core) del(class EventClass, event string, keys []string) (count int) {
+	if !c.isNotifying(class) {
+		return c.storage.Del(keys)
+	}
+
+	var deleted []string
+	c.storage.AtomicUpdate(keys, func(items map[string]*Item) {
+		for _, key := range keys {
+			if items[key] != nil {
+				items[key] = nil
+				deleted = append(deleted, key)
+			}
+		}
+	})
+
+	c.notify(class, event, deleted...)
+
+	return len(deleted)
+}
+
+// deleteExpired removes items like Storage.DelSubmap() and publishes "expired" event for every actually removed key
+func (c *Core) deleteExpired(submap map[string]*Item) (count int) {
+	if !c.isNotifying(EventExpired) {
+		return c.storage.DelSubmap(submap)
+	}
+
+	keys := make([]string, 0, len(submap))
+	for key := range submap {
+		keys = append(keys, key)
+	}
+
+	var deleted []string
+	c.storage.AtomicUpdate(keys, func(items map[string]*Item) {
+		for key, item := range submap {
+			if item != nil && items[key] == item {
+				items[key] = nil
+				deleted = append(deleted, key)
+			}
+		}
+	})
+
+	c.notify(EventExpired, "expired", deleted...)
+
+	return len(deleted)
+}
+
+// notifySet publishes "set" event and "expire" event, if the new value has TTL
+func (c *Core) notifySet(key string, hasTtl bool) {
+	c.notify(EventString, "set", key)
+	if hasTtl {
+		c.notify(EventGeneric, "expire", key)
+	}
+}
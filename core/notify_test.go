@@ -0,0 +1,143 @@
+package core_test
+
+import (
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/core"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newNotifiedCore returns core with enabled notification classes, and pointer to the slice of published events
+func newNotifiedCore(storage Storage, flags string) (c *Core, events *[]string) {
+	classes, err := ParseEventClasses(flags)
+	if err != nil {
+		panic(err)
+	}
+
+	events = &[]string{}
+	c = New(storage)
+	c.SetKeyspaceEvents(classes)
+	c.SetPublisher(func(channel string, message []byte) {
+		*events = append(*events, channel+" "+string(message))
+	})
+
+	return c, events
+}
+
+func TestParseEventClasses(t *testing.T) {
+	tests := []struct {
+		flags   string
+		err     error
+		classes EventClass
+		want    string
+	}{
+		{"", nil, 0, ""},
+		{"KEA", nil, EventKeyspace | EventKeyevent | EventAll, "KEg$lshzxe"},
+		{"xEg", nil, EventKeyevent | EventGeneric | EventExpired, "Egx"},
+		{"$$K", nil, EventKeyspace | EventString, "K$"},
+		{"Kt", ErrEventClass, 0, ""},
+	}
+
+	for _, tst := range tests {
+		classes, err := ParseEventClasses(tst.flags)
+		if err != tst.err {
+			t.Errorf("ParseEventClasses(%q) err: %v != %v", tst.flags, err, tst.err)
+		}
+		if classes != tst.classes {
+			t.Errorf("ParseEventClasses(%q): %b != %b", tst.flags, classes, tst.classes)
+		}
+		if got := classes.String(); got != tst.want {
+			t.Errorf("ParseEventClasses(%q).String(): %q != %q", tst.flags, got, tst.want)
+		}
+	}
+}
+
+func TestCore_Notify(t *testing.T) {
+	tests := []struct {
+		flags string
+		run   func(c *Core)
+		want  []string
+	}{
+		{
+			"KEA",
+			func(c *Core) { c.Set("bytes", []byte("value"), "EX", "10") },
+			[]string{
+				"__keyspace@0__:bytes set", "__keyevent@0__:set bytes",
+				"__keyspace@0__:bytes expire", "__keyevent@0__:expire bytes",
+			},
+		},
+		{
+			"K$",
+			func(c *Core) { c.Set("bytes", []byte("value"), "NX") },
+			[]string{},
+		},
+		{
+			"Eg",
+			func(c *Core) { c.Del([]string{"bytes", "404", "expired", "bytes"}) },
+			[]string{"__keyevent@0__:del bytes", "__keyevent@0__:del expired"},
+		},
+		{
+			"El",
+			func(c *Core) { c.LMove("list", "new", "LEFT", "RIGHT") },
+			[]string{"__keyevent@0__:lpop list", "__keyevent@0__:rpush new"},
+		},
+		{
+			"Kg",
+			func(c *Core) { c.Rename("bytes", "new") },
+			[]string{"__keyspace@0__:bytes rename_from", "__keyspace@0__:new rename_to"},
+		},
+		{
+			"Kh",
+			func(c *Core) {
+				c.DSet("dict", [][]byte{[]byte("banana"), []byte("papa")})
+				c.DDel("dict", []string{"404"})
+				c.DSet("bytes", [][]byte{[]byte("banana"), []byte("papa")})
+			},
+			[]string{"__keyspace@0__:dict hset"},
+		},
+		{
+			"KEs",
+			func(c *Core) { c.Set("bytes", []byte("value")) },
+			[]string{},
+		},
+		{
+			"A",
+			func(c *Core) { c.Set("bytes", []byte("value")) },
+			[]string{},
+		},
+	}
+
+	for _, tst := range tests {
+		c, events := newNotifiedCore(NewMockStorage(), tst.flags)
+		tst.run(c)
+
+		if diff := deep.Equal(*events, tst.want); diff != nil {
+			t.Errorf("%q: %s\n\ngot:%q\n\nwant:%q", tst.flags, diff, *events, tst.want)
+		}
+	}
+}
+
+func TestCore_NotifyExpired(t *testing.T) {
+	expired := NewItemBytes([]byte("Abba"))
+	expired.SetExpireAt(time.Now().Add(-time.Millisecond))
+
+	fully := NewItemDict(map[string][]byte{"expired": []byte("Abba")})
+	fully.SetDictFieldExpireAt("expired", time.Now().Add(-time.Millisecond))
+
+	s := NewStorageHash()
+	s.AddOrReplaceOne("expired", expired)
+	s.AddOrReplaceOne("fully", fully)
+	s.AddOrReplaceOne("alive", NewItemBytes([]byte("KMFDM")))
+	c, events := newNotifiedCore(s, "Exgh")
+
+	if count := c.CollectExpired(); count != 2 {
+		t.Errorf("CollectExpired(): %d != 2", count)
+	}
+
+	want := []string{"__keyevent@0__:del fully", "__keyevent@0__:expired expired", "__keyevent@0__:hexpired fully"}
+	sort.Strings(*events)
+	if diff := deep.Equal(*events, want); diff != nil {
+		t.Errorf("CollectExpired(): %s\n\ngot:%q\n\nwant:%q", diff, *events, want)
+	}
+}
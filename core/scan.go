@@ -0,0 +1,209 @@
+package core
+
+import (
+	"github.com/ryanuber/go-glob"
+	"strconv"
+	"strings"
+)
+
+// ScanDefaultCount is the default amount of work, that should be done at every SCAN call
+const ScanDefaultCount = 10
+
+// ScanResult is a page of SCAN-like commands: cursor to continue iteration and elements of the page.
+// Cursor 0 means the iteration is finished
+type ScanResult struct {
+	Cursor   int
+	Elements [][]byte
+}
+
+// scanOptions contains parsed optional arguments of SCAN-like commands
+type scanOptions struct {
+	pattern  string
+	count    int
+	typeName string
+}
+
+// Scan Incrementally iterates over the keyspace: SCAN cursor [MATCH pattern] [COUNT count] [TYPE type].
+// Iteration starts with cursor 0 and finishes, when returned cursor is 0.
+// Every key, that exists during the full iteration, is returned at least once.
+// MATCH and TYPE filters are applied after keys are retrieved, so the page could be empty even if iteration isn't finished.
+// COUNT is a hint, how many keys should be retrieved at every call.
+// @command SCAN
+func (c *Core) Scan(cursor int, options ...string) (result ScanResult, err error) {
+	opts, err := parseScanOptions(cursor, options, true)
+	if err != nil {
+		return result, err
+	}
+
+	next, keys := c.storage.Scan(cursor, opts.count)
+	result.Cursor = next
+	for _, key := range keys {
+		if !glob.Glob(opts.pattern, key) {
+			continue
+		}
+
+		item := c.getItem(key)
+		if item == nil {
+			continue
+		}
+
+		if opts.typeName != "" && typeName(item) != opts.typeName {
+			continue
+		}
+
+		result.Elements = append(result.Elements, []byte(key))
+	}
+
+	return result, nil
+}
+
+// DScan Incrementally iterates over fields and values of the dict stored at key: HSCAN key cursor [MATCH pattern] [COUNT count].
+// Every element of the page is field followed by its value
+// @command HSCAN
+func (c *Core) DScan(key string, cursor int, options ...string) (result ScanResult, err error) {
+	return c.scanItem(key, Dict, cursor, options, func(item *Item, visit func(field string, value []byte)) {
+		for field, value := range item.liveDict() {
+			visit(field, value)
+		}
+	})
+}
+
+// SScan Incrementally iterates over members of the set stored at key: SSCAN key cursor [MATCH pattern] [COUNT count].
+// @command SSCAN
+func (c *Core) SScan(key string, cursor int, options ...string) (result ScanResult, err error) {
+	return c.scanItem(key, Set, cursor, options, func(item *Item, visit func(field string, value []byte)) {
+		for member := range item.set {
+			visit(member, nil)
+		}
+	})
+}
+
+// ZScan Incrementally iterates over members and scores of the sorted set stored at key: ZSCAN key cursor [MATCH pattern] [COUNT count].
+// Every element of the page is member followed by its score
+// @command ZSCAN
+func (c *Core) ZScan(key string, cursor int, options ...string) (result ScanResult, err error) {
+	return c.scanItem(key, ZSet, cursor, options, func(item *Item, visit func(field string, value []byte)) {
+		for member, score := range item.zset.dict {
+			visit(member, []byte(formatFloat(score)))
+		}
+	})
+}
+
+// scanItem pages through elements of the container item, using the same bucket-by-bucket cursor as StorageHash.Scan():
+// elements are distributed into buckets by hash, so the cursor remains stable while elements are added or removed.
+// forEach visits every element of the item with its value, nil value means the element has no value (e.g. set member)
+func (c *Core) scanItem(
+	key string,
+	kind ItemKind,
+	cursor int,
+	options []string,
+	forEach func(item *Item, visit func(field string, value []byte)),
+) (result ScanResult, err error) {
+	opts, err := parseScanOptions(cursor, options, false)
+	if err != nil {
+		return result, err
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		// In Redis, SCAN-like commands on not existing key return empty page and finish iteration
+		return result, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != kind {
+		return result, ErrWrongType
+	}
+
+	// count fields in every bucket to find the buckets range, containing at least opts.count fields
+	var bucketSizes [bucketsCount]int
+	total := 0
+	forEach(item, func(field string, value []byte) {
+		bucketSizes[getBucket(field)]++
+		total++
+	})
+
+	end := bucketsCount
+	if total > opts.count {
+		// small containers are returned at once, like Redis does for the compact encodings
+		end = cursor
+		for count := 0; end < bucketsCount && count < opts.count; end++ {
+			count += bucketSizes[end]
+		}
+	}
+
+	if end < bucketsCount {
+		result.Cursor = end
+	}
+
+	forEach(item, func(field string, value []byte) {
+		if b := getBucket(field); b < cursor || b >= end || !glob.Glob(opts.pattern, field) {
+			return
+		}
+
+		result.Elements = append(result.Elements, []byte(field))
+		if value != nil {
+			result.Elements = append(result.Elements, copyBytes(value))
+		}
+	})
+
+	return result, nil
+}
+
+// parseScanOptions parses [MATCH pattern] [COUNT count] [TYPE type] options of SCAN-like commands
+func parseScanOptions(cursor int, options []string, allowType bool) (opts scanOptions, err error) {
+	if cursor < 0 {
+		return opts, ErrCursor
+	}
+
+	opts = scanOptions{pattern: "*", count: ScanDefaultCount}
+	for i := 0; i < len(options); i += 2 {
+		if i == len(options)-1 {
+			return opts, ErrSyntax
+		}
+
+		switch value := options[i+1]; strings.ToUpper(options[i]) {
+		case "MATCH":
+			opts.pattern = value
+		case "COUNT":
+			if opts.count, err = strconv.Atoi(value); err != nil {
+				return opts, ErrNotInteger
+			}
+			if opts.count < 1 {
+				return opts, ErrSyntax
+			}
+		case "TYPE":
+			if !allowType {
+				return opts, ErrSyntax
+			}
+			opts.typeName = strings.ToLower(value)
+		default:
+			return opts, ErrSyntax
+		}
+	}
+
+	return opts, nil
+}
+
+// typeName returns Redis name of the item type
+func typeName(item *Item) string {
+	item.RLock()
+	defer item.RUnlock()
+
+	switch item.kind {
+	case Bytes:
+		return "string"
+	case List:
+		return "list"
+	case Dict:
+		return "hash"
+	case Set:
+		return "set"
+	case ZSet:
+		return "zset"
+	default:
+		return "none"
+	}
+}
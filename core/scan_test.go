@@ -0,0 +1,153 @@
+package core_test
+
+import (
+	"fmt"
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/core"
+	"sort"
+	"testing"
+)
+
+func TestCore_Scan(t *testing.T) {
+	tests := []struct {
+		options []string
+		err     error
+		want    []string
+	}{
+		{[]string{"COUNT"}, ErrSyntax, nil},
+		{[]string{"COUNT", "0"}, ErrSyntax, nil},
+		{[]string{"COUNT", "many"}, ErrNotInteger, nil},
+		{[]string{"UNKNOWN", "1"}, ErrSyntax, nil},
+		{nil, nil, []string{"bytes", "dict", "list", "測"}},
+		{[]string{"COUNT", "1"}, nil, []string{"bytes", "dict", "list", "測"}},
+		{[]string{"match", "*i*", "count", "2"}, nil, []string{"dict", "list"}},
+		{[]string{"TYPE", "hash"}, nil, []string{"dict"}},
+		{[]string{"TYPE", "STRING", "MATCH", "*"}, nil, []string{"bytes", "測"}},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		var got []string
+		for cursor := 0; ; {
+			result, err := c.Scan(cursor, tst.options...)
+			if err != tst.err {
+				t.Errorf("Scan(%d, %q) err: %q != %q", cursor, tst.options, err, tst.err)
+			}
+			got = append(got, bytesToStrings(result.Elements)...)
+
+			if err != nil || result.Cursor == 0 {
+				break
+			}
+			cursor = result.Cursor
+		}
+
+		sort.Strings(got)
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("Scan(%q): %s\n\ngot:%q\n\nwant:%q", tst.options, diff, got, tst.want)
+		}
+	}
+
+	if _, err := c.Scan(-1); err != ErrCursor {
+		t.Errorf("Scan(-1) err: %q != %q", err, ErrCursor)
+	}
+}
+
+func TestCore_ScanItem(t *testing.T) {
+	dict := make(map[string][]byte)
+	set := make(map[string]struct{})
+	zset := make(map[string]float64)
+	for i := 0; i < 1000; i++ {
+		dict[fmt.Sprintf("field_%d", i)] = []byte(fmt.Sprintf("value_%d", i))
+		set[fmt.Sprintf("member_%d", i)] = struct{}{}
+		zset[fmt.Sprintf("member_%d", i)] = float64(i)
+	}
+
+	c := New(NewStorageHash())
+	c.Storage().AddOrReplaceOne("dict", NewItemDict(dict))
+	c.Storage().AddOrReplaceOne("set", NewItemSet(set))
+	c.Storage().AddOrReplaceOne("zset", NewItemZSet(zset))
+	c.Storage().AddOrReplaceOne("small", NewItemDict(map[string][]byte{"f1": []byte("v1"), "f2": []byte("v2")}))
+	c.Set("bytes", []byte("value"))
+
+	commands := map[string]func(key string, cursor int, options ...string) (ScanResult, error){
+		"DScan": c.DScan,
+		"SScan": c.SScan,
+		"ZScan": c.ZScan,
+	}
+
+	tests := []struct {
+		command, key string
+		options      []string
+		err          error
+		wantCount    int
+		want         map[string]string
+	}{
+		{"DScan", "bytes", nil, ErrWrongType, 0, nil},
+		{"DScan", "dict", []string{"TYPE", "hash"}, ErrSyntax, 0, nil},
+		{"DScan", "404", nil, nil, 0, map[string]string{}},
+		{"DScan", "small", nil, nil, 1, map[string]string{"f1": "v1", "f2": "v2"}},
+		{"DScan", "dict", []string{"MATCH", "field_99*"}, nil, 0, map[string]string{
+			"field_99": "value_99", "field_990": "value_990", "field_991": "value_991", "field_992": "value_992",
+			"field_993": "value_993", "field_994": "value_994", "field_995": "value_995", "field_996": "value_996",
+			"field_997": "value_997", "field_998": "value_998", "field_999": "value_999",
+		}},
+		{"SScan", "set", []string{"MATCH", "member_99*"}, nil, 0, map[string]string{
+			"member_99": "", "member_990": "", "member_991": "", "member_992": "", "member_993": "", "member_994": "",
+			"member_995": "", "member_996": "", "member_997": "", "member_998": "", "member_999": "",
+		}},
+		{"ZScan", "zset", []string{"COUNT", "50", "MATCH", "member_99*"}, nil, 0, map[string]string{
+			"member_99": "99", "member_990": "990", "member_991": "991", "member_992": "992", "member_993": "993",
+			"member_994": "994", "member_995": "995", "member_996": "996", "member_997": "997", "member_998": "998",
+			"member_999": "999",
+		}},
+		{"DScan", "dict", nil, nil, 0, nil},
+		{"SScan", "set", []string{"COUNT", "100"}, nil, 0, nil},
+	}
+
+	for _, tst := range tests {
+		got := make(map[string]string)
+		calls := 0
+		for cursor := 0; ; calls++ {
+			result, err := commands[tst.command](tst.key, cursor, tst.options...)
+			if err != tst.err {
+				t.Errorf("%s(%q, %d, %q) err: %q != %q", tst.command, tst.key, cursor, tst.options, err, tst.err)
+			}
+
+			for i := 0; i < len(result.Elements); i++ {
+				element := string(result.Elements[i])
+				if _, ok := got[element]; ok {
+					t.Errorf("%s(%q, %q): %q returned twice", tst.command, tst.key, tst.options, element)
+				}
+
+				got[element] = ""
+				if tst.command != "SScan" {
+					i++
+					got[element] = string(result.Elements[i])
+				}
+			}
+
+			if err != nil || result.Cursor == 0 {
+				break
+			}
+			cursor = result.Cursor
+		}
+
+		if tst.err != nil {
+			continue
+		}
+		if tst.wantCount != 0 && calls+1 != tst.wantCount {
+			t.Errorf("%s(%q, %q): calls count %d != %d", tst.command, tst.key, tst.options, calls+1, tst.wantCount)
+		}
+		if tst.want == nil {
+			// full iteration without filters must return every element
+			if len(got) != 1000 {
+				t.Errorf("%s(%q, %q): %d elements returned instead of 1000", tst.command, tst.key, tst.options, len(got))
+			}
+			continue
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("%s(%q, %q): %s\n\ngot:%q\n\nwant:%q", tst.command, tst.key, tst.options, diff, got, tst.want)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package core
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// SAdd Adds the specified members to the set stored at key.
+// Specified members that are already a member of this set are ignored.
+// If key does not exist, a new set is created before adding the specified members.
+// Returns the number of members that were added to the set, not including all the members already present.
+// @command SADD
+// @modifying
+// @denyoom
+func (c *Core) SAdd(key string, members []string) (count int, err error) {
+	defer func() {
+		if count > 0 {
+			c.notify(EventSet, "sadd", key)
+		}
+	}()
+
+	for {
+		var added int
+		item := c.addItemIfAbsent(key, func() *Item {
+			set := make(map[string]struct{}, len(members))
+			added = addSetMembers(set, members)
+			return NewItemSet(set)
+		})
+		if item == nil {
+			return added, nil
+		}
+
+		count, err := addItemSetMembers(item, members)
+		if err != errItemExpired {
+			return count, err
+		}
+	}
+}
+
+// addItemSetMembers adds members into Set item under the item lock and returns count of actually added members.
+// errItemExpired is returned if item expired before it was locked, so the caller should retry with a fresh item
+func addItemSetMembers(item *Item, members []string) (count int, err error) {
+	item.Lock()
+	defer item.Unlock()
+
+	if item.IsExpired() {
+		return 0, errItemExpired
+	}
+
+	if item.kind != Set {
+		return 0, ErrWrongType
+	}
+
+	return addSetMembers(item.Set(), members), nil
+}
+
+// addSetMembers adds members into the set and returns count of actually added members
+func addSetMembers(set map[string]struct{}, members []string) (count int) {
+	for _, member := range members {
+		if _, ok := set[member]; !ok {
+			count++
+			set[member] = struct{}{}
+		}
+	}
+
+	return count
+}
+
+// SRem Removes the specified members from the set stored at key.
+// Specified members that are not a member of this set are ignored.
+// If key does not exist, it is treated as an empty set and this command returns 0.
+// When the last member is removed, the key is removed too.
+// @command SREM
+// @modifying
+func (c *Core) SRem(key string, members []string) (count int, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	count, isEmpty, err := removeSetMembers(item, members)
+	if count > 0 {
+		c.notify(EventSet, "srem", key)
+	}
+	if isEmpty {
+		c.delEmptySet(key, item)
+	}
+
+	return count, err
+}
+
+// removeSetMembers removes members from Set item under the item lock and reports, whether the set became empty
+func removeSetMembers(item *Item, members []string) (count int, isEmpty bool, err error) {
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != Set {
+		return 0, false, ErrWrongType
+	}
+
+	set := item.Set()
+	for _, member := range members {
+		if _, ok := set[member]; ok {
+			count++
+			delete(set, member)
+		}
+	}
+
+	return count, count > 0 && len(set) == 0, nil
+}
+
+// SMembers Returns all the members of the set value stored at key.
+// @command SMEMBERS
+func (c *Core) SMembers(key string) (result []string, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		// In Redis, SMEMBERS on non-exists key returns empty set, not <nil> aka NotFound
+		return nil, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Set {
+		return nil, ErrWrongType
+	}
+
+	return setMembers(item.Set()), nil
+}
+
+// SIsMember Returns 1 if member is a member of the set stored at key, 0 otherwise
+// @command SISMEMBER
+func (c *Core) SIsMember(key, member string) (result int, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Set {
+		return 0, ErrWrongType
+	}
+
+	if _, ok := item.Set()[member]; ok {
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// SCard Returns the set cardinality (number of elements) of the set stored at key.
+// If key does not exist, 0 is returned.
+// @command SCARD
+func (c *Core) SCard(key string) (count int, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Set {
+		return 0, ErrWrongType
+	}
+
+	return len(item.Set()), nil
+}
+
+// SPop Removes and returns a random member from the set value stored at key.
+// When the last member is popped, the key is removed too.
+// Due to the result is random, SPOP is logged into WAL as SREM of the popped member
+// @command SPOP
+// @modifying
+// @replay SREM
+func (c *Core) SPop(key string) (result []byte, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return nil, ErrNotFound
+	}
+
+	member, isEmpty, err := popSetMember(item)
+	if err != nil {
+		return nil, err
+	}
+
+	c.notify(EventSet, "spop", key)
+	if isEmpty {
+		c.delEmptySet(key, item)
+	}
+
+	return []byte(member), nil
+}
+
+// popSetMember removes random member from Set item under the item lock and reports, whether the set became empty
+func popSetMember(item *Item) (member string, isEmpty bool, err error) {
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != Set {
+		return "", false, ErrWrongType
+	}
+
+	set := item.Set()
+	if len(set) == 0 {
+		return "", false, ErrNotFound
+	}
+
+	member = randomSetMember(set)
+	delete(set, member)
+
+	return member, len(set) == 0, nil
+}
+
+// SRandMember Returns a random member from the set value stored at key.
+// @command SRANDMEMBER
+func (c *Core) SRandMember(key string) (result []byte, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return nil, ErrNotFound
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Set {
+		return nil, ErrWrongType
+	}
+
+	set := item.Set()
+	if len(set) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return []byte(randomSetMember(set)), nil
+}
+
+// SInter Returns the members of the set resulting from the intersection of all the given sets.
+// Keys that do not exist are considered to be empty sets.
+// @command SINTER
+func (c *Core) SInter(keys []string) (result []string, err error) {
+	set, err := c.setAlgebra(keys, setInter)
+	if err != nil {
+		return nil, err
+	}
+
+	return setMembers(set), nil
+}
+
+// SUnion Returns the members of the set resulting from the union of all the given sets.
+// Keys that do not exist are considered to be empty sets.
+// @command SUNION
+func (c *Core) SUnion(keys []string) (result []string, err error) {
+	set, err := c.setAlgebra(keys, setUnion)
+	if err != nil {
+		return nil, err
+	}
+
+	return setMembers(set), nil
+}
+
+// SDiff Returns the members of the set resulting from the difference between the first set and all the successive sets.
+// Keys that do not exist are considered to be empty sets.
+// @command SDIFF
+func (c *Core) SDiff(keys []string) (result []string, err error) {
+	set, err := c.setAlgebra(keys, setDiff)
+	if err != nil {
+		return nil, err
+	}
+
+	return setMembers(set), nil
+}
+
+// SInterStore This command is equal to SINTER, but instead of returning the resulting set, it is stored in destination.
+// If destination already exists, it is overwritten. Returns the number of elements in the resulting set.
+// @command SINTERSTORE
+// @modifying
+// @denyoom
+func (c *Core) SInterStore(destination string, keys []string) (count int, err error) {
+	return c.setAlgebraStore(destination, keys, setInter, "sinterstore")
+}
+
+// SUnionStore This command is equal to SUNION, but instead of returning the resulting set, it is stored in destination.
+// If destination already exists, it is overwritten. Returns the number of elements in the resulting set.
+// @command SUNIONSTORE
+// @modifying
+// @denyoom
+func (c *Core) SUnionStore(destination string, keys []string) (count int, err error) {
+	return c.setAlgebraStore(destination, keys, setUnion, "sunionstore")
+}
+
+// SDiffStore This command is equal to SDIFF, but instead of returning the resulting set, it is stored in destination.
+// If destination already exists, it is overwritten. Returns the number of elements in the resulting set.
+// @command SDIFFSTORE
+// @modifying
+// @denyoom
+func (c *Core) SDiffStore(destination string, keys []string) (count int, err error) {
+	return c.setAlgebraStore(destination, keys, setDiff, "sdiffstore")
+}
+
+// setAlgebraStore reduces sets stored at keys by op and replaces destination with the result,
+// then notifies about it with event. Empty result leads to removing destination.
+// Sources are read and destination is replaced atomically, so the result never mixes states of different moments
+func (c *Core) setAlgebraStore(destination string, keys []string, op func(acc, set map[string]struct{}) map[string]struct{}, event string) (count int, err error) {
+	var isDeleted bool
+	c.storage.AtomicUpdate(append([]string{destination}, keys...), func(items map[string]*Item) {
+		// checked before locking, because destination could be one of the sources
+		isExisting := items[destination] != nil && !isExpired(items[destination])
+
+		sources := make([]*Item, len(keys))
+		for i, key := range keys {
+			sources[i] = items[key]
+		}
+
+		unlock := lockItems(sources...)
+		defer unlock()
+
+		var set map[string]struct{}
+		set, err = reduceSets(len(keys), func(i int) (map[string]struct{}, error) {
+			return copySetItem(sources[i])
+		}, op)
+		if err != nil {
+			return
+		}
+
+		if len(set) == 0 {
+			isDeleted = isExisting
+			items[destination] = nil
+			return
+		}
+
+		items[destination] = NewItemSet(set)
+		count = len(set)
+	})
+
+	switch {
+	case err != nil:
+		return 0, err
+	case count > 0:
+		c.notify(EventSet, event, destination)
+	case isDeleted:
+		c.notify(EventGeneric, "del", destination)
+	}
+
+	return count, nil
+}
+
+// delEmptySet removes the set item, which became empty, if it's still stored at key and still has no members.
+// It's called after the item is unlocked, because the storage lock must be taken before the item lock
+func (c *Core) delEmptySet(key string, item *Item) {
+	var deleted bool
+	c.storage.AtomicUpdate([]string{key}, func(items map[string]*Item) {
+		if items[key] != item {
+			return
+		}
+
+		item.RLock()
+		deleted = len(item.Set()) == 0
+		item.RUnlock()
+
+		if deleted {
+			items[key] = nil
+		}
+	})
+
+	if deleted {
+		c.notify(EventGeneric, "del", key)
+	}
+}
+
+// setAlgebra copies sets stored at keys one by one and reduces them into the single set by op.
+// Not existing keys are treated as empty sets.
+func (c *Core) setAlgebra(keys []string, op func(acc, set map[string]struct{}) map[string]struct{}) (result map[string]struct{}, err error) {
+	return reduceSets(len(keys), func(i int) (map[string]struct{}, error) {
+		return c.copySet(keys[i])
+	}, op)
+}
+
+// reduceSets reduces count sets, returned by copySet one by one, into the single set by op
+func reduceSets(count int, copySet func(i int) (map[string]struct{}, error), op func(acc, set map[string]struct{}) map[string]struct{}) (result map[string]struct{}, err error) {
+	for i := 0; i < count; i++ {
+		set, err := copySet(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			result = set
+		} else {
+			result = op(result, set)
+		}
+	}
+
+	return result, nil
+}
+
+// copySet returns a copy of the set stored at key, or empty set if key not found
+func (c *Core) copySet(key string) (result map[string]struct{}, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return map[string]struct{}{}, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	return copySetItem(item)
+}
+
+// copySetItem returns a copy of the set item, or empty set if item is nil or expired.
+// The item should be locked by the caller
+func copySetItem(item *Item) (result map[string]struct{}, err error) {
+	if item == nil || item.IsExpired() {
+		return map[string]struct{}{}, nil
+	}
+
+	if item.kind != Set {
+		return nil, ErrWrongType
+	}
+
+	set := item.Set()
+	result = make(map[string]struct{}, len(set))
+	for member := range set {
+		result[member] = struct{}{}
+	}
+
+	return result, nil
+}
+
+func setInter(acc, set map[string]struct{}) map[string]struct{} {
+	for member := range acc {
+		if _, ok := set[member]; !ok {
+			delete(acc, member)
+		}
+	}
+
+	return acc
+}
+
+func setUnion(acc, set map[string]struct{}) map[string]struct{} {
+	for member := range set {
+		acc[member] = struct{}{}
+	}
+
+	return acc
+}
+
+func setDiff(acc, set map[string]struct{}) map[string]struct{} {
+	for member := range set {
+		delete(acc, member)
+	}
+
+	return acc
+}
+
+// setMembers returns set members as a slice, sorted to make the result reproducible
+func setMembers(set map[string]struct{}) []string {
+	result := make([]string, 0, len(set))
+	for member := range set {
+		result = append(result, member)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// randomSetMember returns random member of non-empty set
+func randomSetMember(set map[string]struct{}) string {
+	n := rand.Intn(len(set))
+	for member := range set {
+		if n == 0 {
+			return member
+		}
+		n--
+	}
+
+	// unreachable for non-empty set
+	return ""
+}
@@ -0,0 +1,308 @@
+package core_test
+
+import (
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/core"
+	"testing"
+)
+
+func getSampleDataSet() map[string]*Item {
+	data := getSampleDataCore()
+	data["set"] = NewItemSet(map[string]struct{}{
+		"Abba":      {},
+		"Rammstein": {},
+		"KMFDM":     {},
+	})
+	data["set2"] = NewItemSet(map[string]struct{}{
+		"KMFDM": {},
+		"測試":    {},
+	})
+
+	return data
+}
+
+func NewMockStorageSet() *MockStorage {
+	return &MockStorage{data: getSampleDataSet()}
+}
+
+func TestCore_SAdd(t *testing.T) {
+	tests := []struct {
+		key       string
+		members   []string
+		err       error
+		wantCount int
+		want      []string
+	}{
+		{"bytes", []string{"a"}, ErrWrongType, 0, nil},
+		{"404", []string{"a", "b", "a"}, nil, 2, []string{"a", "b"}},
+		{"expired", []string{"a"}, nil, 1, []string{"a"}},
+		{"set", []string{"Abba", "AC/DC"}, nil, 1, []string{"AC/DC", "Abba", "KMFDM", "Rammstein"}},
+	}
+
+	c := New(NewMockStorageSet())
+
+	for _, tst := range tests {
+		count, err := c.SAdd(tst.key, tst.members)
+		got, _ := c.SMembers(tst.key)
+
+		if err != tst.err {
+			t.Errorf("SAdd(%q, %q) err: %q != %q", tst.key, tst.members, err, tst.err)
+		}
+		if count != tst.wantCount {
+			t.Errorf("SAdd(%q, %q) count: %d != %d", tst.key, tst.members, count, tst.wantCount)
+		}
+		if diff := deep.Equal(got, tst.want); err == nil && diff != nil {
+			t.Errorf("SAdd(%q, %q): %s\n\ngot:%v\n\nwant:%v", tst.key, tst.members, diff, got, tst.want)
+		}
+	}
+}
+
+func TestCore_SRem(t *testing.T) {
+	tests := []struct {
+		key       string
+		members   []string
+		err       error
+		wantCount int
+		want      []string
+	}{
+		{"bytes", []string{"a"}, ErrWrongType, 0, nil},
+		{"404", []string{"a"}, nil, 0, nil},
+		{"set", []string{"Abba", "AC/DC"}, nil, 1, []string{"KMFDM", "Rammstein"}},
+		{"set2", []string{"KMFDM", "測試"}, nil, 2, nil},
+	}
+
+	c := New(NewMockStorageSet())
+
+	for _, tst := range tests {
+		count, err := c.SRem(tst.key, tst.members)
+		got, _ := c.SMembers(tst.key)
+
+		if err == nil && tst.want == nil && c.Exists([]string{tst.key}) != 0 {
+			t.Errorf("SRem(%q, %q): empty set key still exists", tst.key, tst.members)
+		}
+
+		if err != tst.err {
+			t.Errorf("SRem(%q, %q) err: %q != %q", tst.key, tst.members, err, tst.err)
+		}
+		if count != tst.wantCount {
+			t.Errorf("SRem(%q, %q) count: %d != %d", tst.key, tst.members, count, tst.wantCount)
+		}
+		if diff := deep.Equal(got, tst.want); err == nil && diff != nil {
+			t.Errorf("SRem(%q, %q): %s\n\ngot:%v\n\nwant:%v", tst.key, tst.members, diff, got, tst.want)
+		}
+	}
+}
+
+func TestCore_SIsMember(t *testing.T) {
+	tests := []struct {
+		key, member string
+		err         error
+		want        int
+	}{
+		{"bytes", "a", ErrWrongType, 0},
+		{"404", "a", nil, 0},
+		{"set", "Abba", nil, 1},
+		{"set", "AC/DC", nil, 0},
+	}
+
+	c := New(NewMockStorageSet())
+
+	for _, tst := range tests {
+		got, err := c.SIsMember(tst.key, tst.member)
+		if err != tst.err {
+			t.Errorf("SIsMember(%q, %q) err: %q != %q", tst.key, tst.member, err, tst.err)
+		}
+		if got != tst.want {
+			t.Errorf("SIsMember(%q, %q): %d != %d", tst.key, tst.member, got, tst.want)
+		}
+	}
+}
+
+func TestCore_SCard(t *testing.T) {
+	tests := []struct {
+		key  string
+		err  error
+		want int
+	}{
+		{"bytes", ErrWrongType, 0},
+		{"404", nil, 0},
+		{"set", nil, 3},
+	}
+
+	c := New(NewMockStorageSet())
+
+	for _, tst := range tests {
+		got, err := c.SCard(tst.key)
+		if err != tst.err {
+			t.Errorf("SCard(%q) err: %q != %q", tst.key, err, tst.err)
+		}
+		if got != tst.want {
+			t.Errorf("SCard(%q): %d != %d", tst.key, got, tst.want)
+		}
+	}
+}
+
+func TestCore_SPop(t *testing.T) {
+	c := New(NewMockStorageSet())
+
+	if _, err := c.SPop("bytes"); err != ErrWrongType {
+		t.Errorf("SPop(%q) err: %q != %q", "bytes", err, ErrWrongType)
+	}
+	if _, err := c.SPop("404"); err != ErrNotFound {
+		t.Errorf("SPop(%q) err: %q != %q", "404", err, ErrNotFound)
+	}
+
+	popped := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		member, err := c.SPop("set")
+		if err != nil {
+			t.Errorf("SPop(%q) err: %q", "set", err)
+		}
+		if ok, _ := c.SIsMember("set", string(member)); ok != 0 {
+			t.Errorf("SPop(%q): %q still a member", "set", member)
+		}
+		popped[string(member)] = true
+	}
+
+	want := map[string]bool{"Abba": true, "Rammstein": true, "KMFDM": true}
+	if diff := deep.Equal(popped, want); diff != nil {
+		t.Errorf("SPop(%q): %s\n\ngot:%v\n\nwant:%v", "set", diff, popped, want)
+	}
+
+	if c.Exists([]string{"set"}) != 0 {
+		t.Errorf("SPop(%q): empty set key still exists", "set")
+	}
+	if _, err := c.SPop("set"); err != ErrNotFound {
+		t.Errorf("SPop(%q) on removed set err: %q != %q", "set", err, ErrNotFound)
+	}
+}
+
+func TestCore_SRandMember(t *testing.T) {
+	c := New(NewMockStorageSet())
+
+	if _, err := c.SRandMember("dict"); err != ErrWrongType {
+		t.Errorf("SRandMember(%q) err: %q != %q", "dict", err, ErrWrongType)
+	}
+	if _, err := c.SRandMember("404"); err != ErrNotFound {
+		t.Errorf("SRandMember(%q) err: %q != %q", "404", err, ErrNotFound)
+	}
+
+	member, err := c.SRandMember("set2")
+	if err != nil || (string(member) != "KMFDM" && string(member) != "測試") {
+		t.Errorf("SRandMember(%q): %q, %v", "set2", member, err)
+	}
+	if count, _ := c.SCard("set2"); count != 2 {
+		t.Errorf("SRandMember(%q) modified set: %d != %d", "set2", count, 2)
+	}
+}
+
+func TestCore_SetAlgebra(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		keys []string
+		err  error
+		want []string
+	}{
+		{"SINTER", []string{"set", "set2"}, nil, []string{"KMFDM"}},
+		{"SINTER", []string{"set", "404"}, nil, []string{}},
+		{"SINTER", []string{"set", "bytes"}, ErrWrongType, nil},
+		{"SUNION", []string{"set", "set2", "404"}, nil, []string{"Abba", "KMFDM", "Rammstein", "測試"}},
+		{"SUNION", []string{"list", "set"}, ErrWrongType, nil},
+		{"SDIFF", []string{"set", "set2"}, nil, []string{"Abba", "Rammstein"}},
+		{"SDIFF", []string{"404", "set2"}, nil, []string{}},
+		{"SDIFF", []string{"set2"}, nil, []string{"KMFDM", "測試"}},
+	}
+
+	for _, tst := range tests {
+		c := New(NewMockStorageSet())
+
+		var (
+			got []string
+			err error
+		)
+		switch tst.cmd {
+		case "SINTER":
+			got, err = c.SInter(tst.keys)
+		case "SUNION":
+			got, err = c.SUnion(tst.keys)
+		case "SDIFF":
+			got, err = c.SDiff(tst.keys)
+		}
+
+		if err != tst.err {
+			t.Errorf("%s(%q) err: %q != %q", tst.cmd, tst.keys, err, tst.err)
+		}
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("%s(%q): %s\n\ngot:%v\n\nwant:%v", tst.cmd, tst.keys, diff, got, tst.want)
+		}
+	}
+}
+
+func TestCore_SetAlgebraStore(t *testing.T) {
+	tests := []struct {
+		cmd       string
+		keys      []string
+		err       error
+		wantCount int
+		wantKeys  []string
+	}{
+		{"SINTERSTORE", []string{"set", "set2"}, nil, 1, []string{"KMFDM"}},
+		{"SINTERSTORE", []string{"set", "404"}, nil, 0, nil},
+		{"SINTERSTORE", []string{"set", "dict"}, ErrWrongType, 0, nil},
+		{"SUNIONSTORE", []string{"set", "set2"}, nil, 4, []string{"Abba", "KMFDM", "Rammstein", "測試"}},
+		{"SDIFFSTORE", []string{"set", "set2"}, nil, 2, []string{"Abba", "Rammstein"}},
+	}
+
+	for _, tst := range tests {
+		c := New(NewMockStorageSet())
+		// destination holds value of another type to ensure it is overwritten
+		destination := "bytes"
+
+		var (
+			count int
+			err   error
+		)
+		switch tst.cmd {
+		case "SINTERSTORE":
+			count, err = c.SInterStore(destination, tst.keys)
+		case "SUNIONSTORE":
+			count, err = c.SUnionStore(destination, tst.keys)
+		case "SDIFFSTORE":
+			count, err = c.SDiffStore(destination, tst.keys)
+		}
+
+		if err != tst.err {
+			t.Errorf("%s(%q) err: %q != %q", tst.cmd, tst.keys, err, tst.err)
+		}
+		if count != tst.wantCount {
+			t.Errorf("%s(%q) count: %d != %d", tst.cmd, tst.keys, count, tst.wantCount)
+		}
+		if err != nil {
+			continue
+		}
+
+		got, err := c.SMembers(destination)
+		if err != nil {
+			t.Errorf("%s(%q) SMembers err: %q", tst.cmd, tst.keys, err)
+		}
+		if diff := deep.Equal(got, tst.wantKeys); diff != nil {
+			t.Errorf("%s(%q): %s\n\ngot:%v\n\nwant:%v", tst.cmd, tst.keys, diff, got, tst.wantKeys)
+		}
+	}
+}
+
+func TestCore_SetAlgebraStoreIntoSource(t *testing.T) {
+	c := New(NewMockStorageSet())
+
+	// destination is one of the sources, it's read and replaced atomically
+	count, err := c.SUnionStore("set", []string{"set", "set2"})
+	if err != nil || count != 4 {
+		t.Errorf("SUnionStore(%q): %d, %v", "set", count, err)
+	}
+
+	got, _ := c.SMembers("set")
+	want := []string{"Abba", "KMFDM", "Rammstein", "測試"}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("SUnionStore(%q): %s\n\ngot:%v\n\nwant:%v", "set", diff, got, want)
+	}
+}
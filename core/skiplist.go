@@ -0,0 +1,280 @@
+package core
+
+import "math/rand"
+
+const (
+	skiplistMaxLevel = 32
+	// skiplistP is a probability of node to be promoted to the next level
+	skiplistP = 0.25
+)
+
+// skiplist keeps zset members ordered by score, then lexicographically by member.
+// It is a port of the redis zskiplist: every level link keeps a span -- count of nodes it jumps over,
+// so rank of a member could be calculated in O(log N)
+type skiplist struct {
+	header *skiplistNode
+	tail   *skiplistNode
+	length int
+	level  int
+}
+
+type skiplistNode struct {
+	member   string
+	score    float64
+	backward *skiplistNode
+	level    []skiplistLevel
+}
+
+type skiplistLevel struct {
+	forward *skiplistNode
+	span    int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		header: newSkiplistNode(skiplistMaxLevel, 0, ""),
+		level:  1,
+	}
+}
+
+func newSkiplistNode(level int, score float64, member string) *skiplistNode {
+	return &skiplistNode{
+		member: member,
+		score:  score,
+		level:  make([]skiplistLevel, level),
+	}
+}
+
+func randomSkiplistLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP {
+		level++
+	}
+
+	return level
+}
+
+// less returns true if node should be placed before (score, member) pair
+func (n *skiplistNode) less(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// insert adds new node. Caller must ensure that member isn't in the skiplist yet
+func (sl *skiplist) insert(score float64, member string) *skiplistNode {
+	var (
+		update [skiplistMaxLevel]*skiplistNode
+		rank   [skiplistMaxLevel]int
+	)
+
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i != sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.less(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomSkiplistLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].level[i].span = sl.length
+		}
+		sl.level = level
+	}
+
+	x = newSkiplistNode(level, score, member)
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+
+	// increment span for untouched levels
+	for i := level; i < sl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != sl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		sl.tail = x
+	}
+	sl.length++
+
+	return x
+}
+
+// delete removes node with matching score and member. Returns true if node was found
+func (sl *skiplist) delete(score float64, member string) bool {
+	var update [skiplistMaxLevel]*skiplistNode
+
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.less(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	sl.deleteNode(x, update[:sl.level])
+
+	return true
+}
+
+func (sl *skiplist) deleteNode(x *skiplistNode, update []*skiplistNode) {
+	for i := 0; i < sl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+
+	for sl.level > 1 && sl.header.level[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+}
+
+// rank returns 1-based rank of the node with matching score and member, or 0 if not found
+func (sl *skiplist) rank(score float64, member string) int {
+	rank := 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.less(score, member) ||
+				(x.level[i].forward.score == score && x.level[i].forward.member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+
+		if x != sl.header && x.member == member {
+			return rank
+		}
+	}
+
+	return 0
+}
+
+// byRank returns node by 1-based rank, or nil if rank out of range
+func (sl *skiplist) byRank(rank int) *skiplistNode {
+	traversed := 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+
+		if traversed == rank {
+			if x == sl.header {
+				return nil
+			}
+			return x
+		}
+	}
+
+	return nil
+}
+
+// firstInRange returns first node with score in the range, or nil if there is no such node
+func (sl *skiplist) firstInRange(r scoreRange) *skiplistNode {
+	if !sl.isInRange(r) {
+		return nil
+	}
+
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.isAboveMin(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+
+	x = x.level[0].forward
+	if x == nil || !r.isBelowMax(x.score) {
+		return nil
+	}
+
+	return x
+}
+
+// lastInRange returns last node with score in the range, or nil if there is no such node
+func (sl *skiplist) lastInRange(r scoreRange) *skiplistNode {
+	if !sl.isInRange(r) {
+		return nil
+	}
+
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.isBelowMax(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+
+	if x == sl.header || !r.isAboveMin(x.score) {
+		return nil
+	}
+
+	return x
+}
+
+// isInRange returns true if at least part of the skiplist is in the range
+func (sl *skiplist) isInRange(r scoreRange) bool {
+	if r.min > r.max || (r.min == r.max && (r.minExclusive || r.maxExclusive)) {
+		return false
+	}
+
+	if sl.tail == nil || !r.isAboveMin(sl.tail.score) {
+		return false
+	}
+
+	first := sl.header.level[0].forward
+	if first == nil || !r.isBelowMax(first.score) {
+		return false
+	}
+
+	return true
+}
+
+// scoreRange represents ZRANGEBYSCORE-like interval. Bounds are inclusive by default
+type scoreRange struct {
+	min, max                   float64
+	minExclusive, maxExclusive bool
+}
+
+func (r scoreRange) isAboveMin(score float64) bool {
+	if r.minExclusive {
+		return score > r.min
+	}
+	return score >= r.min
+}
+
+func (r scoreRange) isBelowMax(score float64) bool {
+	if r.maxExclusive {
+		return score < r.max
+	}
+	return score <= r.max
+}
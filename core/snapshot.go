@@ -0,0 +1,180 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Snapshot is point-in-time content of the storage, which is persisted, while the storage is modified.
+// It's copy-on-write at the item level: every Snapshot starts new epoch of the storage, and the first modification
+// of an item in the epoch preserves its content, until the item is persisted. So the items could be captured
+// after the epoch is started, without locking the whole storage, see snapshotEpoch.
+// Persist() MUST be called exactly once for every Snapshot, it releases the captured items and finishes the epoch
+type Snapshot struct {
+	entries []snapshotEntry
+
+	// entriesMu guards entries, while the items are captured by the storage writers
+	entriesMu sync.Mutex
+
+	// epoch is the epoch of the storage, started by the Snapshot
+	epoch int64
+
+	// storageEpoch is the epoch counter of the storage
+	storageEpoch *snapshotEpoch
+
+	// mu is the snapshot mutex of the storage, locked while the Snapshot exists, because the epochs of the storage
+	// don't overlap
+	mu *sync.Mutex
+}
+
+// snapshotEpoch is the epoch counter of the storage. An epoch lasts from the moment a Snapshot is taken
+// until it's persisted. Items, existing at the start of the epoch, preserve their content before the first
+// modification in it, and items, added during the epoch, are never preserved, see Item.freeze()
+type snapshotEpoch struct {
+	// current is the epoch of the Snapshot, which isn't persisted yet, or zero, accessed atomically
+	current int64
+
+	// last is the last started epoch, it's guarded by the snapshot mutex of the storage
+	last int64
+}
+
+// newSnapshot starts new epoch of the storage. It should be called under the snapshot mutex of the storage,
+// at the moment, when no items are added or removed, so the snapshot contains the items existing at the moment
+func newSnapshot(mu *sync.Mutex, storageEpoch *snapshotEpoch, size int) *Snapshot {
+	storageEpoch.last++
+	atomic.StoreInt64(&storageEpoch.current, storageEpoch.last)
+
+	return &Snapshot{
+		entries:      make([]snapshotEntry, 0, size),
+		epoch:        storageEpoch.last,
+		storageEpoch: storageEpoch,
+		mu:           mu,
+	}
+}
+
+// snapshotEntry is the key and the item, captured by Snapshot
+type snapshotEntry struct {
+	key  string
+	item *Item
+}
+
+// Len returns count of keys in the snapshot
+func (s *Snapshot) Len() int {
+	return len(s.entries)
+}
+
+// Persist dumps content of the snapshot into provided Writer and releases the captured items.
+// The snapshot file format is described in snapshotfile.go
+func (s *Snapshot) Persist(w io.Writer, lastMessageId int64) (err error) {
+	defer s.mu.Unlock()
+	defer atomic.StoreInt64(&s.storageEpoch.current, 0)
+
+	persisted := 0
+	// items, left after an encoding error, still must be released
+	defer func() {
+		for _, entry := range s.entries[persisted:] {
+			entry.item.release(s.epoch)
+		}
+	}()
+
+	sw, err := newSnapshotWriter(w, lastMessageId)
+	if err != nil {
+		return fmt.Errorf("Snapshot.Persist(): can't write header: %s", err)
+	}
+
+	for _, entry := range s.entries {
+		// only writers of the item are blocked while it's encoded
+		entry.item.RWMutex.RLock()
+		exp := entry.item.frozen
+		if exp == nil || atomic.LoadInt64(&entry.item.epoch) != s.epoch {
+			// the item isn't modified in the epoch, so it's persisted as is
+			exp = exportItem(entry.key, entry.item)
+		} else {
+			exp.Key = entry.key
+		}
+		err := sw.write(exp)
+		// frozen is accessed only by the writers and by the snapshot, so it's safe to reset it under the read lock
+		entry.item.frozen = nil
+		atomic.StoreInt64(&entry.item.epoch, s.epoch)
+		entry.item.RWMutex.RUnlock()
+
+		persisted++
+		if err != nil {
+			return fmt.Errorf("Snapshot.Persist(): can't encode item: %s", err)
+		}
+	}
+
+	if err := sw.close(); err != nil {
+		return fmt.Errorf("Snapshot.Persist(): can't write trailer: %s", err)
+	}
+
+	return nil
+}
+
+// capture adds the item, stored by the key at the start of the epoch, to the snapshot. It should be called
+// before the key is modified in the epoch, under the storage lock, guarding the key
+func (s *Snapshot) capture(key string, item *Item) {
+	s.entriesMu.Lock()
+	s.entries = append(s.entries, snapshotEntry{key, item})
+	s.entriesMu.Unlock()
+}
+
+// attachEpoch binds the item, added to the storage, to the epoch counter of the storage.
+// The item, which is new to the storage, doesn't exist at the start of the current epoch, so it's never preserved
+// in the epoch. It should be called under the storage lock, guarding the key. Items aren't moved between storages
+func attachEpoch(storageEpoch *snapshotEpoch, item *Item) {
+	if atomic.LoadPointer(&item.storageEpoch) == nil {
+		atomic.StoreInt64(&item.epoch, atomic.LoadInt64(&storageEpoch.current))
+		atomic.StorePointer(&item.storageEpoch, unsafe.Pointer(storageEpoch))
+	}
+}
+
+// freeze preserves content of the item before its first modification in the current snapshot epoch.
+// It should be called under the item write lock
+func (i *Item) freeze() {
+	storageEpoch := (*snapshotEpoch)(atomic.LoadPointer(&i.storageEpoch))
+	if storageEpoch == nil {
+		return
+	}
+
+	epoch := atomic.LoadInt64(&storageEpoch.current)
+	if epoch == 0 || atomic.LoadInt64(&i.epoch) == epoch {
+		return
+	}
+
+	// values are never modified in place, so only the collections are copied
+	exp := exportItem("", i)
+	if i.dict != nil {
+		exp.Dict = make(map[string][]byte, len(i.dict))
+		for field, value := range i.dict {
+			exp.Dict[field] = value
+		}
+	}
+	if i.dictExpireAt != nil {
+		exp.DictExpireAt = make(map[string]time.Time, len(i.dictExpireAt))
+		for field, expireAt := range i.dictExpireAt {
+			exp.DictExpireAt[field] = expireAt
+		}
+	}
+	if i.kind == ZSet {
+		exp.ZSet = make(map[string]float64, len(i.zset.dict))
+		for member, score := range i.zset.dict {
+			exp.ZSet[member] = score
+		}
+	}
+
+	i.frozen = exp
+	atomic.StoreInt64(&i.epoch, epoch)
+}
+
+// release drops the preserved content of the item, which isn't captured by the snapshot of the epoch anymore
+func (i *Item) release(epoch int64) {
+	i.RWMutex.Lock()
+	i.frozen = nil
+	atomic.StoreInt64(&i.epoch, epoch)
+	i.RWMutex.Unlock()
+}
@@ -0,0 +1,155 @@
+package core_test
+
+import (
+	"bytes"
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/core"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// persistedContent persists the snapshot, loads it into new storage and returns content of its items
+func persistedContent(t *testing.T, snapshot *Snapshot, newStorage func() testedStorage) map[string]string {
+	buf := &bytes.Buffer{}
+	if err := snapshot.Persist(buf, 1); err != nil {
+		t.Fatalf("Persist(): %s", err)
+	}
+
+	loading := newStorage()
+	if _, err := loading.Load(buf); err != nil {
+		t.Fatalf("Load(): %s", err)
+	}
+
+	content := make(map[string]string)
+	for key, item := range loading.Data() {
+		content[key] = item.String()
+	}
+
+	return content
+}
+
+func TestSnapshot_Persist(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		e := newStorage()
+		c := New(e)
+		c.Set("bytes", []byte("value"))
+		c.DSet("dict", [][]byte{[]byte("field"), []byte("value")})
+		c.RPush("list", [][]byte{[]byte("a"), []byte("b")})
+		c.SAdd("set", []string{"a", "b"})
+		c.ZAdd("zset", []string{"1", "a", "2", "b"})
+		c.Set("removed", []byte("value"))
+
+		want := persistedContent(t, e.Snapshot(), newStorage)
+
+		snapshot := e.Snapshot()
+		if snapshot.Len() != len(want) {
+			t.Errorf("Len(): %d != %d", snapshot.Len(), len(want))
+		}
+
+		// modifications after the snapshot is taken don't get into it
+		c.SetRange("bytes", 0, []byte("VALUE"))
+		c.DSet("dict", [][]byte{[]byte("field"), []byte("new"), []byte("other"), []byte("new")})
+		c.RPush("list", [][]byte{[]byte("c")})
+		c.SAdd("set", []string{"c"})
+		c.ZAdd("zset", []string{"3", "a"})
+		c.Del([]string{"removed"})
+		c.Set("added", []byte("value"))
+
+		if diff := deep.Equal(persistedContent(t, snapshot, newStorage), want); diff != nil {
+			t.Errorf("Persist() of the snapshot: %s", diff)
+		}
+
+		// the next snapshot contains the modifications
+		got := persistedContent(t, e.Snapshot(), newStorage)
+		if got["bytes"] != "VALUE" || got["added"] != "value" || len(got) != len(want) {
+			t.Errorf("Persist() of the next snapshot: %q", got)
+		}
+	})
+}
+
+func TestSnapshot_PointInTime(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		for attempt := 0; attempt < 20; attempt++ {
+			e := newStorage()
+			c := New(e)
+			keys := make([]string, 3000)
+			for i := range keys {
+				keys[i] = "key" + strconv.Itoa(i)
+				c.Set(keys[i], []byte("old"))
+			}
+
+			// keys are replaced, modified in place and removed one by one, while the snapshot is taken
+			started := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				close(started)
+				for i, key := range keys {
+					switch i % 3 {
+					case 0:
+						c.Set(key, []byte("new"))
+					case 1:
+						c.SetRange(key, 0, []byte("new"))
+					case 2:
+						c.Del([]string{key})
+					}
+				}
+			}()
+
+			<-started
+			snapshot := e.Snapshot()
+			<-done
+			content := persistedContent(t, snapshot, newStorage)
+
+			// the snapshot is point-in-time, so the keys, modified after it's taken, follow the modified ones
+			modified := 0
+			for modified < len(keys) && content[keys[modified]] != "old" {
+				modified++
+			}
+			for _, key := range keys[modified:] {
+				if content[key] != "old" {
+					t.Fatalf("%s is modified after unmodified %s: %q", key, keys[modified], content[key])
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkStorageHash_SetWhilePersisting(b *testing.B) {
+	s := GetFilledStorageHash(100000)
+	c := New(s)
+
+	// the storage is persisted again and again, while the keys are modified
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	persisted := 0
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				s.Persist(ioutil.Discard, 0)
+				persisted++
+			}
+		}
+	}()
+
+	keys := s.Keys()
+	value := []byte(time.Now().String())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Set(keys[i%len(keys)], value)
+	}
+	b.StopTimer()
+
+	close(stop)
+	<-done
+	b.Logf("%d sets, %d snapshots persisted meanwhile", b.N, persisted)
+}
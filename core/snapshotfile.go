@@ -0,0 +1,205 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Snapshot file format, all integers are little-endian:
+//   header:   snapshotMagic, version uint16, lastMessageId int64, CRC32 of the previous header bytes uint32
+//   sections: payload length uint32, CRC32 of the payload uint32, payload: gob stream of up to snapshotSectionItems items
+//   trailer:  zero length uint32, CRC32 of the count uint32, count of the items in all sections uint64
+// Every section is an independent gob stream, so it's verified and decoded separately.
+// Snapshots, written before the format was versioned, are bare gob streams of lastMessageId followed by the items
+const (
+	snapshotMagic        = "RADISHSN"
+	snapshotVersion      = 1
+	snapshotHeaderSize   = len(snapshotMagic) + 2 + 8 + 4
+	snapshotSectionItems = 1024
+)
+
+var (
+	ErrSnapshotVersion   = errors.New("unsupported snapshot version")
+	ErrSnapshotChecksum  = errors.New("snapshot checksum mismatch")
+	ErrSnapshotTruncated = errors.New("snapshot is truncated")
+	ErrSnapshotCount     = errors.New("snapshot items count mismatch")
+)
+
+// snapshotWriter writes items into the snapshot file, collecting them into checksummed sections
+type snapshotWriter struct {
+	w       io.Writer
+	section bytes.Buffer
+	encoder *gob.Encoder
+	// items is count of the items in the current section, count is count of the items in all sections
+	items int
+	count uint64
+}
+
+// newSnapshotWriter writes the snapshot header and returns the writer of the items
+func newSnapshotWriter(w io.Writer, lastMessageId int64) (sw *snapshotWriter, err error) {
+	header := make([]byte, snapshotHeaderSize)
+	copy(header, snapshotMagic)
+	binary.LittleEndian.PutUint16(header[len(snapshotMagic):], snapshotVersion)
+	binary.LittleEndian.PutUint64(header[len(snapshotMagic)+2:], uint64(lastMessageId))
+	binary.LittleEndian.PutUint32(header[snapshotHeaderSize-4:], crc32.ChecksumIEEE(header[:snapshotHeaderSize-4]))
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &snapshotWriter{w: w}, nil
+}
+
+// write encodes the item into the current section, the section is written, when it's full
+func (sw *snapshotWriter) write(exp *gobExportItem) error {
+	if sw.encoder == nil {
+		sw.encoder = gob.NewEncoder(&sw.section)
+	}
+
+	if err := sw.encoder.Encode(exp); err != nil {
+		return err
+	}
+
+	sw.items++
+	sw.count++
+	if sw.items == snapshotSectionItems {
+		return sw.flush()
+	}
+
+	return nil
+}
+
+// close writes the last section and the trailer
+func (sw *snapshotWriter) close() error {
+	if err := sw.flush(); err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 16)
+	binary.LittleEndian.PutUint64(trailer[8:], sw.count)
+	binary.LittleEndian.PutUint32(trailer[4:], crc32.ChecksumIEEE(trailer[8:]))
+	_, err := sw.w.Write(trailer)
+
+	return err
+}
+
+// flush writes the current section, if it's not empty
+func (sw *snapshotWriter) flush() error {
+	if sw.items == 0 {
+		return nil
+	}
+
+	head := make([]byte, 8)
+	binary.LittleEndian.PutUint32(head, uint32(sw.section.Len()))
+	binary.LittleEndian.PutUint32(head[4:], crc32.ChecksumIEEE(sw.section.Bytes()))
+	if _, err := sw.w.Write(head); err != nil {
+		return err
+	}
+	if _, err := sw.w.Write(sw.section.Bytes()); err != nil {
+		return err
+	}
+
+	sw.section.Reset()
+	sw.encoder, sw.items = nil, 0
+
+	return nil
+}
+
+// readSnapshot verifies the snapshot, written by Snapshot.Persist(), and calls add for every decoded item.
+// Sections are verified before decoding, so items of a corrupted section are never added,
+// but items of the previous sections are already added, when an error is returned
+func readSnapshot(r io.Reader, add func(exp *gobExportItem)) (lastMessageId int64, err error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(len(snapshotMagic)); err != nil || string(magic) != snapshotMagic {
+		return readLegacySnapshot(br, add)
+	}
+
+	header := make([]byte, snapshotHeaderSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return 0, ErrSnapshotTruncated
+	}
+	if crc32.ChecksumIEEE(header[:snapshotHeaderSize-4]) != binary.LittleEndian.Uint32(header[snapshotHeaderSize-4:]) {
+		return 0, ErrSnapshotChecksum
+	}
+	if binary.LittleEndian.Uint16(header[len(snapshotMagic):]) != snapshotVersion {
+		return 0, ErrSnapshotVersion
+	}
+	lastMessageId = int64(binary.LittleEndian.Uint64(header[len(snapshotMagic)+2:]))
+
+	var count uint64
+	section := &bytes.Buffer{}
+	head := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(br, head); err != nil {
+			return 0, ErrSnapshotTruncated
+		}
+
+		length, checksum := binary.LittleEndian.Uint32(head), binary.LittleEndian.Uint32(head[4:])
+		if length == 0 {
+			break
+		}
+
+		// the buffer grows while the data is read, so a corrupted length can't allocate more memory than the file has
+		section.Reset()
+		if _, err := io.CopyN(section, br, int64(length)); err != nil {
+			return 0, ErrSnapshotTruncated
+		}
+		if crc32.ChecksumIEEE(section.Bytes()) != checksum {
+			return 0, ErrSnapshotChecksum
+		}
+
+		decoder := gob.NewDecoder(section)
+		for {
+			exp := new(gobExportItem)
+			if err := decoder.Decode(exp); err == io.EOF {
+				break
+			} else if err != nil {
+				return 0, fmt.Errorf("can't decode item: %s", err)
+			}
+
+			add(exp)
+			count++
+		}
+	}
+
+	trailer := make([]byte, 8)
+	if _, err := io.ReadFull(br, trailer); err != nil {
+		return 0, ErrSnapshotTruncated
+	}
+	if crc32.ChecksumIEEE(trailer) != binary.LittleEndian.Uint32(head[4:]) {
+		return 0, ErrSnapshotChecksum
+	}
+	if binary.LittleEndian.Uint64(trailer) != count {
+		return 0, ErrSnapshotCount
+	}
+
+	return lastMessageId, nil
+}
+
+// readLegacySnapshot reads the snapshot, written before the format was versioned
+func readLegacySnapshot(r io.Reader, add func(exp *gobExportItem)) (lastMessageId int64, err error) {
+	decoder := gob.NewDecoder(r)
+
+	if err := decoder.Decode(&lastMessageId); err != nil {
+		return 0, fmt.Errorf("can't decode messageId: %s", err)
+	}
+
+	exp := new(gobExportItem)
+	for err := decoder.Decode(exp); err != io.EOF; err = decoder.Decode(exp) {
+		if err != nil {
+			return 0, fmt.Errorf("can't decode item: %s", err)
+		}
+
+		add(exp)
+
+		exp = new(gobExportItem)
+	}
+
+	return lastMessageId, nil
+}
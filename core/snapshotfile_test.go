@@ -0,0 +1,88 @@
+package core_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	. "github.com/mshaverdo/radish/core"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotFile_Load(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		persisting := newStorage()
+		for i := 0; i < 3000; i++ {
+			persisting.AddOrReplaceOne(fmt.Sprintf("key_%d", i), NewItemString("value"))
+		}
+
+		buf := &bytes.Buffer{}
+		if err := persisting.Persist(buf, 42); err != nil {
+			t.Fatalf("Persist(): %s", err)
+		}
+		data := buf.Bytes()
+
+		loading := newStorage()
+		if messageId, err := loading.Load(bytes.NewReader(data)); err != nil || messageId != 42 || loading.Len() != 3000 {
+			t.Errorf("Load(): messageId %d, len %d, err %v", messageId, loading.Len(), err)
+		}
+
+		// withChecksum recomputes the checksum at offset of the bytes at [from, to)
+		withChecksum := func(data []byte, offset, from, to int) []byte {
+			binary.LittleEndian.PutUint32(data[offset:], crc32.ChecksumIEEE(data[from:to]))
+			return data
+		}
+
+		tests := []struct {
+			name    string
+			corrupt func(data []byte) []byte
+			err     error
+		}{
+			{"header", func(data []byte) []byte { data[12]++; return data }, ErrSnapshotChecksum},
+			{"version", func(data []byte) []byte { data[8]++; return withChecksum(data, 18, 0, 18) }, ErrSnapshotVersion},
+			{"section", func(data []byte) []byte { data[len(data)/2]++; return data }, ErrSnapshotChecksum},
+			{"truncated section", func(data []byte) []byte { return data[:len(data)/2] }, ErrSnapshotTruncated},
+			{"truncated trailer", func(data []byte) []byte { return data[:len(data)-4] }, ErrSnapshotTruncated},
+			{"trailer", func(data []byte) []byte { data[len(data)-1]++; return data }, ErrSnapshotChecksum},
+			{"count", func(data []byte) []byte {
+				data[len(data)-8]++
+				return withChecksum(data, len(data)-12, len(data)-8, len(data))
+			}, ErrSnapshotCount},
+		}
+
+		for _, tst := range tests {
+			corrupted := tst.corrupt(append([]byte{}, data...))
+			_, err := newStorage().Load(bytes.NewReader(corrupted))
+			if err == nil || !strings.Contains(err.Error(), tst.err.Error()) {
+				t.Errorf("Load() of corrupted %s: %v != %v", tst.name, err, tst.err)
+			}
+		}
+	})
+}
+
+func TestSnapshotFile_LoadLegacy(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		data := getSampleDataStorageHash()
+		buf := &bytes.Buffer{}
+		if err := WriteLegacySnapshot(buf, 42, data); err != nil {
+			t.Fatalf("WriteLegacySnapshot(): %s", err)
+		}
+
+		loading := newStorage()
+		messageId, err := loading.Load(buf)
+		if err != nil || messageId != 42 {
+			t.Fatalf("Load(): messageId %d, err %v", messageId, err)
+		}
+
+		got := loading.Data()
+		if len(got) != len(data) {
+			t.Errorf("Load(): len %d != %d", len(got), len(data))
+		}
+		for key, item := range data {
+			if got[key] == nil || got[key].String() != item.String() {
+				t.Errorf("Load(): %q: %v != %v", key, got[key], item)
+			}
+		}
+	})
+}
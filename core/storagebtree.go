@@ -0,0 +1,454 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/google/btree"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	btreeDegree = 32
+
+	// keyPrefixLen is length of the key prefix, used to interpolate keys by RandomKey()
+	keyPrefixLen = 7
+
+	// cursorSlotBits is count of the low bits of the Scan() cursor, which are index of the slot in btreeCursors.
+	// The rest bits are the first bytes of the next key, so the cursor remains valid after the slot is reused
+	cursorSlotBits = 14
+	cursorSlots    = 1 << cursorSlotBits
+)
+
+// StorageBTree keeps keys in lexicographic order, so besides the Storage operations it supports iteration
+// over key ranges, see AscendRange(). It's slower than StorageHash, because all keys are guarded by the single lock
+type StorageBTree struct {
+	// approximate memory in bytes, used by keys and items, see attachItem().
+	// It's the first field to guarantee 64-bit alignment for atomic operations
+	usedMemory int64
+
+	// epoch is the snapshot epoch counter, see Snapshot()
+	epoch snapshotEpoch
+
+	mu sync.RWMutex
+
+	data *btree.BTree
+
+	// volatile is the index of keys with TTL, so expired items are collected without scanning all the keys
+	volatile *btree.BTree
+
+	// dataCursors and volatileCursors keep the next keys of Scan() and ScanVolatile()
+	dataCursors, volatileCursors btreeCursors
+
+	// snapshotMu is locked while a Snapshot of the storage exists
+	snapshotMu sync.Mutex
+}
+
+var _ OrderedStorage = (*StorageBTree)(nil)
+
+// btreeEntry is the key and the item, stored in the tree. Entries of the volatile index have nil item
+type btreeEntry struct {
+	key  string
+	item *Item
+}
+
+// Less implements btree.Item
+func (e *btreeEntry) Less(than btree.Item) bool {
+	return e.key < than.(*btreeEntry).key
+}
+
+// btreeCursors maps Scan() cursors to the exact keys to continue iteration from. Slots are reused in round-robin,
+// so abandoned cursors don't leak memory. The cursor of the reused slot is continued from its key prefix
+type btreeCursors struct {
+	mu      sync.Mutex
+	counter int
+	slots   [cursorSlots]struct {
+		cursor int
+		key    string
+	}
+}
+
+// add returns new cursor to continue iteration from the key
+func (bc *btreeCursors) add(key string) (cursor int) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	slot := bc.counter % cursorSlots
+	bc.counter++
+
+	// the prefix is shifted to fit the slot index, keeping the cursor positive
+	cursor = int(keyPrefix(key)>>8<<cursorSlotBits|uint64(slot)) + 1
+	bc.slots[slot].cursor, bc.slots[slot].key = cursor, key
+	return cursor
+}
+
+// get returns the key to continue iteration from: the exact key, if the slot of the cursor isn't reused,
+// or the least key with the prefix, encoded into the cursor, otherwise
+func (bc *btreeCursors) get(cursor int) (key string) {
+	if cursor <= 0 {
+		return ""
+	}
+
+	slot := (cursor - 1) % cursorSlots
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.slots[slot].cursor == cursor {
+		return bc.slots[slot].key
+	}
+
+	return prefixKey(uint64(cursor-1) >> cursorSlotBits << 8)
+}
+
+// NewStorageBTree constructs new StorageBTree instance
+func NewStorageBTree() *StorageBTree {
+	return &StorageBTree{
+		data:     btree.New(btreeDegree),
+		volatile: btree.New(btreeDegree),
+	}
+}
+
+// Get returns reference to Item by key. If Item not exists, return nil
+func (e *StorageBTree) Get(key string) (item *Item) {
+	e.mu.RLock()
+	item = e.get(key)
+	e.mu.RUnlock()
+	return item
+}
+
+// Get returns *Items mapped to provided keys.
+func (e *StorageBTree) GetSubmap(keys []string) (submap map[string]*Item) {
+	submap = make(map[string]*Item, len(keys))
+
+	e.mu.RLock()
+	for _, key := range keys {
+		if item := e.get(key); item != nil {
+			submap[key] = item
+		}
+	}
+	e.mu.RUnlock()
+
+	return submap
+}
+
+// Keys returns all keys existing in the Storage in lexicographic order
+func (e *StorageBTree) Keys() (keys []string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	keys = make([]string, 0, e.data.Len())
+	e.data.Ascend(func(i btree.Item) bool {
+		keys = append(keys, i.(*btreeEntry).key)
+		return true
+	})
+
+	return keys
+}
+
+// AscendRange calls iterator for keys in the range [from, to) in lexicographic order, until iterator returns false.
+// Empty to means the range has no upper bound. The Storage is locked for reading during the iteration,
+// so iterator shouldn't modify the Storage
+func (e *StorageBTree) AscendRange(from, to string, iterator func(key string, item *Item) bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	iterate := func(i btree.Item) bool {
+		entry := i.(*btreeEntry)
+		return iterator(entry.key, entry.item)
+	}
+
+	if to == "" {
+		e.data.AscendGreaterOrEqual(&btreeEntry{key: from}, iterate)
+	} else {
+		e.data.AscendRange(&btreeEntry{key: from}, &btreeEntry{key: to}, iterate)
+	}
+}
+
+// Scan returns count keys in lexicographic order, beginning from the cursor, and the cursor to continue iteration.
+// The cursor refers to the next key, so it remains stable while keys are added or removed, see btreeCursors.
+// Returned cursor 0 means the iteration is finished
+func (e *StorageBTree) Scan(cursor, count int) (next int, keys []string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return scanTree(e.data, &e.dataCursors, cursor, count, func(key string) bool { return true })
+}
+
+// IndexVolatile adds key to the index of keys with TTL, scanned by ScanVolatile(). Items with TTL are indexed
+// when they are added to the Storage, so it should be called only after TTL is set to the stored item
+func (e *StorageBTree) IndexVolatile(key string) {
+	e.mu.Lock()
+	e.volatile.ReplaceOrInsert(&btreeEntry{key: key})
+	e.mu.Unlock()
+}
+
+// ScanVolatile works like Scan, but returns only indexed keys, which items have TTL or dict fields with TTL.
+// Keys, which items have no TTL anymore, are removed from the index
+func (e *StorageBTree) ScanVolatile(cursor, count int) (next int, keys []string) {
+	// the volatile flag is checked under the storage lock, so the key, which TTL is set after the check,
+	// is indexed again by IndexVolatile()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var stale []string
+	next, keys = scanTree(e.volatile, &e.volatileCursors, cursor, count, func(key string) bool {
+		if item := e.get(key); item != nil && item.isVolatile() {
+			return true
+		}
+
+		stale = append(stale, key)
+		return false
+	})
+
+	// the tree can't be modified during iteration
+	for _, key := range stale {
+		e.volatile.Delete(&btreeEntry{key: key})
+	}
+
+	return next, keys
+}
+
+// Len returns count of keys existing in the Storage
+func (e *StorageBTree) Len() (count int) {
+	e.mu.RLock()
+	count = e.data.Len()
+	e.mu.RUnlock()
+	return count
+}
+
+// UsedMemory returns approximate count of bytes, used by keys and items of the Storage
+func (e *StorageBTree) UsedMemory() (bytes int64) {
+	return atomic.LoadInt64(&e.usedMemory)
+}
+
+// RandomKey returns random key from the Storage, ok is false if the Storage is empty.
+// The tree has no random access, so the key, following a random point between the least and the greatest keys,
+// is returned. Keys aren't distributed uniformly, so it's just an approximation, like eviction sampling is
+func (e *StorageBTree) RandomKey() (key string, ok bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.data.Len() == 0 {
+		return "", false
+	}
+
+	min, max := e.data.Min().(*btreeEntry).key, e.data.Max().(*btreeEntry).key
+	common := 0
+	for common < len(min) && min[common] == max[common] {
+		common++
+	}
+
+	low, high := keyPrefix(min[common:]), keyPrefix(max[common:])
+	span := float64(high - low)
+	// every key follows the gap before it, so the least key gets an extra gap after the greatest key
+	offset := rand.Float64() * span * (1 + 1/float64(e.data.Len()))
+	if offset > span {
+		return min, true
+	}
+
+	pivot := &btreeEntry{key: min[:common] + prefixKey(low+uint64(offset))}
+	e.data.AscendGreaterOrEqual(pivot, func(i btree.Item) bool {
+		key = i.(*btreeEntry).key
+		return false
+	})
+
+	return key, true
+}
+
+// AddOrReplaceOne adds new or replaces one existing Item in the storage. It much faster than AddOrReplace with single items
+func (e *StorageBTree) AddOrReplaceOne(key string, item *Item) {
+	e.mu.Lock()
+	if old := e.get(key); old != nil {
+		e.detach(key, old)
+	}
+	e.attach(key, item)
+	e.mu.Unlock()
+}
+
+// CompareAndSwap replaces Item only if existing Item equals to old, nil old means key not exists in the storage
+// returns true if item was swapped
+func (e *StorageBTree) CompareAndSwap(key string, old, new *Item) (swapped bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.get(key) != old {
+		return false
+	}
+
+	if old != nil {
+		e.detach(key, old)
+	}
+	e.attach(key, new)
+	return true
+}
+
+// AtomicUpdate locks provided keys and calls update with Items mapped to these keys.
+// update may replace or remove (set nil) Items in the map, all changes are applied atomically.
+// Keys absent in the keys slice are ignored
+func (e *StorageBTree) AtomicUpdate(keys []string, update func(items map[string]*Item)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	items := make(map[string]*Item, len(keys))
+	for _, key := range keys {
+		if item := e.get(key); item != nil {
+			items[key] = item
+		}
+	}
+
+	update(items)
+
+	// replaced and removed items are detached first, so an item moved to another key is attached again
+	for _, key := range keys {
+		if existing := e.get(key); existing != nil && existing != items[key] {
+			e.detach(key, existing)
+		}
+	}
+
+	for _, key := range keys {
+		if item := items[key]; item != nil && e.get(key) != item {
+			e.attach(key, item)
+		}
+	}
+}
+
+// Del removes values from storage and returns count of actually removed values
+// if key not found in the storage, just skip it
+func (e *StorageBTree) Del(keys []string) (count int) {
+	e.mu.Lock()
+	for _, key := range keys {
+		if item := e.get(key); item != nil {
+			count++
+			e.detach(key, item)
+		}
+	}
+	e.mu.Unlock()
+
+	return count
+}
+
+// DelSubmap removes Items only if existing *Item equals to provided submap[key]
+// if key not found in the storage, just skip it and returns count of actually deleted items
+func (e *StorageBTree) DelSubmap(submap map[string]*Item) (count int) {
+	e.mu.Lock()
+	for key, item := range submap {
+		if existingItem := e.get(key); existingItem != nil && existingItem == item {
+			count++
+			e.detach(key, existingItem)
+		}
+	}
+	e.mu.Unlock()
+
+	return count
+}
+
+// Snapshot captures point-in-time content of the storage, which could be persisted, while the storage is modified.
+// The storage is locked only to start the snapshot epoch and to clone the tree, which is copy-on-write,
+// so the items are captured from the clone without locking
+func (e *StorageBTree) Snapshot() *Snapshot {
+	e.snapshotMu.Lock()
+
+	e.mu.Lock()
+	s := newSnapshot(&e.snapshotMu, &e.epoch, e.data.Len())
+	data := e.data.Clone()
+	e.mu.Unlock()
+
+	data.Ascend(func(i btree.Item) bool {
+		entry := i.(*btreeEntry)
+		s.capture(entry.key, entry.item)
+		return true
+	})
+
+	return s
+}
+
+// Persist dumps storage data into provided Writer, in the same format as StorageHash does.
+// Writes aren't blocked, see Snapshot()
+func (e *StorageBTree) Persist(w io.Writer, lastMessageId int64) error {
+	return e.Snapshot().Persist(w, lastMessageId)
+}
+
+// Load loads storage data from Reader, see readSnapshot()
+func (e *StorageBTree) Load(r io.Reader) (lastMessageId int64, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.data.Len() != 0 {
+		return 0, errors.New("StorageBTree.Load(): restore enabled only on empty storage")
+	}
+
+	e.volatile.Clear(false)
+
+	lastMessageId, err = readSnapshot(r, func(exp *gobExportItem) {
+		e.attach(exp.Key, importItem(exp))
+	})
+	if err != nil {
+		return 0, fmt.Errorf("StorageBTree.Load(): %s", err)
+	}
+
+	return lastMessageId, nil
+}
+
+// get returns the item by key, the storage should be locked
+func (e *StorageBTree) get(key string) *Item {
+	if i := e.data.Get(&btreeEntry{key: key}); i != nil {
+		return i.(*btreeEntry).item
+	}
+
+	return nil
+}
+
+// attach adds the item to the tree, the storage should be locked for writing,
+// and starts accounting of its memory usage. Item with TTL is added to the volatile index
+func (e *StorageBTree) attach(key string, item *Item) {
+	e.data.ReplaceOrInsert(&btreeEntry{key: key, item: item})
+	attachItem(&e.usedMemory, key, item)
+	attachEpoch(&e.epoch, item)
+	if item.isVolatile() {
+		e.volatile.ReplaceOrInsert(&btreeEntry{key: key})
+	}
+}
+
+// detach removes the item from the tree, the storage should be locked for writing, and from the volatile index
+func (e *StorageBTree) detach(key string, item *Item) {
+	e.data.Delete(&btreeEntry{key: key})
+	e.volatile.Delete(&btreeEntry{key: key})
+	detachItem(&e.usedMemory, key, item)
+}
+
+// scanTree returns count keys of the tree, accepted by filter, beginning from the cursor,
+// and the cursor to continue iteration, registered in cursors, see StorageBTree.Scan()
+func scanTree(tree *btree.BTree, cursors *btreeCursors, cursor, count int, filter func(key string) bool) (next int, keys []string) {
+	tree.AscendGreaterOrEqual(&btreeEntry{key: cursors.get(cursor)}, func(i btree.Item) bool {
+		key := i.(*btreeEntry).key
+		if len(keys) >= count {
+			next = cursors.add(key)
+			return false
+		}
+
+		if filter(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+
+	return next, keys
+}
+
+// keyPrefix returns first keyPrefixLen bytes of the key as a big-endian number
+func keyPrefix(key string) uint64 {
+	var buf [8]byte
+	copy(buf[8-keyPrefixLen:], key)
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+// prefixKey returns the least key, which prefix is greater or equal to the prefix, made by keyPrefix()
+func prefixKey(prefix uint64) string {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], prefix)
+	return strings.TrimRight(string(buf[8-keyPrefixLen:]), "\x00")
+}
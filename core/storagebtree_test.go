@@ -0,0 +1,121 @@
+package core_test
+
+import (
+	"fmt"
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/core"
+	"sort"
+	"testing"
+)
+
+func TestStorageBTree_AscendRange(t *testing.T) {
+	tests := []struct {
+		from, to string
+		limit    int
+		want     []string
+	}{
+		{"", "", 0, []string{"bytes", "dict", "list", "測"}},
+		{"dict", "測", 0, []string{"dict", "list"}},
+		{"c", "", 0, []string{"dict", "list", "測"}},
+		{"", "", 1, []string{"bytes"}},
+		{"m", "n", 0, nil},
+	}
+
+	e := NewStorageBTree()
+	e.SetData(getSampleDataStorageHash())
+
+	for _, tst := range tests {
+		var got []string
+		e.AscendRange(tst.from, tst.to, func(key string, item *Item) bool {
+			if item != e.Get(key) {
+				t.Errorf("AscendRange(%q, %q): wrong item of %q", tst.from, tst.to, key)
+			}
+			got = append(got, key)
+			return tst.limit == 0 || len(got) < tst.limit
+		})
+
+		if diff := deep.Equal(got, tst.want); diff != nil {
+			t.Errorf("AscendRange(%q, %q): %s\n\ngot:%v\n\nwant:%v", tst.from, tst.to, diff, got, tst.want)
+		}
+	}
+}
+
+func TestStorageBTree_ScanPrefix(t *testing.T) {
+	// keys share prefixes, longer than the prefix encoded into the cursor, but every page has no more than count keys
+	e := NewStorageBTree()
+	for i := 0; i < 1000; i++ {
+		e.AddOrReplaceOne(fmt.Sprintf("namespace:user:%04d", i), NewItemString("value"))
+	}
+	e.AddOrReplaceOne("namespace", NewItemString("value"))
+	e.AddOrReplaceOne("namespace:", NewItemString("value"))
+
+	var got []string
+	for cursor := 0; ; {
+		next, keys := e.Scan(cursor, 10)
+		if len(keys) > 10 {
+			t.Fatalf("Scan(%d, 10): %d keys returned", cursor, len(keys))
+		}
+		got = append(got, keys...)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	want := e.Keys()
+	if !sort.StringsAreSorted(got) {
+		t.Errorf("Scan(): keys aren't ordered")
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("Scan(): %s", diff)
+	}
+}
+
+func TestStorageBTree_ScanReusedCursor(t *testing.T) {
+	e := NewStorageBTree()
+	for i := 0; i < 100; i++ {
+		e.AddOrReplaceOne(fmt.Sprintf("namespace:user:%04d", i), NewItemString("value"))
+	}
+
+	cursor, got := e.Scan(0, 10)
+	// other scans reuse every slot of the cursors, so the iteration continues from the key prefix of the cursor
+	for i := 0; i < 1<<14; i++ {
+		e.Scan(0, 1)
+	}
+
+	for cursor != 0 {
+		next, keys := e.Scan(cursor, 10)
+		got = append(got, keys...)
+		cursor = next
+	}
+
+	returned := make(map[string]bool)
+	for _, key := range got {
+		returned[key] = true
+	}
+	for _, key := range e.Keys() {
+		if !returned[key] {
+			t.Errorf("Scan(): key %q isn't returned", key)
+		}
+	}
+}
+
+func TestStorageBTree_RandomKey(t *testing.T) {
+	e := NewStorageBTree()
+	for i := 0; i < 10; i++ {
+		e.AddOrReplaceOne(fmt.Sprintf("long common prefix of the keys %d", i), NewItemString("value"))
+	}
+
+	got := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		key, ok := e.RandomKey()
+		if !ok || e.Get(key) == nil {
+			t.Fatalf("RandomKey(): unexpected key %q", key)
+		}
+		got[key] = true
+	}
+
+	if len(got) != e.Len() {
+		t.Errorf("RandomKey(): only %d of %d keys returned", len(got), e.Len())
+	}
+}
@@ -1,12 +1,14 @@
 package core
 
 import (
-	"encoding/gob"
 	"errors"
 	"fmt"
 	"github.com/OneOfOne/xxhash"
 	"io"
+	"math/rand"
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -17,9 +19,30 @@ const (
 // hashmap sharding gives significant performance boost on wide keyspace
 // (up to 10x SET on 1M keys & 1k concurrent connects at octa-core cpu)
 type StorageHash struct {
+	// count of keys in all buckets, to avoid locking all the buckets in Len().
+	// It's the first field to guarantee 64-bit alignment for atomic operations
+	count int64
+
+	// approximate memory in bytes, used by keys and items, see attachItem()
+	usedMemory int64
+
+	// epoch is the snapshot epoch counter, see Snapshot()
+	epoch snapshotEpoch
+
 	mu [bucketsCount]sync.RWMutex
 
 	data [bucketsCount]map[string]*Item
+
+	// volatile is the index of keys with TTL, so expired items are collected without scanning all the keys
+	volatile [bucketsCount]map[string]struct{}
+
+	// snapshotMu is locked while a Snapshot of the storage exists
+	snapshotMu sync.Mutex
+
+	// snapshot is the Snapshot, which buckets aren't captured yet, and capturedEpoch is the last epoch,
+	// in which the bucket is captured. They are guarded by the bucket locks, see captureBucket()
+	snapshot      *Snapshot
+	capturedEpoch [bucketsCount]int64
 }
 
 // NewStorageHash constructs new  StorageHash instance
@@ -27,6 +50,7 @@ func NewStorageHash() *StorageHash {
 	s := &StorageHash{}
 	for i := range s.data {
 		s.data[i] = make(map[string]*Item)
+		s.volatile[i] = make(map[string]struct{})
 	}
 	return s
 }
@@ -88,14 +112,174 @@ func (e *StorageHash) Keys() (keys []string) {
 	return keys
 }
 
+// Scan returns keys of the next buckets, beginning from the cursor bucket, and the cursor to continue iteration.
+// Whole buckets are returned until count keys collected, so the cursor is just an index of the next bucket
+// and remains stable while keys are added or removed. Returned cursor 0 means the iteration is finished
+func (e *StorageHash) Scan(cursor, count int) (next int, keys []string) {
+	for b := cursor; b < bucketsCount; b++ {
+		if len(keys) >= count {
+			return b, keys
+		}
+
+		e.mu[b].RLock()
+		for k := range e.data[b] {
+			keys = append(keys, k)
+		}
+		e.mu[b].RUnlock()
+	}
+
+	return 0, keys
+}
+
+// IndexVolatile adds key to the index of keys with TTL, scanned by ScanVolatile(). Items with TTL are indexed
+// when they are added to the Storage, so it should be called only after TTL is set to the stored item
+func (e *StorageHash) IndexVolatile(key string) {
+	b := getBucket(key)
+	e.mu[b].Lock()
+	e.volatile[b][key] = struct{}{}
+	e.mu[b].Unlock()
+}
+
+// ScanVolatile works like Scan, but returns only indexed keys, which items have TTL or dict fields with TTL.
+// Keys, which items have no TTL anymore, are removed from the index
+func (e *StorageHash) ScanVolatile(cursor, count int) (next int, keys []string) {
+	for b := cursor; b < bucketsCount; b++ {
+		if len(keys) >= count {
+			return b, keys
+		}
+
+		// the volatile flag is checked under the bucket lock, so the key, which TTL is set after the check,
+		// is indexed again by IndexVolatile()
+		e.mu[b].Lock()
+		for k := range e.volatile[b] {
+			if item := e.data[b][k]; item != nil && item.isVolatile() {
+				keys = append(keys, k)
+			} else {
+				delete(e.volatile[b], k)
+			}
+		}
+		e.mu[b].Unlock()
+	}
+
+	return 0, keys
+}
+
+// Len returns count of keys existing in the Storage
+func (e *StorageHash) Len() (count int) {
+	return int(atomic.LoadInt64(&e.count))
+}
+
+// UsedMemory returns approximate count of bytes, used by keys and items of the Storage
+func (e *StorageHash) UsedMemory() (bytes int64) {
+	return atomic.LoadInt64(&e.usedMemory)
+}
+
+// RandomKey returns random key from the Storage, ok is false if the Storage is empty
+func (e *StorageHash) RandomKey() (key string, ok bool) {
+	start := rand.Intn(bucketsCount)
+	for i := 0; i < bucketsCount; i++ {
+		b := (start + i) % bucketsCount
+
+		e.mu[b].RLock()
+		// map iteration order is random, so the first key is random enough
+		for key = range e.data[b] {
+			ok = true
+			break
+		}
+		e.mu[b].RUnlock()
+
+		if ok {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
 // AddOrReplaceOne adds new or replaces one existing Item in the storage. It much faster than AddOrReplace with single items
 func (e *StorageHash) AddOrReplaceOne(key string, item *Item) {
 	b := getBucket(key)
 	e.mu[b].Lock()
-	e.data[b][key] = item
+	e.captureBucket(b)
+	if old, ok := e.data[b][key]; !ok {
+		atomic.AddInt64(&e.count, 1)
+	} else {
+		e.detach(b, key, old)
+	}
+	e.attach(b, key, item)
 	e.mu[b].Unlock()
 }
 
+// CompareAndSwap replaces Item only if existing Item equals to old, nil old means key not exists in the storage
+// returns true if item was swapped
+func (e *StorageHash) CompareAndSwap(key string, old, new *Item) (swapped bool) {
+	b := getBucket(key)
+	e.mu[b].Lock()
+	defer e.mu[b].Unlock()
+
+	if e.data[b][key] != old {
+		return false
+	}
+
+	e.captureBucket(b)
+	if old == nil {
+		atomic.AddInt64(&e.count, 1)
+	} else {
+		e.detach(b, key, old)
+	}
+	e.attach(b, key, new)
+	return true
+}
+
+// AtomicUpdate locks provided keys and calls update with Items mapped to these keys.
+// update may replace or remove (set nil) Items in the map, all changes are applied atomically.
+// Keys absent in the keys slice are ignored
+func (e *StorageHash) AtomicUpdate(keys []string, update func(items map[string]*Item)) {
+	buckets := make(map[int]struct{}, len(keys))
+	for _, key := range keys {
+		buckets[getBucket(key)] = struct{}{}
+	}
+
+	// lock buckets in ascending order, like Snapshot() does, to avoid deadlocks
+	locked := make([]int, 0, len(buckets))
+	for b := range buckets {
+		locked = append(locked, b)
+	}
+	sort.Ints(locked)
+
+	for _, b := range locked {
+		e.mu[b].Lock()
+		defer e.mu[b].Unlock()
+		e.captureBucket(b)
+	}
+
+	items := make(map[string]*Item, len(keys))
+	for _, key := range keys {
+		if item, ok := e.data[getBucket(key)][key]; ok {
+			items[key] = item
+		}
+	}
+
+	update(items)
+
+	// replaced and removed items are detached first, so an item moved to another key is attached again
+	for _, key := range keys {
+		b := getBucket(key)
+		if existing, ok := e.data[b][key]; ok && existing != items[key] {
+			atomic.AddInt64(&e.count, -1)
+			e.detach(b, key, existing)
+		}
+	}
+
+	for _, key := range keys {
+		b := getBucket(key)
+		if item := items[key]; item != nil && e.data[b][key] != item {
+			atomic.AddInt64(&e.count, 1)
+			e.attach(b, key, item)
+		}
+	}
+}
+
 // Del removes values from storage and returns count of actually removed values
 // if key not found in the storage, just skip it
 func (e *StorageHash) Del(keys []string) (count int) {
@@ -111,15 +295,17 @@ func (e *StorageHash) Del(keys []string) (count int) {
 		}
 
 		e.mu[b].Lock()
+		e.captureBucket(b)
 		for _, key := range bucketKeys {
-			if _, ok := e.data[b][key]; ok {
+			if item, ok := e.data[b][key]; ok {
 				count++
-				delete(e.data[b], key)
+				e.detach(b, key, item)
 			}
 		}
 		e.mu[b].Unlock()
 	}
 
+	atomic.AddInt64(&e.count, int64(-count))
 	return count
 }
 
@@ -138,50 +324,59 @@ func (e *StorageHash) DelSubmap(submap map[string]*Item) (count int) {
 		}
 
 		e.mu[b].Lock()
+		e.captureBucket(b)
 		for _, key := range bucketKeys {
 			if existingItem, ok := e.data[b][key]; ok && existingItem == submap[key] {
 				count++
-				delete(e.data[b], key)
+				e.detach(b, key, existingItem)
 			}
 		}
 		e.mu[b].Unlock()
 	}
 
+	atomic.AddInt64(&e.count, int64(-count))
 	return count
 }
 
-// Persist dumps storage storage data into provided Writer
-func (e *StorageHash) Persist(w io.Writer, lastMessageId int64) error {
-	e.fullLock()
-	defer e.fullUnlock()
-
-	encoder := gob.NewEncoder(w)
+// Snapshot captures point-in-time content of the storage, which could be persisted, while the storage is modified.
+// All the buckets are locked only to start the snapshot epoch, then they are captured one by one. A bucket,
+// modified before it's captured, is captured by the writer, see captureBucket()
+func (e *StorageHash) Snapshot() *Snapshot {
+	e.snapshotMu.Lock()
 
-	if err := encoder.Encode(lastMessageId); err != nil {
-		return fmt.Errorf("StorageHash.Persist(): can't encode messageId: %s", err)
+	// all the buckets are locked at once in ascending order, like AtomicUpdate() does, to start the epoch
+	// at the same moment for all of them
+	for b := range e.data {
+		e.mu[b].RLock()
+	}
+	s := newSnapshot(&e.snapshotMu, &e.epoch, e.Len())
+	e.snapshot = s
+	for b := range e.data {
+		e.mu[b].RUnlock()
 	}
 
-	exp := &gobExportItem{}
-	for _, bucketData := range e.data {
-		for k, v := range bucketData {
-			exp.Key = k
-			exp.ExpireAt = v.expireAt
-			exp.Kind = v.kind
-			exp.Bytes = v.bytes
-			exp.List = v.list
-			exp.Dict = v.dict
+	for b := range e.data {
+		e.mu[b].Lock()
+		e.captureBucket(b)
+		e.mu[b].Unlock()
+	}
 
-			if err := encoder.Encode(exp); err != nil {
-				return fmt.Errorf("StorageHash.Persist(): can't encode item: %s", err)
-				return err
-			}
-		}
+	// all the buckets are captured, so the writers don't access the snapshot anymore
+	for b := range e.data {
+		e.mu[b].Lock()
+		e.snapshot = nil
+		e.mu[b].Unlock()
 	}
 
-	return nil
+	return s
 }
 
-// Load loads storage storage data from Reader
+// Persist dumps storage storage data into provided Writer. Writes aren't blocked, see Snapshot()
+func (e *StorageHash) Persist(w io.Writer, lastMessageId int64) error {
+	return e.Snapshot().Persist(w, lastMessageId)
+}
+
+// Load loads storage storage data from Reader, see readSnapshot()
 func (e *StorageHash) Load(r io.Reader) (lastMessageId int64, err error) {
 	for b := range e.data {
 		e.mu[b].Lock()
@@ -192,51 +387,49 @@ func (e *StorageHash) Load(r io.Reader) (lastMessageId int64, err error) {
 		}
 
 		e.data[b] = make(map[string]*Item)
+		e.volatile[b] = make(map[string]struct{})
 	}
 
-	decoder := gob.NewDecoder(r)
-
-	if err := decoder.Decode(&lastMessageId); err != nil {
-		return 0, fmt.Errorf("StorageHash.Load(): can't decode messageId: %s", err)
+	lastMessageId, err = readSnapshot(r, func(exp *gobExportItem) {
+		e.attach(getBucket(exp.Key), exp.Key, importItem(exp))
+		atomic.AddInt64(&e.count, 1)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("StorageHash.Load(): %s", err)
 	}
 
-	exp := new(gobExportItem)
-	for err := decoder.Decode(exp); err != io.EOF; err = decoder.Decode(exp) {
-		if err != nil {
-			return 0, fmt.Errorf("StorageHash.Load(): can't decode item: %s", err)
-		}
-
-		bucket := e.data[getBucket(exp.Key)]
-		bucket[exp.Key] = new(Item)
-		bucket[exp.Key].expireAt = exp.ExpireAt
-		bucket[exp.Key].kind = exp.Kind
-		bucket[exp.Key].bytes = exp.Bytes
-		bucket[exp.Key].list = exp.List
-		bucket[exp.Key].dict = exp.Dict
+	return lastMessageId, nil
+}
 
-		exp = new(gobExportItem)
+// attach adds the item to the bucket, which should be locked for writing,
+// and starts accounting of its memory usage. Item with TTL is added to the volatile index
+func (e *StorageHash) attach(b int, key string, item *Item) {
+	e.data[b][key] = item
+	attachItem(&e.usedMemory, key, item)
+	attachEpoch(&e.epoch, item)
+	if item.isVolatile() {
+		e.volatile[b][key] = struct{}{}
 	}
+}
 
-	return lastMessageId, nil
+// detach removes the item from the bucket, which should be locked for writing, and from the volatile index
+func (e *StorageHash) detach(b int, key string, item *Item) {
+	delete(e.data[b], key)
+	delete(e.volatile[b], key)
+	detachItem(&e.usedMemory, key, item)
 }
 
-// FullLock locks storage and all items to ensure exclusive access to its content
-func (e *StorageHash) fullLock() {
-	for b := range e.data {
-		e.mu[b].Lock()
-		for _, v := range e.data[b] {
-			v.Lock()
-		}
+// captureBucket adds items of the bucket, which should be locked for writing, to the snapshot,
+// if the bucket isn't captured in the current epoch yet. It should be called before the bucket is modified
+func (e *StorageHash) captureBucket(b int) {
+	epoch := atomic.LoadInt64(&e.epoch.current)
+	if epoch == 0 || e.capturedEpoch[b] == epoch {
+		return
 	}
-}
 
-// FullUnlock unlocks storage and all items
-func (e *StorageHash) fullUnlock() {
-	for b := range e.data {
-		for _, v := range e.data[b] {
-			v.Unlock()
-		}
-		e.mu[b].Unlock()
+	e.capturedEpoch[b] = epoch
+	for k, v := range e.data[b] {
+		e.snapshot.capture(k, v)
 	}
 }
 
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/go-test/deep"
 	. "github.com/mshaverdo/radish/core"
+	"io"
 	"io/ioutil"
 	"math"
 	"math/rand"
@@ -17,6 +18,34 @@ import (
 	"time"
 )
 
+// testedStorage is a storage engine, tested by the suite
+type testedStorage interface {
+	Storage
+	Persist(w io.Writer, lastMessageId int64) error
+	Snapshot() *Snapshot
+	Load(r io.Reader) (lastMessageId int64, err error)
+	SetData(data map[string]*Item)
+	Data() map[string]*Item
+}
+
+// storageEngines are constructors of the storage engines, every test of the suite runs against each of them
+var storageEngines = []struct {
+	name string
+	new  func() testedStorage
+}{
+	{"StorageHash", func() testedStorage { return NewStorageHash() }},
+	{"StorageBTree", func() testedStorage { return NewStorageBTree() }},
+}
+
+// forEachEngine runs the test against every storage engine
+func forEachEngine(t *testing.T, test func(t *testing.T, newStorage func() testedStorage)) {
+	for _, engine := range storageEngines {
+		t.Run(engine.name, func(t *testing.T) {
+			test(t, engine.new)
+		})
+	}
+}
+
 func getSampleDataStorageHash() map[string]*Item {
 	return map[string]*Item{
 		"bytes": NewItemBytes([]byte("Призрак бродит по Европе - призрак коммунизма.")),
@@ -33,182 +62,406 @@ func getSampleDataStorageHash() map[string]*Item {
 	}
 }
 
-func TestStorageHash_Get(t *testing.T) {
-	data := getSampleDataStorageHash()
-	e := NewStorageHash()
-	e.SetData(data)
-
-	for key, item := range data {
-		got := e.Get(key)
-		if got != item {
-			t.Errorf("Get(%q): got %p want %p (values: %q, %q)", key, got, item, got, item)
+func TestStorage_Get(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		data := getSampleDataStorageHash()
+		e := newStorage()
+		e.SetData(data)
+
+		for key, item := range data {
+			got := e.Get(key)
+			if got != item {
+				t.Errorf("Get(%q): got %p want %p (values: %q, %q)", key, got, item, got, item)
+			}
 		}
-	}
+	})
 }
 
-func TestStorageHash_GetSubmap(t *testing.T) {
-	data := getSampleDataStorageHash()
-
-	tests := []struct {
-		keys []string
-		want map[string]*Item
-	}{
-		{
-			[]string{"bytes", "dict", "測", "404"},
-			map[string]*Item{"bytes": data["bytes"], "dict": data["dict"], "測": data["測"]},
-		},
-	}
+func TestStorage_GetSubmap(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		data := getSampleDataStorageHash()
+
+		tests := []struct {
+			keys []string
+			want map[string]*Item
+		}{
+			{
+				[]string{"bytes", "dict", "測", "404"},
+				map[string]*Item{"bytes": data["bytes"], "dict": data["dict"], "測": data["測"]},
+			},
+		}
 
-	e := NewStorageHash()
-	e.SetData(data)
+		e := newStorage()
+		e.SetData(data)
 
-	for _, tst := range tests {
-		got := e.GetSubmap(tst.keys)
-		if !reflect.DeepEqual(got, tst.want) {
-			t.Errorf("GetSubmap(%q): \ngot:%v\n\nwant:%v", tst.keys, got, tst.want)
+		for _, tst := range tests {
+			got := e.GetSubmap(tst.keys)
+			if !reflect.DeepEqual(got, tst.want) {
+				t.Errorf("GetSubmap(%q): \ngot:%v\n\nwant:%v", tst.keys, got, tst.want)
+			}
 		}
-	}
+	})
 }
 
-func TestStorageHash_AddOrReplaceOne(t *testing.T) {
-	tests := map[string]*Item{
-		"測試": NewItemBytes([]byte("value of 測試")), "list": NewItemBytes([]byte("value of list")),
-	}
-	data := getSampleDataStorageHash()
-	e := NewStorageHash()
-	e.SetData(data)
+func TestStorage_AddOrReplaceOne(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		tests := map[string]*Item{
+			"測試": NewItemBytes([]byte("value of 測試")), "list": NewItemBytes([]byte("value of list")),
+		}
+		data := getSampleDataStorageHash()
+		e := newStorage()
+		e.SetData(data)
 
-	for key, item := range tests {
-		e.AddOrReplaceOne(key, item)
-		got := e.Get(key)
-		if got != item {
-			t.Errorf("Get(%q): got %p want %p (values: %q, %q)", key, got, item, got, item)
+		for key, item := range tests {
+			e.AddOrReplaceOne(key, item)
+			got := e.Get(key)
+			if got != item {
+				t.Errorf("Get(%q): got %p want %p (values: %q, %q)", key, got, item, got, item)
+			}
 		}
-	}
+	})
 }
 
-func TestStorageHash_Keys(t *testing.T) {
-	data := getSampleDataStorageHash()
-	e := NewStorageHash()
-	e.SetData(data)
+func TestStorage_CompareAndSwap(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		data := getSampleDataStorageHash()
+		newItem := NewItemBytes([]byte("new"))
+
+		tests := []struct {
+			key         string
+			old         *Item
+			wantSwapped bool
+			wantItem    *Item
+		}{
+			{"bytes", data["list"], false, data["bytes"]},
+			{"bytes", nil, false, data["bytes"]},
+			{"bytes", data["bytes"], true, newItem},
+			{"404", data["list"], false, nil},
+			{"404", nil, true, newItem},
+		}
 
-	var want []string
-	for key := range data {
-		want = append(want, key)
-	}
+		e := newStorage()
+		e.SetData(data)
 
-	got := e.Keys()
-	sort.Strings(got)
-	sort.Strings(want)
+		for _, tst := range tests {
+			swapped := e.CompareAndSwap(tst.key, tst.old, newItem)
+			if swapped != tst.wantSwapped {
+				t.Errorf("CompareAndSwap(%q) swapped: %v != %v", tst.key, swapped, tst.wantSwapped)
+			}
 
-	if diff := deep.Equal(got, want); diff != nil {
-		t.Errorf("Keys(): %s\n\ngot:%v\n\nwant:%v", diff, got, want)
-	}
+			if got := e.Get(tst.key); got != tst.wantItem {
+				t.Errorf("CompareAndSwap(%q): got %p want %p (values: %q, %q)", tst.key, got, tst.wantItem, got, tst.wantItem)
+			}
+		}
+	})
 }
 
-func TestStorageHash_Del(t *testing.T) {
-	tests := []struct {
-		keys, want []string
-	}{
-		{[]string{"404", "測"}, []string{"bytes", "dict", "list"}},
-		{[]string{"bytes", "dict"}, []string{"list"}},
-	}
+func TestStorage_AtomicUpdate(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		data := getSampleDataStorageHash()
+		newItem := NewItemBytes([]byte("new"))
+
+		e := newStorage()
+		e.SetData(data)
+
+		e.AtomicUpdate([]string{"bytes", "list", "404", "new"}, func(items map[string]*Item) {
+			want := map[string]*Item{"bytes": data["bytes"], "list": data["list"]}
+			if !reflect.DeepEqual(items, want) {
+				t.Errorf("AtomicUpdate() items: \ngot:%v\n\nwant:%v", items, want)
+			}
+
+			items["new"] = items["bytes"]
+			items["bytes"] = nil
+			items["404"] = newItem
+			items["dict"] = nil // not in keys, should be ignored
+		})
+
+		want := map[string]*Item{"new": data["bytes"], "list": data["list"], "404": newItem, "dict": data["dict"], "測": data["測"]}
+		if got := e.Data(); !reflect.DeepEqual(got, want) {
+			t.Errorf("AtomicUpdate(): \ngot:%v\n\nwant:%v", got, want)
+		}
+	})
+}
 
-	data := getSampleDataStorageHash()
-	e := NewStorageHash()
-	e.SetData(data)
+func TestStorage_Keys(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		data := getSampleDataStorageHash()
+		e := newStorage()
+		e.SetData(data)
 
-	for _, tst := range tests {
-		e.Del(tst.keys)
-		got := e.Keys()
+		var want []string
+		for key := range data {
+			want = append(want, key)
+		}
 
+		got := e.Keys()
 		sort.Strings(got)
-		sort.Strings(tst.want)
-		if diff := deep.Equal(got, tst.want); diff != nil {
-			t.Errorf("Del(): %s\n\ngot:%v\n\nwant:%v", diff, got, tst.want)
+		sort.Strings(want)
+
+		if diff := deep.Equal(got, want); diff != nil {
+			t.Errorf("Keys(): %s\n\ngot:%v\n\nwant:%v", diff, got, want)
 		}
-	}
+	})
 }
 
-func TestStorageHash_DelSubmap(t *testing.T) {
-	data := getSampleDataStorageHash()
-
-	tests := []struct {
-		submap    map[string]*Item
-		wantCount int
-		wantKeys  []string
-	}{
-		{
-			map[string]*Item{"404": nil, "測": data["bytes"], "list": data["list"]},
-			1,
-			[]string{"bytes", "dict", "測"},
-		},
-		{
-			map[string]*Item{"測": nil, "dict": data["dict"], "bytes": data["bytes"]},
-			2,
-			[]string{"測"},
-		},
-	}
+func TestStorage_Scan(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		e := newStorage()
+		for i := 0; i < 10000; i++ {
+			e.AddOrReplaceOne(fmt.Sprintf("key_%d", i), NewItemString("value"))
+		}
 
-	e := NewStorageHash()
-	e.SetData(data)
+		seen := make(map[string]int)
+		calls := 0
+		for cursor := 0; ; {
+			next, keys := e.Scan(cursor, 100)
+			calls++
+			if next != 0 && len(keys) < 100 {
+				t.Errorf("Scan(%d, 100): %d keys returned in the middle of iteration", cursor, len(keys))
+			}
+
+			for _, key := range keys {
+				seen[key]++
+			}
+
+			// keys, added or removed during iteration, must not break the cursor
+			e.Del([]string{fmt.Sprintf("key_%d", 9999-calls)})
+			e.AddOrReplaceOne(fmt.Sprintf("new_%d", calls), NewItemString("value"))
+
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
 
-	for _, tst := range tests {
-		count := e.DelSubmap(tst.submap)
-		got := e.Keys()
+		for i := 0; i < 10000-calls; i++ {
+			if key := fmt.Sprintf("key_%d", i); seen[key] != 1 {
+				t.Errorf("Scan(): key %q returned %d times", key, seen[key])
+			}
+		}
+		if calls < 10000/100/2 || calls > 10000/100*2 {
+			t.Errorf("Scan(): unexpected count of calls: %d", calls)
+		}
+	})
+}
+
+func TestStorage_ScanVolatile(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		e := newStorage()
+		for i := 0; i < 1000; i++ {
+			e.AddOrReplaceOne(fmt.Sprintf("key_%d", i), NewItemString("value"))
+		}
+
+		volatile := NewItemString("value")
+		volatile.SetTtl(100)
+		e.AddOrReplaceOne("volatile", volatile)
+		e.AtomicUpdate([]string{"volatile", "renamed"}, func(items map[string]*Item) {
+			items["renamed"], items["volatile"] = items["volatile"], nil
+		})
+
+		fields := NewItemDict(map[string][]byte{"field": []byte("value")})
+		fields.SetDictFieldExpireAt("field", time.Now().Add(time.Hour))
+		e.AddOrReplaceOne("fields", fields)
+
+		expired := e.Get("key_1")
+		expired.SetTtl(100)
+		e.IndexVolatile("key_1")
+
+		persisted := e.Get("key_2")
+		persisted.SetTtl(100)
+		e.IndexVolatile("key_2")
+		persisted.RemoveTtl()
+
+		e.IndexVolatile("key_3")
+		e.IndexVolatile("not_existing")
+
+		var got []string
+		for cursor := 0; ; {
+			next, keys := e.ScanVolatile(cursor, 1)
+			got = append(got, keys...)
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
 
 		sort.Strings(got)
-		sort.Strings(tst.wantKeys)
+		want := []string{"fields", "key_1", "renamed"}
+		if diff := deep.Equal(got, want); diff != nil {
+			t.Errorf("ScanVolatile(): %s\n\ngot:%q\n\nwant:%q", diff, got, want)
+		}
+	})
+}
 
-		if count != tst.wantCount {
-			t.Errorf("DelSubmap(%q) count: %d != %d", tst.submap, count, tst.wantCount)
+func TestStorage_Len(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		e := newStorage()
+		item := NewItemString("value")
+
+		steps := []struct {
+			name string
+			do   func()
+			want int
+		}{
+			{"AddOrReplaceOne", func() { e.AddOrReplaceOne("a", item) }, 1},
+			{"AddOrReplaceOne existing", func() { e.AddOrReplaceOne("a", item) }, 1},
+			{"CompareAndSwap new", func() { e.CompareAndSwap("b", nil, item) }, 2},
+			{"CompareAndSwap existing", func() { e.CompareAndSwap("b", item, NewItemString("new")) }, 2},
+			{"CompareAndSwap failed", func() { e.CompareAndSwap("c", item, item) }, 2},
+			{"AtomicUpdate", func() {
+				e.AtomicUpdate([]string{"a", "b", "c", "d"}, func(items map[string]*Item) {
+					items["a"] = nil
+					items["c"] = item
+					items["d"] = item
+				})
+			}, 3},
+			{"Del", func() { e.Del([]string{"b", "404"}) }, 2},
+			{"DelSubmap", func() { e.DelSubmap(map[string]*Item{"c": item, "d": NewItemString("other")}) }, 1},
 		}
 
-		if diff := deep.Equal(got, tst.wantKeys); diff != nil {
-			t.Errorf("DelSubmap(%q): %s\n\ngot:%v\n\nwant:%v", tst.submap, diff, got, tst.wantKeys)
+		for _, step := range steps {
+			step.do()
+			if got := e.Len(); got != step.want {
+				t.Errorf("Len() after %s: %d != %d", step.name, got, step.want)
+			}
 		}
-	}
+	})
 }
 
-func TestStorageHash_concurrency(t *testing.T) {
-	if testing.Short() {
-		t.Skip()
-	}
+func TestStorage_RandomKey(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		e := newStorage()
+		if _, ok := e.RandomKey(); ok {
+			t.Errorf("RandomKey() returned key from empty storage")
+		}
 
-	tests := [][]string{
-		{"aa", "bb", "cc"},
-		{"aa", "bb", "cc", "測", "測試"},
-		{"測", "別れ、比類のない", "hhh"},
-		{"aa", "bb", "cc", "測", "測試"},
-	}
+		data := getSampleDataStorageHash()
+		e.SetData(data)
 
-	var keys []string
-	for i := 0; i < 100; i++ {
-		keys = append(keys, fmt.Sprintf("%d", rand.Uint64()))
-	}
-	tests = append(tests, keys)
+		got := make(map[string]bool)
+		for i := 0; i < 1000; i++ {
+			key, ok := e.RandomKey()
+			if _, exists := data[key]; !ok || !exists {
+				t.Fatalf("RandomKey(): unexpected key %q", key)
+			}
+			got[key] = true
+		}
 
-	e := NewStorageHash()
-	var wg sync.WaitGroup
-	for i := 0; i < 1000; i++ {
-		wg.Add(1)
-		go StorageHashWorker(&wg, e, tests)
-	}
+		if len(got) != len(data) {
+			t.Errorf("RandomKey(): only %d of %d keys returned", len(got), len(data))
+		}
+	})
+}
 
-	wg.Wait()
+func TestStorage_Del(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		tests := []struct {
+			keys, want []string
+		}{
+			{[]string{"404", "測"}, []string{"bytes", "dict", "list"}},
+			{[]string{"bytes", "dict"}, []string{"list"}},
+		}
 
-	// Due to last operation of every StorageHashWorker is AddOrReplaceOne() for last keyset
-	// after all workers done, only last keyset  should remain in the storage
-	got := e.Keys()
-	want := tests[len(tests)-1]
-	sort.Strings(got)
-	sort.Strings(want)
-	if diff := deep.Equal(got, want); diff != nil {
-		t.Errorf("Keys(): %s\n\ngot:%v\n\nwant:%v", diff, got, want)
-	}
+		data := getSampleDataStorageHash()
+		e := newStorage()
+		e.SetData(data)
+
+		for _, tst := range tests {
+			e.Del(tst.keys)
+			got := e.Keys()
+
+			sort.Strings(got)
+			sort.Strings(tst.want)
+			if diff := deep.Equal(got, tst.want); diff != nil {
+				t.Errorf("Del(): %s\n\ngot:%v\n\nwant:%v", diff, got, tst.want)
+			}
+		}
+	})
 }
 
-func StorageHashWorker(wg *sync.WaitGroup, e *StorageHash, tests [][]string) {
+func TestStorage_DelSubmap(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		data := getSampleDataStorageHash()
+
+		tests := []struct {
+			submap    map[string]*Item
+			wantCount int
+			wantKeys  []string
+		}{
+			{
+				map[string]*Item{"404": nil, "測": data["bytes"], "list": data["list"]},
+				1,
+				[]string{"bytes", "dict", "測"},
+			},
+			{
+				map[string]*Item{"測": nil, "dict": data["dict"], "bytes": data["bytes"]},
+				2,
+				[]string{"測"},
+			},
+		}
+
+		e := newStorage()
+		e.SetData(data)
+
+		for _, tst := range tests {
+			count := e.DelSubmap(tst.submap)
+			got := e.Keys()
+
+			sort.Strings(got)
+			sort.Strings(tst.wantKeys)
+
+			if count != tst.wantCount {
+				t.Errorf("DelSubmap(%q) count: %d != %d", tst.submap, count, tst.wantCount)
+			}
+
+			if diff := deep.Equal(got, tst.wantKeys); diff != nil {
+				t.Errorf("DelSubmap(%q): %s\n\ngot:%v\n\nwant:%v", tst.submap, diff, got, tst.wantKeys)
+			}
+		}
+	})
+}
+
+func TestStorage_concurrency(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		if testing.Short() {
+			t.Skip()
+		}
+
+		tests := [][]string{
+			{"aa", "bb", "cc"},
+			{"aa", "bb", "cc", "測", "測試"},
+			{"測", "別れ、比類のない", "hhh"},
+			{"aa", "bb", "cc", "測", "測試"},
+		}
+
+		var keys []string
+		for i := 0; i < 100; i++ {
+			keys = append(keys, fmt.Sprintf("%d", rand.Uint64()))
+		}
+		tests = append(tests, keys)
+
+		e := newStorage()
+		var wg sync.WaitGroup
+		for i := 0; i < 1000; i++ {
+			wg.Add(1)
+			go StorageWorker(&wg, e, tests)
+		}
+
+		wg.Wait()
+
+		// Due to last operation of every StorageWorker is AddOrReplaceOne() for last keyset
+		// after all workers done, only last keyset  should remain in the storage
+		got := e.Keys()
+		want := tests[len(tests)-1]
+		sort.Strings(got)
+		sort.Strings(want)
+		if diff := deep.Equal(got, want); diff != nil {
+			t.Errorf("Keys(): %s\n\ngot:%v\n\nwant:%v", diff, got, want)
+		}
+	})
+}
+
+func StorageWorker(wg *sync.WaitGroup, e Storage, tests [][]string) {
 	var items map[string]*Item
 	for _, tst := range tests {
 		items = map[string]*Item{}
@@ -252,30 +505,58 @@ func GetFilledStorageHash(n int) *StorageHash {
 	return s
 }
 
-func TestStorageHash_PersistLoad(t *testing.T) {
-	persisting := NewStorageHash()
-	persisting.SetData(getSampleDataStorageHash())
-	buf := bytes.NewBuffer(nil)
+func TestStorage_PersistLoad(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newStorage func() testedStorage) {
+		persisting := newStorage()
+		persisting.SetData(getSampleDataStorageHash())
+		persisting.AddOrReplaceOne("set", NewItemSet(map[string]struct{}{"Abba": {}, "KMFDM": {}}))
+		persisting.AddOrReplaceOne("zset", NewItemZSet(map[string]float64{"Abba": 1, "KMFDM": -2.5}))
+		fieldsTtl := NewItemDict(map[string][]byte{"expired": []byte("Abba"), "alive": []byte("KMFDM"), "persistent": []byte("Rammstein")})
+		fieldsTtl.SetDictExpireAt(map[string]time.Time{
+			"expired": time.Now().Add(-time.Second).Round(0),
+			"alive":   time.Now().Add(time.Hour).Round(0),
+		})
+		persisting.AddOrReplaceOne("fieldsTtl", fieldsTtl)
+		buf := bytes.NewBuffer(nil)
+
+		err := persisting.Persist(buf, math.MaxInt64)
+		if err != nil {
+			t.Errorf("Failed to persist: %s", err)
+		}
+
+		loading := newStorage()
+		messageId, err := loading.Load(buf)
 
-	err := persisting.Persist(buf, math.MaxInt64)
-	if err != nil {
-		t.Errorf("Failed to persist: %s", err)
-	}
+		if err != nil {
+			t.Errorf("Failed to load: %s", err)
+		}
 
-	loading := NewStorageHash()
-	messageId, err := loading.Load(buf)
+		if messageId != math.MaxInt64 {
+			t.Errorf("Invalid messageId: %d != %d", messageId, math.MaxInt64)
+		}
 
-	if err != nil {
-		t.Errorf("Failed to load: %s", err)
-	}
+		if loading.Len() != persisting.Len() {
+			t.Errorf("Persist/Load Len mismatch: %d != %d", loading.Len(), persisting.Len())
+		}
 
-	if messageId != math.MaxInt64 {
-		t.Errorf("Invalid messageId: %d != %d", messageId, math.MaxInt64)
-	}
+		got, want := loading.Data(), persisting.Data()
 
-	if !reflect.DeepEqual(loading.Data(), persisting.Data()) {
-		t.Errorf("Persist/Load data mismatch: \ngot:%q\n\nwant:%q", loading.Data(), persisting.Data())
-	}
+		// zset skiplist levels are random, so compare zset items by content
+		if got["zset"].String() != want["zset"].String() {
+			t.Errorf("Persist/Load zset mismatch: \ngot:%q\n\nwant:%q", got["zset"], want["zset"])
+		}
+		delete(got, "zset")
+		delete(want, "zset")
+
+		for key := range want {
+			got[key].ResetStats()
+			want[key].ResetStats()
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Persist/Load data mismatch: \ngot:%q\n\nwant:%q", got, want)
+		}
+	})
 }
 
 func BenchmarkStorageHash_Persist(b *testing.B) {
@@ -0,0 +1,424 @@
+package core
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxStringLength is the maximum size of the string value, the same as in Redis
+const MaxStringLength = 512 * 1024 * 1024
+
+// Append If key already exists and is a string, this command appends the value at the end of the string.
+// If key does not exist it is created and set as an empty string,
+// so APPEND will be similar to SET in this special case.
+// Returns the length of the string after the append operation.
+// @command APPEND
+// @modifying
+// @denyoom
+func (c *Core) Append(key string, value []byte) (count int, err error) {
+	defer c.notifyOnSuccess(&err, EventString, "append", key)
+
+	for {
+		item := c.addItemIfAbsent(key, func() *Item {
+			return NewItemBytes(copyBytes(value))
+		})
+		if item == nil {
+			return len(value), nil
+		}
+
+		count, err := modifyItemBytes(item, func(current []byte) ([]byte, error) {
+			if len(current)+len(value) > MaxStringLength {
+				return nil, ErrStringLength
+			}
+
+			// never append in place: current value may share memory with requests, still waiting to be written into WAL
+			result := make([]byte, len(current)+len(value))
+			copy(result, current)
+			copy(result[len(current):], value)
+
+			return result, nil
+		})
+		if err != errItemExpired {
+			return count, err
+		}
+	}
+}
+
+// StrLen Returns the length of the string value stored at key. Returns 0 if key does not exist.
+// @command STRLEN
+func (c *Core) StrLen(key string) (count int, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Bytes {
+		return 0, ErrWrongType
+	}
+
+	return len(item.bytes), nil
+}
+
+// GetRange Returns the substring of the string value stored at key,
+// determined by the offsets start and end (both are inclusive).
+// Negative offsets can be used in order to provide an offset starting from the end of the string.
+// So -1 means the last character, -2 the penultimate and so forth.
+// @command GETRANGE
+func (c *Core) GetRange(key string, start, end int) (result []byte, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		// In Redis, GETRANGE on non-exists key returns empty string, not <nil> aka NotFound
+		return []byte{}, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != Bytes {
+		return nil, ErrWrongType
+	}
+
+	value := item.bytes
+	vLen := len(value)
+
+	if start < 0 {
+		start += vLen
+	}
+	if end < 0 {
+		end += vLen
+	}
+
+	start = int(math.Max(float64(start), 0.0))
+	end = int(math.Min(float64(end), float64(vLen-1)))
+
+	// after normalizing, next check  also covers start > len(), end < 0
+	if start > end {
+		return []byte{}, nil
+	}
+
+	return copyBytes(value[start : end+1]), nil
+}
+
+// SetRange Overwrites part of the string stored at key, starting at the specified offset, for the entire length of value.
+// If the offset is larger than the current length of the string at key, the string is padded with zero-bytes.
+// Non-existing keys are considered as empty strings.
+// Returns the length of the string after it was modified by the command.
+// @command SETRANGE
+// @modifying
+// @denyoom
+func (c *Core) SetRange(key string, offset int, value []byte) (count int, err error) {
+	if offset < 0 {
+		return 0, ErrOffset
+	}
+	if offset+len(value) > MaxStringLength {
+		return 0, ErrStringLength
+	}
+
+	overwrite := func(current []byte) ([]byte, error) {
+		if len(value) == 0 {
+			return current, nil
+		}
+
+		// never modify in place: current value may share memory with requests, still waiting to be written into WAL
+		result := make([]byte, int(math.Max(float64(len(current)), float64(offset+len(value)))))
+		copy(result, current)
+		copy(result[offset:], value)
+
+		return result, nil
+	}
+
+	if len(value) > 0 {
+		// like in Redis, SETRANGE with empty value doesn't modify the key, so it isn't notified
+		defer c.notifyOnSuccess(&err, EventString, "setrange", key)
+	}
+
+	for {
+		item := c.getItem(key)
+		if item == nil && len(value) == 0 {
+			// In Redis, SETRANGE with empty value doesn't create a key
+			return 0, nil
+		}
+
+		item = c.addItemIfAbsent(key, func() *Item {
+			result, _ := overwrite(nil)
+			return NewItemBytes(result)
+		})
+		if item == nil {
+			return offset + len(value), nil
+		}
+
+		count, err := modifyItemBytes(item, overwrite)
+		if err != errItemExpired {
+			return count, err
+		}
+	}
+}
+
+// GetSet Atomically sets key to value and returns the old value stored at key.
+// If key not exists, sets the value and returns ErrNotFound
+// @command GETSET
+// @modifying
+// @modifyingnotfound
+// @denyoom
+func (c *Core) GetSet(key string, value []byte) (result []byte, err error) {
+	c.storage.AtomicUpdate([]string{key}, func(items map[string]*Item) {
+		result, err = getItemBytes(items[key])
+		if err == ErrWrongType {
+			return
+		}
+
+		items[key] = NewItemBytes(value)
+	})
+
+	if err != ErrWrongType {
+		c.notify(EventString, "set", key)
+	}
+
+	return result, err
+}
+
+// GetDel Get the value of key and delete the key.
+// This command is similar to GET, except for the fact that it also deletes the key on success.
+// @command GETDEL
+// @modifying
+func (c *Core) GetDel(key string) (result []byte, err error) {
+	c.storage.AtomicUpdate([]string{key}, func(items map[string]*Item) {
+		result, err = getItemBytes(items[key])
+		if err == nil {
+			items[key] = nil
+		}
+	})
+
+	if err == nil {
+		c.notify(EventGeneric, "del", key)
+	}
+
+	return result, err
+}
+
+// MGet Returns the values of all specified keys.
+// For every key that does not hold a string value or does not exist, nil value is returned.
+// @command MGET
+func (c *Core) MGet(keys []string) (result [][]byte, err error) {
+	result = make([][]byte, len(keys))
+	for i, key := range keys {
+		result[i], _ = c.Get(key)
+	}
+
+	return result, nil
+}
+
+// MSet Sets the given keys to their respective values: MSET key value [key value ...].
+// MSET replaces existing values with new values, just as regular SET.
+// MSET is atomic, so all given keys are set at once.
+// @command MSET
+// @modifying
+// @denyoom
+func (c *Core) MSet(pairs [][]byte) (err error) {
+	keys, items, err := parseKeyValuePairs(pairs)
+	if err != nil {
+		return err
+	}
+
+	c.storage.AtomicUpdate(keys, func(existing map[string]*Item) {
+		for key, item := range items {
+			existing[key] = item
+		}
+	})
+
+	c.notify(EventString, "set", keys...)
+
+	return nil
+}
+
+// MSetNX Sets the given keys to their respective values: MSETNX key value [key value ...].
+// MSETNX will not perform any operation at all even if just a single key already exists.
+// Returns 1 if the all the keys were set, 0 if no key was set
+// @command MSETNX
+// @modifying
+// @denyoom
+func (c *Core) MSetNX(pairs [][]byte) (result int, err error) {
+	keys, items, err := parseKeyValuePairs(pairs)
+	if err != nil {
+		return 0, err
+	}
+
+	c.storage.AtomicUpdate(keys, func(existing map[string]*Item) {
+		for _, item := range existing {
+			if !isExpired(item) {
+				return
+			}
+		}
+
+		for key, item := range items {
+			existing[key] = item
+		}
+		result = 1
+	})
+
+	if result == 1 {
+		c.notify(EventString, "set", keys...)
+	}
+
+	return result, nil
+}
+
+// SetNX Set key to hold string value if key does not exist.
+// Returns 1 if the key was set, 0 if the key was not set
+// @command SETNX
+// @modifying
+// @denyoom
+func (c *Core) SetNX(key string, value []byte) (result int, err error) {
+	existing := c.addItemIfAbsent(key, func() *Item {
+		return NewItemBytes(value)
+	})
+	if existing != nil {
+		return 0, nil
+	}
+
+	c.notify(EventString, "set", key)
+
+	return 1, nil
+}
+
+// modifyItemBytes replaces value of Bytes item by result of modify() under the item lock and returns new length.
+// errItemExpired is returned if item expired before it was locked, so the caller should retry with a fresh item
+func modifyItemBytes(item *Item, modify func(current []byte) ([]byte, error)) (count int, err error) {
+	item.Lock()
+	defer item.Unlock()
+
+	if item.IsExpired() {
+		return 0, errItemExpired
+	}
+
+	if item.kind != Bytes {
+		return 0, ErrWrongType
+	}
+
+	result, err := modify(item.bytes)
+	if err != nil {
+		return 0, err
+	}
+
+	item.bytes = result
+	return len(result), nil
+}
+
+// getItemBytes returns copy of the value of not expired Bytes item, ErrNotFound if item is nil or expired
+func getItemBytes(item *Item) (result []byte, err error) {
+	if item == nil {
+		return nil, ErrNotFound
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.IsExpired() {
+		return nil, ErrNotFound
+	}
+
+	if item.kind != Bytes {
+		return nil, ErrWrongType
+	}
+
+	return copyBytes(item.bytes), nil
+}
+
+// setOptions contains parsed optional arguments of SET command
+type setOptions struct {
+	nx, xx, get, keepTtl bool
+	expireAt             time.Time
+}
+
+// parseSetOptions parses [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|KEEPTTL]
+func parseSetOptions(options []string) (opts setOptions, err error) {
+	hasExpire := false
+	for i := 0; i < len(options); i++ {
+		switch option := strings.ToUpper(options[i]); option {
+		case "NX":
+			opts.nx = true
+		case "XX":
+			opts.xx = true
+		case "GET":
+			opts.get = true
+		case "KEEPTTL":
+			if hasExpire {
+				return opts, ErrSyntax
+			}
+			hasExpire, opts.keepTtl = true, true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExpire || i == len(options)-1 {
+				return opts, ErrSyntax
+			}
+			hasExpire = true
+
+			i++
+			if opts.expireAt, err = parseExpireAt(option, options[i]); err != nil {
+				return opts, err
+			}
+		default:
+			return opts, ErrSyntax
+		}
+	}
+
+	if opts.nx && opts.xx {
+		return opts, ErrSyntax
+	}
+
+	return opts, nil
+}
+
+// parseExpireAt converts value of EX/PX/EXAT/PXAT option into absolute expiration time
+func parseExpireAt(option, value string) (expireAt time.Time, err error) {
+	ttl, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return expireAt, ErrNotInteger
+	}
+
+	unit := time.Second
+	if option == "PX" || option == "PXAT" {
+		unit = time.Millisecond
+	}
+
+	// ttl must be positive and must not overflow time.Duration
+	if ttl <= 0 || ttl > math.MaxInt64/int64(unit) {
+		return expireAt, ErrExpireTime
+	}
+
+	if option == "EX" || option == "PX" {
+		return time.Now().Add(time.Duration(ttl) * unit), nil
+	}
+
+	return time.Unix(0, 0).Add(time.Duration(ttl) * unit), nil
+}
+
+// parseKeyValuePairs parses key value [key value ...] arguments into Bytes items. At least one pair is required
+func parseKeyValuePairs(pairs [][]byte) (keys []string, items map[string]*Item, err error) {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return nil, nil, ErrSyntax
+	}
+
+	items = make(map[string]*Item, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key := string(pairs[i])
+		if _, ok := items[key]; !ok {
+			keys = append(keys, key)
+		}
+		// like in Redis, the last value wins for duplicated keys
+		items[key] = NewItemBytes(pairs[i+1])
+	}
+
+	return keys, items, nil
+}
+
+func copyBytes(value []byte) []byte {
+	result := make([]byte, len(value))
+	copy(result, value)
+
+	return result
+}
@@ -0,0 +1,308 @@
+package core_test
+
+import (
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/core"
+	"testing"
+)
+
+func TestCore_Append(t *testing.T) {
+	tests := []struct {
+		key, value string
+		err        error
+		wantCount  int
+		want       string
+	}{
+		{"dict", "a", ErrWrongType, 0, ""},
+		{"404", "Abba", nil, 4, "Abba"},
+		{"404", " & KMFDM", nil, 12, "Abba & KMFDM"},
+		{"expired", "new", nil, 3, "new"},
+		{"測", "", nil, 75, "幽霊はヨーロッパを追いかけています - 共産主義の幽霊"},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		count, err := c.Append(tst.key, []byte(tst.value))
+		got, _ := c.Get(tst.key)
+
+		if err != tst.err {
+			t.Errorf("Append(%q, %q) err: %q != %q", tst.key, tst.value, err, tst.err)
+		}
+		if count != tst.wantCount {
+			t.Errorf("Append(%q, %q) count: %d != %d", tst.key, tst.value, count, tst.wantCount)
+		}
+		if err == nil && string(got) != tst.want {
+			t.Errorf("Append(%q, %q): %q != %q", tst.key, tst.value, got, tst.want)
+		}
+	}
+}
+
+func TestCore_StrLen(t *testing.T) {
+	tests := []struct {
+		key       string
+		err       error
+		wantCount int
+	}{
+		{"dict", ErrWrongType, 0},
+		{"404", nil, 0},
+		{"expired", nil, 0},
+		{"測", nil, 75},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		count, err := c.StrLen(tst.key)
+
+		if err != tst.err {
+			t.Errorf("StrLen(%q) err: %q != %q", tst.key, err, tst.err)
+		}
+		if count != tst.wantCount {
+			t.Errorf("StrLen(%q): %d != %d", tst.key, count, tst.wantCount)
+		}
+	}
+}
+
+func TestCore_GetRange(t *testing.T) {
+	tests := []struct {
+		key        string
+		start, end int
+		err        error
+		want       string
+	}{
+		{"dict", 0, -1, ErrWrongType, ""},
+		{"404", 0, -1, nil, ""},
+		{"value", 0, 3, nil, "This"},
+		{"value", -3, -1, nil, "ing"},
+		{"value", 0, -1, nil, "This is a string"},
+		{"value", 10, 100, nil, "string"},
+		{"value", -100, 1, nil, "Th"},
+		{"value", 5, 3, nil, ""},
+		{"value", 100, 200, nil, ""},
+	}
+
+	c := New(NewMockStorage())
+	c.Set("value", []byte("This is a string"))
+
+	for _, tst := range tests {
+		got, err := c.GetRange(tst.key, tst.start, tst.end)
+
+		if err != tst.err {
+			t.Errorf("GetRange(%q, %d, %d) err: %q != %q", tst.key, tst.start, tst.end, err, tst.err)
+		}
+		if string(got) != tst.want {
+			t.Errorf("GetRange(%q, %d, %d): %q != %q", tst.key, tst.start, tst.end, got, tst.want)
+		}
+	}
+}
+
+func TestCore_SetRange(t *testing.T) {
+	tests := []struct {
+		key       string
+		offset    int
+		value     string
+		err       error
+		wantCount int
+		want      string
+	}{
+		{"dict", 0, "a", ErrWrongType, 0, ""},
+		{"value", -1, "a", ErrOffset, 0, ""},
+		{"value", MaxStringLength, "a", ErrStringLength, 0, ""},
+		{"404", 0, "", nil, 0, ""},
+		{"404", 3, "abc", nil, 6, "\x00\x00\x00abc"},
+		{"value", 6, "Redis", nil, 11, "Hello Redis"},
+		{"value", 6, "Radish!", nil, 13, "Hello Radish!"},
+		{"value", 0, "", nil, 13, "Hello Radish!"},
+	}
+
+	c := New(NewMockStorage())
+	c.Set("value", []byte("Hello World"))
+
+	for _, tst := range tests {
+		count, err := c.SetRange(tst.key, tst.offset, []byte(tst.value))
+		got, _ := c.Get(tst.key)
+
+		if err != tst.err {
+			t.Errorf("SetRange(%q, %d, %q) err: %q != %q", tst.key, tst.offset, tst.value, err, tst.err)
+		}
+		if count != tst.wantCount {
+			t.Errorf("SetRange(%q, %d, %q) count: %d != %d", tst.key, tst.offset, tst.value, count, tst.wantCount)
+		}
+		if err == nil && string(got) != tst.want {
+			t.Errorf("SetRange(%q, %d, %q): %q != %q", tst.key, tst.offset, tst.value, got, tst.want)
+		}
+	}
+}
+
+func TestCore_GetSet(t *testing.T) {
+	tests := []struct {
+		key, value string
+		err        error
+		want       string
+	}{
+		{"dict", "a", ErrWrongType, ""},
+		{"404", "first", ErrNotFound, ""},
+		{"404", "second", nil, "first"},
+		{"expired", "new", ErrNotFound, ""},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		got, err := c.GetSet(tst.key, []byte(tst.value))
+		value, _ := c.Get(tst.key)
+
+		if err != tst.err {
+			t.Errorf("GetSet(%q, %q) err: %q != %q", tst.key, tst.value, err, tst.err)
+		}
+		if string(got) != tst.want {
+			t.Errorf("GetSet(%q, %q): %q != %q", tst.key, tst.value, got, tst.want)
+		}
+		if err != ErrWrongType && string(value) != tst.value {
+			t.Errorf("GetSet(%q, %q) value: %q != %q", tst.key, tst.value, value, tst.value)
+		}
+	}
+}
+
+func TestCore_GetDel(t *testing.T) {
+	tests := []struct {
+		key  string
+		err  error
+		want string
+	}{
+		{"dict", ErrWrongType, ""},
+		{"404", ErrNotFound, ""},
+		{"expired", ErrNotFound, ""},
+		{"測", nil, "幽霊はヨーロッパを追いかけています - 共産主義の幽霊"},
+		{"測", ErrNotFound, ""},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		got, err := c.GetDel(tst.key)
+
+		if err != tst.err {
+			t.Errorf("GetDel(%q) err: %q != %q", tst.key, err, tst.err)
+		}
+		if string(got) != tst.want {
+			t.Errorf("GetDel(%q): %q != %q", tst.key, got, tst.want)
+		}
+	}
+
+	if _, err := c.DGetAll("dict"); err != nil {
+		t.Errorf("GetDel() removed value of wrong type")
+	}
+}
+
+func TestCore_MGet(t *testing.T) {
+	c := New(NewMockStorage())
+
+	got, err := c.MGet([]string{"測", "dict", "404", "expired", "測"})
+	want := [][]byte{
+		[]byte("幽霊はヨーロッパを追いかけています - 共産主義の幽霊"),
+		nil,
+		nil,
+		nil,
+		[]byte("幽霊はヨーロッパを追いかけています - 共産主義の幽霊"),
+	}
+
+	if err != nil {
+		t.Errorf("MGet() err: %q", err)
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("MGet(): %s\n\ngot:%q\n\nwant:%q", diff, got, want)
+	}
+}
+
+func TestCore_MSet(t *testing.T) {
+	tests := []struct {
+		pairs []string
+		err   error
+		want  []string
+	}{
+		{[]string{"a", "1", "b"}, ErrSyntax, nil},
+		{[]string{}, ErrSyntax, nil},
+		{[]string{"a", "1", "b", "2", "dict", "3", "a", "4"}, nil, []string{"4", "2", "3"}},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		err := c.MSet(stringsToBytes(tst.pairs))
+		if err != tst.err {
+			t.Errorf("MSet(%q) err: %q != %q", tst.pairs, err, tst.err)
+		}
+		if err != nil {
+			continue
+		}
+
+		got, _ := c.MGet([]string{"a", "b", "dict"})
+		if diff := deep.Equal(bytesToStrings(got), tst.want); diff != nil {
+			t.Errorf("MSet(%q): %s\n\ngot:%q\n\nwant:%q", tst.pairs, diff, got, tst.want)
+		}
+	}
+}
+
+func TestCore_MSetNX(t *testing.T) {
+	tests := []struct {
+		pairs []string
+		err   error
+		want  int
+	}{
+		{[]string{"a", "1", "b"}, ErrSyntax, 0},
+		{[]string{}, ErrSyntax, 0},
+		{[]string{"a", "1", "dict", "2"}, nil, 0},
+		{[]string{"a", "1", "expired", "2"}, nil, 1},
+		{[]string{"b", "1", "a", "2"}, nil, 0},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		result, err := c.MSetNX(stringsToBytes(tst.pairs))
+		if err != tst.err {
+			t.Errorf("MSetNX(%q) err: %q != %q", tst.pairs, err, tst.err)
+		}
+		if result != tst.want {
+			t.Errorf("MSetNX(%q): %d != %d", tst.pairs, result, tst.want)
+		}
+	}
+
+	got, _ := c.MGet([]string{"a", "b", "expired"})
+	want := []string{"1", "", "2"}
+	if diff := deep.Equal(bytesToStrings(got), want); diff != nil {
+		t.Errorf("MSetNX(): %s\n\ngot:%q\n\nwant:%q", diff, got, want)
+	}
+}
+
+func TestCore_SetNX(t *testing.T) {
+	tests := []struct {
+		key, value string
+		want       int
+		wantValue  string
+	}{
+		{"404", "first", 1, "first"},
+		{"404", "second", 0, "first"},
+		{"expired", "new", 1, "new"},
+		{"dict", "new", 0, ""},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		result, err := c.SetNX(tst.key, []byte(tst.value))
+		value, _ := c.Get(tst.key)
+
+		if err != nil {
+			t.Errorf("SetNX(%q, %q) err: %q", tst.key, tst.value, err)
+		}
+		if result != tst.want {
+			t.Errorf("SetNX(%q, %q): %d != %d", tst.key, tst.value, result, tst.want)
+		}
+		if string(value) != tst.wantValue {
+			t.Errorf("SetNX(%q, %q) value: %q != %q", tst.key, tst.value, value, tst.wantValue)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"time"
+)
+
+// PTtl Like TTL this command returns the remaining time to live of a key that has an expire set,
+// with the sole difference that TTL returns the amount of remaining time in seconds while PTTL returns it in milliseconds.
+// @command PTTL
+func (c *Core) PTtl(key string) (ttl int, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		// In redis, not found key don't causes error, just return -2
+		return -2, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if !item.HasTtl() {
+		return -1, nil
+	}
+
+	return item.MilliTtl(), nil
+}
+
+// ExpireTime Returns the absolute Unix timestamp (since January 1, 1970) in seconds at which the given key will expire.
+// Returns -1 if the key exists but has no associated expiration time, -2 if the key does not exist.
+// @command EXPIRETIME
+func (c *Core) ExpireTime(key string) (timestamp int, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return -2, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if !item.HasTtl() {
+		return -1, nil
+	}
+
+	return int(item.ExpireAt().Unix()), nil
+}
+
+// PExpire This command works exactly like EXPIRE but the time to live of the key is specified in milliseconds.
+// WAL records it as PEXPIREAT, so it doesn't need TTL correction on replay
+// @command PEXPIRE
+// @modifying
+// @absttl 1 milliseconds PEXPIREAT $0 $1
+func (c *Core) PExpire(key string, milliseconds int) (result int) {
+	return c.expireAt(key, time.Now().Add(time.Duration(milliseconds)*time.Millisecond))
+}
+
+// ExpireAt has the same effect and semantic as EXPIRE, but instead of specifying the number of seconds
+// representing the TTL, it takes an absolute Unix timestamp (seconds since January 1, 1970).
+// A timestamp in the past will delete the key immediately.
+// @command EXPIREAT
+// @modifying
+func (c *Core) ExpireAt(key string, timestamp int) (result int) {
+	return c.expireAt(key, time.Unix(int64(timestamp), 0))
+}
+
+// PExpireAt has the same effect and semantic as EXPIREAT,
+// but the Unix time at which the key will expire is specified in milliseconds instead of seconds.
+// @command PEXPIREAT
+// @modifying
+func (c *Core) PExpireAt(key string, timestamp int) (result int) {
+	return c.expireAt(key, time.Unix(0, 0).Add(time.Duration(timestamp)*time.Millisecond))
+}
+
+// PSetEx works exactly like SETEX with the sole difference that the expire time is specified in milliseconds instead of seconds.
+// WAL records it as SET with PXAT option, so it doesn't need TTL correction on replay
+// @command PSETEX
+// @modifying
+// @denyoom
+// @absttl 1 milliseconds SET $0 $2 PXAT $1
+func (c *Core) PSetEx(key string, milliseconds int, value []byte) (err error) {
+	if milliseconds <= 0 {
+		return ErrExpireTime
+	}
+
+	item := NewItemBytes(value)
+	item.SetMilliTtl(milliseconds)
+	c.storage.AddOrReplaceOne(key, item)
+	c.notifySet(key, true)
+
+	return nil
+}
+
+// expireAt sets absolute expiration time on key. Expiration time in the past leads to deleting the key
+func (c *Core) expireAt(key string, expireAt time.Time) (result int) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0
+	}
+
+	if !expireAt.After(time.Now()) {
+		c.Del([]string{key})
+		return 1
+	}
+
+	// deferred first to index the key after the item is unlocked: the storage is never locked under the item lock
+	defer c.storage.IndexVolatile(key)
+
+	item.Lock()
+	defer item.Unlock()
+
+	// check IsExpired() one more time inside the critical section, to avoid updating TTL
+	// for item, that already prepared to removal by CollectExpired()
+	if item.IsExpired() {
+		return 0
+	}
+
+	item.SetExpireAt(expireAt)
+	c.notify(EventGeneric, "expire", key)
+
+	return 1
+}
@@ -0,0 +1,208 @@
+package core_test
+
+import (
+	. "github.com/mshaverdo/radish/core"
+	"testing"
+	"time"
+)
+
+func TestCore_PTtl(t *testing.T) {
+	tests := []struct {
+		key              string
+		wantMin, wantMax int
+	}{
+		{"bytes", 999000, 1000000},
+		{"dict", -1, -1},
+		{"404", -2, -2},
+		{"expired", -2, -2},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		ttl, err := c.PTtl(tst.key)
+		if err != nil {
+			t.Errorf("PTtl(%q) err: %q != nil", tst.key, err)
+		}
+		if ttl < tst.wantMin || ttl > tst.wantMax {
+			t.Errorf("PTtl(%q) ttl: %d not in [%d, %d]", tst.key, ttl, tst.wantMin, tst.wantMax)
+		}
+	}
+}
+
+func TestCore_ExpireTime(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"bytes", int(time.Now().Add(1000 * time.Second).Unix())},
+		{"dict", -1},
+		{"404", -2},
+		{"expired", -2},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		timestamp, err := c.ExpireTime(tst.key)
+		if err != nil {
+			t.Errorf("ExpireTime(%q) err: %q != nil", tst.key, err)
+		}
+		// allow 1 second difference: sample data was created a bit earlier
+		if timestamp != tst.want && timestamp != tst.want-1 {
+			t.Errorf("ExpireTime(%q): %d != %d", tst.key, timestamp, tst.want)
+		}
+	}
+}
+
+func TestCore_PExpire(t *testing.T) {
+	tests := []struct {
+		key        string
+		ttl        int
+		wantResult int
+		wantExists bool
+	}{
+		{"bytes", 10500, 1, true},
+		{"dict", 0, 1, false},
+		{"404", 11000, 0, false},
+		{"expired", 12000, 0, false},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		result := c.PExpire(tst.key, tst.ttl)
+		if result != tst.wantResult {
+			t.Errorf("PExpire(%q) result: %d != %d", tst.key, result, tst.wantResult)
+		}
+
+		ttl, _ := c.PTtl(tst.key)
+		if exists := ttl != -2; exists != tst.wantExists {
+			t.Errorf("PExpire(%q) existanse: %t != %t", tst.key, exists, tst.wantExists)
+		}
+		if tst.wantExists && (ttl > tst.ttl || ttl < tst.ttl-100) {
+			t.Errorf("PExpire(%q) ttl: %d != %d", tst.key, ttl, tst.ttl)
+		}
+	}
+}
+
+func TestCore_ExpireAt(t *testing.T) {
+	future := int(time.Now().Add(time.Hour).Unix())
+
+	tests := []struct {
+		key        string
+		timestamp  int
+		wantResult int
+		wantExists bool
+	}{
+		{"bytes", future, 1, true},
+		{"dict", 1, 1, false},
+		{"404", future, 0, false},
+		{"expired", future, 0, false},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		result := c.ExpireAt(tst.key, tst.timestamp)
+		if result != tst.wantResult {
+			t.Errorf("ExpireAt(%q) result: %d != %d", tst.key, result, tst.wantResult)
+		}
+
+		timestamp, _ := c.ExpireTime(tst.key)
+		if exists := timestamp != -2; exists != tst.wantExists {
+			t.Errorf("ExpireAt(%q) existanse: %t != %t", tst.key, exists, tst.wantExists)
+		}
+		if tst.wantExists && timestamp != tst.timestamp {
+			t.Errorf("ExpireAt(%q) timestamp: %d != %d", tst.key, timestamp, tst.timestamp)
+		}
+	}
+}
+
+func TestCore_PExpireAt(t *testing.T) {
+	future := int(time.Now().Add(time.Hour).UnixNano() / int64(time.Millisecond))
+
+	tests := []struct {
+		key        string
+		timestamp  int
+		wantResult int
+		wantExists bool
+	}{
+		{"bytes", future, 1, true},
+		{"dict", -1, 1, false},
+		{"404", future, 0, false},
+		{"expired", future, 0, false},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		result := c.PExpireAt(tst.key, tst.timestamp)
+		if result != tst.wantResult {
+			t.Errorf("PExpireAt(%q) result: %d != %d", tst.key, result, tst.wantResult)
+		}
+
+		timestamp, _ := c.ExpireTime(tst.key)
+		if exists := timestamp != -2; exists != tst.wantExists {
+			t.Errorf("PExpireAt(%q) existanse: %t != %t", tst.key, exists, tst.wantExists)
+		}
+		if tst.wantExists && timestamp != tst.timestamp/1000 {
+			t.Errorf("PExpireAt(%q) timestamp: %d != %d", tst.key, timestamp, tst.timestamp/1000)
+		}
+	}
+}
+
+func TestCore_PSetEx(t *testing.T) {
+	tests := []struct {
+		key, value string
+		ttl        int
+		err        error
+	}{
+		{"bytes", "new", 1500, nil},
+		{"dict", "new", 2500, nil},
+		{"404", "new", 0, ErrExpireTime},
+		{"expired", "new", 100, nil},
+	}
+
+	c := New(NewMockStorage())
+
+	for _, tst := range tests {
+		err := c.PSetEx(tst.key, tst.ttl, []byte(tst.value))
+		if err != tst.err {
+			t.Errorf("PSetEx(%q) err: %q != %q", tst.key, err, tst.err)
+		}
+		if err != nil {
+			continue
+		}
+
+		value, _ := c.Get(tst.key)
+		if string(value) != tst.value {
+			t.Errorf("PSetEx(%q) value: %q != %q", tst.key, value, tst.value)
+		}
+		if ttl, _ := c.PTtl(tst.key); ttl > tst.ttl || ttl < tst.ttl-100 {
+			t.Errorf("PSetEx(%q) ttl: %d != %d", tst.key, ttl, tst.ttl)
+		}
+	}
+}
+
+func TestCore_CollectExpiredIndexed(t *testing.T) {
+	c := New(NewStorageHash())
+	c.Set("persistent", []byte("value"))
+	c.Set("set", []byte("value"), "PX", "1")
+	c.Set("expire", []byte("value"))
+	c.PExpire("expire", 1)
+	c.Set("renamed", []byte("value"), "PX", "1")
+	c.Rename("renamed", "new")
+	c.Set("persisted", []byte("value"), "PX", "1")
+	c.Persist("persisted")
+	c.DSet("fields", [][]byte{[]byte("field"), []byte("value")})
+	c.DPExpire("fields", 1, "FIELDS", "1", "field")
+	time.Sleep(2 * time.Millisecond)
+
+	if count := c.CollectExpired(); count != 4 {
+		t.Errorf("CollectExpired(): %d != 4", count)
+	}
+	if count := c.DbSize(); count != 2 {
+		t.Errorf("DbSize() after CollectExpired(): %d != 2", count)
+	}
+}
@@ -0,0 +1,699 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// zset is a sorted set: member->score map for O(1) score lookup and skiplist for ordered ranges
+type zset struct {
+	dict map[string]float64
+	zsl  *skiplist
+}
+
+func newZset(members map[string]float64) *zset {
+	z := &zset{
+		dict: make(map[string]float64, len(members)),
+		zsl:  newSkiplist(),
+	}
+	for member, score := range members {
+		z.set(member, score)
+	}
+
+	return z
+}
+
+// set adds new member or updates score of existing one
+func (z *zset) set(member string, score float64) {
+	if current, ok := z.dict[member]; ok {
+		if current == score {
+			return
+		}
+		z.zsl.delete(current, member)
+	}
+
+	z.dict[member] = score
+	z.zsl.insert(score, member)
+}
+
+// remove removes member and returns true if member was found
+func (z *zset) remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+
+	delete(z.dict, member)
+	z.zsl.delete(score, member)
+
+	return true
+}
+
+func (z *zset) len() int {
+	return len(z.dict)
+}
+
+// members returns copy of the member->score map
+func (z *zset) members() map[string]float64 {
+	result := make(map[string]float64, len(z.dict))
+	for member, score := range z.dict {
+		result[member] = score
+	}
+
+	return result
+}
+
+// ZAdd Adds all the specified members with the specified scores to the sorted set stored at key.
+// Arguments are: [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+// If a specified member is already a member of the sorted set, the score is updated
+// and the element reinserted at the right position to ensure the correct ordering.
+// Returns the number of elements added to the sorted set (or changed, if CH specified).
+// With INCR option, ZADD acts like ZINCRBY and returns the new score of member,
+// or ErrNotFound if the operation was aborted due to NX/XX/GT/LT conditions
+// @command ZADD
+// @modifying
+// @denyoom
+func (c *Core) ZAdd(key string, args []string) (result interface{}, err error) {
+	opts, scores, members, err := parseZAddArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	event := ""
+	defer func() {
+		if event != "" && err == nil {
+			c.notify(EventZSet, event, key)
+		}
+	}()
+
+	for {
+		var item *Item
+		if opts.xx {
+			// XX never adds new elements, so don't create new key
+			if item = c.getItem(key); item == nil {
+				if opts.incr {
+					return nil, ErrNotFound
+				}
+				return 0, nil
+			}
+		} else {
+			item = c.addItemIfAbsent(key, func() *Item {
+				z := newZset(nil)
+				result, event, err = zadd(z, members, scores, opts)
+				return initItem(&Item{kind: ZSet, zset: z})
+			})
+			if item == nil {
+				return result, err
+			}
+		}
+
+		result, event, err = zaddItem(item, members, scores, opts)
+		if err != errItemExpired {
+			return result, err
+		}
+	}
+}
+
+// zaddItem applies ZADD to ZSet item under the item lock.
+// errItemExpired is returned if item expired before it was locked, so the caller should retry with a fresh item
+func zaddItem(item *Item, members []string, scores []float64, opts zAddOptions) (result interface{}, event string, err error) {
+	item.Lock()
+	defer item.Unlock()
+
+	if item.IsExpired() {
+		return nil, "", errItemExpired
+	}
+
+	if item.kind != ZSet {
+		return nil, "", ErrWrongType
+	}
+
+	return zadd(item.zset, members, scores, opts)
+}
+
+// zadd adds members with scores into the sorted set according to ZADD options.
+// Returns ZADD result and the event to notify about, or empty event, if nothing changed
+func zadd(z *zset, members []string, scores []float64, opts zAddOptions) (result interface{}, event string, err error) {
+	added, changed := 0, 0
+	score := 0.0
+	for i, member := range members {
+		score = scores[i]
+		current, exists := z.dict[member]
+		if exists && opts.nx || !exists && opts.xx {
+			if opts.incr {
+				return nil, "", ErrNotFound
+			}
+			continue
+		}
+
+		if opts.incr {
+			score += current
+			if math.IsNaN(score) {
+				return nil, "", ErrNaN
+			}
+		}
+
+		if exists && (opts.gt && score <= current || opts.lt && score >= current) {
+			if opts.incr {
+				return nil, "", ErrNotFound
+			}
+			continue
+		}
+
+		if !exists {
+			added++
+		} else if score != current {
+			changed++
+		}
+		z.set(member, score)
+	}
+
+	if added+changed > 0 {
+		event = "zadd"
+		if opts.incr {
+			event = "zincr"
+		}
+	}
+
+	if opts.incr {
+		return score, event, nil
+	}
+
+	if opts.ch {
+		return added + changed, event, nil
+	}
+
+	return added, event, nil
+}
+
+// ZIncrBy Increments the score of member in the sorted set stored at key by increment.
+// If member does not exist in the sorted set, it is added with increment as its score.
+// If key does not exist, a new sorted set with the specified member as its sole member is created.
+// Returns the new score of member
+// @command ZINCRBY
+// @modifying
+// @denyoom
+func (c *Core) ZIncrBy(key string, increment float64, member string) (score float64, err error) {
+	if math.IsNaN(increment) {
+		return 0, ErrNotFloat
+	}
+
+	defer c.notifyOnSuccess(&err, EventZSet, "zincr", key)
+
+	for {
+		item := c.addItemIfAbsent(key, func() *Item {
+			return NewItemZSet(map[string]float64{member: increment})
+		})
+		if item == nil {
+			return increment, nil
+		}
+
+		score, err := incrItemZSetMember(item, member, increment)
+		if err != errItemExpired {
+			return score, err
+		}
+	}
+}
+
+// incrItemZSetMember increments score of member in ZSet item under the item lock.
+// errItemExpired is returned if item expired before it was locked, so the caller should retry with a fresh item
+func incrItemZSetMember(item *Item, member string, increment float64) (score float64, err error) {
+	item.Lock()
+	defer item.Unlock()
+
+	if item.IsExpired() {
+		return 0, errItemExpired
+	}
+
+	if item.kind != ZSet {
+		return 0, ErrWrongType
+	}
+
+	z := item.zset
+	score = z.dict[member] + increment
+	if math.IsNaN(score) {
+		return 0, ErrNaN
+	}
+	z.set(member, score)
+
+	return score, nil
+}
+
+// ZRem Removes the specified members from the sorted set stored at key. Non existing members are ignored.
+// Returns the number of members removed from the sorted set
+// @command ZREM
+// @modifying
+func (c *Core) ZRem(key string, members []string) (count int, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != ZSet {
+		return 0, ErrWrongType
+	}
+
+	for _, member := range members {
+		if item.zset.remove(member) {
+			count++
+		}
+	}
+
+	if count > 0 {
+		c.notify(EventZSet, "zrem", key)
+	}
+
+	return count, nil
+}
+
+// ZScore Returns the score of member in the sorted set at key.
+// @command ZSCORE
+func (c *Core) ZScore(key, member string) (score float64, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0, ErrNotFound
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != ZSet {
+		return 0, ErrWrongType
+	}
+
+	score, ok := item.zset.dict[member]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return score, nil
+}
+
+// ZCard Returns the sorted set cardinality (number of elements) of the sorted set stored at key.
+// @command ZCARD
+func (c *Core) ZCard(key string) (count int, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != ZSet {
+		return 0, ErrWrongType
+	}
+
+	return item.zset.len(), nil
+}
+
+// ZRank Returns the rank of member in the sorted set stored at key, with the scores ordered from low to high.
+// The rank is 0-based, which means that the member with the lowest score has rank 0.
+// @command ZRANK
+func (c *Core) ZRank(key, member string) (rank int, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		return 0, ErrNotFound
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != ZSet {
+		return 0, ErrWrongType
+	}
+
+	score, ok := item.zset.dict[member]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return item.zset.zsl.rank(score, member) - 1, nil
+}
+
+// ZCount Returns the number of elements in the sorted set at key with a score between min and max.
+// min and max are inclusive by default, '(' prefix makes bound exclusive. -inf and +inf are allowed
+// @command ZCOUNT
+func (c *Core) ZCount(key, min, max string) (count int, err error) {
+	r, err := parseScoreRange(min, max)
+	if err != nil {
+		return 0, err
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != ZSet {
+		return 0, ErrWrongType
+	}
+
+	zsl := item.zset.zsl
+	first := zsl.firstInRange(r)
+	if first == nil {
+		return 0, nil
+	}
+	last := zsl.lastInRange(r)
+
+	return zsl.rank(last.score, last.member) - zsl.rank(first.score, first.member) + 1, nil
+}
+
+// ZRange Returns the specified range of elements in the sorted set stored at key,
+// ordered from the lowest to the highest score.
+// Arguments are: start stop [WITHSCORES]. start and stop are zero-based indexes, negative indexes count from the end.
+// With WITHSCORES, every member is followed by its score
+// @command ZRANGE
+func (c *Core) ZRange(key string, args []string) (result [][]byte, err error) {
+	return c.zRange(key, args, false)
+}
+
+// ZRevRange Returns the specified range of elements in the sorted set stored at key,
+// ordered from the highest to the lowest score.
+// Arguments are: start stop [WITHSCORES]
+// @command ZREVRANGE
+func (c *Core) ZRevRange(key string, args []string) (result [][]byte, err error) {
+	return c.zRange(key, args, true)
+}
+
+// ZRangeByScore Returns all the elements in the sorted set at key with a score between min and max.
+// Arguments are: min max [WITHSCORES] [LIMIT offset count].
+// min and max are inclusive by default, '(' prefix makes bound exclusive. -inf and +inf are allowed
+// @command ZRANGEBYSCORE
+func (c *Core) ZRangeByScore(key string, args []string) (result [][]byte, err error) {
+	if len(args) < 2 {
+		return nil, ErrSyntax
+	}
+
+	r, err := parseScoreRange(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	withScores := false
+	offset, count := 0, -1
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, ErrSyntax
+			}
+			if offset, err = parseInt(args[i+1]); err != nil {
+				return nil, err
+			}
+			if count, err = parseInt(args[i+2]); err != nil {
+				return nil, err
+			}
+			i += 2
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		return [][]byte{}, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != ZSet {
+		return nil, ErrWrongType
+	}
+
+	result = [][]byte{}
+	if offset < 0 {
+		return result, nil
+	}
+
+	x := item.zset.zsl.firstInRange(r)
+	for ; x != nil && offset > 0; offset-- {
+		x = x.level[0].forward
+	}
+
+	for ; x != nil && count != 0 && r.isBelowMax(x.score); x = x.level[0].forward {
+		result = appendZsetNode(result, x, withScores)
+		count--
+	}
+
+	return result, nil
+}
+
+// ZPopMin Removes and returns the member with the lowest score in the sorted set stored at key, followed by its score.
+// @command ZPOPMIN
+// @modifying
+func (c *Core) ZPopMin(key string) (result [][]byte, err error) {
+	return c.zPop(key, false)
+}
+
+// ZPopMax Removes and returns the member with the highest score in the sorted set stored at key, followed by its score.
+// @command ZPOPMAX
+// @modifying
+func (c *Core) ZPopMax(key string) (result [][]byte, err error) {
+	return c.zPop(key, true)
+}
+
+func (c *Core) zPop(key string, max bool) (result [][]byte, err error) {
+	item := c.getItem(key)
+	if item == nil {
+		// In Redis, ZPOPMIN on non-exists key returns empty list, not <nil> aka NotFound
+		return [][]byte{}, nil
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	if item.kind != ZSet {
+		return nil, ErrWrongType
+	}
+
+	z := item.zset
+	x := z.zsl.header.level[0].forward
+	if max {
+		x = z.zsl.tail
+	}
+	if x == nil {
+		return [][]byte{}, nil
+	}
+
+	result = appendZsetNode(nil, x, true)
+	z.remove(x.member)
+
+	if max {
+		c.notify(EventZSet, "zpopmax", key)
+	} else {
+		c.notify(EventZSet, "zpopmin", key)
+	}
+
+	return result, nil
+}
+
+func (c *Core) zRange(key string, args []string, reverse bool) (result [][]byte, err error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, ErrSyntax
+	}
+
+	start, err := parseInt(args[0])
+	if err != nil {
+		return nil, err
+	}
+	stop, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	withScores := len(args) == 3
+	if withScores && strings.ToUpper(args[2]) != "WITHSCORES" {
+		return nil, ErrSyntax
+	}
+
+	item := c.getItem(key)
+	if item == nil {
+		return [][]byte{}, nil
+	}
+
+	item.RLock()
+	defer item.RUnlock()
+
+	if item.kind != ZSet {
+		return nil, ErrWrongType
+	}
+
+	zsl := item.zset.zsl
+	zLen := zsl.length
+
+	if start < 0 {
+		start += zLen
+	}
+	if stop < 0 {
+		stop += zLen
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= zLen {
+		stop = zLen - 1
+	}
+
+	// after normalizing, next check  also covers start > len(), stop < 0
+	if start > stop {
+		return [][]byte{}, nil
+	}
+
+	// skiplist ranks are 1-based
+	rank := start + 1
+	if reverse {
+		rank = zLen - start
+	}
+
+	result = make([][]byte, 0, stop-start+1)
+	x := zsl.byRank(rank)
+	for i := start; i <= stop && x != nil; i++ {
+		result = appendZsetNode(result, x, withScores)
+		if reverse {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+
+	return result, nil
+}
+
+func appendZsetNode(result [][]byte, x *skiplistNode, withScore bool) [][]byte {
+	result = append(result, []byte(x.member))
+	if withScore {
+		result = append(result, []byte(formatFloat(x.score)))
+	}
+
+	return result
+}
+
+type zAddOptions struct {
+	nx, xx, gt, lt, ch, incr bool
+}
+
+// parseZAddArgs parses [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func parseZAddArgs(args []string) (opts zAddOptions, scores []float64, members []string, err error) {
+	i := 0
+loop:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			opts.nx = true
+		case "XX":
+			opts.xx = true
+		case "GT":
+			opts.gt = true
+		case "LT":
+			opts.lt = true
+		case "CH":
+			opts.ch = true
+		case "INCR":
+			opts.incr = true
+		default:
+			break loop
+		}
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return opts, nil, nil, ErrSyntax
+	}
+	if opts.nx && opts.xx || opts.gt && opts.lt || opts.nx && (opts.gt || opts.lt) {
+		return opts, nil, nil, ErrSyntax
+	}
+	if opts.incr && len(pairs) != 2 {
+		return opts, nil, nil, ErrSyntax
+	}
+
+	for i := 0; i < len(pairs); i += 2 {
+		score, err := parseFloat(pairs[i])
+		if err != nil {
+			return opts, nil, nil, err
+		}
+		scores = append(scores, score)
+		members = append(members, pairs[i+1])
+	}
+
+	return opts, scores, members, nil
+}
+
+// parseScoreRange parses ZRANGEBYSCORE-like min and max bounds
+func parseScoreRange(min, max string) (r scoreRange, err error) {
+	if r.min, r.minExclusive, err = parseScoreBound(min); err != nil {
+		return r, err
+	}
+	if r.max, r.maxExclusive, err = parseScoreBound(max); err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+func parseScoreBound(bound string) (value float64, exclusive bool, err error) {
+	if strings.HasPrefix(bound, "(") {
+		exclusive = true
+		bound = bound[1:]
+	}
+
+	value, err = parseFloat(bound)
+	if err != nil {
+		return 0, false, ErrInvalidRange
+	}
+
+	return value, exclusive, nil
+}
+
+func parseFloat(s string) (float64, error) {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) {
+		return 0, ErrNotFloat
+	}
+
+	return value, nil
+}
+
+func parseInt(s string) (int, error) {
+	value, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+
+	return value, nil
+}
+
+// formatFloat formats float in the redis way: as short as possible and with inf instead of +Inf
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+}
+
+// String returns members with scores, ordered by score
+func (z *zset) String() string {
+	result := "["
+	delimiter := ""
+	for x := z.zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		result += fmt.Sprintf("%s%q: %s", delimiter, x.member, formatFloat(x.score))
+		delimiter = ", "
+	}
+	result += "]"
+
+	return result
+}
@@ -0,0 +1,431 @@
+package core_test
+
+import (
+	"fmt"
+	"github.com/go-test/deep"
+	. "github.com/mshaverdo/radish/core"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func getSampleDataZSet() map[string]*Item {
+	data := getSampleDataCore()
+	data["zset"] = NewItemZSet(map[string]float64{
+		"Abba":      1,
+		"Rammstein": 2.5,
+		"KMFDM":     2.5,
+		"AC/DC":     10,
+	})
+
+	return data
+}
+
+func NewMockStorageZSet() *MockStorage {
+	return &MockStorage{data: getSampleDataZSet()}
+}
+
+func TestCore_ZAdd(t *testing.T) {
+	tests := []struct {
+		key        string
+		args       []string
+		err        error
+		wantResult interface{}
+		want       []string
+	}{
+		{"bytes", []string{"1", "a"}, ErrWrongType, nil, nil},
+		{"404", []string{"1", "a", "2"}, ErrSyntax, nil, nil},
+		{"404", []string{"NX", "XX", "1", "a"}, ErrSyntax, nil, nil},
+		{"404", []string{"NX", "GT", "1", "a"}, ErrSyntax, nil, nil},
+		{"404", []string{"INCR", "1", "a", "2", "b"}, ErrSyntax, nil, nil},
+		{"404", []string{"one", "a"}, ErrNotFloat, nil, nil},
+		{"404", []string{"1", "a", "nan", "b"}, ErrNotFloat, nil, nil},
+		{"404", []string{"XX", "1", "a"}, nil, 0, []string{}},
+		{"404", []string{"2", "b", "1", "a", "3", "b"}, nil, 2, []string{"a", "1", "b", "3"}},
+		{"zset", []string{"0", "Abba", "-inf", "Queen"}, nil, 1, []string{"Queen", "-inf", "Abba", "0", "KMFDM", "2.5", "Rammstein", "2.5", "AC/DC", "10"}},
+		{"zset", []string{"ch", "0", "Abba", "1", "Queen"}, nil, 2, []string{"Abba", "0", "Queen", "1", "KMFDM", "2.5", "Rammstein", "2.5", "AC/DC", "10"}},
+		{"zset", []string{"NX", "CH", "0", "Abba", "1", "Queen"}, nil, 1, []string{"Abba", "1", "Queen", "1", "KMFDM", "2.5", "Rammstein", "2.5", "AC/DC", "10"}},
+		{"zset", []string{"XX", "5", "Abba", "1", "Queen"}, nil, 0, []string{"KMFDM", "2.5", "Rammstein", "2.5", "Abba", "5", "AC/DC", "10"}},
+		{"zset", []string{"GT", "CH", "0", "Abba", "11", "AC/DC"}, nil, 1, []string{"Abba", "1", "KMFDM", "2.5", "Rammstein", "2.5", "AC/DC", "11"}},
+		{"zset", []string{"LT", "CH", "0", "Abba", "11", "AC/DC"}, nil, 1, []string{"Abba", "0", "KMFDM", "2.5", "Rammstein", "2.5", "AC/DC", "10"}},
+		{"zset", []string{"incr", "1.5", "Abba"}, nil, 2.5, []string{"Abba", "2.5", "KMFDM", "2.5", "Rammstein", "2.5", "AC/DC", "10"}},
+		{"zset", []string{"INCR", "NX", "1.5", "Abba"}, ErrNotFound, nil, []string{"Abba", "1", "KMFDM", "2.5", "Rammstein", "2.5", "AC/DC", "10"}},
+		{"zset", []string{"INCR", "LT", "1", "Abba"}, ErrNotFound, nil, []string{"Abba", "1", "KMFDM", "2.5", "Rammstein", "2.5", "AC/DC", "10"}},
+		{"zset", []string{"INCR", "XX", "1", "Queen"}, ErrNotFound, nil, []string{"Abba", "1", "KMFDM", "2.5", "Rammstein", "2.5", "AC/DC", "10"}},
+		{"zset", []string{"INCR", "inf", "AC/DC"}, nil, math.Inf(1), []string{"Abba", "1", "KMFDM", "2.5", "Rammstein", "2.5", "AC/DC", "inf"}},
+	}
+
+	for _, tst := range tests {
+		c := New(NewMockStorageZSet())
+		result, err := c.ZAdd(tst.key, tst.args)
+
+		if err != tst.err {
+			t.Errorf("ZAdd(%q, %q) err: %q != %q", tst.key, tst.args, err, tst.err)
+		}
+		if result != tst.wantResult {
+			t.Errorf("ZAdd(%q, %q) result: %v != %v", tst.key, tst.args, result, tst.wantResult)
+		}
+		if tst.want == nil {
+			continue
+		}
+
+		got, _ := c.ZRange(tst.key, []string{"0", "-1", "WITHSCORES"})
+		if diff := deep.Equal(bytesToStrings(got), tst.want); diff != nil {
+			t.Errorf("ZAdd(%q, %q): %s\n\ngot:%v\n\nwant:%v", tst.key, tst.args, diff, bytesToStrings(got), tst.want)
+		}
+	}
+}
+
+func TestCore_ZIncrBy(t *testing.T) {
+	tests := []struct {
+		key, member string
+		increment   float64
+		err         error
+		want        float64
+	}{
+		{"bytes", "a", 1, ErrWrongType, 0},
+		{"404", "a", 1.5, nil, 1.5},
+		{"404", "a", -3, nil, -1.5},
+		{"zset", "Abba", 10, nil, 11},
+		{"zset", "Abba", math.Inf(1), nil, math.Inf(1)},
+		{"zset", "Abba", math.Inf(-1), ErrNaN, 0},
+	}
+
+	c := New(NewMockStorageZSet())
+
+	for _, tst := range tests {
+		got, err := c.ZIncrBy(tst.key, tst.increment, tst.member)
+		if err != tst.err {
+			t.Errorf("ZIncrBy(%q, %v, %q) err: %q != %q", tst.key, tst.increment, tst.member, err, tst.err)
+		}
+		if got != tst.want {
+			t.Errorf("ZIncrBy(%q, %v, %q): %v != %v", tst.key, tst.increment, tst.member, got, tst.want)
+		}
+		if score, _ := c.ZScore(tst.key, tst.member); err == nil && score != tst.want {
+			t.Errorf("ZIncrBy(%q, %v, %q) score: %v != %v", tst.key, tst.increment, tst.member, score, tst.want)
+		}
+	}
+}
+
+func TestCore_ZRem(t *testing.T) {
+	tests := []struct {
+		key       string
+		members   []string
+		err       error
+		wantCount int
+		want      []string
+	}{
+		{"bytes", []string{"a"}, ErrWrongType, 0, nil},
+		{"404", []string{"a"}, nil, 0, []string{}},
+		{"zset", []string{"Abba", "Queen", "KMFDM"}, nil, 2, []string{"Rammstein", "AC/DC"}},
+	}
+
+	c := New(NewMockStorageZSet())
+
+	for _, tst := range tests {
+		count, err := c.ZRem(tst.key, tst.members)
+		got, _ := c.ZRange(tst.key, []string{"0", "-1"})
+
+		if err != tst.err {
+			t.Errorf("ZRem(%q, %q) err: %q != %q", tst.key, tst.members, err, tst.err)
+		}
+		if count != tst.wantCount {
+			t.Errorf("ZRem(%q, %q) count: %d != %d", tst.key, tst.members, count, tst.wantCount)
+		}
+		if diff := deep.Equal(bytesToStrings(got), tst.want); err == nil && diff != nil {
+			t.Errorf("ZRem(%q, %q): %s\n\ngot:%v\n\nwant:%v", tst.key, tst.members, diff, bytesToStrings(got), tst.want)
+		}
+	}
+}
+
+func TestCore_ZScore(t *testing.T) {
+	tests := []struct {
+		key, member string
+		err         error
+		want        float64
+	}{
+		{"bytes", "a", ErrWrongType, 0},
+		{"404", "a", ErrNotFound, 0},
+		{"zset", "Queen", ErrNotFound, 0},
+		{"zset", "KMFDM", nil, 2.5},
+	}
+
+	c := New(NewMockStorageZSet())
+
+	for _, tst := range tests {
+		got, err := c.ZScore(tst.key, tst.member)
+		if err != tst.err {
+			t.Errorf("ZScore(%q, %q) err: %q != %q", tst.key, tst.member, err, tst.err)
+		}
+		if got != tst.want {
+			t.Errorf("ZScore(%q, %q): %v != %v", tst.key, tst.member, got, tst.want)
+		}
+	}
+}
+
+func TestCore_ZCard(t *testing.T) {
+	tests := []struct {
+		key  string
+		err  error
+		want int
+	}{
+		{"bytes", ErrWrongType, 0},
+		{"404", nil, 0},
+		{"zset", nil, 4},
+	}
+
+	c := New(NewMockStorageZSet())
+
+	for _, tst := range tests {
+		got, err := c.ZCard(tst.key)
+		if err != tst.err {
+			t.Errorf("ZCard(%q) err: %q != %q", tst.key, err, tst.err)
+		}
+		if got != tst.want {
+			t.Errorf("ZCard(%q): %d != %d", tst.key, got, tst.want)
+		}
+	}
+}
+
+func TestCore_ZRank(t *testing.T) {
+	tests := []struct {
+		key, member string
+		err         error
+		want        int
+	}{
+		{"bytes", "a", ErrWrongType, 0},
+		{"404", "a", ErrNotFound, 0},
+		{"zset", "Queen", ErrNotFound, 0},
+		{"zset", "Abba", nil, 0},
+		{"zset", "KMFDM", nil, 1},
+		{"zset", "Rammstein", nil, 2},
+		{"zset", "AC/DC", nil, 3},
+	}
+
+	c := New(NewMockStorageZSet())
+
+	for _, tst := range tests {
+		got, err := c.ZRank(tst.key, tst.member)
+		if err != tst.err {
+			t.Errorf("ZRank(%q, %q) err: %q != %q", tst.key, tst.member, err, tst.err)
+		}
+		if got != tst.want {
+			t.Errorf("ZRank(%q, %q): %d != %d", tst.key, tst.member, got, tst.want)
+		}
+	}
+}
+
+func TestCore_ZCount(t *testing.T) {
+	tests := []struct {
+		key, min, max string
+		err           error
+		want          int
+	}{
+		{"bytes", "0", "1", ErrWrongType, 0},
+		{"404", "0", "1", nil, 0},
+		{"zset", "a", "1", ErrInvalidRange, 0},
+		{"zset", "-inf", "+inf", nil, 4},
+		{"zset", "1", "2.5", nil, 3},
+		{"zset", "(1", "2.5", nil, 2},
+		{"zset", "(1", "(2.5", nil, 0},
+		{"zset", "2.5", "2.5", nil, 2},
+		{"zset", "10", "1", nil, 0},
+		{"zset", "11", "+inf", nil, 0},
+		{"zset", "2.6", "(10", nil, 0},
+	}
+
+	c := New(NewMockStorageZSet())
+
+	for _, tst := range tests {
+		got, err := c.ZCount(tst.key, tst.min, tst.max)
+		if err != tst.err {
+			t.Errorf("ZCount(%q, %q, %q) err: %q != %q", tst.key, tst.min, tst.max, err, tst.err)
+		}
+		if got != tst.want {
+			t.Errorf("ZCount(%q, %q, %q): %d != %d", tst.key, tst.min, tst.max, got, tst.want)
+		}
+	}
+}
+
+func TestCore_ZRange(t *testing.T) {
+	tests := []struct {
+		key     string
+		args    []string
+		reverse bool
+		err     error
+		want    []string
+	}{
+		{"bytes", []string{"0", "1"}, false, ErrWrongType, nil},
+		{"404", []string{"0", "1"}, false, nil, []string{}},
+		{"zset", []string{"0"}, false, ErrSyntax, nil},
+		{"zset", []string{"0", "a"}, false, ErrNotInteger, nil},
+		{"zset", []string{"0", "1", "SCORES"}, false, ErrSyntax, nil},
+		{"zset", []string{"0", "-1"}, false, nil, []string{"Abba", "KMFDM", "Rammstein", "AC/DC"}},
+		{"zset", []string{"1", "2", "withscores"}, false, nil, []string{"KMFDM", "2.5", "Rammstein", "2.5"}},
+		{"zset", []string{"-2", "100"}, false, nil, []string{"Rammstein", "AC/DC"}},
+		{"zset", []string{"3", "1"}, false, nil, []string{}},
+		{"zset", []string{"0", "-1"}, true, nil, []string{"AC/DC", "Rammstein", "KMFDM", "Abba"}},
+		{"zset", []string{"0", "0", "WITHSCORES"}, true, nil, []string{"AC/DC", "10"}},
+		{"zset", []string{"-100", "-3"}, true, nil, []string{"AC/DC", "Rammstein"}},
+	}
+
+	c := New(NewMockStorageZSet())
+
+	for _, tst := range tests {
+		var (
+			result [][]byte
+			err    error
+		)
+		if tst.reverse {
+			result, err = c.ZRevRange(tst.key, tst.args)
+		} else {
+			result, err = c.ZRange(tst.key, tst.args)
+		}
+
+		if err != tst.err {
+			t.Errorf("ZRange(%q, %q) reverse %t err: %q != %q", tst.key, tst.args, tst.reverse, err, tst.err)
+		}
+		if diff := deep.Equal(bytesToStrings(result), tst.want); err == nil && diff != nil {
+			t.Errorf("ZRange(%q, %q) reverse %t: %s\n\ngot:%v\n\nwant:%v", tst.key, tst.args, tst.reverse, diff, bytesToStrings(result), tst.want)
+		}
+	}
+}
+
+func TestCore_ZRangeByScore(t *testing.T) {
+	tests := []struct {
+		key  string
+		args []string
+		err  error
+		want []string
+	}{
+		{"bytes", []string{"0", "1"}, ErrWrongType, nil},
+		{"404", []string{"0", "1"}, nil, []string{}},
+		{"zset", []string{"0"}, ErrSyntax, nil},
+		{"zset", []string{"0", "1", "LIMIT", "1"}, ErrSyntax, nil},
+		{"zset", []string{"0", "1", "LIMIT", "a", "1"}, ErrNotInteger, nil},
+		{"zset", []string{"-inf", "+inf"}, nil, []string{"Abba", "KMFDM", "Rammstein", "AC/DC"}},
+		{"zset", []string{"(1", "10", "WITHSCORES"}, nil, []string{"KMFDM", "2.5", "Rammstein", "2.5", "AC/DC", "10"}},
+		{"zset", []string{"-inf", "+inf", "LIMIT", "1", "2"}, nil, []string{"KMFDM", "Rammstein"}},
+		{"zset", []string{"-inf", "(10", "limit", "1", "-1", "withscores"}, nil, []string{"KMFDM", "2.5", "Rammstein", "2.5"}},
+		{"zset", []string{"-inf", "+inf", "LIMIT", "-1", "2"}, nil, []string{}},
+		{"zset", []string{"-inf", "+inf", "LIMIT", "10", "2"}, nil, []string{}},
+		{"zset", []string{"11", "12"}, nil, []string{}},
+	}
+
+	c := New(NewMockStorageZSet())
+
+	for _, tst := range tests {
+		result, err := c.ZRangeByScore(tst.key, tst.args)
+		if err != tst.err {
+			t.Errorf("ZRangeByScore(%q, %q) err: %q != %q", tst.key, tst.args, err, tst.err)
+		}
+		if diff := deep.Equal(bytesToStrings(result), tst.want); err == nil && diff != nil {
+			t.Errorf("ZRangeByScore(%q, %q): %s\n\ngot:%v\n\nwant:%v", tst.key, tst.args, diff, bytesToStrings(result), tst.want)
+		}
+	}
+}
+
+func TestCore_ZPop(t *testing.T) {
+	c := New(NewMockStorageZSet())
+
+	if _, err := c.ZPopMin("bytes"); err != ErrWrongType {
+		t.Errorf("ZPopMin(%q) err: %q != %q", "bytes", err, ErrWrongType)
+	}
+
+	tests := []struct {
+		max  bool
+		want []string
+	}{
+		{false, []string{"Abba", "1"}},
+		{true, []string{"AC/DC", "10"}},
+		{true, []string{"Rammstein", "2.5"}},
+		{false, []string{"KMFDM", "2.5"}},
+		{false, []string{}},
+	}
+
+	for _, tst := range tests {
+		var (
+			result [][]byte
+			err    error
+		)
+		if tst.max {
+			result, err = c.ZPopMax("zset")
+		} else {
+			result, err = c.ZPopMin("zset")
+		}
+
+		if err != nil {
+			t.Errorf("ZPop max %t err: %q", tst.max, err)
+		}
+		if diff := deep.Equal(bytesToStrings(result), tst.want); diff != nil {
+			t.Errorf("ZPop max %t: %s\n\ngot:%v\n\nwant:%v", tst.max, diff, bytesToStrings(result), tst.want)
+		}
+	}
+}
+
+// TestCore_ZSetRandom checks skiplist ordering and ranks against sorted slice
+func TestCore_ZSetRandom(t *testing.T) {
+	c := New(NewStorageHash())
+	scores := map[string]float64{}
+	for i := 0; i < 3000; i++ {
+		member := fmt.Sprintf("m_%d", rand.Intn(1000))
+		if rand.Intn(4) == 0 {
+			c.ZRem("zset", []string{member})
+			delete(scores, member)
+			continue
+		}
+
+		score := float64(rand.Intn(100))
+		c.ZAdd("zset", []string{strconv.FormatFloat(score, 'f', -1, 64), member})
+		scores[member] = score
+	}
+
+	var want []string
+	for member := range scores {
+		want = append(want, member)
+	}
+	sort.Slice(want, func(i, j int) bool {
+		si, sj := scores[want[i]], scores[want[j]]
+		return si < sj || si == sj && want[i] < want[j]
+	})
+
+	got, _ := c.ZRange("zset", []string{"0", "-1"})
+	if diff := deep.Equal(bytesToStrings(got), want); diff != nil {
+		t.Errorf("ZRange(): %s", diff)
+	}
+
+	for i, member := range want {
+		if rank, _ := c.ZRank("zset", member); rank != i {
+			t.Errorf("ZRank(%q): %d != %d", member, rank, i)
+		}
+	}
+
+	if count, _ := c.ZCount("zset", "10", "(50"); count != len(filterScores(scores, 10, 50)) {
+		t.Errorf("ZCount(): %d != %d", count, len(filterScores(scores, 10, 50)))
+	}
+}
+
+func filterScores(scores map[string]float64, min, max float64) (result []string) {
+	for member, score := range scores {
+		if score >= min && score < max {
+			result = append(result, member)
+		}
+	}
+
+	return result
+}
+
+func bytesToStrings(values [][]byte) []string {
+	if values == nil {
+		return nil
+	}
+
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = string(v)
+	}
+
+	return result
+}
@@ -3,6 +3,7 @@ package message
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"time"
 )
@@ -30,6 +31,19 @@ func (r *Request) GetArgumentInt(i int) (result int, err error) {
 	return result, err
 }
 
+// GetArgumentFloat returns float64 argument by index i. Return error if unable to parse float, or requested index too big
+func (r *Request) GetArgumentFloat(i int) (result float64, err error) {
+	if i > len(r.Args)-1 {
+		return 0, errors.New(fmt.Sprintf("Trying to get not existing argument: %d > %d", i, len(r.Args)-1))
+	}
+
+	if result, err = strconv.ParseFloat(string(r.Args[i]), 64); err != nil || math.IsNaN(result) {
+		return 0, errors.New(fmt.Sprintf("Args[%d] isn't float: %q", i, r.Args[i]))
+	}
+
+	return result, nil
+}
+
 // GetArgumentInt returns string argument by index i. Return error if requested index too big
 func (r *Request) GetArgumentString(i int) (result string, err error) {
 	if i > len(r.Args)-1 {
@@ -60,6 +74,16 @@ func (r *Request) GetArgumentVariadicBytes(i int) (result [][]byte, err error) {
 	return r.Args[i:], nil
 }
 
+// GetArgumentOptionalString returns rest of string args beginning from i index, or nil if there are no such args
+func (r *Request) GetArgumentOptionalString(i int) (result []string) {
+	if i > len(r.Args)-1 {
+		return nil
+	}
+
+	result, _ = r.GetArgumentVariadicString(i)
+	return result
+}
+
 // GetArgumentBytes returns bytes argument by index i. Return error if requested index too big
 func (r *Request) GetArgumentBytes(i int) (result []byte, err error) {
 	if i > len(r.Args)-1 {
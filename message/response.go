@@ -15,6 +15,16 @@ const (
 	StatusInvalidCommand
 	StatusInvalidArguments
 	StatusTypeMismatch
+	// StatusScriptError is an error of a script, which message already starts with an error code, like NOSCRIPT
+	StatusScriptError
+	// StatusReadOnly is returned on attempt to modify the storage of a read-only replica
+	StatusReadOnly
+	// StatusRedirect is returned by a cluster node for keys served by another node, the message is MOVED or ASK redirect
+	StatusRedirect
+	// StatusClusterError is a cluster error, which message starts with its own error code, like CROSSSLOT
+	StatusClusterError
+	// StatusOutOfMemory is returned on attempt to increase memory usage, when used memory reaches maxmemory
+	StatusOutOfMemory
 )
 
 // Response is a container, represents a Response to Request Command
@@ -88,6 +98,43 @@ func (r *ResponseInt) String() string {
 	)
 }
 
+///////////////////////// ResponseIntSlice ///////////////////////////////////
+type ResponseIntSlice struct {
+	status  Status
+	payload []int
+}
+
+var _ Response = (*ResponseIntSlice)(nil)
+
+func NewResponseIntSlice(status Status, payload []int) *ResponseIntSlice {
+	return &ResponseIntSlice{status: status, payload: payload}
+}
+
+func (r *ResponseIntSlice) Payload() []int {
+	return r.payload
+}
+
+func (r *ResponseIntSlice) Status() Status {
+	return r.status
+}
+
+func (r *ResponseIntSlice) Bytes() [][]byte {
+	result := make([][]byte, len(r.payload))
+	for i, v := range r.payload {
+		result[i] = []byte(strconv.Itoa(v))
+	}
+
+	return result
+}
+
+func (r *ResponseIntSlice) String() string {
+	return fmt.Sprintf(
+		"ResponseIntSlice{\n\tStatus: %q \n\tPayload: %d \n}",
+		r.status,
+		r.payload,
+	)
+}
+
 ///////////////////////// ResponseString ///////////////////////////////////
 type ResponseString struct {
 	status  Status
@@ -155,3 +202,84 @@ func (r *ResponseStringSlice) String() string {
 		strPayload,
 	)
 }
+
+///////////////////////// ResponseCursor ///////////////////////////////////
+type ResponseCursor struct {
+	status  Status
+	cursor  int
+	payload [][]byte
+}
+
+var _ Response = (*ResponseCursor)(nil)
+
+func NewResponseCursor(status Status, cursor int, payload [][]byte) *ResponseCursor {
+	return &ResponseCursor{status: status, cursor: cursor, payload: payload}
+}
+
+func (r *ResponseCursor) Cursor() int {
+	return r.cursor
+}
+
+func (r *ResponseCursor) Payload() [][]byte {
+	return r.payload
+}
+
+func (r *ResponseCursor) Status() Status {
+	return r.status
+}
+
+// Bytes returns cursor, followed by payload elements
+func (r *ResponseCursor) Bytes() [][]byte {
+	return append([][]byte{[]byte(strconv.Itoa(r.cursor))}, r.payload...)
+}
+
+func (r *ResponseCursor) String() string {
+	strPayload := make([]string, len(r.payload))
+	for i, v := range r.payload {
+		strPayload[i] = string(v)
+	}
+	return fmt.Sprintf(
+		"ResponseCursor{\n\tStatus: %q \n\tCursor: %d \n\tPayload: %q \n}",
+		r.status,
+		r.cursor,
+		strPayload,
+	)
+}
+
+///////////////////////// ResponseSlice ///////////////////////////////////
+// ResponseSlice contains responses to several requests, e.g. to requests of a transaction
+type ResponseSlice struct {
+	status  Status
+	payload []Response
+}
+
+var _ Response = (*ResponseSlice)(nil)
+
+func NewResponseSlice(status Status, payload []Response) *ResponseSlice {
+	return &ResponseSlice{status: status, payload: payload}
+}
+
+func (r *ResponseSlice) Payload() []Response {
+	return r.payload
+}
+
+func (r *ResponseSlice) Status() Status {
+	return r.status
+}
+
+// Bytes returns payloads of all the responses one after another
+func (r *ResponseSlice) Bytes() (result [][]byte) {
+	for _, v := range r.payload {
+		result = append(result, v.Bytes()...)
+	}
+
+	return result
+}
+
+func (r *ResponseSlice) String() string {
+	return fmt.Sprintf(
+		"ResponseSlice{\n\tStatus: %q \n\tPayload: %s \n}",
+		r.status,
+		r.payload,
+	)
+}
@@ -4,9 +4,9 @@ package message
 
 import "strconv"
 
-const _Status_name = "StatusOkStatusErrorStatusNotFoundStatusInvalidCommandStatusInvalidArgumentsStatusTypeMismatch"
+const _Status_name = "StatusOkStatusErrorStatusNotFoundStatusInvalidCommandStatusInvalidArgumentsStatusTypeMismatchStatusScriptErrorStatusReadOnlyStatusRedirectStatusClusterErrorStatusOutOfMemory"
 
-var _Status_index = [...]uint8{0, 8, 19, 33, 53, 75, 93}
+var _Status_index = [...]uint8{0, 8, 19, 33, 53, 75, 93, 110, 124, 138, 156, 173}
 
 func (i Status) String() string {
 	if i < 0 || i >= Status(len(_Status_index)-1) {
@@ -0,0 +1,127 @@
+// Package pubsub implements publish/subscribe messaging: a message, published into a channel,
+// is delivered to all the subscribers of the channel and of the glob patterns, matching the channel
+package pubsub
+
+import (
+	"github.com/ryanuber/go-glob"
+	"sort"
+	"sync"
+)
+
+// Message is a message, delivered to a subscriber.
+// Pattern is the matched pattern, or empty string if the message is received by channel subscription
+type Message struct {
+	Pattern string
+	Channel string
+	Payload []byte
+}
+
+// subscriptions maps channel or pattern to its subscribers
+type subscriptions map[string]map[*Subscriber]struct{}
+
+// Broker delivers published messages to subscribers
+type Broker struct {
+	mutex    sync.RWMutex
+	channels subscriptions
+	patterns subscriptions
+}
+
+// NewBroker Constructs new instance of Broker
+func NewBroker() *Broker {
+	return &Broker{
+		channels: make(subscriptions),
+		patterns: make(subscriptions),
+	}
+}
+
+// NewSubscriber returns new subscriber without subscriptions. It should be closed, when it isn't needed anymore
+func (b *Broker) NewSubscriber() *Subscriber {
+	return &Subscriber{
+		broker:   b,
+		messages: make(chan Message, SubscriberBufferSize),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+}
+
+// Publish delivers payload to all the subscribers of the channel and of the patterns, matching the channel.
+// Returns the number of receivers, so the subscriber of both the channel and a matching pattern is counted twice
+func (b *Broker) Publish(channel string, payload []byte) (count int) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for subscriber := range b.channels[channel] {
+		if subscriber.deliver(Message{Channel: channel, Payload: payload}) {
+			count++
+		}
+	}
+
+	for pattern, subscribers := range b.patterns {
+		if !glob.Glob(pattern, channel) {
+			continue
+		}
+
+		for subscriber := range subscribers {
+			if subscriber.deliver(Message{Pattern: pattern, Channel: channel, Payload: payload}) {
+				count++
+			}
+		}
+	}
+
+	return count
+}
+
+// Channels returns sorted active channels, matching the glob pattern. Active channel has at least one subscriber.
+// Empty pattern matches all the channels
+func (b *Broker) Channels(pattern string) (result []string) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	result = make([]string, 0, len(b.channels))
+	for channel := range b.channels {
+		if pattern == "" || glob.Glob(pattern, channel) {
+			result = append(result, channel)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// NumSub returns the number of subscribers of the channel, not counting subscribers of patterns
+func (b *Broker) NumSub(channel string) (count int) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return len(b.channels[channel])
+}
+
+// NumPat returns the number of unique patterns, subscribed by all the subscribers
+func (b *Broker) NumPat() (count int) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return len(b.patterns)
+}
+
+// add subscribes subscriber to the channel or pattern name
+func (b *Broker) add(subs subscriptions, name string, subscriber *Subscriber) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if subs[name] == nil {
+		subs[name] = make(map[*Subscriber]struct{})
+	}
+	subs[name][subscriber] = struct{}{}
+}
+
+// remove unsubscribes subscriber from the channel or pattern name. Channel without subscribers is removed
+func (b *Broker) remove(subs subscriptions, name string, subscriber *Subscriber) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(subs[name], subscriber)
+	if len(subs[name]) == 0 {
+		delete(subs, name)
+	}
+}
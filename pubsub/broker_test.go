@@ -0,0 +1,144 @@
+package pubsub_test
+
+import (
+	"github.com/go-test/deep"
+	"github.com/mshaverdo/radish/pubsub"
+	"testing"
+)
+
+func TestBroker_Publish(t *testing.T) {
+	b := pubsub.NewBroker()
+
+	news := b.NewSubscriber()
+	defer news.Close()
+	if diff := deep.Equal(news.Subscribe([]string{"news", "sport", "news"}), []int{1, 2, 2}); diff != nil {
+		t.Errorf("Subscribe(): %s", diff)
+	}
+
+	all := b.NewSubscriber()
+	defer all.Close()
+	if diff := deep.Equal(all.PSubscribe([]string{"*", "new*"}), []int{1, 2}); diff != nil {
+		t.Errorf("PSubscribe(): %s", diff)
+	}
+
+	tests := []struct {
+		channel   string
+		wantCount int
+		want      map[*pubsub.Subscriber][]pubsub.Message
+	}{
+		{
+			"news",
+			3,
+			map[*pubsub.Subscriber][]pubsub.Message{
+				news: {{Channel: "news", Payload: []byte("news")}},
+				all:  {{Pattern: "*", Channel: "news", Payload: []byte("news")}, {Pattern: "new*", Channel: "news", Payload: []byte("news")}},
+			},
+		},
+		{
+			"weather",
+			1,
+			map[*pubsub.Subscriber][]pubsub.Message{
+				news: nil,
+				all:  {{Pattern: "*", Channel: "weather", Payload: []byte("weather")}},
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		if count := b.Publish(tst.channel, []byte(tst.channel)); count != tst.wantCount {
+			t.Errorf("Publish(%q): %d != %d", tst.channel, count, tst.wantCount)
+		}
+
+		for subscriber, want := range tst.want {
+			var got []pubsub.Message
+			for len(subscriber.Messages()) > 0 {
+				got = append(got, <-subscriber.Messages())
+			}
+
+			// messages of different patterns are delivered in random order
+			if len(got) == 2 && got[0].Pattern > got[1].Pattern {
+				got[0], got[1] = got[1], got[0]
+			}
+
+			if diff := deep.Equal(got, want); diff != nil {
+				t.Errorf("Publish(%q): %s\n\ngot:%v\n\nwant:%v", tst.channel, diff, got, want)
+			}
+		}
+	}
+}
+
+func TestBroker_Introspection(t *testing.T) {
+	b := pubsub.NewBroker()
+
+	s1 := b.NewSubscriber()
+	s1.Subscribe([]string{"news", "sport"})
+	s1.PSubscribe([]string{"n*"})
+
+	s2 := b.NewSubscriber()
+	s2.Subscribe([]string{"news", "music"})
+	s2.PSubscribe([]string{"n*", "m*"})
+
+	if diff := deep.Equal(b.Channels(""), []string{"music", "news", "sport"}); diff != nil {
+		t.Errorf("Channels(): %s", diff)
+	}
+	if diff := deep.Equal(b.Channels("*s*"), []string{"music", "news", "sport"}); diff != nil {
+		t.Errorf("Channels(*s*): %s", diff)
+	}
+	if diff := deep.Equal(b.Channels("n*"), []string{"news"}); diff != nil {
+		t.Errorf("Channels(n*): %s", diff)
+	}
+	if got := b.NumSub("news"); got != 2 {
+		t.Errorf("NumSub(news): %d != 2", got)
+	}
+	if got := b.NumPat(); got != 2 {
+		t.Errorf("NumPat(): %d != 2", got)
+	}
+
+	unsubscribed, counts := s1.Unsubscribe(nil)
+	if diff := deep.Equal(unsubscribed, []string{"news", "sport"}); diff != nil {
+		t.Errorf("Unsubscribe(): %s", diff)
+	}
+	if diff := deep.Equal(counts, []int{2, 1}); diff != nil {
+		t.Errorf("Unsubscribe(): %s", diff)
+	}
+
+	s2.Close()
+	if _, ok := <-s2.Messages(); ok {
+		t.Errorf("Messages() isn't closed by Close()")
+	}
+
+	if diff := deep.Equal(b.Channels(""), []string{}); diff != nil {
+		t.Errorf("Channels() after unsubscribe: %s", diff)
+	}
+	if got := b.NumPat(); got != 1 {
+		t.Errorf("NumPat() after unsubscribe: %d != 1", got)
+	}
+	if got := b.Publish("news", nil); got != 1 {
+		t.Errorf("Publish() after unsubscribe: %d != 1", got)
+	}
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	b := pubsub.NewBroker()
+	s := b.NewSubscriber()
+	defer s.Close()
+	s.Subscribe([]string{"flood"})
+
+	for i := 0; i < pubsub.SubscriberBufferSize; i++ {
+		if count := b.Publish("flood", nil); count != 1 {
+			t.Fatalf("Publish() #%d: %d != 1", i, count)
+		}
+	}
+
+	if count := b.Publish("flood", nil); count != 0 {
+		t.Errorf("Publish() to the full subscriber: %d != 0", count)
+	}
+
+	received := 0
+	for range s.Messages() {
+		received++
+	}
+	if received != pubsub.SubscriberBufferSize {
+		t.Errorf("received %d != %d", received, pubsub.SubscriberBufferSize)
+	}
+}
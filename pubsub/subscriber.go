@@ -0,0 +1,124 @@
+package pubsub
+
+import (
+	"sort"
+	"sync"
+)
+
+// SubscriberBufferSize is the max count of messages, waiting for delivery to a subscriber.
+// Like in Redis with client-output-buffer-limit for pubsub clients, the subscriber, which can't keep up
+// with published messages, is disconnected: its Messages() channel is closed
+const SubscriberBufferSize = 1024
+
+// Subscriber receives messages, published into subscribed channels and channels, matching subscribed patterns.
+// Subscribe and unsubscribe methods should be called by a single goroutine, which owns the subscriber
+type Subscriber struct {
+	broker *Broker
+
+	// mutex protects messages against sending after close
+	mutex    sync.Mutex
+	isClosed bool
+	messages chan Message
+
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+// Messages returns channel of received messages. It's closed when the subscriber is closed or can't keep up
+func (s *Subscriber) Messages() <-chan Message {
+	return s.messages
+}
+
+// Count returns the number of subscribed channels and patterns
+func (s *Subscriber) Count() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+// Subscribe subscribes to the channels and returns the number of subscriptions after every channel
+func (s *Subscriber) Subscribe(channels []string) (counts []int) {
+	return s.subscribe(s.broker.channels, s.channels, channels)
+}
+
+// PSubscribe subscribes to the glob patterns and returns the number of subscriptions after every pattern
+func (s *Subscriber) PSubscribe(patterns []string) (counts []int) {
+	return s.subscribe(s.broker.patterns, s.patterns, patterns)
+}
+
+// Unsubscribe unsubscribes from the channels, or from all the channels if channels is empty.
+// Returns unsubscribed channels and the number of subscriptions after every channel
+func (s *Subscriber) Unsubscribe(channels []string) (unsubscribed []string, counts []int) {
+	return s.unsubscribe(s.broker.channels, s.channels, channels)
+}
+
+// PUnsubscribe unsubscribes from the patterns, or from all the patterns if patterns is empty.
+// Returns unsubscribed patterns and the number of subscriptions after every pattern
+func (s *Subscriber) PUnsubscribe(patterns []string) (unsubscribed []string, counts []int) {
+	return s.unsubscribe(s.broker.patterns, s.patterns, patterns)
+}
+
+// Close unsubscribes from all the channels and patterns and closes Messages() channel
+func (s *Subscriber) Close() {
+	s.Unsubscribe(nil)
+	s.PUnsubscribe(nil)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.isClosed {
+		s.isClosed = true
+		close(s.messages)
+	}
+}
+
+func (s *Subscriber) subscribe(brokerSubs subscriptions, own map[string]struct{}, names []string) (counts []int) {
+	counts = make([]int, len(names))
+	for i, name := range names {
+		if _, ok := own[name]; !ok {
+			own[name] = struct{}{}
+			s.broker.add(brokerSubs, name, s)
+		}
+		counts[i] = s.Count()
+	}
+
+	return counts
+}
+
+func (s *Subscriber) unsubscribe(brokerSubs subscriptions, own map[string]struct{}, names []string) (unsubscribed []string, counts []int) {
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	counts = make([]int, len(names))
+	for i, name := range names {
+		if _, ok := own[name]; ok {
+			delete(own, name)
+			s.broker.remove(brokerSubs, name, s)
+		}
+		counts[i] = s.Count()
+	}
+
+	return names, counts
+}
+
+// deliver sends message to the subscriber without blocking. Returns false, if the subscriber is closed.
+// The subscriber with full buffer is closed
+func (s *Subscriber) deliver(message Message) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.isClosed {
+		return false
+	}
+
+	select {
+	case s.messages <- message:
+		return true
+	default:
+		s.isClosed = true
+		close(s.messages)
+		return false
+	}
+}
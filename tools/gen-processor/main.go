@@ -11,6 +11,8 @@ import (
 	"io/ioutil"
 	"log"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -22,14 +24,57 @@ type Command struct {
 	Result      string
 	Error       string
 	IsModifying bool
+	IsDenyOom   bool
 	TtlArgIndex string
+	IsTtlOption bool
 	IsVariadic  bool
+	ReplayCmd   string
+
+	// IsModifyingNotFound is true, if the command modifies a storage even though it responds NotFound,
+	// like GETSET of not existing key. If NotFoundOption is set, it's true only if the option is passed
+	// among optional arguments, beginning from OptionsArgIndex
+	IsModifyingNotFound bool
+	NotFoundOption      string
+	OptionsArgIndex     int
+
+	// AbsTtlArgIndex is index of the relative TTL argument in AbsTtlUnit, which is logged into WAL as AbsTtlRequest
+	// with absolute expiration time. If IsAbsTtlOption is true, TTL is passed as EX/PX options beginning from the index
+	AbsTtlArgIndex string
+	AbsTtlUnit     string
+	AbsTtlRequest  string
+	IsAbsTtlOption bool
+
+	// KeyArgs are indexes of the arguments, which are keys. KeysFrom is index of the variadic keys argument,
+	// which takes the rest of the arguments: every argument if KeysStep is 1, or every second one, like MSET pairs
+	KeyArgs  []int
+	KeysFrom int
+	KeysStep int
+}
+
+// HasKeys returns true, if the command has key arguments
+func (c Command) HasKeys() bool {
+	return len(c.KeyArgs) > 0 || c.KeysStep > 0
 }
 
 type Data struct {
 	PackageName       string
 	Commands          []Command
 	ModifyingCommands []Command
+	DenyOomCommands   []Command
+	ReplayCommands    []Command
+	KeyGroups         []KeyGroup
+	// ModifyingNotFoundCommands are commands, which modify a storage even though they respond NotFound
+	ModifyingNotFoundCommands []Command
+	// AbsTtlCommands are commands with relative TTL, which are logged into WAL with absolute expiration time
+	AbsTtlCommands []Command
+}
+
+// KeyGroup is a group of commands with the same key arguments
+type KeyGroup struct {
+	Cmds     []string
+	KeyArgs  []int
+	KeysFrom int
+	KeysStep int
 }
 
 func main() {
@@ -56,7 +101,15 @@ func main() {
 		if strings.HasSuffix(pkg.Name, "_test") {
 			continue
 		}
-		for _, file := range pkg.Files {
+		// pkg.Files is a map, so sort file names to make generated code stable
+		var fileNames []string
+		for fileName := range pkg.Files {
+			fileNames = append(fileNames, fileName)
+		}
+		sort.Strings(fileNames)
+
+		for _, fileName := range fileNames {
+			file := pkg.Files[fileName]
 			fmt.Printf("parsing %s\n", file.Name)
 			commands = append(commands, getCommands(file)...)
 		}
@@ -71,6 +124,21 @@ func main() {
 		if c.IsModifying {
 			data.ModifyingCommands = append(data.ModifyingCommands, c)
 		}
+		if c.IsDenyOom {
+			data.DenyOomCommands = append(data.DenyOomCommands, c)
+		}
+		if c.IsModifyingNotFound {
+			data.ModifyingNotFoundCommands = append(data.ModifyingNotFoundCommands, c)
+		}
+		if c.AbsTtlArgIndex != "" {
+			data.AbsTtlCommands = append(data.AbsTtlCommands, c)
+		}
+		if c.ReplayCmd != "" {
+			data.ReplayCommands = append(data.ReplayCommands, c)
+		}
+		if c.HasKeys() {
+			data.KeyGroups = addToKeyGroups(data.KeyGroups, c)
+		}
 	}
 
 	tmpl, err := template.ParseFiles(tmplFile)
@@ -100,7 +168,11 @@ func getCommands(f *ast.File) []Command {
 
 	commandRe := regexp.MustCompile("(?i)^//\\s*@command\\s+(\\w+)")
 	ttlRe := regexp.MustCompile("(?i)^//\\s*@Ttl\\s+(\\d+)")
-	isModifyingRe := regexp.MustCompile("(?i)^//\\s*@modifying")
+	isModifyingRe := regexp.MustCompile("(?i)^//\\s*@modifying\\s*$")
+	modifyingNotFoundRe := regexp.MustCompile("(?i)^//\\s*@modifyingnotfound(?:\\s+(\\w+))?")
+	isDenyOomRe := regexp.MustCompile("(?i)^//\\s*@denyoom")
+	replayRe := regexp.MustCompile("(?i)^//\\s*@replay\\s+(\\w+)")
+	absTtlRe := regexp.MustCompile("(?i)^//\\s*@absttl\\s+(\\d+)\\s+(seconds|milliseconds|options)(?:\\s+(.+?))?\\s*$")
 
 	for _, decl := range f.Decls {
 		fn, ok := decl.(*ast.FuncDecl)
@@ -117,15 +189,32 @@ func getCommands(f *ast.File) []Command {
 		}
 
 		isModifying := false
+		isDenyOom := false
+		isModifyingNotFound := false
+		notFoundOption := ""
 		cmd := ""
 		ttlArgIndex := ""
+		replayCmd := ""
+		var absTtl []string
 		for _, docStr := range fn.Doc.List {
 			if isModifyingRe.FindString(docStr.Text) != "" {
 				isModifying = true
 				continue
 			}
 
-			matches := commandRe.FindStringSubmatch(docStr.Text)
+			if isDenyOomRe.FindString(docStr.Text) != "" {
+				isDenyOom = true
+				continue
+			}
+
+			matches := modifyingNotFoundRe.FindStringSubmatch(docStr.Text)
+			if len(matches) == 2 {
+				isModifyingNotFound = true
+				notFoundOption = strings.ToUpper(matches[1])
+				continue
+			}
+
+			matches = commandRe.FindStringSubmatch(docStr.Text)
 			if len(matches) == 2 {
 				cmd = matches[1]
 				continue
@@ -136,6 +225,18 @@ func getCommands(f *ast.File) []Command {
 				ttlArgIndex = matches[1]
 				continue
 			}
+
+			matches = replayRe.FindStringSubmatch(docStr.Text)
+			if len(matches) == 2 {
+				replayCmd = matches[1]
+				continue
+			}
+
+			matches = absTtlRe.FindStringSubmatch(docStr.Text)
+			if len(matches) == 4 {
+				absTtl = matches[1:]
+				continue
+			}
 		}
 
 		if cmd == "" {
@@ -148,8 +249,40 @@ func getCommands(f *ast.File) []Command {
 			Function:    fn.Name.Name,
 			Args:        args,
 			IsModifying: isModifying,
+			IsDenyOom:   isDenyOom,
 			TtlArgIndex: ttlArgIndex,
 			IsVariadic:  variadic,
+			ReplayCmd:   replayCmd,
+
+			IsModifyingNotFound: isModifyingNotFound,
+			NotFoundOption:      notFoundOption,
+		}
+
+		setKeyArgs(&c, getArgNames(fn.Type.Params.List))
+
+		if notFoundOption != "" {
+			// the option is searched among optional keyword arguments, like SET key value GET
+			c.OptionsArgIndex = len(args) - 1
+			if len(args) == 0 || args[c.OptionsArgIndex] != "...string" {
+				log.Fatalf("%s(): @modifyingnotfound option requires optional arguments", fn.Name.Name)
+			}
+		}
+
+		if absTtl != nil {
+			setAbsTtl(&c, fn.Name.Name, absTtl[0], strings.ToLower(absTtl[1]), absTtl[2])
+		} else if isModifying {
+			// relative TTL in WAL depends on the time passed since the request was processed, so it must be rewritten
+			for _, name := range getArgNames(fn.Type.Params.List) {
+				if name == "seconds" || name == "milliseconds" || name == "ttl" {
+					log.Fatalf("%s(): modifying command with relative TTL %s requires @absttl", fn.Name.Name, name)
+				}
+			}
+		}
+
+		if ttlArgIndex != "" {
+			// TTL could be passed as optional keyword argument, like SET key value EX 10
+			index, _ := strconv.Atoi(ttlArgIndex)
+			c.IsTtlOption = index < len(args) && args[index] == "...string"
 		}
 
 		fmt.Printf("\n\n=== %s() is a command %s, variadic: %t\n", fn.Name.Name, cmd, variadic)
@@ -178,6 +311,7 @@ func getCommands(f *ast.File) []Command {
 		fmt.Printf("Args: %s\n", c.Args)
 		fmt.Printf("Result: %s\n", c.Result)
 		fmt.Printf("Err: %s\n", c.Error)
+		fmt.Printf("Keys: %v, from %d step %d\n", c.KeyArgs, c.KeysFrom, c.KeysStep)
 		commands = append(commands, c)
 	}
 
@@ -191,6 +325,8 @@ func getArgs(list []*ast.Field) (args []string, isVariadic bool) {
 			switch paramType := p.Type.(type) {
 			case *ast.Ident:
 				args = append(args, paramType.Name)
+			case *ast.InterfaceType:
+				args = append(args, "interface{}")
 			case *ast.ArrayType:
 				is2d := false
 				var EltName string
@@ -210,6 +346,8 @@ func getArgs(list []*ast.Field) (args []string, isVariadic bool) {
 					strType += "[]string"
 				case "byte":
 					strType += "[]byte"
+				case "int":
+					strType += "[]int"
 				default:
 					log.Fatalf("Unknown Elt type: %v", paramType.Elt.(*ast.Ident).Name)
 				}
@@ -219,6 +357,13 @@ func getArgs(list []*ast.Field) (args []string, isVariadic bool) {
 
 				args = append(args, strType)
 				//fmt.Printf("%s\n", strType)
+			case *ast.Ellipsis:
+				// optional trailing arguments, like SET key value [NX|XX] [EX seconds]
+				if elt, ok := paramType.Elt.(*ast.Ident); !ok || elt.Name != "string" {
+					log.Fatalf("Unknown Ellipsis Elt type: %v", paramType.Elt)
+				}
+				isVariadic = true
+				args = append(args, "...string")
 			default:
 				log.Fatalf("NEW ARG TYPE: %T\n", p.Type)
 
@@ -228,3 +373,75 @@ func getArgs(list []*ast.Field) (args []string, isVariadic bool) {
 
 	return args, isVariadic
 }
+
+func getArgNames(list []*ast.Field) (names []string) {
+	for _, p := range list {
+		for _, name := range p.Names {
+			names = append(names, name.Name)
+		}
+	}
+
+	return names
+}
+
+// setKeyArgs finds key arguments of the command by the names of Core method parameters:
+// key, newKey, source and destination are single keys, keys are the rest arguments and pairs are key/value pairs
+func setKeyArgs(c *Command, names []string) {
+	for i, name := range names {
+		switch name {
+		case "key", "newKey", "source", "destination":
+			c.KeyArgs = append(c.KeyArgs, i)
+		case "keys":
+			c.KeysFrom, c.KeysStep = i, 1
+		case "pairs":
+			c.KeysFrom, c.KeysStep = i, 2
+		}
+	}
+}
+
+// setAbsTtl sets absolute TTL rewrite of the command from @absttl tag: TTL argument index, unit and WAL request
+func setAbsTtl(c *Command, function, index, unit, request string) {
+	i, _ := strconv.Atoi(index)
+	if i >= len(c.Args) {
+		log.Fatalf("%s(): @absttl argument %d out of range", function, i)
+	}
+
+	c.AbsTtlArgIndex = index
+	switch unit {
+	case "options":
+		if c.Args[i] != "...string" || request != "" {
+			log.Fatalf("%s(): @absttl options requires optional arguments and no request", function)
+		}
+		c.IsAbsTtlOption = true
+		return
+	case "seconds":
+		c.AbsTtlUnit = "time.Second"
+	case "milliseconds":
+		c.AbsTtlUnit = "time.Millisecond"
+	}
+
+	if c.Args[i] != "int" || request == "" {
+		log.Fatalf("%s(): @absttl %s requires int argument and request", function, unit)
+	}
+	for _, word := range strings.Fields(request)[1:] {
+		if !strings.HasPrefix(word, "$") {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(word[1:], "...")); err != nil || n >= len(c.Args) {
+			log.Fatalf("%s(): invalid @absttl request argument %s", function, word)
+		}
+	}
+	c.AbsTtlRequest = request
+}
+
+// addToKeyGroups adds the command into the group with the same key arguments, or into a new group
+func addToKeyGroups(groups []KeyGroup, c Command) []KeyGroup {
+	for i, g := range groups {
+		if fmt.Sprint(g.KeyArgs) == fmt.Sprint(c.KeyArgs) && g.KeysFrom == c.KeysFrom && g.KeysStep == c.KeysStep {
+			groups[i].Cmds = append(groups[i].Cmds, c.Cmd)
+			return groups
+		}
+	}
+
+	return append(groups, KeyGroup{Cmds: []string{c.Cmd}, KeyArgs: c.KeyArgs, KeysFrom: c.KeysFrom, KeysStep: c.KeysStep})
+}